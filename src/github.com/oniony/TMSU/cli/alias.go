@@ -0,0 +1,139 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+var AliasCommand = Command{
+	Name:     "alias",
+	Synopsis: "Creates a tag alias",
+	Usages: []string{"tmsu alias ALIAS TAG",
+		"tmsu alias",
+		"tmsu alias --delete ALIAS..."},
+	Description: `Creates ALIAS as an alternative name for TAG. Applying, removing or querying ALIAS then operates on TAG itself, such that files are only ever tagged with TAG.
+
+Unlike merging two tags, the tag keeps its name and this is what is shown when tags are listed. Use 'tmsu tags --show-aliases' to list the aliases alongside their tags.
+
+When run without arguments lists the set of tag aliases.
+
+TAG must already exist. An alias cannot have the same name as an existing tag or alias. Deleting a tag also deletes its aliases.`,
+	Examples: []string{"$ tmsu alias bw black-and-white",
+		"$ tmsu alias\nbw -> black-and-white",
+		"$ tmsu alias --delete bw"},
+	Options: Options{Option{"--delete", "-d", "deletes the tag aliases", false, ""}},
+	Exec:    aliasExec,
+}
+
+// unexported
+
+func aliasExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		if len(args) < 1 {
+			return fmt.Errorf("alias to delete must be specified"), nil
+		}
+
+		return deleteAliases(store, tx, args)
+	}
+
+	switch len(args) {
+	case 0:
+		return listAliases(store, tx), nil
+	case 1:
+		return fmt.Errorf("tag to alias must be specified"), nil
+	case 2:
+		return addAlias(store, tx, args[0], args[1]), nil
+	}
+
+	return fmt.Errorf("too many arguments"), nil
+}
+
+func listAliases(store *storage.Storage, tx *storage.Tx) error {
+	log.Infof("retrieving tag aliases")
+
+	aliases, err := store.Aliases(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve aliases: %v", err)
+	}
+
+	for _, alias := range aliases {
+		fmt.Printf("%v -> %v\n", text.Escape(alias.Name, '=', ' '), text.Escape(alias.Tag.Name, '=', ' '))
+	}
+
+	return nil
+}
+
+func addAlias(store *storage.Storage, tx *storage.Tx, aliasName, tagName string) error {
+	if err := checkWritable("add alias"); err != nil {
+		return err
+	}
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}
+	}
+
+	log.Infof("adding alias '%v' for tag '%v'", aliasName, tag.Name)
+
+	if _, err := store.AddAlias(tx, aliasName, *tag); err != nil {
+		return fmt.Errorf("could not add alias '%v': %v", aliasName, err)
+	}
+
+	return nil
+}
+
+func deleteAliases(store *storage.Storage, tx *storage.Tx, aliasNames []string) (error, warnings) {
+	if err := checkWritable("delete alias"); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, aliasName := range aliasNames {
+		log.Infof("deleting alias '%v'", aliasName)
+
+		if err := store.DeleteAlias(tx, aliasName); err != nil {
+			switch err.(type) {
+			case database.NoSuchAliasError:
+				warnings = append(warnings, err.Error())
+				continue
+			default:
+				return fmt.Errorf("could not delete alias '%v': %v", aliasName, err), warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
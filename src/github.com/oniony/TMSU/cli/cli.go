@@ -40,47 +40,106 @@ func Run() {
 		command = findCommand(commands, "help")
 	}
 
-	log.Verbosity = options.Count("--verbose") + 1
+	threshold, err := logThreshold(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Threshold = threshold
+	log.Progress = log.Threshold == log.WarnLevel && stderrIsCharDevice()
 
 	var databasePath string
 	switch {
 	case options.HasOption("--database"):
-		log.Infof(2, "using database from command-line option")
+		log.Infof("using database from command-line option")
 		databasePath = options.Get("--database").Argument
 	case os.Getenv("TMSU_DB") != "":
-		log.Infof(2, "using database from environment variable")
+		log.Infof("using database from environment variable")
 		databasePath = os.Getenv("TMSU_DB")
 	default:
+		var name string
+		name, databasePath, err = activeDatabase()
+		if err != nil {
+			log.Fatalf("could not find database: %v", err)
+		}
+		if name != "" {
+			log.Infof("using active database '%v' from the registry", name)
+			break
+		}
+
 		databasePath, err = findDatabase()
 		if err != nil {
 			log.Fatalf("could not find database: %v", err)
 		}
 	}
 
+	createMissingDatabase = options.HasOption("--create-database")
+	readOnlyDatabase = options.HasOption("--read-only")
+
+	if readOnlyDatabase && command.Modifies {
+		log.Fatal(ReadOnlyError{"run '" + command.Name + "'"})
+	}
+
 	err, warnings := command.Exec(options, arguments, databasePath)
+	log.EndProgress()
+
+	noMatches := false
+	if _, ok := err.(NoMatchesError); ok {
+		noMatches = options.HasOption("--exit-nonzero-on-empty")
+		err = nil
+	}
 
 	if warnings != nil {
 		for _, warning := range warnings {
-			log.Warn(warning)
+			log.Error(warning)
 		}
 	}
 
 	if err != nil {
-		log.Warn(err.Error())
+		log.Error(err.Error())
 	}
 
 	if err != nil || (warnings != nil && len(warnings) > 0) {
 		os.Exit(1)
 	}
+
+	if noMatches {
+		os.Exit(2)
+	}
 }
 
 // unexported
 
-var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
+// Determines which messages are shown: --verbose shows informational messages
+// and, if repeated, debugging messages too, whilst --quiet shows only errors.
+func logThreshold(options Options) (log.Level, error) {
+	verbosity := options.Count("--verbose")
+
+	if options.HasOption("--quiet") {
+		if verbosity > 0 {
+			return 0, fmt.Errorf("the --quiet and --verbose options are mutually exclusive")
+		}
+
+		return log.ErrorLevel, nil
+	}
+
+	threshold := log.WarnLevel + log.Level(verbosity)
+	if threshold > log.DebugLevel {
+		threshold = log.DebugLevel
+	}
+
+	return threshold, nil
+}
+
+var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages (repeat for debugging messages)", false, ""},
 	Option{"--help", "-h", "show help and exit", false, ""},
 	Option{"--version", "-V", "show version information and exit", false, ""},
 	Option{"--database", "-D", "use the specified database", true, ""},
+	Option{"--create-database", "", "create the database if it does not exist", false, ""},
+	Option{"--read-only", "", "open the database such that it cannot be modified", false, ""},
 	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
+	Option{"--quiet", "", "show only errors, not warnings or the progress of long-running operations", false, ""},
+	Option{"--exit-nonzero-on-empty", "", "exit with status 2 if 'files' or 'untagged' list nothing", false, ""},
 }
 
 func findDatabase() (string, error) {
@@ -92,12 +151,21 @@ func findDatabase() (string, error) {
 		return databasePath, nil
 	}
 
+	return filepath.Join(homeDir(), ".tmsu", "default.db"), nil
+}
+
+// Determines the user's home directory, preferring $HOME where it is set.
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+
 	u, err := user.Current()
 	if err != nil {
 		panic(fmt.Sprintf("could not identify current user: %v", err))
 	}
 
-	return filepath.Join(u.HomeDir, ".tmsu", "default.db"), nil
+	return u.HomeDir
 }
 
 func findDatabaseInPath() (string, error) {
@@ -110,7 +178,7 @@ func findDatabaseInPath() (string, error) {
 	for {
 		dbPath := filepath.Join(path, ".tmsu", "db")
 
-		log.Infof(2, "looking for database at '%s'", dbPath)
+		log.Infof("looking for database at '%s'", dbPath)
 
 		_, err := os.Stat(dbPath)
 		if err == nil {
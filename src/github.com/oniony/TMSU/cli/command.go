@@ -25,4 +25,5 @@ type Command struct {
 	Options     Options
 	Exec        func(options Options, arguments []string, databasePath string) (error, warnings)
 	Hidden      bool
+	Modifies    bool // whether the command always modifies the database
 }
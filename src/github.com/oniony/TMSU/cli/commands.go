@@ -20,25 +20,42 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AliasCommand,
+	&CompleteCommand,
 	&ConfigCommand,
 	&CopyCommand,
+	&DbCommand,
 	&DeleteCommand,
+	&DiffCommand,
 	&DupesCommand,
+	&ExecCommand,
+	&ExportCommand,
 	&FilesCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportCommand,
 	&InfoCommand,
 	&InitCommand,
+	&LogCommand,
 	&MergeCommand,
 	&MountCommand,
+	&MvCommand,
+	&RebaseCommand,
+	&ReindexCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RmCommand,
+	&ShellCommand,
 	&StatusCommand,
+	&SuggestCommand,
 	&TagCommand,
 	&TagsCommand,
+	&UndoCommand,
 	&UnmountCommand,
 	&UntagCommand,
 	&UntaggedCommand,
+	&VacuumCommand,
 	&ValuesCommand,
+	&VerifyCommand,
 	&VersionCommand,
 	&VfsCommand}
@@ -20,22 +20,39 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AliasCommand,
+	&CompleteCommand,
 	&ConfigCommand,
 	&CopyCommand,
+	&DbCommand,
 	&DeleteCommand,
+	&DiffCommand,
 	&DupesCommand,
+	&ExecCommand,
+	&ExportCommand,
 	&FilesCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportCommand,
 	&InfoCommand,
 	&InitCommand,
+	&LogCommand,
 	&MergeCommand,
+	&MvCommand,
+	&RebaseCommand,
+	&ReindexCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RmCommand,
+	&ShellCommand,
 	&StatusCommand,
+	&SuggestCommand,
 	&TagCommand,
 	&TagsCommand,
+	&UndoCommand,
 	&UntagCommand,
 	&UntaggedCommand,
+	&VacuumCommand,
 	&ValuesCommand,
+	&VerifyCommand,
 	&VersionCommand}
@@ -16,27 +16,56 @@
 package cli
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/csv"
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/terminal"
 	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"github.com/oniony/TMSU/storage/database"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 // unexported
 
+// Whether a missing database should be created when opened, as requested by the
+// global --create-database option.
+var createMissingDatabase = false
+
+// Whether the database should be opened such that it cannot be modified, as
+// requested by the global --read-only option.
+var readOnlyDatabase = false
+
 func openDatabase(path string) (*storage.Storage, error) {
-	storage, err := storage.OpenAt(path)
+	var store *storage.Storage
+	var err error
+
+	switch {
+	case readOnlyDatabase:
+		store, err = storage.OpenReadOnlyAt(path)
+	case createMissingDatabase:
+		var created bool
+		store, created, err = storage.OpenOrCreateAt(path)
+		if created {
+			log.Warnf("%v: creating database", path)
+		}
+	default:
+		store, err = storage.OpenAt(path)
+	}
+
 	if err != nil {
 		switch err.(type) {
 		case database.DatabaseNotFoundError:
-			return nil, fmt.Errorf("no database found: use 'tmsu init' to create one")
+			return nil, fmt.Errorf("no database found at '%v': use 'tmsu init' or --create-database to create one", path)
 		case database.DatabaseAccessError:
 			return nil, fmt.Errorf("cannot access database: %v", err)
 		default:
@@ -44,7 +73,80 @@ func openDatabase(path string) (*storage.Storage, error) {
 		}
 	}
 
-	return storage, nil
+	return store, nil
+}
+
+// How the paths of listed files are shown: relative to the working directory,
+// relative to another base directory or absolute, and whether they are quoted
+// for the shell.
+type pathStyle struct {
+	base     string
+	absolute bool
+	quote    bool
+}
+
+func pathStyleFor(options Options) (pathStyle, error) {
+	absolute := options.HasOption("--absolute")
+	quote := options.HasOption("--shell-quote")
+
+	if !options.HasOption("--relative-to") {
+		return pathStyle{"", absolute, quote}, nil
+	}
+
+	if absolute {
+		return pathStyle{}, fmt.Errorf("the --relative-to and --absolute options are mutually exclusive")
+	}
+
+	base := options.Get("--relative-to").Argument
+
+	stat, err := os.Stat(base)
+	if err != nil || !stat.IsDir() {
+		return pathStyle{}, fmt.Errorf("%v: no such directory", base)
+	}
+
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return pathStyle{}, fmt.Errorf("%v: could not get absolute path: %v", base, err)
+	}
+
+	return pathStyle{absBase, false, quote}, nil
+}
+
+// Formats the absolute path for output. A path that cannot be shown relative to
+// the --relative-to directory is shown as an absolute path with a warning.
+func (style pathStyle) format(absPath string) string {
+	path := style.relative(absPath)
+
+	if style.quote {
+		return text.ShellQuote(path)
+	}
+
+	return path
+}
+
+func (style pathStyle) relative(absPath string) string {
+	switch {
+	case style.absolute:
+		return absPath
+	case style.base == "":
+		return _path.Rel(absPath)
+	}
+
+	relPath := _path.RelTo(absPath, style.base)
+	if filepath.IsAbs(relPath) {
+		log.Warnf("%v: not under '%v': showing absolute path", absPath, style.base)
+	}
+
+	return relPath
+}
+
+// Checks that the database may be modified by the action.
+func checkWritable(action string) error {
+	if readOnlyDatabase {
+		return ReadOnlyError{action}
+	}
+
+	return nil
 }
 
 func stdoutIsCharDevice() bool {
@@ -59,6 +161,15 @@ func stdoutIsCharDevice() bool {
 	return false
 }
 
+func stderrIsCharDevice() bool {
+	stat, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
 func useColour(options Options) (bool, error) {
 	when := "auto"
 	if options.HasOption("--color") {
@@ -150,6 +261,46 @@ func parseTagOrValueName(name string) string {
 	return buffer.String()
 }
 
+// Parses a tag name that may contain the wildcards '*' and '?', returning the
+// corresponding glob pattern, if there are unescaped wildcards, or else the
+// unescaped name.
+func parseTagGlob(name string) (string, bool) {
+	buffer := new(bytes.Buffer)
+	var escaped, wildcard bool
+
+	for _, r := range name {
+		if escaped {
+			switch r {
+			case '*', '?', '[', ']', '\\':
+				buffer.WriteRune('\\')
+			}
+
+			buffer.WriteRune(r)
+			escaped = false
+			continue
+		}
+
+		switch r {
+		case '\\':
+			escaped = true
+		case '*', '?':
+			wildcard = true
+			buffer.WriteRune(r)
+		case '[', ']':
+			buffer.WriteRune('\\')
+			buffer.WriteRune(r)
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+
+	if !wildcard {
+		return parseTagOrValueName(name), false
+	}
+
+	return buffer.String(), true
+}
+
 func parseTagEqValueName(tagArg string) (string, string) {
 	tagNameBuffer := new(bytes.Buffer)
 	valueNameBuffer := new(bytes.Buffer)
@@ -181,8 +332,8 @@ func parseTagEqValueName(tagArg string) (string, string) {
 }
 
 func formatTagValueName(tagName, valueName string, useColour, implicit, explicit bool) string {
-	tagName = escape(tagName, '=', ' ')
-	valueName = escape(valueName, '=', ' ')
+	tagName = text.Escape(tagName, '=', ' ')
+	valueName = text.Escape(valueName, '=', ' ')
 
 	if useColour {
 		colourCode := colourCodeFor(implicit, explicit)
@@ -213,10 +364,72 @@ func colourCodeFor(implicit, explicit bool) string {
 	return ""
 }
 
-func escape(text string, chars ...rune) string {
-	for _, char := range chars {
-		text = strings.Replace(text, string(char), `\`+string(char), -1)
+// Prints the records, the first of which should be the header row, as CSV.
+func printCsv(records [][]string) error {
+	writer := csv.NewWriter(os.Stdout)
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("could not write CSV: %v", err)
 	}
 
-	return text
+	return nil
+}
+
+// Asks the user to confirm an action, returning true only if they answer 'y' or
+// 'yes'.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%v [y/N] ", prompt)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
+
+func readCommentedLines(path string) ([]string, error) {
+	var reader *bufio.Reader
+	if path == "-" {
+		log.Info("reading standard input")
+
+		reader = bufio.NewReader(os.Stdin)
+	} else {
+		log.Infof("%v: reading file", path)
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+		}
+		defer file.Close()
+
+		reader = bufio.NewReader(file)
+	}
+
+	lines := make([]string, 0, 10)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%v: could not read file: %v", path, err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimLeft(line, " \t"), "#") {
+			lines = append(lines, line)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return lines, nil
+}
+
+func warnFingerprintAlgorithmChanged(previousAlgorithm, algorithm string) {
+	log.Warnf("existing fingerprints were computed with '%v' rather than '%v': run 'tmsu repair --unmodified' to recalculate them", previousAlgorithm, algorithm)
 }
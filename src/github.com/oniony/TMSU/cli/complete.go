@@ -0,0 +1,152 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+)
+
+var CompleteCommand = Command{
+	Name:     "_complete",
+	Synopsis: "List completion candidates",
+	Usages: []string{"tmsu _complete tag [WORD]",
+		"tmsu _complete value [WORD]"},
+	Description: `Lists the tag names (or value names) that start with the partial WORD specified, one per line. This subcommand is intended for use by shell completion scripts.
+
+If WORD contains an equals sign then the values of the tag before the equals sign that start with the remainder of WORD are listed instead, e.g. 'year=20' lists 'year=2017', 'year=2018', &c.`,
+	Examples: []string{"$ tmsu _complete tag mu\nmusic\nmusical",
+		"$ tmsu _complete tag year=20\nyear=2017\nyear=2018",
+		"$ tmsu _complete value 20\n2017\n2018"},
+	Exec:   completeExec,
+	Hidden: true,
+}
+
+// unexported
+
+func completeExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 1 {
+		return fmt.Errorf("completion context must be specified"), nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	context := args[0]
+
+	word := ""
+	if len(args) > 1 {
+		word = args[1]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if containsUnescaped(word, '=') {
+		tagName, valuePrefix := parseTagEqValueName(word)
+		return completeTagValues(store, tx, tagName, valuePrefix), nil
+	}
+
+	switch context {
+	case "tag":
+		return completeTags(store, tx, parseTagOrValueName(word)), nil
+	case "value":
+		return completeValues(store, tx, parseTagOrValueName(word)), nil
+	}
+
+	return fmt.Errorf("invalid completion context '%v': must be one of tag, value", context), nil
+}
+
+func completeTags(store *storage.Storage, tx *storage.Tx, prefix string) error {
+	log.Infof("retrieving tags starting with '%v'.", prefix)
+
+	tags, err := store.TagsByNamePrefix(tx, prefix)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	for _, tag := range tags {
+		fmt.Println(text.Escape(tag.Name, '=', ' '))
+	}
+
+	return nil
+}
+
+func completeValues(store *storage.Storage, tx *storage.Tx, prefix string) error {
+	log.Infof("retrieving values starting with '%v'.", prefix)
+
+	values, err := store.ValuesByNamePrefix(tx, prefix)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	for _, value := range values {
+		fmt.Println(text.Escape(value.Name, '=', ' '))
+	}
+
+	return nil
+}
+
+func completeTagValues(store *storage.Storage, tx *storage.Tx, tagName, prefix string) error {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return nil
+	}
+
+	log.Infof("retrieving values of tag '%v' starting with '%v'.", tagName, prefix)
+
+	values, err := store.ValuesByTagAndNamePrefix(tx, tag.Id, prefix)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err)
+	}
+
+	for _, value := range values {
+		fmt.Println(formatTagValueName(tag.Name, value.Name, false, false, false))
+	}
+
+	return nil
+}
+
+func containsUnescaped(text string, char rune) bool {
+	var escaped bool
+
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == char:
+			return true
+		}
+	}
+
+	return false
+}
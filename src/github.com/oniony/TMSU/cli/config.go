@@ -17,6 +17,9 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"strings"
 )
@@ -25,13 +28,33 @@ var ConfigCommand = Command{
 	Name:     "config",
 	Synopsis: "Views or amends database settings",
 	Usages: []string{"tmsu config",
-		"tmsu config NAME[=VALUE]..."},
+		"tmsu config NAME[=VALUE]...",
+		"tmsu config --constraints [TAG[=TYPE]]..."},
 	Description: `Lists or views the database settings for the current database.
 
 Without arguments the complete set of settings are shown, otherwise lists the settings for the specified setting NAMEs.
 
-If a VALUE is specified then the setting is updated.`,
-	Options: Options{},
+If a VALUE is specified then the setting is updated.
+
+The setting 'auditLog' may be yes or no (the default). When enabled, the applying and removal of tags and the merging and deletion of tags are recorded, along with the time and the user, for display by the 'log' subcommand.
+
+The setting 'fileFingerprintAlgorithm' may be one of dynamic:SHA256 (the default), dynamic:SHA1, dynamic:MD5, dynamic:BLAKE2b, SHA256, SHA1, MD5, BLAKE2b, none or dynamic:SIZE. The dynamic hash algorithms sample large files rather than hashing their entire contents. dynamic:SIZE, e.g. dynamic:4M, hashes the first and last SIZE bytes of each file along with its size. When the algorithm is changed the previous algorithm is recorded until the fingerprints are recalculated with 'tmsu repair --unmodified'.
+
+The setting 'journalMode' may be one of wal (the default), delete, truncate or persist. In WAL mode the virtual filesystem can continue to read the database whilst other commands are updating it. WAL mode is not supported for databases on network filesystems, such as NFS, in which case the database continues to use its existing journal mode: setting 'journalMode' to delete restores SQLite's default behaviour. The new journal mode takes effect the next time the database is opened when no other process has it open.
+
+The setting 'metadataTags' determines the tags applied from a file's metadata by 'tmsu tag --from-exif'. It is a comma-separated list of the fields to apply: FIELD applies each of the field's values as a tag whilst FIELD:TAG applies them as values of TAG. The fields are Keywords, DateTimeOriginal (as YYYY-MM-DD), Make and Model. The default is Keywords,DateTimeOriginal:date,Model:camera.
+
+The setting 'postTagHook' may be the path of an executable to run whenever the 'tag' subcommand applies tags to a file, or none (the default). See the 'tag' subcommand for details.
+
+With --constraints the value constraints of the tags are listed or amended instead. A tag's value constraint restricts the values that can be applied with it, such that mistyped values are rejected by the 'tag' subcommand. TYPE may be one of int, int-range:MIN..MAX, date (of the form YYYY-MM-DD), enum:VALUE,... or none, which removes the constraint. Tagging without a value is always permitted and existing taggings are not checked when a constraint is added.`,
+	Examples: []string{"$ tmsu config autoCreateTags=no",
+		"$ tmsu config metadataTags=Keywords,DateTimeOriginal:taken,Make:camera",
+		"$ tmsu config postTagHook=/home/bob/bin/make-thumbnail",
+		"$ tmsu config --constraints rating=int-range:1..5 taken=date",
+		"$ tmsu config --constraints\nrating=int-range:1..5\ntaken=date",
+		"$ tmsu config --constraints colour=enum:red,green,blue",
+		"$ tmsu config --constraints colour=none"},
+	Options: Options{{"--constraints", "-c", "list or amend the tags' value constraints", false, ""}},
 	Exec:    configExec,
 }
 
@@ -50,6 +73,10 @@ func configExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--constraints") {
+		return constraintsExec(store, tx, args), nil
+	}
+
 	if len(args) == 0 {
 		if err := listAllSettings(store, tx); err != nil {
 			return fmt.Errorf("could not list settings"), nil
@@ -73,6 +100,10 @@ func configExec(options Options, args []string, databasePath string) (error, war
 			name := parts[0]
 			value := parts[1]
 
+			if err := checkWritable("amend setting"); err != nil {
+				return err, nil
+			}
+
 			if err := amendSetting(store, tx, name, value); err != nil {
 				return fmt.Errorf("could not amend setting '%v' to '%v': %v", name, value, err), nil
 			}
@@ -153,9 +184,159 @@ func amendSetting(store *storage.Storage, tx *storage.Tx, name, value string) er
 		return fmt.Errorf("no such setting '%v'", name)
 	}
 
+	switch name {
+	case "auditLog":
+		switch value {
+		case "yes", "Yes", "YES", "true", "True", "TRUE", "no", "No", "false", "False", "FALSE":
+		default:
+			return fmt.Errorf("must be yes or no")
+		}
+	case "fileFingerprintAlgorithm":
+		if err := recordFingerprintAlgorithmChange(store, tx, setting.Value, value); err != nil {
+			return err
+		}
+	case "journalMode":
+		if err := storage.ValidateJournalMode(value); err != nil {
+			return err
+		}
+	case "metadataTags":
+		if _, err := parseMetadataMappings(value); err != nil {
+			return err
+		}
+	}
+
 	if _, err = store.UpdateSetting(tx, name, value); err != nil {
 		return fmt.Errorf("could not update setting '%v': %v", name, err)
 	}
 
 	return nil
 }
+
+func constraintsExec(store *storage.Storage, tx *storage.Tx, args []string) error {
+	if len(args) == 0 {
+		return listValueConstraints(store, tx)
+	}
+
+	for _, arg := range args {
+		tagName, constraintType := parseTagEqValueName(arg)
+		if tagName == "" {
+			return fmt.Errorf("invalid argument, '%v'", arg)
+		}
+
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return fmt.Errorf("no such tag '%v'", tagName)
+		}
+
+		if constraintType == "" {
+			if err := printValueConstraint(store, tx, tag); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := checkWritable("amend value constraint"); err != nil {
+			return err
+		}
+
+		if err := amendValueConstraint(store, tx, tag, constraintType); err != nil {
+			return fmt.Errorf("could not amend value constraint for tag '%v' to '%v': %v", tagName, constraintType, err)
+		}
+	}
+
+	return nil
+}
+
+func listValueConstraints(store *storage.Storage, tx *storage.Tx) error {
+	constraints, err := store.ValueConstraints(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value constraints: %v", err)
+	}
+	if len(constraints) == 0 {
+		return nil
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	constraintTypes := make(map[entities.TagId]string, len(constraints))
+	for _, constraint := range constraints {
+		constraintTypes[constraint.TagId] = constraint.Type
+	}
+
+	for _, tag := range tags {
+		if constraintType, ok := constraintTypes[tag.Id]; ok {
+			printSettingAndValue(text.Escape(tag.Name, '='), constraintType)
+		}
+	}
+
+	return nil
+}
+
+func printValueConstraint(store *storage.Storage, tx *storage.Tx, tag *entities.Tag) error {
+	constraint, err := store.ValueConstraintByTagId(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value constraint for tag '%v': %v", tag.Name, err)
+	}
+
+	constraintType := "none"
+	if constraint != nil {
+		constraintType = constraint.Type
+	}
+
+	printSettingAndValue(text.Escape(tag.Name, '='), constraintType)
+
+	return nil
+}
+
+func amendValueConstraint(store *storage.Storage, tx *storage.Tx, tag *entities.Tag, constraintType string) error {
+	if constraintType == "none" {
+		return store.DeleteValueConstraint(tx, tag.Id)
+	}
+
+	_, err := store.UpdateValueConstraint(tx, tag.Id, constraintType)
+	return err
+}
+
+// Records the algorithm that existing fingerprints were computed with so that
+// the 'status' and 'repair' subcommands can identify mismatches due to the change.
+func recordFingerprintAlgorithmChange(store *storage.Storage, tx *storage.Tx, oldAlgorithm, newAlgorithm string) error {
+	if err := fingerprint.ValidateFileAlgorithm(newAlgorithm); err != nil {
+		return err
+	}
+
+	previous, err := store.Setting(tx, "previousFileFingerprintAlgorithm")
+	if err != nil {
+		return fmt.Errorf("could not retrieve setting 'previousFileFingerprintAlgorithm': %v", err)
+	}
+
+	switch {
+	case previous.Value == newAlgorithm:
+		// changed back before fingerprints were recalculated
+		if err := store.DeleteSetting(tx, "previousFileFingerprintAlgorithm"); err != nil {
+			return fmt.Errorf("could not delete setting 'previousFileFingerprintAlgorithm': %v", err)
+		}
+	case previous.Value == "" && oldAlgorithm != newAlgorithm:
+		fileCount, err := store.FileCount(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file count: %v", err)
+		}
+		if fileCount == 0 {
+			return nil
+		}
+
+		if _, err := store.UpdateSetting(tx, "previousFileFingerprintAlgorithm", oldAlgorithm); err != nil {
+			return fmt.Errorf("could not update setting 'previousFileFingerprintAlgorithm': %v", err)
+		}
+
+		warnFingerprintAlgorithmChanged(oldAlgorithm, newAlgorithm)
+	}
+
+	return nil
+}
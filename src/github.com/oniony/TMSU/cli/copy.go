@@ -18,32 +18,49 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
 )
 
 var CopyCommand = Command{
-	Name:        "copy",
-	Aliases:     []string{"cp"},
-	Synopsis:    "Create a copy of a tag",
-	Usages:      []string{"tmsu copy TAG NEW..."},
-	Description: `Creates a new tag NEW applied to the same set of files as TAG.`,
+	Name:     "copy",
+	Aliases:  []string{"cp"},
+	Synopsis: "Create a copy of a tag",
+	Usages: []string{"tmsu copy TAG NEW...",
+		"tmsu copy [OPTION]... --prefix=PREFIX TAG..."},
+	Description: `Creates a new tag NEW applied to the same set of files as TAG.
+
+With --prefix each TAG is instead copied to a new tag named by prepending PREFIX to its name.
+
+With --with-implications the tags implied by each TAG, directly or indirectly, are also copied and the implications between them are recreated between the copies, such that the whole tag hierarchy is cloned under the new names. The tags and implications created are listed.`,
 	Examples: []string{"$ tmsu copy cheese wine",
-		"$ tmsu copy report document text"},
-	Options: Options{},
-	Exec:    copyExec,
+		"$ tmsu copy report document text",
+		"$ tmsu copy --prefix=old- report",
+		"$ tmsu copy --prefix=archive- --with-implications photo\ntag 'photo' copied to 'archive-photo'\ntag 'image' copied to 'archive-image'\nimplication 'archive-photo -> archive-image' created"},
+	Options: Options{{"--prefix", "-p", "name each copy by prepending PREFIX to the tag name", true, ""},
+		{"--with-implications", "", "also copy the tags implied by TAG and the implications between them", false, ""}},
+	Exec:     copyExec,
+	Modifies: true,
 }
 
 // unexported
 
 func copyExec(options Options, args []string, databasePath string) (error, warnings) {
-	if len(args) < 2 {
-		return fmt.Errorf("too few arguments"), nil
-	}
+	withImplications := options.HasOption("--with-implications")
 
-	sourceTagName := parseTagOrValueName(args[0])
+	prefix := ""
+	if options.HasOption("--prefix") {
+		prefix = options.Get("--prefix").Argument
+		if prefix == "" {
+			return fmt.Errorf("prefix must be specified"), nil
+		}
+	}
 
-	destTagNames := make([]string, len(args)-1)
-	for index, arg := range args[1:] {
-		destTagNames[index] = parseTagOrValueName(arg)
+	if withImplications && prefix == "" {
+		return fmt.Errorf("the --with-implications option requires --prefix"), nil
+	}
+	if len(args) < 1 || (prefix == "" && len(args) < 2) {
+		return fmt.Errorf("too few arguments"), nil
 	}
 
 	store, err := openDatabase(databasePath)
@@ -58,6 +75,22 @@ func copyExec(options Options, args []string, databasePath string) (error, warni
 	}
 	defer tx.Commit()
 
+	if prefix != "" {
+		sourceTagNames := make([]string, len(args))
+		for index, arg := range args {
+			sourceTagNames[index] = parseTagOrValueName(arg)
+		}
+
+		return copyTagsWithPrefix(store, tx, sourceTagNames, prefix, withImplications)
+	}
+
+	sourceTagName := parseTagOrValueName(args[0])
+
+	destTagNames := make([]string, len(args)-1)
+	for index, arg := range args[1:] {
+		destTagNames[index] = parseTagOrValueName(arg)
+	}
+
 	sourceTag, err := store.TagByName(tx, sourceTagName)
 	if err != nil {
 		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err), nil
@@ -69,21 +102,135 @@ func copyExec(options Options, args []string, databasePath string) (error, warni
 	warnings := make(warnings, 0, 10)
 
 	for _, destTagName := range destTagNames {
-		destTag, err := store.TagByName(tx, destTagName)
+		_, warnings, err = copyTag(store, tx, sourceTag, destTagName, warnings)
+		if err != nil {
+			return err, warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+// Copies each of the source tags, and optionally the tags they imply, to a new
+// tag named with the prefix. The implications between the copied tags are
+// recreated between the copies.
+func copyTagsWithPrefix(store *storage.Storage, tx *storage.Tx, sourceTagNames []string, prefix string, withImplications bool) (error, warnings) {
+	sourceTags := make(entities.Tags, 0, len(sourceTagNames))
+	for _, sourceTagName := range sourceTagNames {
+		sourceTag, err := store.TagByName(tx, sourceTagName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err), nil
+		}
+		if sourceTag == nil {
+			return fmt.Errorf("no such tag '%v'", sourceTagName), nil
 		}
-		if destTag != nil {
-			warnings = append(warnings, fmt.Sprintf("a tag with name '%v' already exists", destTagName))
+
+		sourceTags = append(sourceTags, sourceTag)
+	}
+
+	var implications entities.Implications
+	if withImplications {
+		var err error
+		implications, err = store.Implications(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve implications: %v", err), nil
+		}
+
+		sourceTags = impliedTagClosure(sourceTags, implications)
+	}
+
+	warnings := make(warnings, 0, 10)
+	copies := make(map[entities.TagId]*entities.Tag, len(sourceTags))
+
+	for _, sourceTag := range sourceTags {
+		var destTag *entities.Tag
+		var err error
+		destTag, warnings, err = copyTag(store, tx, sourceTag, prefix+sourceTag.Name, warnings)
+		if err != nil {
+			return err, warnings
+		}
+		if destTag == nil {
+			continue
+		}
+
+		copies[sourceTag.Id] = destTag
+
+		if withImplications {
+			fmt.Printf("tag '%v' copied to '%v'\n", sourceTag.Name, destTag.Name)
+		}
+	}
+
+	for _, implication := range implications {
+		implyingTag, ok := copies[implication.ImplyingTag.Id]
+		if !ok {
+			continue
+		}
+		impliedTag, ok := copies[implication.ImpliedTag.Id]
+		if !ok {
 			continue
 		}
 
-		log.Infof(2, "copying tag '%v' to '%v'.", sourceTagName, destTagName)
+		pair := entities.TagIdValueIdPair{implyingTag.Id, implication.ImplyingValue.Id}
+		impliedPair := entities.TagIdValueIdPair{impliedTag.Id, implication.ImpliedValue.Id}
+		name := formatTagValueName(implyingTag.Name, implication.ImplyingValue.Name, false, false, false) + " -> " +
+			formatTagValueName(impliedTag.Name, implication.ImpliedValue.Name, false, false, false)
 
-		if _, err = store.CopyTag(tx, sourceTag.Id, destTagName); err != nil {
-			return fmt.Errorf("could not copy tag '%v' to '%v': %v", sourceTagName, destTagName, err), warnings
+		// the originals may have been forced to form a cycle
+		if err := store.AddImplication(tx, pair, impliedPair, implication.InheritsValue, true); err != nil {
+			return fmt.Errorf("could not create implication '%v': %v", name, err), warnings
 		}
+
+		fmt.Printf("implication '%v' created\n", name)
 	}
 
 	return nil, warnings
 }
+
+// Adds to the tags those that they imply, directly or indirectly.
+func impliedTagClosure(tags entities.Tags, implications entities.Implications) entities.Tags {
+	closure := make(entities.Tags, 0, len(tags))
+	seen := make(map[entities.TagId]bool, len(tags))
+
+	for _, tag := range tags {
+		if !seen[tag.Id] {
+			seen[tag.Id] = true
+			closure = append(closure, tag)
+		}
+	}
+
+	for index := 0; index < len(closure); index++ {
+		for _, implication := range implications {
+			if implication.ImplyingTag.Id != closure[index].Id || seen[implication.ImpliedTag.Id] {
+				continue
+			}
+
+			impliedTag := implication.ImpliedTag
+			seen[impliedTag.Id] = true
+			closure = append(closure, &impliedTag)
+		}
+	}
+
+	return closure
+}
+
+// Copies the tag, returning nil with a warning if the destination tag already
+// exists.
+func copyTag(store *storage.Storage, tx *storage.Tx, sourceTag *entities.Tag, destTagName string, warnings warnings) (*entities.Tag, warnings, error) {
+	destTag, err := store.TagByName(tx, destTagName)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err)
+	}
+	if destTag != nil {
+		warnings = append(warnings, fmt.Sprintf("a tag with name '%v' already exists", destTagName))
+		return nil, warnings, nil
+	}
+
+	log.Infof("copying tag '%v' to '%v'.", sourceTag.Name, destTagName)
+
+	destTag, err = store.CopyTag(tx, sourceTag.Id, destTagName)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("could not copy tag '%v' to '%v': %v", sourceTag.Name, destTagName, err)
+	}
+
+	return destTag, warnings, nil
+}
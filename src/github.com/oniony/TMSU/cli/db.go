@@ -0,0 +1,288 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var DbCommand = Command{
+	Name:     "db",
+	Synopsis: "Manage the registry of named databases",
+	Usages: []string{"tmsu db [list]",
+		"tmsu db add NAME PATH",
+		"tmsu db remove NAME",
+		"tmsu db use NAME",
+		"tmsu db use --none"},
+	Description: `Manages a registry of named database locations, held in ~/.tmsu/databases, so that switching between databases does not require the --database option or the TMSU_DB environment variable.
+
+  add     registers the database at PATH as NAME
+  remove  removes NAME from the registry (the database itself is untouched)
+  use     makes NAME the active database
+  list    lists the registered databases, marking the active database with '*'
+
+Once a database is active, subsequent commands use it unless --database or TMSU_DB specify otherwise. Use 'tmsu db use --none' to revert to the database of the working directory.`,
+	Examples: []string{"$ tmsu db add work ~/work/.tmsu/db",
+		"$ tmsu db add personal ~/media/.tmsu/db",
+		"$ tmsu db use work",
+		"$ tmsu db list\n* work      /home/bob/work/.tmsu/db\n  personal  /home/bob/media/.tmsu/db"},
+	Options: Options{Option{"--none", "", "with 'use', deactivate the active database", false, ""}},
+	Exec:    dbExec,
+}
+
+// unexported
+
+func dbExec(options Options, args []string, databasePath string) (error, warnings) {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	registry, err := readDatabaseRegistry()
+	if err != nil {
+		return err, nil
+	}
+
+	switch action {
+	case "list":
+		if len(args) > 0 {
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		listRegisteredDatabases(registry)
+		return nil, nil
+	case "add":
+		switch {
+		case len(args) < 2:
+			return fmt.Errorf("database name and path must be specified"), nil
+		case len(args) > 2:
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		return registerDatabase(registry, args[0], args[1])
+	case "remove":
+		switch {
+		case len(args) < 1:
+			return fmt.Errorf("database name must be specified"), nil
+		case len(args) > 1:
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		return unregisterDatabase(registry, args[0]), nil
+	case "use":
+		switch {
+		case options.HasOption("--none") && len(args) > 0:
+			return fmt.Errorf("a database name cannot be specified with --none"), nil
+		case options.HasOption("--none"):
+			registry.active = ""
+			return registry.write(), nil
+		case len(args) < 1:
+			return fmt.Errorf("database name must be specified"), nil
+		case len(args) > 1:
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		return useDatabase(registry, args[0]), nil
+	}
+
+	return fmt.Errorf("invalid action '%v': must be one of add, remove, use, list", action), nil
+}
+
+func listRegisteredDatabases(registry *databaseRegistry) {
+	nameWidth := 0
+	for _, database := range registry.databases {
+		if len(database.name) > nameWidth {
+			nameWidth = len(database.name)
+		}
+	}
+
+	for _, database := range registry.databases {
+		marker := " "
+		if database.name == registry.active {
+			marker = "*"
+		}
+
+		fmt.Printf("%v %-*v  %v\n", marker, nameWidth, database.name, database.path)
+	}
+}
+
+func registerDatabase(registry *databaseRegistry, name, path string) (error, warnings) {
+	if err := validateDatabaseName(name); err != nil {
+		return err, nil
+	}
+	if registry.find(name) != nil {
+		return fmt.Errorf("database '%v' is already registered", name), nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("could not get absolute path of '%v': %v", path, err), nil
+	}
+
+	registry.databases = append(registry.databases, registeredDatabase{name, absPath})
+	if err := registry.write(); err != nil {
+		return err, nil
+	}
+
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		return nil, warnings{fmt.Sprintf("database '%v' does not exist: use 'tmsu --database=%v init' to create it", absPath, absPath)}
+	}
+
+	return nil, nil
+}
+
+func unregisterDatabase(registry *databaseRegistry, name string) error {
+	for index, database := range registry.databases {
+		if database.name == name {
+			registry.databases = append(registry.databases[:index], registry.databases[index+1:]...)
+			if registry.active == name {
+				registry.active = ""
+			}
+
+			return registry.write()
+		}
+	}
+
+	return fmt.Errorf("no such database '%v'", name)
+}
+
+func useDatabase(registry *databaseRegistry, name string) error {
+	if registry.find(name) == nil {
+		return fmt.Errorf("no such database '%v'", name)
+	}
+
+	registry.active = name
+	return registry.write()
+}
+
+func validateDatabaseName(name string) error {
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) != -1 || name[0] == '*' || name[0] == '#' {
+		return fmt.Errorf("invalid database name '%v': must not be empty, contain whitespace or start with '*' or '#'", name)
+	}
+
+	return nil
+}
+
+// Retrieves the path of the active database from the registry, if any.
+func activeDatabase() (string, string, error) {
+	registry, err := readDatabaseRegistry()
+	if err != nil {
+		return "", "", err
+	}
+
+	if database := registry.find(registry.active); database != nil {
+		return database.name, database.path, nil
+	}
+
+	return "", "", nil
+}
+
+type registeredDatabase struct {
+	name string
+	path string
+}
+
+// The registry of named databases. It is stored one database per line as the
+// name and path separated by a tab, the name of the active database prefixed
+// with '*'.
+type databaseRegistry struct {
+	databases []registeredDatabase
+	active    string
+}
+
+func databaseRegistryPath() string {
+	return filepath.Join(homeDir(), ".tmsu", "databases")
+}
+
+func readDatabaseRegistry() (*databaseRegistry, error) {
+	registry := &databaseRegistry{make([]registeredDatabase, 0, 10), ""}
+
+	path := databaseRegistryPath()
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return registry, nil
+		}
+
+		return nil, fmt.Errorf("could not open database registry '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid database registry '%v': malformed line '%v'", path, line)
+		}
+
+		name := parts[0]
+		if name[0] == '*' {
+			name = name[1:]
+			registry.active = name
+		}
+
+		registry.databases = append(registry.databases, registeredDatabase{name, parts[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read database registry '%v': %v", path, err)
+	}
+
+	return registry, nil
+}
+
+func (registry *databaseRegistry) find(name string) *registeredDatabase {
+	for index := range registry.databases {
+		if registry.databases[index].name == name {
+			return &registry.databases[index]
+		}
+	}
+
+	return nil
+}
+
+func (registry *databaseRegistry) write() error {
+	path := databaseRegistryPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create directory for database registry '%v': %v", path, err)
+	}
+
+	content := "# TMSU database registry: managed by 'tmsu db'\n"
+	for _, database := range registry.databases {
+		if database.name == registry.active {
+			content += "*"
+		}
+		content += database.name + "\t" + database.path + "\n"
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("could not write database registry '%v': %v", path, err)
+	}
+
+	return nil
+}
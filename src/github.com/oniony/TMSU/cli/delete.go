@@ -17,25 +17,52 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
 )
 
 var DeleteCommand = Command{
-	Name:        "delete",
-	Aliases:     []string{"del", "rm"},
-	Synopsis:    "Delete one or more tags",
-	Usages:      []string{"tmsu delete TAG..."},
-	Description: `Permanently deletes the TAGs specified.`,
+	Name:     "delete",
+	Aliases:  []string{"del"},
+	Synopsis: "Delete one or more tags",
+	Usages: []string{"tmsu delete TAG...",
+		"tmsu delete [OPTION]... --unused"},
+	Description: `Permanently deletes the TAGs specified.
+
+With --unused every tag that is not applied to any file is deleted instead and the names of the deleted tags are listed. Unused tags that imply, or are implied by, another tag are kept, with a warning, as they still form part of the tag hierarchy: delete the implications first with 'tmsu imply --delete' to have them removed. Use --dry-run to list the tags that would be deleted without deleting them.
+
+A TAG containing the wildcards '*' or '?' deletes every tag whose name matches the pattern. The matching tags are listed and must be confirmed before they are deleted, unless --yes is specified. A pattern that matches no tags is reported but is not an error. Escape the wildcard with a backslash to match it literally.
+
+The most recent deletion may be undone with 'tmsu undo'.`,
 	Examples: []string{"$ tmsu delete pineapple",
-		"$ tmsu delete red green blue"},
-	Options: Options{Option{"--value", "", "delete a value", false, ""}},
-	Exec:    deleteExec,
+		"$ tmsu delete red green blue",
+		"$ tmsu delete --yes 'tmp-*'",
+		"$ tmsu delete --unused --dry-run\nkumquat\nquince"},
+	Options: Options{Option{"--value", "", "delete a value", false, ""},
+		Option{"--unused", "-u", "delete the tags not applied to any file", false, ""},
+		Option{"--dry-run", "-n", "list the unused tags without deleting them", false, ""},
+		Option{"--yes", "-y", "delete the tags matching a pattern without asking for confirmation", false, ""}},
+	Exec:     deleteExec,
+	Modifies: true,
 }
 
 // unexported
 
 func deleteExec(options Options, args []string, databasePath string) (error, warnings) {
-	if len(args) == 0 {
+	unused := options.HasOption("--unused")
+	dryRun := options.HasOption("--dry-run")
+
+	switch {
+	case unused && len(args) > 0:
+		return fmt.Errorf("tags cannot be specified with --unused"), nil
+	case unused && options.HasOption("--value"):
+		return fmt.Errorf("the --unused and --value options are mutually exclusive"), nil
+	case dryRun && !unused:
+		return fmt.Errorf("the --dry-run option can only be used with --unused"), nil
+	case !unused && len(args) == 0:
 		return fmt.Errorf("too few arguments"), nil
 	}
 
@@ -51,32 +78,163 @@ func deleteExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if unused {
+		return deleteUnusedTags(store, tx, dryRun)
+	}
+
 	if options.HasOption("--value") {
 		return deleteValue(store, tx, args)
 	}
 
-	return deleteTag(store, tx, args)
+	return deleteTag(store, tx, args, options.HasOption("--yes"))
 }
 
-func deleteTag(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
+func deleteTag(store *storage.Storage, tx *storage.Tx, tagArgs []string, yes bool) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
+	tags, matchedTags, warnings, err := tagsToDelete(store, tx, tagArgs, warnings)
+	if err != nil {
+		return err, warnings
+	}
+
+	if len(matchedTags) > 0 && !yes {
+		for _, tag := range matchedTags {
+			fmt.Println(text.Escape(tag.Name, '=', ' '))
+		}
+
+		if !confirm(fmt.Sprintf("delete %v matching tags?", len(matchedTags))) {
+			return fmt.Errorf("no tags were deleted"), warnings
+		}
+	}
+
+	if err := beginUndoTags(store, tx, "delete", tags); err != nil {
+		return err, warnings
+	}
+
+	for _, tag := range tags {
+		log.Infof("deleting tag '%v'", tag.Name)
+
+		if err := store.DeleteTag(tx, tag.Id); err != nil {
+			return fmt.Errorf("could not delete tag '%v': %v", tag.Name, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+// Identifies the tags to delete, expanding any glob patterns against the
+// existing tags. The tags that matched a pattern are also returned separately
+// so that their deletion may be confirmed.
+func tagsToDelete(store *storage.Storage, tx *storage.Tx, tagArgs []string, warnings warnings) (entities.Tags, entities.Tags, warnings, error) {
+	tags := make(entities.Tags, 0, len(tagArgs))
+	matchedTags := make(entities.Tags, 0, 10)
+	var allTags entities.Tags
+	var ignoreCase bool
+
 	for _, tagArg := range tagArgs {
-		tagName := parseTagOrValueName(tagArg)
+		pattern, isGlob := parseTagGlob(tagArg)
 
-		tag, err := store.TagByName(tx, tagName)
-		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), warnings
+		if !isGlob {
+			tag, err := store.TagByName(tx, pattern)
+			if err != nil {
+				return nil, nil, warnings, fmt.Errorf("could not retrieve tag '%v': %v", pattern, err)
+			}
+			if tag == nil {
+				warnings = append(warnings, fmt.Sprintf("no such tag '%v'", pattern))
+				continue
+			}
+
+			if !tags.Contains(tag) {
+				tags = append(tags, tag)
+			}
+
+			continue
+		}
+
+		if allTags == nil {
+			settings, err := store.Settings(tx)
+			if err != nil {
+				return nil, nil, warnings, fmt.Errorf("could not retrieve settings: %v", err)
+			}
+			ignoreCase = !settings.CaseSensitive()
+
+			allTags, err = store.Tags(tx)
+			if err != nil {
+				return nil, nil, warnings, fmt.Errorf("could not retrieve tags: %v", err)
+			}
+		}
+
+		glob := query.GlobExpression{pattern}
+		matched := false
+		for _, tag := range allTags {
+			if !glob.Matches(tag.Name, ignoreCase) {
+				continue
+			}
+
+			matched = true
+			if !tags.Contains(tag) {
+				tags = append(tags, tag)
+				matchedTags = append(matchedTags, tag)
+			}
+		}
+
+		if !matched {
+			warnings = append(warnings, fmt.Sprintf("no tags match '%v'", tagArg))
 		}
-		if tag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
+	}
+
+	return tags, matchedTags, warnings, nil
+}
+
+func deleteUnusedTags(store *storage.Storage, tx *storage.Tx, dryRun bool) (error, warnings) {
+	tagFileCounts, err := store.TagFileCounts(tx, "name")
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag usage: %v", err), nil
+	}
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve implications: %v", err), nil
+	}
+
+	implicationTagIds := make(map[entities.TagId]bool, len(implications)*2)
+	for _, implication := range implications {
+		implicationTagIds[implication.ImplyingTag.Id] = true
+		implicationTagIds[implication.ImpliedTag.Id] = true
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	unused := make(entities.Tags, 0, 10)
+	for _, tagFileCount := range tagFileCounts {
+		if tagFileCount.FileCount > 0 {
 			continue
 		}
 
-		err = store.DeleteTag(tx, tag.Id)
-		if err != nil {
-			return fmt.Errorf("could not delete tag '%v': %v", tagName, err), warnings
+		if implicationTagIds[tagFileCount.Id] {
+			warnings = append(warnings, fmt.Sprintf("tag '%v' is unused but has implications: not deleted", tagFileCount.Name))
+			continue
 		}
+
+		unused = append(unused, &entities.Tag{Id: tagFileCount.Id, Name: tagFileCount.Name})
+	}
+
+	if !dryRun && len(unused) > 0 {
+		if err := beginUndoTags(store, tx, "delete", unused); err != nil {
+			return err, warnings
+		}
+	}
+
+	for _, tag := range unused {
+		if !dryRun {
+			log.Infof("deleting unused tag '%v'", tag.Name)
+
+			if err := store.DeleteTag(tx, tag.Id); err != nil {
+				return fmt.Errorf("could not delete tag '%v': %v", tag.Name, err), warnings
+			}
+		}
+
+		fmt.Println(text.Escape(tag.Name, '=', ' '))
 	}
 
 	return nil, warnings
@@ -85,6 +243,7 @@ func deleteTag(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error,
 func deleteValue(store *storage.Storage, tx *storage.Tx, valueArgs []string) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
+	values := make(entities.Values, 0, len(valueArgs))
 	for _, valueArg := range valueArgs {
 		valueName := parseTagOrValueName(valueArg)
 
@@ -97,8 +256,31 @@ func deleteValue(store *storage.Storage, tx *storage.Tx, valueArgs []string) (er
 			continue
 		}
 
-		if err = store.DeleteValue(tx, value.Id); err != nil {
-			return fmt.Errorf("could not delete value '%v': %v", valueName, err), warnings
+		if !values.Contains(value) {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) > 0 {
+		names := make([]string, len(values))
+		for index, value := range values {
+			names[index] = value.Name
+		}
+
+		if err := beginUndo(store, tx, undoDescription("delete", "value", names)); err != nil {
+			return err, warnings
+		}
+
+		for _, value := range values {
+			if err := store.SaveUndoValue(tx, value.Id); err != nil {
+				return fmt.Errorf("could not record value '%v' for undoing: %v", value.Name, err), warnings
+			}
+		}
+	}
+
+	for _, value := range values {
+		if err := store.DeleteValue(tx, value.Id); err != nil {
+			return fmt.Errorf("could not delete value '%v': %v", value.Name, err), warnings
 		}
 	}
 
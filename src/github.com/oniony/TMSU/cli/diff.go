@@ -0,0 +1,179 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+)
+
+var DiffCommand = Command{
+	Name:     "diff",
+	Synopsis: "Compare the tags of two files",
+	Usages:   []string{"tmsu diff [OPTION]... FILE1 FILE2"},
+	Description: `Compares the tags applied to FILE1 and FILE2. Each tag is listed prefixed with '<' if it is applied only to FILE1, '>' if applied only to FILE2 or '=' if applied to both. A tag applied to both files with different values is listed with each file's values.
+
+A file that is not in the database is matched to a tagged file with the same fingerprint, such that a copy can be compared against the original. A file that is in neither has no tags.
+
+This is useful for deciding which of a pair of duplicate files to keep: see the 'dupes' subcommand.`,
+	Examples: []string{"$ tmsu diff beach1.jpg beach2.jpg\n< holiday\n= photo\n< year=2017\n> year=2018"},
+	Options: Options{{"--explicit", "-e", "compare only the explicitly applied tags", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links", false, ""}},
+	Exec: diffExec,
+}
+
+// unexported
+
+func diffExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments"), nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	explicitOnly := options.HasOption("--explicit")
+	followSymlinks := !options.HasOption("--no-dereference")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	warnings := make(warnings, 0, 10)
+
+	tagNames := make([][]string, len(args))
+	for index, path := range args {
+		file, err := resolveFileOrCopy(store, tx, path, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if file == nil {
+			warnings = append(warnings, fmt.Sprintf("%v: not tagged", path))
+			continue
+		}
+
+		tagNames[index], err = tagNamesForFile(store, tx, file.Id, explicitOnly, false)
+		if err != nil {
+			return err, warnings
+		}
+	}
+
+	printTagDiff(tagNames[0], tagNames[1])
+
+	return nil, warnings
+}
+
+// Retrieves the file in the database for the path or, should there be none,
+// the sole file in the database with the same fingerprint.
+func resolveFileOrCopy(store *storage.Storage, tx *storage.Tx, path string, followSymlinks bool) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err == nil && stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("%v: retrieving file", path)
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file != nil {
+		return file, nil
+	}
+
+	if _, err := os.Stat(absPath); err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return nil, fmt.Errorf("%v: no such file", path)
+		case os.IsPermission(err):
+			return nil, fmt.Errorf("%v: permission denied", path)
+		default:
+			return nil, fmt.Errorf("%v: could not stat file: %v", path, err)
+		}
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	log.Infof("%v: creating fingerprint", path)
+
+	fp, err := fingerprint.Create(absPath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+	}
+	if fp == fingerprint.Empty {
+		return nil, nil
+	}
+
+	files, err := store.FilesByFingerprint(tx, fp)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve files by fingerprint: %v", path, err)
+	}
+
+	switch len(files) {
+	case 0:
+		return nil, nil
+	case 1:
+		log.Infof("%v: comparing tags of '%v', which has the same fingerprint", path, files[0].Path())
+		return files[0], nil
+	default:
+		return nil, fmt.Errorf("%v: not tagged but has the same fingerprint as %v tagged files", path, len(files))
+	}
+}
+
+// Prints the union of the sorted tag names, each prefixed according to which
+// of the lists it appears in.
+func printTagDiff(tagNames1, tagNames2 []string) {
+	index1, index2 := 0, 0
+	for index1 < len(tagNames1) || index2 < len(tagNames2) {
+		switch {
+		case index2 == len(tagNames2) || index1 < len(tagNames1) && tagNames1[index1] < tagNames2[index2]:
+			fmt.Println("< " + tagNames1[index1])
+			index1++
+		case index1 == len(tagNames1) || tagNames2[index2] < tagNames1[index1]:
+			fmt.Println("> " + tagNames2[index2])
+			index2++
+		default:
+			fmt.Println("= " + tagNames1[index1])
+			index1++
+			index2++
+		}
+	}
+}
@@ -22,26 +22,82 @@ import (
 	"github.com/oniony/TMSU/common/log"
 	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 var DupesCommand = Command{
-	Name:        "dupes",
-	Synopsis:    "Identify duplicate files",
-	Usages:      []string{"tmsu dupes [FILE]..."},
-	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.`,
+	Name:     "dupes",
+	Synopsis: "Identify duplicate files",
+	Usages:   []string{"tmsu dupes [OPTION]... [FILE]..."},
+	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.
+
+FILE need not itself be in the database, so this can be used to determine whether files from elsewhere, e.g. a downloads directory, are already present in the database. For each FILE that has duplicates, the paths of the matching files in the database are listed.
+
+When identifying duplicates between files in the database, --older-than limits the output to those sets of duplicates where the oldest file was modified more than DURATION before the newest whilst --newer-than limits it to those sets where all of the files were modified within DURATION of each other. DURATION is a number followed by one of the units s, m, h, d or w, e.g. 30d.
+
+With --include-untagged, the untagged files beneath the working directory are also compared against the files in the database. Files listed in a '.tmsuignore' file are skipped.
+
+The --sort option controls the order of the files within each set: 'name' (the default) or 'time', which lists the oldest files first.`,
 	Examples: []string{"$ tmsu dupes\nSet of 2 duplicates:\n  /tmp/song.mp3\n  /tmp/copy of song.mp3a",
-		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3"},
-	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
-	Exec:    dupesExec,
+		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3",
+		"$ tmsu dupes --recursive ~/Downloads\n/home/bob/Downloads/song.mp3:\n  /tmp/song.mp3",
+		"$ tmsu dupes --older-than=30d --sort=time",
+		"$ tmsu dupes --include-untagged"},
+	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""},
+		Option{"--older-than", "", "list only sets whose files' modification times span more than DURATION", true, ""},
+		Option{"--newer-than", "", "list only sets whose files' modification times span less than DURATION", true, ""},
+		Option{"--include-untagged", "", "also compare untagged files beneath the working directory", false, ""},
+		Option{"--sort", "-s", "sort files within each set: name, time", true, ""}},
+	Exec: dupesExec,
 }
 
 // unexported
 
+type duplicateFilter struct {
+	olderThan time.Duration
+	newerThan time.Duration
+}
+
 func dupesExec(options Options, args []string, databasePath string) (error, warnings) {
 	recursive := options.HasOption("--recursive")
+	includeUntagged := options.HasOption("--include-untagged")
+
+	var filter duplicateFilter
+	if options.HasOption("--older-than") {
+		text := options.Get("--older-than").Argument
+		duration, ok := query.ParseDuration(text)
+		if !ok || duration <= 0 {
+			return fmt.Errorf("invalid duration '%v': must be a positive number followed by s, m, h, d or w, e.g. 30d", text), nil
+		}
+		filter.olderThan = duration
+	}
+	if options.HasOption("--newer-than") {
+		text := options.Get("--newer-than").Argument
+		duration, ok := query.ParseDuration(text)
+		if !ok || duration <= 0 {
+			return fmt.Errorf("invalid duration '%v': must be a positive number followed by s, m, h, d or w, e.g. 30d", text), nil
+		}
+		filter.newerThan = duration
+	}
+
+	sortBy := "name"
+	if options.HasOption("--sort") {
+		sortBy = options.Get("--sort").Argument
+		switch sortBy {
+		case "name", "time":
+		default:
+			return fmt.Errorf("invalid sort '%v': must be one of name, time", sortBy), nil
+		}
+	}
+
+	if len(args) > 0 && (filter.olderThan > 0 || filter.newerThan > 0 || includeUntagged) {
+		return fmt.Errorf("the --older-than, --newer-than and --include-untagged options cannot be used with FILE"), nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -57,24 +113,41 @@ func dupesExec(options Options, args []string, databasePath string) (error, warn
 
 	switch len(args) {
 	case 0:
-		return findDuplicatesInDb(store, tx), nil
+		return findDuplicatesInDb(store, tx, filter, includeUntagged, sortBy)
 	default:
-		return findDuplicatesOf(store, tx, args, recursive)
+		return findDuplicatesOf(store, tx, args, recursive, sortBy)
 	}
 }
 
-func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
-	log.Info(2, "identifying duplicate files.")
+func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx, filter duplicateFilter, includeUntagged bool, sortBy string) (error, warnings) {
+	log.Info("identifying duplicate files.")
 
 	fileSets, err := store.DuplicateFiles(tx)
 	if err != nil {
-		return fmt.Errorf("could not identify duplicate files: %v", err)
+		return fmt.Errorf("could not identify duplicate files: %v", err), nil
 	}
 
-	log.Infof(2, "found %v sets of duplicate files.", len(fileSets))
+	var warnings warnings
+	if includeUntagged {
+		fileSets, warnings, err = addUntaggedDuplicates(store, tx, fileSets)
+		if err != nil {
+			return err, warnings
+		}
+	}
 
-	for index, fileSet := range fileSets {
-		if index > 0 {
+	log.Infof("found %v sets of duplicate files.", len(fileSets))
+
+	first := true
+	for _, fileSet := range fileSets {
+		if !filter.matches(fileSet) {
+			continue
+		}
+
+		sortDuplicates(fileSet, sortBy)
+
+		if first {
+			first = false
+		} else {
 			fmt.Println()
 		}
 
@@ -86,16 +159,177 @@ func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
 		}
 	}
 
-	return nil
+	return nil, warnings
+}
+
+// Determines whether the spread of modification times within a set of
+// duplicates satisfies the filter.
+func (filter duplicateFilter) matches(fileSet entities.Files) bool {
+	if len(fileSet) == 0 {
+		return false
+	}
+
+	oldest, newest := fileSet[0].ModTime, fileSet[0].ModTime
+	for _, file := range fileSet[1:] {
+		if file.ModTime.Before(oldest) {
+			oldest = file.ModTime
+		}
+		if file.ModTime.After(newest) {
+			newest = file.ModTime
+		}
+	}
+
+	spread := newest.Sub(oldest)
+
+	if filter.olderThan > 0 && spread <= filter.olderThan {
+		return false
+	}
+	if filter.newerThan > 0 && spread >= filter.newerThan {
+		return false
+	}
+
+	return true
+}
+
+func sortDuplicates(files entities.Files, sortBy string) {
+	if sortBy != "time" {
+		return
+	}
+
+	sort.Stable(filesByModTime(files))
+}
+
+type filesByModTime entities.Files
+
+func (files filesByModTime) Len() int           { return len(files) }
+func (files filesByModTime) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files filesByModTime) Less(i, j int) bool { return files[i].ModTime.Before(files[j].ModTime) }
+
+type filesByPath entities.Files
+
+func (files filesByPath) Len() int           { return len(files) }
+func (files filesByPath) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files filesByPath) Less(i, j int) bool { return files[i].Path() < files[j].Path() }
+
+type fileSetsByFingerprint []entities.Files
+
+func (fileSets fileSetsByFingerprint) Len() int { return len(fileSets) }
+func (fileSets fileSetsByFingerprint) Swap(i, j int) {
+	fileSets[i], fileSets[j] = fileSets[j], fileSets[i]
+}
+func (fileSets fileSetsByFingerprint) Less(i, j int) bool {
+	return fileSets[i][0].Fingerprint < fileSets[j][0].Fingerprint
+}
+
+// Adds the untagged files beneath the working directory to the sets of
+// duplicate files, forming new sets where an untagged file duplicates a single
+// tagged file.
+func addUntaggedDuplicates(store *storage.Storage, tx *storage.Tx, fileSets []entities.Files) ([]entities.Files, warnings, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("retrieving files.")
+
+	dbFiles, err := store.Files(tx, "none")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	dbPaths := make(map[string]bool, len(dbFiles))
+	dbFilesBySize := make(map[int64]entities.Files)
+	for _, dbFile := range dbFiles {
+		dbPaths[dbFile.Path()] = true
+		if !dbFile.IsDir && dbFile.Fingerprint != fingerprint.Fingerprint("") {
+			dbFilesBySize[dbFile.Size] = append(dbFilesBySize[dbFile.Size], dbFile)
+		}
+	}
+
+	setsByFingerprint := make(map[fingerprint.Fingerprint]entities.Files, len(fileSets))
+	for _, fileSet := range fileSets {
+		setsByFingerprint[fileSet[0].Fingerprint] = fileSet
+	}
+
+	log.Info("identifying untagged duplicate files.")
+
+	entries, err := filesystem.Enumerate(".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not enumerate paths: %v", err)
+	}
+
+	ignorer := _path.NewIgnorer()
+	warnings := make(warnings, 0, 10)
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+
+		absPath, err := filepath.Abs(entry.Path)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("%v: could not determine absolute path: %v", entry.Path, err)
+		}
+
+		if dbPaths[absPath] {
+			continue
+		}
+
+		ignored, err := ignorer.Ignored(absPath)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		if ignored {
+			continue
+		}
+
+		stat, err := os.Lstat(absPath)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: could not stat: %v", entry.Path, err))
+			continue
+		}
+
+		candidates, ok := dbFilesBySize[stat.Size()]
+		if !ok || !stat.Mode().IsRegular() {
+			continue
+		}
+
+		fp, err := fingerprint.Create(absPath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: could not create fingerprint: %v", entry.Path, err))
+			continue
+		}
+
+		fileSet, ok := setsByFingerprint[fp]
+		if !ok {
+			fileSet = candidates.Where(func(file *entities.File) bool { return file.Fingerprint == fp })
+			if len(fileSet) == 0 {
+				continue
+			}
+			fileSets = append(fileSets, fileSet)
+		}
+
+		file := &entities.File{0, filepath.Dir(absPath), filepath.Base(absPath), fp, stat.ModTime().UTC(), stat.Size(), false}
+		setsByFingerprint[fp] = append(fileSet, file)
+	}
+
+	for index, fileSet := range fileSets {
+		fileSets[index] = setsByFingerprint[fileSet[0].Fingerprint]
+		sort.Sort(filesByPath(fileSets[index]))
+	}
+	sort.Sort(fileSetsByFingerprint(fileSets))
+
+	return fileSets, warnings, nil
 }
 
-func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (error, warnings) {
+func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool, sortBy string) (error, warnings) {
 	settings, err := store.Settings(tx)
 	if err != nil {
 		return err, nil
 	}
 
 	warnings := make(warnings, 0, 10)
+	existingPaths := make([]string, 0, len(paths))
 	for _, path := range paths {
 		_, err := os.Stat(path)
 		if err != nil {
@@ -110,7 +344,10 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 				return err, warnings
 			}
 		}
+
+		existingPaths = append(existingPaths, path)
 	}
+	paths = existingPaths
 
 	if recursive {
 		p, err := filesystem.Enumerate(paths...)
@@ -126,7 +363,18 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 
 	first := true
 	for _, path := range paths {
-		log.Infof(2, "%v: identifying duplicate files.", path)
+		log.Infof("%v: identifying duplicate files.", path)
+
+		// files of a size that no file in the database has cannot be duplicates
+		if stat, err := os.Lstat(path); err == nil && stat.Mode().IsRegular() {
+			count, err := store.FileCountBySize(tx, stat.Size())
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve files of size %v: %v", path, stat.Size(), err), warnings
+			}
+			if count == 0 {
+				continue
+			}
+		}
 
 		fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
 		if err != nil {
@@ -149,6 +397,7 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 
 		// filter out the file we're searching on
 		dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
+		sortDuplicates(dupes, sortBy)
 
 		if len(paths) > 1 && len(dupes) > 0 {
 			if first {
@@ -21,6 +21,24 @@ import (
 
 type warnings []string
 
+// Returned by the commands that list files when there are none to list. This is
+// not an error unless the global --exit-nonzero-on-empty option is specified.
+type NoMatchesError struct {
+}
+
+func (err NoMatchesError) Error() string {
+	return "no matches"
+}
+
+// Returned when a change is attempted to a database opened with --read-only.
+type ReadOnlyError struct {
+	Action string
+}
+
+func (err ReadOnlyError) Error() string {
+	return fmt.Sprintf("cannot %v: the database was opened with --read-only", err.Action)
+}
+
 type NoSuchTagError struct {
 	Name string
 }
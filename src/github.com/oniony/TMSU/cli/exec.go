@@ -0,0 +1,202 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"strings"
+)
+
+var ExecCommand = Command{
+	Name:     "exec",
+	Synopsis: "Run a script of tag and untag commands",
+	Usages:   []string{"tmsu exec [OPTION]... --file=SCRIPT"},
+	Description: `Runs the 'tag' and 'untag' commands listed in SCRIPT, one per line, within a single database transaction. This is considerably faster than running each command separately when making many changes.
+
+Each line of SCRIPT is a command as it would be given to 'tmsu' on the command line, without the leading 'tmsu', e.g. 'tag --tags="photo holiday" beach.jpg'. Arguments containing whitespace may be enclosed in quotation marks. Blank lines and lines beginning with '#' are ignored. If SCRIPT is '-' then the commands are read from standard input.
+
+The changes are committed once all of the commands have run. Should any command fail, including one that reports warnings such as a missing file, then none of the changes are made. With --continue-on-error the failed commands are instead reported and the changes made by the remaining commands are committed.`,
+	Examples: []string{"$ tmsu exec --file=tagging.txt",
+		"$ generate-tags | tmsu exec --continue-on-error --file=-"},
+	Options: Options{{"--file", "-f", "read the commands from SCRIPT", true, ""},
+		{"--continue-on-error", "-k", "commit the commands that succeed and report those that fail", false, ""}},
+	Exec:     execExec,
+	Modifies: true,
+}
+
+// unexported
+
+var execCommands = []*Command{&TagCommand, &UntagCommand}
+
+type execLine struct {
+	number int
+	text   string
+}
+
+func execExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+	if !options.HasOption("--file") {
+		return fmt.Errorf("the script to run must be specified with --file"), nil
+	}
+
+	path := options.Get("--file").Argument
+	continueOnError := options.HasOption("--continue-on-error")
+
+	lines, err := readScriptLines(path)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	warnings, failed, err := execLines(store, tx, path, lines, continueOnError)
+	if err != nil {
+		tx.Rollback()
+		return err, warnings
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), warnings
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v commands failed", failed, len(lines)), warnings
+	}
+
+	return nil, warnings
+}
+
+func readScriptLines(path string) ([]execLine, error) {
+	var reader io.Reader
+	if path == "-" {
+		log.Info("reading commands from standard input")
+
+		reader = os.Stdin
+	} else {
+		log.Infof("%v: reading commands", path)
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	lines := make([]execLine, 0, 10)
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, execLine{number, line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: could not read file: %v", path, err)
+	}
+
+	return lines, nil
+}
+
+// Runs each of the lines within the transaction. With continueOnError each
+// line runs within its own savepoint such that a failed line can be undone
+// without losing the changes made by the others.
+func execLines(store *storage.Storage, tx *storage.Tx, path string, lines []execLine, continueOnError bool) (warnings, int, error) {
+	warnings := make(warnings, 0, 10)
+	failed := 0
+
+	for _, line := range lines {
+		log.Infof("%v:%v: %v", path, line.number, line.text)
+
+		if continueOnError {
+			if err := tx.Savepoint("line"); err != nil {
+				return warnings, failed, fmt.Errorf("could not create savepoint: %v", err)
+			}
+		}
+
+		err, lineWarnings := execLineInTx(store, tx, line.text)
+		for _, warning := range lineWarnings {
+			warnings = append(warnings, fmt.Sprintf("%v:%v: %v", path, line.number, warning))
+		}
+
+		// a command that only partially succeeded has failed all the same
+		if err == nil && len(lineWarnings) > 0 {
+			err = fmt.Errorf("command failed with warnings")
+		}
+
+		if err == nil {
+			if continueOnError {
+				if err := tx.ReleaseSavepoint("line"); err != nil {
+					return warnings, failed, fmt.Errorf("could not release savepoint: %v", err)
+				}
+			}
+
+			continue
+		}
+
+		if !continueOnError {
+			return warnings, failed, fmt.Errorf("%v:%v: %v: no changes were made", path, line.number, err)
+		}
+
+		warnings = append(warnings, fmt.Sprintf("%v:%v: %v", path, line.number, err))
+		failed++
+
+		if err := tx.RollbackToSavepoint("line"); err != nil {
+			return warnings, failed, fmt.Errorf("could not roll back to savepoint: %v", err)
+		}
+	}
+
+	return warnings, failed, nil
+}
+
+func execLineInTx(store *storage.Storage, tx *storage.Tx, line string) (error, warnings) {
+	parser := NewOptionParser(Options{}, execCommands)
+	command, options, args, err := parser.Parse(text.Tokenize(line)...)
+	if err != nil {
+		return err, nil
+	}
+
+	switch {
+	case command == nil:
+		return fmt.Errorf("missing subcommand: must be one of tag, untag"), nil
+	case command.Name == TagCommand.Name:
+		return tagInTx(store, tx, options, args)
+	case command.Name == UntagCommand.Name:
+		return untagInTx(store, tx, options, args)
+	}
+
+	return fmt.Errorf("invalid subcommand '%v': must be one of tag, untag", command.Name), nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ExportCommand = Command{
+	Name:     "export",
+	Synopsis: "Export the database to a portable document",
+	Usages:   []string{"tmsu export [OPTION]..."},
+	Description: `Writes the tags, values, implications, files and taggings in the database to standard output as a JSON document.
+
+File paths are written relative to ROOT, which defaults to the root of the filesystem, such that the document can be imported on a machine where the files reside under a different path. Files outside of ROOT are omitted.
+
+File fingerprints are included so that the 'import' subcommand can relink the taggings by file content rather than by path.`,
+	Examples: []string{"$ tmsu export >backup.json",
+		"$ tmsu export --root=/home/bob >backup.json"},
+	Options: Options{{"--root", "-r", "write paths relative to ROOT", true, ""}},
+	Exec:    exportExec,
+}
+
+// unexported
+
+const exportFormat = "tmsu-export"
+const exportVersion = 1
+
+type exportDocument struct {
+	Format       string              `json:"format"`
+	Version      int                 `json:"version"`
+	Root         string              `json:"root"`
+	Tags         []string            `json:"tags"`
+	Values       []string            `json:"values"`
+	Implications []exportImplication `json:"implications"`
+	Files        []exportFile        `json:"files"`
+}
+
+type exportImplication struct {
+	Tag           string `json:"tag"`
+	Value         string `json:"value,omitempty"`
+	ImpliedTag    string `json:"impliedTag"`
+	ImpliedValue  string `json:"impliedValue,omitempty"`
+	InheritsValue bool   `json:"inheritsValue,omitempty"`
+}
+
+type exportFile struct {
+	Path        string          `json:"path"`
+	Fingerprint string          `json:"fingerprint"`
+	ModTime     time.Time       `json:"modTime"`
+	Size        int64           `json:"size"`
+	IsDir       bool            `json:"isDir"`
+	Tags        []exportTagging `json:"tags"`
+}
+
+type exportTagging struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value,omitempty"`
+}
+
+func exportExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	root := string(filepath.Separator)
+	if options.HasOption("--root") {
+		var err error
+		root, err = filepath.Abs(options.Get("--root").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", options.Get("--root").Argument, err), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	document, err := buildExportDocument(store, tx, root)
+	if err != nil {
+		return err, nil
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode export document: %v", err), nil
+	}
+
+	fmt.Println(string(data))
+
+	return nil, nil
+}
+
+func buildExportDocument(store *storage.Storage, tx *storage.Tx, root string) (*exportDocument, error) {
+	log.Info("retrieving tags")
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	tagNames := make(map[entities.TagId]string, len(tags))
+	document := exportDocument{exportFormat, exportVersion, root, make([]string, len(tags)), nil, nil, nil}
+	for index, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+		document.Tags[index] = tag.Name
+	}
+
+	log.Info("retrieving values")
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	valueNames := make(map[entities.ValueId]string, len(values))
+	document.Values = make([]string, len(values))
+	for index, value := range values {
+		valueNames[value.Id] = value.Name
+		document.Values[index] = value.Name
+	}
+
+	log.Info("retrieving implications")
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	document.Implications = make([]exportImplication, len(implications))
+	for index, implication := range implications {
+		document.Implications[index] = exportImplication{implication.ImplyingTag.Name,
+			implication.ImplyingValue.Name,
+			implication.ImpliedTag.Name,
+			implication.ImpliedValue.Name,
+			implication.InheritsValue}
+	}
+
+	log.Info("retrieving taggings")
+
+	fileTags, err := store.FileTags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve taggings: %v", err)
+	}
+
+	taggingsByFileId := make(map[entities.FileId][]exportTagging, len(fileTags))
+	for _, fileTag := range fileTags {
+		tagging := exportTagging{tagNames[fileTag.TagId], valueNames[fileTag.ValueId]}
+		taggingsByFileId[fileTag.FileId] = append(taggingsByFileId[fileTag.FileId], tagging)
+	}
+
+	log.Info("retrieving files")
+
+	files, err := store.Files(tx, "path")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	document.Files = make([]exportFile, 0, len(files))
+	for _, file := range files {
+		relPath, err := filepath.Rel(root, file.Path())
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			log.Infof("%v: not under root '%v': omitted", file.Path(), root)
+			continue
+		}
+
+		taggings := taggingsByFileId[file.Id]
+		if taggings == nil {
+			taggings = make([]exportTagging, 0)
+		}
+
+		document.Files = append(document.Files, exportFile{relPath,
+			string(file.Fingerprint),
+			file.ModTime,
+			file.Size,
+			file.IsDir,
+			taggings})
+	}
+
+	return &document, nil
+}
@@ -16,53 +16,162 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
-	"github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/tmsu"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var FilesCommand = Command{
 	Name:     "files",
 	Aliases:  []string{"query"},
 	Synopsis: "List files with particular tags",
-	Usages:   []string{"tmsu files [OPTION]... [QUERY]"},
+	Usages: []string{"tmsu files [OPTION]... [QUERY]",
+		"tmsu files [OPTION]... --query-file=FILE"},
 	Description: `Lists the files in the database that match the QUERY specified. If no query is specified, all files in the database are listed.
 
-QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >= eq ne lt gt le ge.
+QUERY may contain tag names to match, operators and parentheses. Operators are: and or xor not == != < > <= >= eq ne lt gt le ge within near ~.
+
+The 'xor' operator matches files that match exactly one of its operands, e.g. 'raw xor edited' finds files tagged with one but not both. As with the other operators, implied tags are taken into account unless --explicit is specified.
+
+The 'not' operator binds more tightly than 'and', which binds more tightly than 'xor', which binds more tightly than 'or', so 'a or b xor c and not d' is 'a or (b xor (c and (not d)))'. Parentheses may be nested to group terms otherwise, e.g. '(a or b) and not (c or d)'. Where a query is malformed, the error gives the character position of the offending token.
+
+A tag name containing the wildcards '*' or '?' matches any tag whose name matches the pattern, e.g. 'client-*' matches 'client-acme' and 'client-initech'. A pattern that matches no tags matches no files. Escape the wildcard with a backslash to match it literally.
+
+Tags may be organised hierarchically by separating the levels of their names with a slash '/', e.g. 'location/europe/france'. The wildcard '*' also matches the slash, so 'location/europe/*' matches the files tagged with any tag beneath 'location/europe' however deep. See 'tmsu tags --tree'.
+
+A tag name on its own matches files with that tag whether or not it has a value, e.g. 'rating' matches files tagged 'rating' and 'rating=5'. A comparison matches only files with a matching value, e.g. 'rating=5', and a value of '*' matches any value, such that 'rating=*' matches files tagged 'rating=5' but not those tagged 'rating' without a value. Conversely, 'rating and not rating=*' finds the files tagged without a value. Quote the value, e.g. "rating='*'", to match the value '*' literally.
+
+Values are compared numerically where both the value and the number in the query are numbers, e.g. 'rating >= 4' matches the values 4.0 and 10, and textually otherwise, e.g. 'high' is greater than '4'.
+
+The names 'modified' and 'added', when compared, match on the time a file was last modified or added to the database rather than on a tag. They can be compared against a date (YYYY-MM-DD), a time (YYYY-MM-DDTHH:MM:SS) or a duration (e.g. 30m, 12h, 7d or 2w) indicating how long ago, e.g. 'modified within 7d'. Dates and times without a timezone are interpreted as UTC. Files added with earlier versions have no recorded added time. Where the value is neither a date, a time nor a duration, e.g. 'modified = yes', the comparison is against a tag of that name instead. To compare a tag named 'modified' or 'added' against a date, quote its name, e.g. "'modified' = 2020-01-01".
+
+The name 'tagcount', when compared, matches on the number of distinct tags applied to a file, e.g. 'tagcount < 3' finds sparsely tagged files. Only the explicitly applied tags are counted unless --count-implied is specified. Where the value is not a whole number, e.g. 'tagcount = high', the comparison is against a tag named 'tagcount' instead. A quoted name is always a tag, e.g. "'tagcount' = 3".
+
+The name 'size', when compared, matches on the size of a file in bytes. Sizes may have a unit: KB, MB, GB or TB for powers of 1000 and KiB, MiB, GiB or TiB for powers of 1024, e.g. 'size > 500MB'. Sizes are recorded when a file is tagged or repaired. Where the value is not a size, e.g. 'size = large', the comparison is against a tag named 'size' instead. A quoted name is always a tag, e.g. "'size' = 10".
+
+The 'near' operator matches values that are 'lat,lon' positions within a distance, in metres (m), kilometres (km) or miles (mi), of a point, e.g. 'gps near 51.5,-0.12 within 10km'. Values that are not positions are ignored. The words 'near' and 'within' are only operators when they follow a tag name, so tags of those names can still be queried, e.g. 'near and not within'.
+
+The '~' operator matches values against a regular expression, e.g. "version ~ '^2\.[0-9]+'". The pattern may be enclosed in single or double quotation marks, which is necessary if it contains whitespace or parentheses, and backslashes within it are not treated as escapes. Patterns are unanchored unless '^' or '$' are used. As the database cannot evaluate regular expressions, each of the values is tested in turn, so this may be slower than other comparisons on large databases.
+
+The 'path:' predicate matches files whose path matches a glob pattern, e.g. 'landscape and path:photos/2023/*'. Relative patterns are interpreted relative to the database root rather than the working directory. The wildcard '*' also matches path separators, so 'photos/*' matches everything beneath 'photos', as does 'photos/'. Paths are compared case-sensitively unless --ignore-case is specified.
+
+The 'fingerprint:' predicate matches files whose fingerprint is, or begins with, the fingerprint given, e.g. 'fingerprint:3a7bd3e2'. This is useful for finding the tags of a file whose hash is known from elsewhere.
 
 Queries are run against the database so the results may not reflect the current state of the filesystem. Only tagged files are matched: to identify untagged files use the 'untagged' subcommand.
 
-Note: If your tag or value name contains whitespace, operators (e.g. '<') or parentheses ('(' or ')'), these must be escaped with a backslash '\', e.g. '\<tag\>' matches the tag name '<tag>'. Your shell, however, may use some punctuation for its own purposes: this can normally be avoided by enclosing the query in single quotation marks or by escaping the problem characters with a backslash.`,
+Use --print0 when piping the output to other programs, e.g. 'xargs -0', as this is safe for paths that contain whitespace or newline characters.
+
+Use --tree to list the files beneath their directories, indented, rather than as a flat list, which makes it easier to see where the matches are within a large set. Only the directories containing matches are shown, and a chain of directories that contain nothing but a single directory is shown on one line. The entries within each directory are listed in order of name. With --count each directory is shown with the number of matching files beneath it instead.
+
+Use --explain to show, for each file listed, the tags that satisfied the query. Tags that were not applied explicitly are annotated with the explicitly applied tags that imply them. This is slower so is off by default.
+
+The --format option lists the files as a JSON document or as CSV, with a header row, for use in other programs. Both include each file's path, fingerprint and tags: the tags are separated by semicolons in CSV.
+
+Paths are shown relative to the working directory where they are beneath it. Use --relative-to to show them relative to DIR instead or --absolute to always show absolute paths. A path that is not beneath DIR is shown as an absolute path with a warning. With --shell-quote each path is quoted, where necessary, as per the POSIX shell, so that the output may be pasted into a shell safely.
+
+The files are listed in order of path, as per 'name' (or 'path'), unless --sort is specified: 'basename' orders by the file name within any directory, 'modified' (or 'time') by modification time, 'size' by size, 'fingerprint' by fingerprint, 'id' by the order the files were added and 'none' leaves the order as the database finds it. With 'value:TAG' the files are ordered by their values for TAG, numerically where the values are numbers, with files that have no value for TAG last. Use --reverse to reverse the order.
+
+Use --limit to list at most N files and --offset to skip the first N, such that a large set of matches can be paged through. Pages are only stable with a deterministic --sort, i.e. not 'none'. The --count option reports the total number of matches regardless.
+
+When no files match, the exit status is 0 unless the global --exit-nonzero-on-empty option is specified, in which case it is 2. This allows a script to distinguish a query with no results from an error, which always exits with status 1.
+
+With --link-to the matching files are not listed but instead a symbolic link to each is created in DIR, which is created if necessary, as a static alternative to the virtual filesystem for programs that do not work well with FUSE. By default, as per --flatten, the links are created directly within DIR and links whose names would collide are given a numeric suffix, e.g. 'photo.1.jpg'. With --preserve-tree the links are instead created at the file's path relative to the database root, or at its absolute path for files outside of it, beneath DIR. Existing links to the same file are left alone. The number of links created is reported, as is each link that could not be created.
+
+The query may instead be read from FILE using --query-file, or from standard input if FILE is '-'. Lines beginning with '#' are treated as comments and the remaining lines are joined to form a single query.
+
+Note: If your tag or value name contains whitespace, operators (e.g. '<') or parentheses ('(' or ')'), these must be escaped with a backslash '\', e.g. '\<tag\>' matches the tag name '<tag>', or the name enclosed in single or double quotation marks, e.g. 'title = "A, B: and C"'. A quoted name is taken literally: it does not contain wildcards and may be one of the operator words, e.g. '"and"'. Within quotation marks only the quotation mark and the backslash may be escaped. Quotation marks elsewhere in a name, e.g. the apostrophe in children's, are ordinary characters. Your shell, however, may use some punctuation for its own purposes: this can normally be avoided by enclosing the query in single quotation marks or by escaping the problem characters with a backslash.`,
 	Examples: []string{"$ tmsu files music mp3  # files with both 'music' and 'mp3'",
 		"$ tmsu files music and mp3  # same query but with explicit 'and'",
 		"$ tmsu files music and not mp3",
+		`$ tmsu files "(jazz or blues) and not (mp3 or wma)"`,
 		`$ tmsu files "music and (mp3 or flac)"`,
+		`$ tmsu files "client-* and not archived"`,
 		`$ tmsu files "year == 2017"`,
 		`$ tmsu files "year < 2017"`,
 		`$ tmsu files year lt 2017`,
 		`$ tmsu files year`,
+		`$ tmsu files "year=*"  # files with any value for 'year'`,
+		`$ tmsu files "modified > 2017-01-01"`,
+		`$ tmsu files music and added within 7d`,
+		`$ tmsu files "tagcount < 3"`,
+		`$ tmsu files "video and size > 1GB"`,
+		`$ tmsu files "gps near 51.5,-0.12 within 10km"`,
+		`$ tmsu files "version ~ '^2\.\d+'"`,
+		`$ tmsu files "landscape and path:photos/2023/*"`,
+		`$ tmsu files "fingerprint: 3a7bd3e2"`,
 		`$ tmsu files --path=/home/bob music`,
+		`$ tmsu files --relative-to=/home/bob/music mp3`,
 		`$ tmsu files 'contains\=equals'`,
-		`$ tmsu files '\<tag\>'`},
+		`$ tmsu files 'title = "A, B: and C"'`,
+		`$ tmsu files '\<tag\>'`,
+		`$ tmsu files --format=json music`,
+		"$ tmsu files --format=csv music\npath,fingerprint,tags\ntralala.mp3,4a9c...,music;mp3",
+		`$ tmsu files --sort=size --reverse video`,
+		`$ tmsu files --sort=value:rating photo`,
+		`$ tmsu files --sort=name --limit=100 --offset=200 photo`,
+		"$ tmsu files --explain portrait\nselfie.jpg: portrait (implied by photo)",
+		"$ tmsu files --tree photo\n./pictures/\n  2017/\n    beach.jpg\n  2018/\n    mountain.jpg",
+		"$ tmsu files --tree --count photo\n./pictures/: 2\n  2017/: 1\n  2018/: 1",
+		`$ echo "music and not mp3" | tmsu files --query-file=-`,
+		"$ tmsu files --link-to=/tmp/holiday holiday\ncreated 42 link(s) in /tmp/holiday",
+		`$ tmsu files --link-to=/tmp/holiday --preserve-tree holiday`,
+		`$ tmsu files -0 music | xargs -0 mplayer`},
 	Options: Options{{"--directory", "-d", "list only items that are directories", false, ""},
 		{"--file", "-f", "list only items that are files", false, ""},
 		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
 		{"--count", "-c", "lists the number of files rather than their names", false, ""},
 		{"--path", "-p", "list only items under PATH", true, ""},
 		{"--explicit", "-e", "list only explicitly tagged files", false, ""},
-		{"--sort", "-s", "sort output: id, none, name, size, time", true, ""},
-		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""}},
+		{"--sort", "-s", "sort output: id, none, name, path, basename, modified, size, fingerprint, value:TAG", true, ""},
+		{"--reverse", "", "reverse the sort order", false, ""},
+		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""},
+		{"--format", "", "output format: text, json, csv", true, ""},
+		{"--query-file", "-q", "read the query from FILE ('-' for standard input)", true, ""},
+		{"--explain", "", "show the tags by which each file matched", false, ""},
+		{"--tree", "", "list the files beneath their directories", false, ""},
+		{"--count-implied", "", "include implied tags when comparing 'tagcount'", false, ""},
+		{"--relative-to", "", "show paths relative to DIR", true, ""},
+		{"--absolute", "", "show absolute paths", false, ""},
+		{"--shell-quote", "", "quote paths for the shell where necessary", false, ""},
+		{"--limit", "", "list at most N files", true, ""},
+		{"--offset", "", "skip the first N files", true, ""},
+		{"--link-to", "", "create symbolic links to the files in DIR rather than listing them", true, ""},
+		{"--flatten", "", "create the links directly within DIR, suffixing colliding names (default)", false, ""},
+		{"--preserve-tree", "", "create the links at the files' paths beneath DIR", false, ""}},
 	Exec: filesExec,
 }
 
 // unexported
 
 func filesExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	return filesInTx(store, tx, options, args)
+}
+
+// Lists the files matching the query specified by the options and arguments
+// within an existing transaction.
+func filesInTx(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
 	dirOnly := options.HasOption("--directory")
 	fileOnly := options.HasOption("--file")
 	print0 := options.HasOption("--print0")
@@ -70,12 +179,82 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	hasPath := options.HasOption("--path")
 	explicitOnly := options.HasOption("--explicit")
 	ignoreCase := options.HasOption("--ignore-case")
+	explain := options.HasOption("--explain")
+	tree := options.HasOption("--tree")
+	countImplied := options.HasOption("--count-implied")
+
+	format := "text"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+	}
+
+	switch format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("invalid format '%v': must be one of text, json, csv", format), nil
+	}
+
+	if print0 && showCount {
+		return fmt.Errorf("the --print0 and --count options are mutually exclusive"), nil
+	}
+	if explain && (print0 || showCount || format != "text") {
+		return fmt.Errorf("the --explain option cannot be used with --print0, --count or --format"), nil
+	}
+	if tree && (print0 || explain || format != "text" || options.HasOption("--shell-quote")) {
+		return fmt.Errorf("the --tree option cannot be used with --print0, --explain, --format or --shell-quote"), nil
+	}
+	if options.HasOption("--shell-quote") && (print0 || format != "text") {
+		return fmt.Errorf("the --shell-quote option cannot be used with --print0 or --format"), nil
+	}
+
+	linkDir := ""
+	if options.HasOption("--link-to") {
+		linkDir = options.Get("--link-to").Argument
+		if linkDir == "" {
+			return fmt.Errorf("the --link-to option requires a directory"), nil
+		}
+		if print0 || showCount || explain || tree || format != "text" {
+			return fmt.Errorf("the --link-to option cannot be used with --print0, --count, --explain, --tree or --format"), nil
+		}
+	}
+
+	preserveTree := options.HasOption("--preserve-tree")
+	if (preserveTree || options.HasOption("--flatten")) && linkDir == "" {
+		return fmt.Errorf("the --flatten and --preserve-tree options require --link-to"), nil
+	}
+	if preserveTree && options.HasOption("--flatten") {
+		return fmt.Errorf("the --flatten and --preserve-tree options are mutually exclusive"), nil
+	}
+
+	style, err := pathStyleFor(options)
+	if err != nil {
+		return err, nil
+	}
 
 	sort := "name"
 	if options.HasOption("--sort") {
 		sort = options.Get("--sort").Argument
 	}
 
+	switch {
+	case sort == "id", sort == "none", sort == "name", sort == "path", sort == "basename", sort == "time", sort == "modified", sort == "size", sort == "fingerprint":
+	case strings.HasPrefix(sort, "value:") && len(sort) > len("value:"):
+	default:
+		return fmt.Errorf("invalid sort '%v': must be one of id, none, name, path, basename, modified, size, fingerprint, value:TAG", sort), nil
+	}
+
+	reverse := options.HasOption("--reverse")
+
+	limit, err := uintOption(options, "--limit")
+	if err != nil {
+		return err, nil
+	}
+
+	offset, err := uintOption(options, "--offset")
+	if err != nil {
+		return err, nil
+	}
+
 	absPath := ""
 	if hasPath {
 		relPath := options.Get("--path").Argument
@@ -87,33 +266,60 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 		}
 	}
 
-	store, err := openDatabase(databasePath)
-	if err != nil {
-		return err, nil
-	}
-	defer store.Close()
+	if !ignoreCase {
+		settings, err := store.Settings(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve settings: %v", err), nil
+		}
 
-	tx, err := store.Begin()
-	if err != nil {
-		return err, nil
+		ignoreCase = !settings.CaseSensitive()
 	}
-	defer tx.Commit()
 
 	queryText := strings.Join(args, " ")
-	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, sort)
+	if options.HasOption("--query-file") {
+		if len(args) > 0 {
+			return fmt.Errorf("cannot specify a query argument with --query-file"), nil
+		}
+
+		var err error
+		queryText, err = readQueryFile(options.Get("--query-file").Argument)
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, countImplied, ignoreCase, explain, tree, sort, reverse, format, style, limit, offset, linkDir, preserveTree)
 }
 
 // unexported
 
-func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase bool, sort string) (error, warnings) {
-	log.Info(2, "parsing query")
+func uintOption(options Options, name string) (uint, error) {
+	if !options.HasOption(name) {
+		return 0, nil
+	}
+
+	argument := options.Get(name).Argument
+	number, err := strconv.ParseUint(argument, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument '%v' for '%v': must be a non-negative integer", argument, name)
+	}
+
+	return uint(number), nil
+}
+
+func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly, countImplied, ignoreCase, explain, tree bool, sort string, reverse bool, format string, style pathStyle, limit, offset uint, linkDir string, preserveTree bool) (error, warnings) {
+	log.Info("parsing query")
 
 	expression, err := query.Parse(queryText)
 	if err != nil {
 		return fmt.Errorf("could not parse query: %v", err), nil
 	}
 
-	log.Info(2, "checking tag names")
+	if countImplied {
+		expression = query.CountImpliedTags(expression)
+	}
+
+	log.Info("checking tag names")
 
 	warnings := make(warnings, 0, 10)
 
@@ -123,13 +329,22 @@ func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path s
 	}
 
 	tags, err := store.TagsByCasedNames(tx, tagNames, ignoreCase)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err), nil
+	}
+
+	aliases, err := store.AliasesByNames(tx, tagNames, ignoreCase)
+	if err != nil {
+		return fmt.Errorf("could not retrieve aliases: %v", err), nil
+	}
+
 	for _, tagName := range tagNames {
 		if err := entities.ValidateTagName(tagName); err != nil {
 			warnings = append(warnings, err.Error())
 			continue
 		}
 
-		if !tags.ContainsCasedName(tagName, ignoreCase) {
+		if !tags.ContainsCasedName(tagName, ignoreCase) && !aliases.ContainsCasedName(tagName, ignoreCase) {
 			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
 			continue
 		}
@@ -153,26 +368,126 @@ func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path s
 		}
 	}
 
-	log.Info(2, "querying database")
+	log.Info("querying database")
+
+	// values are sorted after the query, by path within each value
+	sortTagName := ""
+	querySort, queryReverse := sort, reverse
+	if strings.HasPrefix(sort, "value:") {
+		sortTagName = parseTagOrValueName(sort[len("value:"):])
+		querySort, queryReverse = "path", false
+	}
+
+	// the count is of all matches and the directory and file filters and the
+	// value sort are applied after the query, so only otherwise can the
+	// database page
+	inMemory := dirOnly || fileOnly || sortTagName != ""
+	queryLimit, queryOffset := limit, offset
+	if showCount || inMemory {
+		queryLimit, queryOffset = 0, 0
+	}
+
+	batch, err := tmsu.NewBatch(store, tx)
+	if err != nil {
+		return err, warnings
+	}
 
-	files, err := store.FilesForQuery(tx, expression, path, explicitOnly, ignoreCase, sort)
+	files, err := batch.Files(expression, path, explicitOnly, ignoreCase, querySort, queryReverse, queryLimit, queryOffset)
 	if err != nil {
-		if strings.Index(err.Error(), "parser stack overflow") > -1 {
-			return fmt.Errorf("the query is too complex (see the troubleshooting wiki for how to increase the stack size)"), warnings
+		return err, warnings
+	}
+
+	if sortTagName != "" {
+		if err := sortFilesByValue(store, tx, files, sortTagName, reverse, ignoreCase); err != nil {
+			return err, warnings
 		}
+	}
+
+	if !showCount && inMemory {
+		files = pageFiles(filterFiles(files, dirOnly, fileOnly), limit, offset)
+	}
 
-		return fmt.Errorf("could not query files: %v", err), warnings
+	if explain {
+		return explainFiles(store, tx, expression, files, dirOnly, fileOnly, explicitOnly, ignoreCase, style), warnings
 	}
 
-	if err = listFiles(tx, files, dirOnly, fileOnly, print0, showCount); err != nil {
+	if tree {
+		return listFileTree(filterFiles(files, dirOnly, fileOnly), showCount, style), warnings
+	}
+
+	if linkDir != "" {
+		err, linkWarnings := linkFiles(store, filterFiles(files, dirOnly, fileOnly), linkDir, preserveTree)
+		return err, append(warnings, linkWarnings...)
+	}
+
+	if err = listFiles(store, tx, files, dirOnly, fileOnly, print0, showCount, format, style); err != nil {
 		return err, warnings
 	}
 
 	return nil, warnings
 }
 
-func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool) error {
-	relPaths := make([]string, 0, len(files))
+// Sorts the files by their values for the tag, including implied values, such
+// that numbers are compared numerically. Files without a value for the tag are
+// listed last, whether or not the order is reversed.
+func sortFilesByValue(store *storage.Storage, tx *storage.Tx, files entities.Files, tagName string, reverse, ignoreCase bool) error {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}
+	}
+
+	fileTags, err := store.FileTagsByTagId(tx, tag.Id, false)
+	if err != nil {
+		return fmt.Errorf("could not retrieve taggings for tag '%v': %v", tagName, err)
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		valueNames[value.Id] = value.Name
+	}
+
+	// a file with several values for the tag is sorted by the lowest
+	fileValueNames := make(map[entities.FileId]string, len(fileTags))
+	for _, fileTag := range fileTags {
+		valueName, ok := valueNames[fileTag.ValueId]
+		if !ok {
+			continue
+		}
+
+		if existing, seen := fileValueNames[fileTag.FileId]; !seen || query.CompareValueNames(valueName, "<", existing, ignoreCase) {
+			fileValueNames[fileTag.FileId] = valueName
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		valueName, ok := fileValueNames[files[i].Id]
+		otherValueName, otherOk := fileValueNames[files[j].Id]
+
+		switch {
+		case !ok:
+			return false
+		case !otherOk:
+			return true
+		case reverse:
+			return query.CompareValueNames(valueName, ">", otherValueName, ignoreCase)
+		default:
+			return query.CompareValueNames(valueName, "<", otherValueName, ignoreCase)
+		}
+	})
+
+	return nil
+}
+
+func filterFiles(files entities.Files, dirOnly, fileOnly bool) entities.Files {
+	matches := make(entities.Files, 0, len(files))
 	for _, file := range files {
 		if fileOnly && file.IsDir {
 			continue
@@ -181,13 +496,41 @@ func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0,
 			continue
 		}
 
-		absPath := file.Path()
-		relPath := path.Rel(absPath)
+		matches = append(matches, file)
+	}
 
-		relPaths = append(relPaths, relPath)
+	return matches
+}
+
+func pageFiles(files entities.Files, limit, offset uint) entities.Files {
+	if offset >= uint(len(files)) {
+		return entities.Files{}
 	}
+	files = files[offset:]
 
-	if showCount {
+	if limit != 0 && limit < uint(len(files)) {
+		files = files[:limit]
+	}
+
+	return files
+}
+
+func listFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool, format string, style pathStyle) error {
+	matches := filterFiles(files, dirOnly, fileOnly)
+	relPaths := make([]string, 0, len(matches))
+	for _, file := range matches {
+		relPaths = append(relPaths, style.format(file.Path()))
+	}
+
+	if format == "json" {
+		if err := listFilesAsJson(store, tx, matches, relPaths, showCount); err != nil {
+			return err
+		}
+	} else if format == "csv" {
+		if err := listFilesAsCsv(store, tx, matches, relPaths, showCount); err != nil {
+			return err
+		}
+	} else if showCount {
 		fmt.Println(len(relPaths))
 	} else {
 		for _, relPath := range relPaths {
@@ -199,9 +542,400 @@ func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0,
 		}
 	}
 
+	if len(matches) == 0 {
+		return NoMatchesError{}
+	}
+
+	return nil
+}
+
+// A directory, or file, within the tree of matching files. Count is the number of
+// matching files beneath it.
+type fileTreeNode struct {
+	children map[string]*fileTreeNode
+	matched  bool
+	count    int
+}
+
+func newFileTreeNode() *fileTreeNode {
+	return &fileTreeNode{make(map[string]*fileTreeNode), false, 0}
+}
+
+func listFileTree(files entities.Files, showCount bool, style pathStyle) error {
+	root := newFileTreeNode()
+	for _, file := range files {
+		node := root
+		for _, name := range strings.Split(style.relative(file.Path()), string(filepath.Separator)) {
+			node.count++
+
+			child, ok := node.children[name]
+			if !ok {
+				child = newFileTreeNode()
+				node.children[name] = child
+			}
+
+			node = child
+		}
+
+		node.matched = true
+	}
+
+	root.print(0, showCount)
+
+	if len(files) == 0 {
+		return NoMatchesError{}
+	}
+
+	return nil
+}
+
+func (node *fileTreeNode) print(depth int, showCount bool) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indent := strings.Repeat("  ", depth)
+
+	for _, name := range names {
+		child := node.children[name]
+		label := name
+
+		// a chain of directories without matches of their own is shown as one
+		for !child.matched && len(child.children) == 1 {
+			onlyName, only := child.onlyChild()
+			if len(only.children) == 0 {
+				break
+			}
+
+			label += string(filepath.Separator) + onlyName
+			child = only
+		}
+
+		switch {
+		case len(child.children) == 0:
+			if !showCount {
+				fmt.Printf("%v%v\n", indent, label)
+			}
+		case showCount:
+			fmt.Printf("%v%v%v: %v\n", indent, label, string(filepath.Separator), child.count)
+		default:
+			fmt.Printf("%v%v%v\n", indent, label, string(filepath.Separator))
+		}
+
+		child.print(depth+1, showCount)
+	}
+}
+
+func (node *fileTreeNode) onlyChild() (string, *fileTreeNode) {
+	for name, child := range node.children {
+		return name, child
+	}
+
+	return "", nil
+}
+
+// Creates a symbolic link to each of the files within the directory, either
+// directly within it or at the file's path beneath it.
+func linkFiles(store *storage.Storage, files entities.Files, linkDir string, preserveTree bool) (error, warnings) {
+	absLinkDir, err := filepath.Abs(linkDir)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", linkDir, err), nil
+	}
+
+	if err := os.MkdirAll(absLinkDir, 0755); err != nil {
+		return fmt.Errorf("%v: could not create directory: %v", linkDir, err), nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	created := 0
+	used := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		var linkPath string
+		if preserveTree {
+			linkPath = filepath.Join(absLinkDir, treeLinkPath(file.Path(), store.RootPath))
+		} else {
+			linkPath = flatLinkPath(absLinkDir, file.Name, file.Path(), used)
+		}
+
+		if target, err := os.Readlink(linkPath); err == nil && target == file.Path() {
+			log.Infof("%v: already linked", linkPath)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: could not create directory: %v", filepath.Dir(linkPath), err))
+			continue
+		}
+
+		if err := os.Symlink(file.Path(), linkPath); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: could not create link: %v", linkPath, err))
+			continue
+		}
+
+		log.Infof("%v: linked to %v", linkPath, file.Path())
+		created++
+	}
+
+	fmt.Printf("created %v link(s) in %v\n", created, linkDir)
+	if len(warnings) > 0 {
+		fmt.Printf("%v link(s) could not be created\n", len(warnings))
+	}
+
+	return nil, warnings
+}
+
+// The path, relative to the link directory, of the link to the file: the path
+// of the file relative to the root, if it is beneath it, or else its absolute
+// path.
+func treeLinkPath(path, root string) string {
+	prefix := root + string(filepath.Separator)
+	if strings.HasPrefix(path, prefix) {
+		return path[len(prefix):]
+	}
+
+	return strings.TrimPrefix(path, string(filepath.Separator))
+}
+
+// The path of the link to a file with the specified name directly within the
+// link directory. A numeric suffix is added before the extension of names that
+// have already been used or that exist and do not link to the target.
+func flatLinkPath(linkDir, name, target string, used map[string]bool) string {
+	extension := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, extension)
+
+	linkName := name
+	for suffix := 1; used[linkName] || occupied(filepath.Join(linkDir, linkName), target); suffix++ {
+		linkName = fmt.Sprintf("%v.%v%v", stem, suffix, extension)
+	}
+
+	used[linkName] = true
+
+	return filepath.Join(linkDir, linkName)
+}
+
+// Whether something other than a link to the target exists at the path.
+func occupied(path, target string) bool {
+	if _, err := os.Lstat(path); err != nil {
+		return false
+	}
+
+	existing, err := os.Readlink(path)
+	return err != nil || existing != target
+}
+
+func explainFiles(store *storage.Storage, tx *storage.Tx, expression query.Expression, files entities.Files, dirOnly, fileOnly, explicitOnly, ignoreCase bool, style pathStyle) error {
+	terms, err := query.PositiveTerms(expression)
+	if err != nil {
+		return fmt.Errorf("could not identify query terms: %v", err)
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	tagNames := make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		valueNames[value.Id] = value.Name
+	}
+
+	aliases, err := store.Aliases(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve aliases: %v", err)
+	}
+
+	explained := 0
+	for _, file := range files {
+		if fileOnly && file.IsDir {
+			continue
+		}
+		if dirOnly && !file.IsDir {
+			continue
+		}
+
+		log.Infof("%v: explaining match", file.Path())
+
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, explicitOnly)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file-tags: %v", file.Path(), err)
+		}
+
+		implyingNames := make(map[entities.TagIdValueIdPair][]string)
+		for _, fileTag := range fileTags {
+			if !fileTag.Explicit {
+				continue
+			}
+
+			implications, err := store.ImplicationsFor(tx, fileTag.ToTagIdValueIdPair())
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve implications: %v", file.Path(), err)
+			}
+
+			implyingName := formatTagValueName(tagNames[fileTag.TagId], valueNames[fileTag.ValueId], false, false, false)
+			for _, implication := range implications {
+				impliedPair := implication.ImpliedTagValuePair()
+				if !containsTagName(implyingNames[impliedPair], implyingName) {
+					implyingNames[impliedPair] = append(implyingNames[impliedPair], implyingName)
+				}
+			}
+		}
+
+		reasons := make([]string, 0, len(terms))
+		for _, fileTag := range fileTags {
+			tagName := tagNames[fileTag.TagId]
+			valueName := valueNames[fileTag.ValueId]
+
+			// the query may name the tag by one of its aliases
+			matched := false
+			for _, name := range append([]string{tagName}, aliases.NamesForTag(fileTag.TagId)...) {
+				if matchesAnyTerm(terms, name, valueName, ignoreCase) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+
+			reason := formatTagValueName(tagName, valueName, false, false, false)
+			if !fileTag.Explicit {
+				reason += " (implied by " + strings.Join(implyingNames[fileTag.ToTagIdValueIdPair()], ", ") + ")"
+			}
+
+			reasons = append(reasons, reason)
+		}
+
+		sort.Strings(reasons)
+
+		fmt.Printf("%v: %v\n", style.format(file.Path()), strings.Join(reasons, ", "))
+		explained++
+	}
+
+	if explained == 0 {
+		return NoMatchesError{}
+	}
+
 	return nil
 }
 
+func matchesAnyTerm(terms []query.Expression, tagName, valueName string, ignoreCase bool) bool {
+	for _, term := range terms {
+		switch exp := term.(type) {
+		case query.TagExpression:
+			if namesEqual(exp.Name, tagName, ignoreCase) {
+				return true
+			}
+		case query.GlobExpression:
+			if exp.Matches(tagName, ignoreCase) {
+				return true
+			}
+		case query.ComparisonExpression:
+			if valueName != "" && namesEqual(exp.Tag.Name, tagName, ignoreCase) && query.CompareValueNames(valueName, exp.Operator, exp.Value.Name, ignoreCase) {
+				return true
+			}
+		case query.AnyValueExpression:
+			if valueName != "" && namesEqual(exp.Tag.Name, tagName, ignoreCase) {
+				return true
+			}
+		case query.NearExpression:
+			if valueName != "" && namesEqual(exp.Tag.Name, tagName, ignoreCase) && exp.Matches(valueName) {
+				return true
+			}
+		case query.RegexExpression:
+			if valueName != "" && namesEqual(exp.Tag.Name, tagName, ignoreCase) && exp.Matches(valueName, ignoreCase) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func namesEqual(a, b string, ignoreCase bool) bool {
+	if ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+func readQueryFile(path string) (string, error) {
+	lines, err := readCommentedLines(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, " "), nil
+}
+
+type fileJson struct {
+	Path        string    `json:"path"`
+	Fingerprint string    `json:"fingerprint"`
+	ModTime     time.Time `json:"modTime"`
+	Tags        []string  `json:"tags"`
+}
+
+func listFilesAsJson(store *storage.Storage, tx *storage.Tx, files entities.Files, relPaths []string, showCount bool) error {
+	var output interface{}
+
+	if showCount {
+		output = map[string]int{"count": len(files)}
+	} else {
+		items := make([]fileJson, len(files))
+		for index, file := range files {
+			tagNames, err := tagNamesForFile(store, tx, file.Id, false, false)
+			if err != nil {
+				return err
+			}
+
+			items[index] = fileJson{relPaths[index], string(file.Fingerprint), file.ModTime, tagNames}
+		}
+
+		output = items
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Errorf("could not encode output as JSON: %v", err)
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
+
+func listFilesAsCsv(store *storage.Storage, tx *storage.Tx, files entities.Files, relPaths []string, showCount bool) error {
+	if showCount {
+		return printCsv([][]string{{"count"}, {strconv.Itoa(len(files))}})
+	}
+
+	records := make([][]string, 0, len(files)+1)
+	records = append(records, []string{"path", "fingerprint", "tags"})
+	for index, file := range files {
+		tagNames, err := tagNamesForFile(store, tx, file.Id, false, false)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, []string{relPaths[index], string(file.Fingerprint), strings.Join(tagNames, ";")})
+	}
+
+	return printCsv(records)
+}
+
 func containsTag(tags []string, tag string) bool {
 	for _, iteratedTag := range tags {
 		if iteratedTag == tag {
@@ -88,7 +88,7 @@ func summary(colour bool) {
 	}
 
 	for _, command := range helpCommands {
-		if command.Hidden && log.Verbosity < 2 {
+		if command.Hidden && !log.Enabled(log.InfoLevel) {
 			continue
 		}
 
@@ -125,7 +125,7 @@ func listCommands() {
 	commandNames := make([]string, 0, len(helpCommands))
 
 	for _, command := range helpCommands {
-		if command.Hidden && log.Verbosity < 2 {
+		if command.Hidden && !log.Enabled(log.InfoLevel) {
 			continue
 		}
 
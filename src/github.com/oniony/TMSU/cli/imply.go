@@ -27,7 +27,8 @@ var ImplyCommand = Command{
 	Name:     "imply",
 	Synopsis: "Creates a tag implication",
 	Usages: []string{"tmsu imply [OPTION] TAG[=VALUE] IMPL[=VALUE]...",
-		"tmsu imply"},
+		"tmsu imply",
+		"tmsu imply --tree"},
 	Description: `Creates a tag implication such that any file tagged TAG will be implicitly tagged IMPL.
 
 When run without arguments lists the set of tag implications.
@@ -36,14 +37,30 @@ Tag implications are applied at time of file query (not at time of tag applicati
 
 By default the 'tag' subcommand will not explicitly apply tags that are already implied by the implication rules.
 
-The 'tags' subcommand can be used to identify which tags applied to a file are implied.`,
+The 'tags' subcommand can be used to identify which tags applied to a file are implied.
+
+With --inherit-value the implied tags take the value of the implying tag, such that a file tagged TAG=VALUE is implicitly tagged IMPL=VALUE. Values cannot then be specified for either tag.
+
+An implication that would create a cycle, such that a tag ultimately implies itself, is refused unless --force is specified.
+
+With --tree the implications are listed as an indented tree starting from each tag that is not itself implied, such that the full chain of implications for each tag can be seen. Any implication cycles are reported.`,
 	Examples: []string{`$ tmsu imply mp3 music`,
 		`$ tmsu imply
 mp3 -> music`,
 		`$ tmsu imply aubergine aka=eggplant`,
-		`$ tmsu imply --delete mp3 music`},
-	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""}},
-	Exec:    implyExec,
+		`$ tmsu imply --inherit-value camera source
+$ tmsu imply
+camera -> source (inherits value)`,
+		`$ tmsu imply --delete mp3 music`,
+		`$ tmsu imply --tree
+mp3
+  music
+    art`},
+	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""},
+		Option{"--tree", "-t", "lists the implications as a tree", false, ""},
+		Option{"--force", "-f", "creates the implication even if it would create a cycle", false, ""},
+		Option{"--inherit-value", "", "the implied tags take the value of the implying tag", false, ""}},
+	Exec: implyExec,
 }
 
 // unexported
@@ -61,6 +78,12 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer tx.Commit()
 
+	return implyInTx(store, tx, options, args)
+}
+
+// Lists, adds or deletes the implications specified by the options and
+// arguments within an existing transaction.
+func implyInTx(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
 	colour, err := useColour(options)
 	if err != nil {
 		return err, nil
@@ -74,18 +97,33 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 		return deleteImplications(store, tx, args)
 	}
 
+	if options.HasOption("--tree") {
+		if options.HasOption("--inherit-value") {
+			return fmt.Errorf("the --inherit-value option cannot be used with --tree"), nil
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		return listImplicationTree(store, tx, colour)
+	}
+
 	switch len(args) {
 	case 0:
+		if options.HasOption("--inherit-value") {
+			return fmt.Errorf("tags must be specified"), nil
+		}
+
 		return listImplications(store, tx, colour), nil
 	case 1:
 		return fmt.Errorf("tag(s) to be implied must be specified"), nil
 	default:
-		return addImplications(store, tx, args)
+		return addImplications(store, tx, args, options.HasOption("--inherit-value"), options.HasOption("--force"))
 	}
 }
 
 func listImplications(store *storage.Storage, tx *storage.Tx, colour bool) error {
-	log.Infof(2, "retrieving tag implications.")
+	log.Infof("retrieving tag implications.")
 
 	implications, err := store.Implications(tx)
 	if err != nil {
@@ -115,15 +153,133 @@ func listImplications(store *storage.Storage, tx *storage.Tx, colour bool) error
 			implying := formatTagValueName(implication.ImplyingTag.Name, implication.ImplyingValue.Name, colour, false, true)
 			implied := formatTagValueName(implication.ImpliedTag.Name, implication.ImpliedValue.Name, colour, true, false)
 
-			fmt.Printf("%s%s -> %s\n", padding, implying, implied)
+			fmt.Printf("%s%s -> %s%s\n", padding, implying, implied, inheritsValueSuffix(*implication))
 		}
 	}
 
 	return nil
 }
 
-func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
-	log.Infof(2, "loading settings")
+func listImplicationTree(store *storage.Storage, tx *storage.Tx, colour bool) (error, warnings) {
+	log.Infof("retrieving tag implications.")
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve implications: %v", err), nil
+	}
+
+	tree := implicationTree{make(map[entities.TagIdValueIdPair]implicationTreeNode),
+		make(map[entities.TagIdValueIdPair][]implicationTreeChild),
+		make(map[entities.TagIdValueIdPair]bool),
+		colour,
+		make(warnings, 0, 10)}
+
+	implying := make([]entities.TagIdValueIdPair, 0, len(implications))
+	implied := make(map[entities.TagIdValueIdPair]bool, len(implications))
+	for _, implication := range implications {
+		pair := implication.ImplyingTagValuePair()
+		impliedPair := implication.ImpliedTagValuePair()
+
+		tree.nodes[pair] = implicationTreeNode{implication.ImplyingTag.Name, implication.ImplyingValue.Name}
+		tree.nodes[impliedPair] = implicationTreeNode{implication.ImpliedTag.Name, implication.ImpliedValue.Name}
+
+		if _, ok := tree.children[pair]; !ok {
+			implying = append(implying, pair)
+		}
+		tree.children[pair] = append(tree.children[pair], implicationTreeChild{impliedPair, inheritsValueSuffix(*implication)})
+		implied[impliedPair] = true
+	}
+
+	for _, pair := range implying {
+		if !implied[pair] {
+			tree.print(pair, nil, "")
+		}
+	}
+
+	// tags that are only reachable via a cycle have no root
+	for _, pair := range implying {
+		if !tree.visited[pair] {
+			tree.print(pair, nil, "")
+		}
+	}
+
+	return nil, tree.warnings
+}
+
+type implicationTreeNode struct {
+	tagName   string
+	valueName string
+}
+
+type implicationTreeChild struct {
+	pair   entities.TagIdValueIdPair
+	suffix string
+}
+
+type implicationTree struct {
+	nodes    map[entities.TagIdValueIdPair]implicationTreeNode
+	children map[entities.TagIdValueIdPair][]implicationTreeChild
+	visited  map[entities.TagIdValueIdPair]bool
+	colour   bool
+	warnings warnings
+}
+
+func (tree *implicationTree) print(pair entities.TagIdValueIdPair, path []entities.TagIdValueIdPair, suffix string) {
+	tree.visited[pair] = true
+
+	indent := strings.Repeat("  ", len(path))
+	node := tree.nodes[pair]
+	name := formatTagValueName(node.tagName, node.valueName, tree.colour, len(path) > 0, len(path) == 0)
+
+	for index, ancestor := range path {
+		if ancestor == pair {
+			cycle := make([]string, 0, len(path)-index+1)
+			for _, cyclePair := range path[index:] {
+				cycle = append(cycle, tree.name(cyclePair))
+			}
+			cycle = append(cycle, tree.name(pair))
+
+			fmt.Printf("%s%s%s (cycle)\n", indent, name, suffix)
+			tree.warnings = append(tree.warnings, fmt.Sprintf("implication cycle: %v", strings.Join(cycle, " -> ")))
+			return
+		}
+	}
+
+	fmt.Printf("%s%s%s\n", indent, name, suffix)
+
+	path = append(path, pair)
+	for _, child := range tree.children[pair] {
+		tree.print(child.pair, path, child.suffix)
+	}
+}
+
+func (tree *implicationTree) name(pair entities.TagIdValueIdPair) string {
+	node := tree.nodes[pair]
+	return formatTagValueName(node.tagName, node.valueName, false, false, false)
+}
+
+func inheritsValueSuffix(implication entities.Implication) string {
+	if implication.InheritsValue {
+		return " (inherits value)"
+	}
+
+	return ""
+}
+
+func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string, inheritsValue, force bool) (error, warnings) {
+	if err := checkWritable("add implication"); err != nil {
+		return err, nil
+	}
+
+	if inheritsValue {
+		for _, tagArg := range tagArgs {
+			if _, valueName := parseTagEqValueName(tagArg); valueName != "" {
+				return fmt.Errorf("%v: a value cannot be specified with --inherit-value", tagArg), nil
+			}
+		}
+	}
+
+	log.Infof("loading settings")
 
 	settings, err := store.Settings(tx)
 	if err != nil {
@@ -201,9 +357,9 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 			}
 		}
 
-		log.Infof(2, "adding tag implication of '%v' to '%v'", implyingTagArg, impliedTagArg)
+		log.Infof("adding tag implication of '%v' to '%v'", implyingTagArg, impliedTagArg)
 
-		if err = store.AddImplication(tx, entities.TagIdValueIdPair{implyingTag.Id, implyingValue.Id}, entities.TagIdValueIdPair{impliedTag.Id, impliedValue.Id}); err != nil {
+		if err = store.AddImplication(tx, entities.TagIdValueIdPair{implyingTag.Id, implyingValue.Id}, entities.TagIdValueIdPair{impliedTag.Id, impliedValue.Id}, inheritsValue, force); err != nil {
 			return fmt.Errorf("cannot add implication of '%v' to '%v': %v", implyingTagArg, impliedTagArg, err), warnings
 		}
 	}
@@ -212,7 +368,11 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 }
 
 func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
-	log.Infof(2, "loading settings")
+	if err := checkWritable("delete implication"); err != nil {
+		return err, nil
+	}
+
+	log.Infof("loading settings")
 
 	implyingTagArg := tagArgs[0]
 	impliedTagArgs := tagArgs[1:]
@@ -237,7 +397,7 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string
 
 	warnings := make(warnings, 0, 10)
 	for _, impliedTagArg := range impliedTagArgs {
-		log.Infof(2, "removing tag implication %v -> %v.", implyingTagArg, impliedTagArg)
+		log.Infof("removing tag implication %v -> %v.", implyingTagArg, impliedTagArg)
 
 		impliedTagName, impliedValueName := parseTagEqValueName(impliedTagArg)
 
@@ -0,0 +1,323 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ImportCommand = Command{
+	Name:     "import",
+	Synopsis: "Import a document produced by export",
+	Usages:   []string{"tmsu import [OPTION]... [FILE]"},
+	Description: `Reads a document produced by the 'export' subcommand from FILE, or from standard input if FILE is '-' or not specified, and recreates its tags, values, implications and taggings in the database.
+
+By default files are relinked by path: each file's path in the document is resolved against ROOT, which defaults to the root recorded in the document. Files not already in the database are added with the details recorded in the document.
+
+With --relink-by-fingerprint the taggings are instead applied to the files already in the database that have the same fingerprint, regardless of path. Files with no match are relinked by path.
+
+Taggings are merged with any already present in the database: existing taggings are never removed.`,
+	Examples: []string{"$ tmsu import backup.json",
+		"$ tmsu import --root=/home/fred backup.json",
+		"$ tmsu import --relink-by-fingerprint <backup.json"},
+	Options: Options{{"--root", "-r", "resolve paths relative to ROOT", true, ""},
+		{"--relink-by-path", "", "relink files by path (default)", false, ""},
+		{"--relink-by-fingerprint", "", "relink files by fingerprint", false, ""}},
+	Exec:     importExec,
+	Modifies: true,
+}
+
+// unexported
+
+type importer struct {
+	store           *storage.Storage
+	tx              *storage.Tx
+	root            string
+	byFingerprint   bool
+	tags            map[string]*entities.Tag
+	values          map[string]*entities.Value
+	filesAdded      uint
+	tagsAdded       uint
+	taggingsCreated uint
+	warnings        warnings
+}
+
+func importExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+	if options.HasOption("--relink-by-path") && options.HasOption("--relink-by-fingerprint") {
+		return fmt.Errorf("the --relink-by-path and --relink-by-fingerprint options are mutually exclusive"), nil
+	}
+
+	path := "-"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	document, err := readExportDocument(path)
+	if err != nil {
+		return err, nil
+	}
+
+	root := document.Root
+	if options.HasOption("--root") {
+		root, err = filepath.Abs(options.Get("--root").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", options.Get("--root").Argument, err), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	importer := importer{store,
+		tx,
+		root,
+		options.HasOption("--relink-by-fingerprint"),
+		make(map[string]*entities.Tag, len(document.Tags)),
+		make(map[string]*entities.Value, len(document.Values)),
+		0,
+		0,
+		0,
+		make(warnings, 0, 10)}
+
+	if err := importer.importDocument(document); err != nil {
+		return err, importer.warnings
+	}
+
+	fmt.Printf("%v files added, %v tags added, %v taggings created\n", importer.filesAdded, importer.tagsAdded, importer.taggingsCreated)
+
+	return nil, importer.warnings
+}
+
+func readExportDocument(path string) (*exportDocument, error) {
+	var reader io.Reader
+	if path == "-" {
+		log.Info("reading document from standard input")
+
+		reader = os.Stdin
+	} else {
+		log.Infof("%v: reading document", path)
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not open file: %v", path, err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	var document exportDocument
+	if err := json.NewDecoder(reader).Decode(&document); err != nil {
+		return nil, fmt.Errorf("could not parse document: %v", err)
+	}
+
+	if document.Format != exportFormat {
+		return nil, fmt.Errorf("not a TMSU export document")
+	}
+	if document.Version > exportVersion {
+		return nil, fmt.Errorf("unsupported export document version %v", document.Version)
+	}
+
+	return &document, nil
+}
+
+func (importer *importer) importDocument(document *exportDocument) error {
+	log.Info("importing tags")
+
+	for _, tagName := range document.Tags {
+		if _, err := importer.tag(tagName); err != nil {
+			return err
+		}
+	}
+
+	log.Info("importing values")
+
+	for _, valueName := range document.Values {
+		if _, err := importer.value(valueName); err != nil {
+			return err
+		}
+	}
+
+	log.Info("importing implications")
+
+	for _, implication := range document.Implications {
+		pair, err := importer.pair(implication.Tag, implication.Value)
+		if err != nil {
+			return err
+		}
+
+		impliedPair, err := importer.pair(implication.ImpliedTag, implication.ImpliedValue)
+		if err != nil {
+			return err
+		}
+
+		if err := importer.store.AddImplication(importer.tx, pair, impliedPair, implication.InheritsValue, false); err != nil {
+			importer.warnings = append(importer.warnings, fmt.Sprintf("could not add implication of '%v' by '%v': %v",
+				formatTagValueName(implication.ImpliedTag, implication.ImpliedValue, false, false, false),
+				formatTagValueName(implication.Tag, implication.Value, false, false, false),
+				err))
+		}
+	}
+
+	log.Info("importing files")
+
+	for _, file := range document.Files {
+		if err := importer.importFile(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (importer *importer) importFile(exportedFile exportFile) error {
+	files := make(entities.Files, 0, 1)
+
+	if importer.byFingerprint && exportedFile.Fingerprint != "" {
+		log.Infof("%v: relinking by fingerprint", exportedFile.Path)
+
+		matches, err := importer.store.FilesByFingerprint(importer.tx, fingerprint.Fingerprint(exportedFile.Fingerprint))
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve files by fingerprint: %v", exportedFile.Path, err)
+		}
+
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		absPath := filepath.Join(importer.root, exportedFile.Path)
+
+		log.Infof("%v: relinking by path", absPath)
+
+		file, err := importer.store.FileByPath(importer.tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", absPath, err)
+		}
+		if file == nil {
+			file, err = importer.store.AddFile(importer.tx, absPath, fingerprint.Fingerprint(exportedFile.Fingerprint), exportedFile.ModTime, exportedFile.Size, exportedFile.IsDir)
+			if err != nil {
+				return fmt.Errorf("%v: could not add file to database: %v", absPath, err)
+			}
+
+			importer.filesAdded++
+		}
+
+		files = append(files, file)
+	}
+
+	for _, tagging := range exportedFile.Tags {
+		pair, err := importer.pair(tagging.Tag, tagging.Value)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			exists, err := importer.store.FileTagExists(importer.tx, file.Id, pair.TagId, pair.ValueId, true)
+			if err != nil {
+				return fmt.Errorf("%v: could not check tagging: %v", file.Path(), err)
+			}
+			if exists {
+				continue
+			}
+
+			if _, err := importer.store.AddFileTag(importer.tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+				return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+			}
+
+			importer.taggingsCreated++
+		}
+	}
+
+	return nil
+}
+
+func (importer *importer) pair(tagName, valueName string) (entities.TagIdValueIdPair, error) {
+	tag, err := importer.tag(tagName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+
+	value, err := importer.value(valueName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+
+	return entities.TagIdValueIdPair{tag.Id, value.Id}, nil
+}
+
+func (importer *importer) tag(name string) (*entities.Tag, error) {
+	if tag, ok := importer.tags[name]; ok {
+		return tag, nil
+	}
+
+	tag, err := importer.store.TagByName(importer.tx, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag '%v': %v", name, err)
+	}
+	if tag == nil {
+		tag, err = importer.store.AddTag(importer.tx, name)
+		if err != nil {
+			return nil, fmt.Errorf("could not create tag '%v': %v", name, err)
+		}
+
+		importer.tagsAdded++
+	}
+
+	importer.tags[name] = tag
+
+	return tag, nil
+}
+
+func (importer *importer) value(name string) (*entities.Value, error) {
+	if value, ok := importer.values[name]; ok {
+		return value, nil
+	}
+
+	value, err := importer.store.ValueByName(importer.tx, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve value '%v': %v", name, err)
+	}
+	if value == nil {
+		value, err = importer.store.AddValue(importer.tx, name)
+		if err != nil {
+			return nil, fmt.Errorf("could not create value '%v': %v", name, err)
+		}
+	}
+
+	importer.values[name] = value
+
+	return value, nil
+}
@@ -16,28 +16,65 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/common/terminal/ansi"
 	"github.com/oniony/TMSU/storage"
 	"math"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 var InfoCommand = Command{
-	Name:        "info",
-	Synopsis:    "Show database information",
-	Usages:      []string{"tmsu info"},
-	Description: "Shows the database information.",
+	Name:     "info",
+	Synopsis: "Show database information",
+	Usages: []string{"tmsu info [OPTION]...",
+		"tmsu info [OPTION]... --by-dir [DIR]"},
+	Description: `Shows the database information.
+
+With --by-dir the files beneath DIR, which defaults to the root path, are grouped by their leading directories and the number of files in each group that are tagged is shown against the total, with the percentage of coverage. By default files are grouped by the directories immediately beneath DIR: use --depth to group them by directories further down. Files directly within DIR are grouped under '.'. Hidden files and directories are skipped. This highlights the parts of a collection that have yet to be tagged.
+
+With --format=json the statistics are instead written as a JSON document, for consumption by other programs, comprising the number of files, tags, values and taggings, the mean tags per file and files per tag, and the most used tags, of which there are at most --top.
+
+The document has a 'version' property that will be incremented should any existing property change meaning. New properties may be added without the version changing.`,
+	Examples: []string{"$ tmsu info --stats",
+		"$ tmsu stats --format=json --top=5",
+		"$ tmsu stats --by-dir --depth=2 ~/photos"},
 	Options: Options{
 		Option{"--stats", "-s", "show statistics", false, ""},
-		Option{"--usage", "-u", "show tag usage breakdown", false, ""}},
+		Option{"--usage", "-u", "show tag usage breakdown", false, ""},
+		Option{"--format", "", "output FORMAT: 'text' (default) or 'json'", true, ""},
+		Option{"--top", "", "list the TOP most used tags in the JSON document (default: 10)", true, ""},
+		Option{"--by-dir", "", "show tag coverage by directory", false, ""},
+		Option{"--depth", "", "group files by directories DEPTH levels beneath DIR (default: 1)", true, ""}},
 	Exec:    infoExec,
 	Aliases: []string{"stats"},
 }
 
 // unexported
 
+const statsVersion = 1
+
+type statsDocument struct {
+	Version         int        `json:"version"`
+	Files           uint       `json:"files"`
+	Tags            uint       `json:"tags"`
+	Values          uint       `json:"values"`
+	Taggings        uint       `json:"taggings"`
+	MeanTagsPerFile float64    `json:"meanTagsPerFile"`
+	MeanFilesPerTag float64    `json:"meanFilesPerTag"`
+	TopTags         []statsTag `json:"topTags"`
+}
+
+type statsTag struct {
+	Name  string `json:"name"`
+	Files uint   `json:"files"`
+}
+
 func infoExec(options Options, args []string, databasePath string) (error, warnings) {
 	stats := options.HasOption("--stats")
 	usage := options.HasOption("--usage")
@@ -46,6 +83,54 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 		return err, nil
 	}
 
+	asJson := false
+	if options.HasOption("--format") {
+		switch format := options.Get("--format").Argument; format {
+		case "text":
+		case "json":
+			asJson = true
+		default:
+			return fmt.Errorf("invalid format '%v': must be one of text, json", format), nil
+		}
+	}
+
+	top := 10
+	if options.HasOption("--top") {
+		argument := options.Get("--top").Argument
+
+		top, err = strconv.Atoi(argument)
+		if err != nil || top < 0 {
+			return fmt.Errorf("invalid number of tags '%v': must be a non-negative integer", argument), nil
+		}
+	}
+
+	if asJson && usage {
+		return fmt.Errorf("the --format=json and --usage options are mutually exclusive"), nil
+	}
+
+	byDir := options.HasOption("--by-dir")
+	if asJson && byDir {
+		return fmt.Errorf("the --format=json and --by-dir options are mutually exclusive"), nil
+	}
+
+	depth := 1
+	if options.HasOption("--depth") {
+		if !byDir {
+			return fmt.Errorf("the --depth option requires --by-dir"), nil
+		}
+
+		argument := options.Get("--depth").Argument
+
+		depth, err = strconv.Atoi(argument)
+		if err != nil || depth < 1 {
+			return fmt.Errorf("invalid depth '%v': must be a positive integer", argument), nil
+		}
+	}
+
+	if byDir && len(args) > 1 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -58,6 +143,10 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 	}
 	defer tx.Commit()
 
+	if asJson {
+		return showStatisticsJson(store, tx, top), nil
+	}
+
 	showBasic(store, tx, colour)
 
 	if stats {
@@ -66,6 +155,16 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 	if usage {
 		showUsage(store, tx, colour)
 	}
+	if byDir {
+		dir := store.RootPath
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		if err := showDirectoryCoverage(store, tx, dir, depth, colour); err != nil {
+			return err, nil
+		}
+	}
 
 	return nil, nil
 }
@@ -85,45 +184,85 @@ func showBasic(store *storage.Storage, tx *storage.Tx, colour bool) error {
 }
 
 func showStatistics(store *storage.Storage, tx *storage.Tx, colour bool) error {
+	document, err := buildStatsDocument(store, tx, 0)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printInfo("Tags", document.Tags, colour)
+	printInfo("Values", document.Values, colour)
+	printInfo("Files", document.Files, colour)
+	printInfo("Taggings", document.Taggings, colour)
+	printInfof("Mean tags per file", "%1.2f", document.MeanTagsPerFile, colour)
+	printInfof("Mean files per tag", "%1.2f", document.MeanFilesPerTag, colour)
+
+	return nil
+}
+
+func showStatisticsJson(store *storage.Storage, tx *storage.Tx, top int) error {
+	document, err := buildStatsDocument(store, tx, top)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode statistics: %v", err)
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
+
+func buildStatsDocument(store *storage.Storage, tx *storage.Tx, top int) (*statsDocument, error) {
 	tagCount, err := store.TagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag count: %v", err)
+		return nil, fmt.Errorf("could not retrieve tag count: %v", err)
 	}
 
 	valueCount, err := store.ValueCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value count: %v", err)
+		return nil, fmt.Errorf("could not retrieve value count: %v", err)
 	}
 
 	fileCount, err := store.FileCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve file count: %v", err)
+		return nil, fmt.Errorf("could not retrieve file count: %v", err)
 	}
 
 	fileTagCount, err := store.FileTagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve taggings count: %v", err)
+		return nil, fmt.Errorf("could not retrieve taggings count: %v", err)
 	}
 
-	var averageTagsPerFile float32
+	document := statsDocument{statsVersion, fileCount, tagCount, valueCount, fileTagCount, 0, 0, make([]statsTag, 0, top)}
+
 	if fileCount > 0 {
-		averageTagsPerFile = float32(fileTagCount) / float32(fileCount)
+		document.MeanTagsPerFile = float64(fileTagCount) / float64(fileCount)
 	}
 
-	var averageFilesPerTag float32
 	if tagCount > 0 {
-		averageFilesPerTag = float32(fileTagCount) / float32(tagCount)
+		document.MeanFilesPerTag = float64(fileTagCount) / float64(tagCount)
 	}
 
-	fmt.Println()
-	printInfo("Tags", tagCount, colour)
-	printInfo("Values", valueCount, colour)
-	printInfo("Files", fileCount, colour)
-	printInfo("Taggings", fileTagCount, colour)
-	printInfof("Mean tags per file", "%1.2f", averageTagsPerFile, colour)
-	printInfof("Mean files per tag", "%1.2f", averageFilesPerTag, colour)
+	if top > 0 {
+		tagFileCounts, err := store.TagFileCounts(tx, "count")
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag usage: %v", err)
+		}
 
-	return nil
+		for _, tagFileCount := range tagFileCounts {
+			if len(document.TopTags) == top || tagFileCount.FileCount == 0 {
+				break
+			}
+
+			document.TopTags = append(document.TopTags, statsTag{tagFileCount.Name, tagFileCount.FileCount})
+		}
+	}
+
+	return &document, nil
 }
 
 func showUsage(store *storage.Storage, tx *storage.Tx, colour bool) error {
@@ -158,6 +297,119 @@ func showUsage(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	return nil
 }
 
+type directoryCoverage struct {
+	files  uint
+	tagged uint
+}
+
+func showDirectoryCoverage(store *storage.Storage, tx *storage.Tx, dir string, depth int, colour bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", dir, err)
+	}
+
+	stat, err := os.Stat(absDir)
+	if err != nil || !stat.IsDir() {
+		return fmt.Errorf("%v: no such directory", dir)
+	}
+
+	files, err := filesBeneath(store, tx, absDir)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve files beneath directory: %v", dir, err)
+	}
+
+	tagged := make(map[string]bool, len(files))
+	for _, file := range files {
+		tagged[file.Path()] = true
+	}
+
+	coverages := make(map[string]*directoryCoverage)
+	err = filepath.Walk(absDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == absDir {
+				return err
+			}
+
+			log.Warnf("%v: %v", path, err)
+			return nil
+		}
+		if path == absDir {
+			return nil
+		}
+
+		if info.Name()[0] == '.' {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		group := leadingDirectories(absDir, filepath.Dir(path), depth)
+
+		coverage, ok := coverages[group]
+		if !ok {
+			coverage = &directoryCoverage{}
+			coverages[group] = coverage
+		}
+
+		coverage.files++
+		if tagged[path] {
+			coverage.tagged++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%v: could not examine directory: %v", dir, err)
+	}
+
+	groups := make([]string, 0, len(coverages))
+	maxLength := 0
+	for group := range coverages {
+		groups = append(groups, group)
+		if len(group) > maxLength {
+			maxLength = len(group)
+		}
+	}
+	sort.Strings(groups)
+
+	fmt.Println()
+	for _, group := range groups {
+		coverage := coverages[group]
+
+		counts := fmt.Sprintf("%v/%v", coverage.tagged, coverage.files)
+		percentage := fmt.Sprintf("%.0f%%", 100*float64(coverage.tagged)/float64(coverage.files))
+		if colour {
+			counts = ansi.Yellow(counts)
+			percentage = ansi.Yellow(percentage)
+		}
+
+		fmt.Printf("  %*s %v %v\n", -maxLength, group, counts, percentage)
+	}
+
+	return nil
+}
+
+// Determines the group for a directory beneath the root: the first depth
+// components of its path relative to the root.
+func leadingDirectories(root, dir string, depth int) string {
+	relPath, err := filepath.Rel(root, dir)
+	if err != nil || relPath == "." {
+		return "."
+	}
+
+	components := strings.Split(relPath, string(filepath.Separator))
+	if len(components) > depth {
+		components = components[:depth]
+	}
+
+	return filepath.Join(components...)
+}
+
 func printInfo(name string, value interface{}, colour bool) {
 	printInfof(name, "%v", value, colour)
 }
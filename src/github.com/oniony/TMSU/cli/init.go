@@ -26,16 +26,23 @@ import (
 var InitCommand = Command{
 	Name:     "init",
 	Synopsis: "Initializes a new database",
-	Usages:   []string{"tmsu init [PATH]"},
+	Usages: []string{"tmsu init [PATH]...",
+		"tmsu --database=FILE init"},
 	Description: `Initializes a new local database.
 
 Creates a .tmsu directory under PATH and initialises a new empty database within it.
 
 If no PATH is specified then the current working directory is assumed.
 
-The new database is used automatically whenever TMSU is invoked from a directory under PATH (unless overridden by the global --database option or the TMSU_DB environment variable.`,
-	Options: Options{},
-	Exec:    initExec,
+The new database is used automatically whenever TMSU is invoked from a directory under PATH (unless overridden by the global --database option or the TMSU_DB environment variable).
+
+If no PATH is specified but the global --database option is then the database is instead created at FILE, which can then be used from anywhere with --database. The database can also be created on first use by specifying the global --create-database option with any other subcommand.`,
+	Examples: []string{"$ tmsu init",
+		"$ tmsu init ~/photos",
+		"$ tmsu --database=~/work.db init"},
+	Options:  Options{},
+	Exec:     initExec,
+	Modifies: true,
 }
 
 // unexported
@@ -43,6 +50,20 @@ The new database is used automatically whenever TMSU is invoked from a directory
 func initExec(options Options, args []string, databasePath string) (error, warnings) {
 	paths := args
 
+	if len(paths) == 0 && options.HasOption("--database") {
+		if _, err := os.Stat(databasePath); err == nil {
+			return fmt.Errorf("%v: database already exists", databasePath), nil
+		}
+
+		log.Warnf("%v: creating database", databasePath)
+
+		if err := storage.CreateAt(databasePath); err != nil {
+			return fmt.Errorf("%v: could not initialize database: %v", databasePath, err), nil
+		}
+
+		return nil, nil
+	}
+
 	if len(paths) == 0 {
 		workingDirectory, err := os.Getwd()
 		if err != nil {
@@ -0,0 +1,99 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"time"
+)
+
+var LogCommand = Command{
+	Name:     "log",
+	Synopsis: "Show the audit log",
+	Usages:   []string{"tmsu log [OPTION]..."},
+	Description: `Lists the changes recorded in the audit log, oldest first: the applying ('tag') and removal ('untag') of tags and the merging ('merge') and deletion ('delete') of tags and values. Each entry shows the time, in local time, the user that made the change and what was changed.
+
+Changes are only recorded whilst the 'auditLog' setting is enabled, which it is not by default: see the 'config' subcommand. The log is only ever appended to.
+
+With --since only the changes made at or after TIME are listed. TIME may be a date (YYYY-MM-DD), a time (YYYY-MM-DDTHH:MM:SS) or a duration (e.g. 30m, 12h, 7d or 2w) indicating how long ago.`,
+	Examples: []string{"$ tmsu config auditLog=yes",
+		"$ tmsu log --since=7d\n2018-03-01 19:02:14 bob tag /home/bob/mountain.jpg: landscape\n2018-03-01 19:05:40 bob merge landscape into scenery",
+		"$ tmsu log --since=2018-03-01"},
+	Options: Options{{"--since", "-s", "list the changes made at or after TIME", true, ""}},
+	Exec:    logExec,
+}
+
+// unexported
+
+func logExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) != 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	var since time.Time
+	if options.HasOption("--since") {
+		argument := options.Get("--since").Argument
+
+		var ok bool
+		since, ok = query.ParseTime(argument, time.Now())
+		if !ok {
+			return fmt.Errorf("invalid time '%v': expected YYYY-MM-DD, YYYY-MM-DDTHH:MM:SS or a duration such as 7d", argument), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	entries, err := store.AuditEntriesSince(tx, since)
+	if err != nil {
+		return fmt.Errorf("could not retrieve audit log: %v", err), nil
+	}
+
+	for _, entry := range entries {
+		fmt.Printf("%v %v %v %v\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.User, entry.Operation, describeAuditEntry(entry))
+	}
+
+	return nil, nil
+}
+
+func describeAuditEntry(entry *entities.AuditEntry) string {
+	tag := formatTagValueName(entry.Tag, entry.Value, false, false, false)
+	if entry.Tag == "" {
+		// a change to a value rather than a tag
+		tag = "value " + text.Escape(entry.Value, '=', ' ')
+	}
+
+	switch entry.Operation {
+	case "merge":
+		return tag + " into " + text.Escape(entry.Detail, '=', ' ')
+	case "tag", "untag":
+		return entry.Path + ": " + tag
+	}
+
+	return tag
+}
@@ -18,18 +18,28 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 )
 
 var MergeCommand = Command{
-	Name:        "merge",
-	Synopsis:    "Merge tags",
-	Usages:      []string{"tmsu merge TAG... DEST"},
-	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.`,
+	Name:     "merge",
+	Synopsis: "Merge tags",
+	Usages:   []string{"tmsu merge TAG... DEST"},
+	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.
+
+All of the TAGs are merged within a single transaction: if any part of the merge fails then no changes are made to the database.
+
+Where a file is tagged with both TAG and DEST with differing values, e.g. 'year=2017' and 'released=2018', the file ends up with both values applied to DEST as separate taggings. With --report-conflicts these value conflicts are counted and reported.
+
+The most recent merge may be undone with 'tmsu undo'.`,
 	Examples: []string{`$ tmsu merge cehese cheese`,
-		`$ tmsu merge outdoors outdoor outside`},
-	Options: Options{Option{"--value", "", "merge values", false, ""}},
-	Exec:    mergeExec,
+		`$ tmsu merge outdoors outdoor outside`,
+		"$ tmsu merge --report-conflicts released year\n1 value conflict: values kept as separate taggings of tag 'year'"},
+	Options: Options{Option{"--value", "", "merge values", false, ""},
+		Option{"--report-conflicts", "", "count and report the conflicting values", false, ""}},
+	Exec:     mergeExec,
+	Modifies: true,
 }
 
 // unexported
@@ -39,6 +49,11 @@ func mergeExec(options Options, args []string, databasePath string) (error, warn
 		return fmt.Errorf("too few arguments"), nil
 	}
 
+	reportConflicts := options.HasOption("--report-conflicts")
+	if reportConflicts && options.HasOption("--value") {
+		return fmt.Errorf("the --report-conflicts option cannot be used when merging values"), nil
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -49,7 +64,6 @@ func mergeExec(options Options, args []string, databasePath string) (error, warn
 	if err != nil {
 		return err, nil
 	}
-	defer tx.Commit()
 
 	sourceNames := make([]string, len(args)-1)
 	for index, name := range args[:len(args)-1] {
@@ -58,14 +72,25 @@ func mergeExec(options Options, args []string, databasePath string) (error, warn
 
 	destName := parseTagOrValueName(args[len(args)-1])
 
+	var warnings warnings
 	if options.HasOption("--value") {
-		return mergeValues(store, tx, sourceNames, destName)
+		err, warnings = mergeValues(store, tx, sourceNames, destName)
+	} else {
+		err, warnings = mergeTags(store, tx, sourceNames, destName, reportConflicts)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err, warnings
 	}
 
-	return mergeTags(store, tx, sourceNames, destName)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), warnings
+	}
+
+	return nil, warnings
 }
 
-func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string, destTagName string) (error, warnings) {
+func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string, destTagName string, reportConflicts bool) (error, warnings) {
 	destTag, err := store.TagByName(tx, destTagName)
 	if err != nil {
 		return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err), nil
@@ -74,6 +99,18 @@ func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string,
 		return fmt.Errorf("no such tag '%v'", destTagName), nil
 	}
 
+	destFileTags, err := store.FileTagsByTagId(tx, destTag.Id, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files for tag '%v': %v", destTagName, err), nil
+	}
+
+	destValueIds := make(map[entities.FileId][]entities.ValueId, len(destFileTags))
+	for _, fileTag := range destFileTags {
+		destValueIds[fileTag.FileId] = append(destValueIds[fileTag.FileId], fileTag.ValueId)
+	}
+
+	conflicts := 0
+	undoing := false
 	warnings := make(warnings, 0, 10)
 	for _, sourceTagName := range sourceTagNames {
 		if sourceTagName == destTagName {
@@ -90,31 +127,87 @@ func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string,
 			continue
 		}
 
-		log.Infof(2, "finding files tagged '%v'.", sourceTagName)
+		if !undoing {
+			if err := beginUndo(store, tx, undoDescription("merge", "tag", sourceTagNames)+fmt.Sprintf(" into '%v'", destTagName)); err != nil {
+				return err, warnings
+			}
+
+			if err := store.SaveUndoTag(tx, destTag.Id); err != nil {
+				return fmt.Errorf("could not record tag '%v' for undoing: %v", destTagName, err), warnings
+			}
+
+			undoing = true
+		}
+
+		if err := store.SaveUndoTag(tx, sourceTag.Id); err != nil {
+			return fmt.Errorf("could not record tag '%v' for undoing: %v", sourceTagName, err), warnings
+		}
+
+		if err := store.Audit(tx, entities.AuditEntry{Operation: "merge", Tag: sourceTag.Name, Detail: destTag.Name}); err != nil {
+			return fmt.Errorf("could not record merge of tag '%v': %v", sourceTagName, err), warnings
+		}
+
+		log.Infof("finding files tagged '%v'.", sourceTagName)
 
 		fileTags, err := store.FileTagsByTagId(tx, sourceTag.Id, true)
 		if err != nil {
 			return fmt.Errorf("could not retrieve files for tag '%v': %v", sourceTagName, err), warnings
 		}
 
-		log.Infof(2, "applying tag '%v' to these files.", destTagName)
+		log.Infof("applying tag '%v' to these files.", destTagName)
 
 		for _, fileTag := range fileTags {
+			if isValueConflict(fileTag.ValueId, destValueIds[fileTag.FileId]) {
+				log.Infof("file #%v: value conflict between '%v' and '%v'.", fileTag.FileId, sourceTagName, destTagName)
+				conflicts++
+			}
+
 			if _, err = store.AddFileTag(tx, fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
 				return fmt.Errorf("could not apply tag '%v' to file #%v: %v", destTagName, fileTag.FileId, err), warnings
 			}
+
+			destValueIds[fileTag.FileId] = append(destValueIds[fileTag.FileId], fileTag.ValueId)
 		}
 
-		log.Infof(2, "deleting tag '%v'.", sourceTagName)
+		log.Infof("deleting tag '%v'.", sourceTagName)
 
 		if err = store.DeleteTag(tx, sourceTag.Id); err != nil {
 			return fmt.Errorf("could not delete tag '%v': %v", sourceTagName, err), warnings
 		}
 	}
 
+	if reportConflicts {
+		switch conflicts {
+		case 1:
+			fmt.Printf("1 value conflict: values kept as separate taggings of tag '%v'\n", destTagName)
+		default:
+			fmt.Printf("%v value conflicts: values kept as separate taggings of tag '%v'\n", conflicts, destTagName)
+		}
+	}
+
 	return nil, warnings
 }
 
+// Determines whether applying a value to a file conflicts with the values the
+// file already has for the destination tag: both are values and they differ.
+func isValueConflict(valueId entities.ValueId, destValueIds []entities.ValueId) bool {
+	if valueId == 0 {
+		return false
+	}
+
+	conflict := false
+	for _, destValueId := range destValueIds {
+		if destValueId == valueId {
+			return false
+		}
+		if destValueId != 0 {
+			conflict = true
+		}
+	}
+
+	return conflict
+}
+
 func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []string, destValueName string) (error, warnings) {
 	destValue, err := store.ValueByName(tx, destValueName)
 	if err != nil {
@@ -124,6 +217,7 @@ func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []stri
 		return fmt.Errorf("no such value '%v'", destValueName), nil
 	}
 
+	undoing := false
 	warnings := make(warnings, 0, 10)
 
 	for _, sourceValueName := range sourceValueNames {
@@ -141,14 +235,34 @@ func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []stri
 			continue
 		}
 
-		log.Infof(2, "finding files tagged with value '%v'.", sourceValueName)
+		if !undoing {
+			if err := beginUndo(store, tx, undoDescription("merge", "value", sourceValueNames)+fmt.Sprintf(" into '%v'", destValueName)); err != nil {
+				return err, warnings
+			}
+
+			if err := store.SaveUndoValue(tx, destValue.Id); err != nil {
+				return fmt.Errorf("could not record value '%v' for undoing: %v", destValueName, err), warnings
+			}
+
+			undoing = true
+		}
+
+		if err := store.SaveUndoValue(tx, sourceValue.Id); err != nil {
+			return fmt.Errorf("could not record value '%v' for undoing: %v", sourceValueName, err), warnings
+		}
+
+		if err := store.Audit(tx, entities.AuditEntry{Operation: "merge", Value: sourceValue.Name, Detail: destValue.Name}); err != nil {
+			return fmt.Errorf("could not record merge of value '%v': %v", sourceValueName, err), warnings
+		}
+
+		log.Infof("finding files tagged with value '%v'.", sourceValueName)
 
 		fileTags, err := store.FileTagsByValueId(tx, sourceValue.Id)
 		if err != nil {
 			return fmt.Errorf("could not retrieve files for value '%v': %v", sourceValueName, err), warnings
 		}
 
-		log.Infof(2, "applying value '%v' to these files.", destValueName)
+		log.Infof("applying value '%v' to these files.", destValueName)
 
 		for _, fileTag := range fileTags {
 			if _, err = store.AddFileTag(tx, fileTag.FileId, fileTag.TagId, destValue.Id); err != nil {
@@ -156,7 +270,7 @@ func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []stri
 			}
 		}
 
-		log.Infof(2, "deleting value '%v'.", sourceValueName)
+		log.Infof("deleting value '%v'.", sourceValueName)
 
 		if err = store.DeleteValue(tx, sourceValue.Id); err != nil {
 			return fmt.Errorf("could not delete value '%v': %v", sourceValueName, err), warnings
@@ -0,0 +1,119 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/metadata"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+)
+
+// unexported
+
+// Maps a metadata field to the tag to apply. Where the tag name is empty the
+// field's values are themselves applied as tags.
+type metadataMapping struct {
+	field   string
+	tagName string
+}
+
+// Parses the 'metadataTags' setting: a comma-separated list of FIELD or
+// FIELD:TAG entries.
+func parseMetadataMappings(text string) ([]metadataMapping, error) {
+	mappings := make([]metadataMapping, 0, 5)
+
+	for _, entry := range strings.Split(text, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		field, tagName := entry, ""
+		if index := strings.Index(entry, ":"); index != -1 {
+			field, tagName = entry[:index], entry[index+1:]
+
+			if err := entities.ValidateTagName(tagName); err != nil {
+				return nil, fmt.Errorf("invalid tag name '%v' for metadata field '%v': %v", tagName, field, err)
+			}
+		}
+
+		if !metadata.IsField(field) {
+			return nil, fmt.Errorf("unknown metadata field '%v': must be one of %v", field, strings.Join(metadata.FieldNames, ", "))
+		}
+
+		mappings = append(mappings, metadataMapping{field, tagName})
+	}
+
+	return mappings, nil
+}
+
+// Determines the tags to apply to a file from its metadata. Tags and values
+// are created as for those specified on the command line, except that tags
+// similar to existing ones are created without confirmation. Metadata that
+// cannot be read or that would make invalid names is reported and skipped.
+func metadataTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entities.Settings, extractor metadata.Extractor, path string) (entities.TagIdValueIdPairs, error) {
+	mappings, err := parseMetadataMappings(settings.MetadataTags())
+	if err != nil {
+		return nil, fmt.Errorf("invalid setting 'metadataTags': %v", err)
+	}
+
+	log.Infof("%v: extracting metadata", path)
+
+	fields, err := extractor.Extract(path)
+	if err != nil {
+		log.Warnf("%v: could not read metadata: %v", path, err)
+		return nil, nil
+	}
+
+	tagArgs := make([]string, 0, 10)
+	for _, mapping := range mappings {
+		for _, fieldValue := range fields[mapping.field] {
+			tagName, valueName := mapping.tagName, ""
+			if tagName == "" {
+				tagName = fieldValue
+			} else {
+				valueName = fieldValue
+			}
+
+			if err := entities.ValidateTagName(tagName); err != nil {
+				log.Warnf("%v: ignoring %v '%v': %v", path, mapping.field, fieldValue, err)
+				continue
+			}
+			if valueName != "" {
+				if err := entities.ValidateValueName(valueName); err != nil {
+					log.Warnf("%v: ignoring %v '%v': %v", path, mapping.field, fieldValue, err)
+					continue
+				}
+			}
+
+			tagArgs = append(tagArgs, formatTagValueName(tagName, valueName, false, false, false))
+		}
+	}
+
+	if len(tagArgs) == 0 {
+		return nil, nil
+	}
+
+	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, true, false, false, nil)
+	for _, warning := range warnings {
+		log.Warnf("%v: %v", path, warning)
+	}
+
+	return pairs, err
+}
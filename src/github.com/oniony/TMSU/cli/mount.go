@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/vfs"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -42,11 +44,15 @@ If FILE is not specified but the TMSU_DB environment variable is defined then th
 
 Where neither FILE is specified nor TMSU_DB defined then the default database is mounted.
 
+By default the files within the virtual filesystem are symbolic links to the tagged files. With --link-mode=hardlink they are instead presented as read-only regular files with the content of the tagged files, like hard links, for the benefit of programs that handle symbolic links poorly. As the content is served by the virtual filesystem this works across devices. Tagged directories, and files that cannot be read, remain symbolic links.
+
 To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --options=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)`,
 	Examples: []string{"$ tmsu mount mp",
 		"$ tmsu mount /tmp/db mp",
-		"$ tmsu mount --options=allow_other mp"},
-	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
+		"$ tmsu mount --options=allow_other mp",
+		"$ tmsu mount --link-mode=hardlink mp"},
+	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""},
+		Option{"--link-mode", "", "present files as symlink (the default) or hardlink entries", true, ""}},
 	Exec:    mountExec,
 }
 
@@ -58,6 +64,14 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 		mountOptions = options.Get("--options").Argument
 	}
 
+	linkMode := vfs.SymlinkMode
+	if options.HasOption("--link-mode") {
+		linkMode = options.Get("--link-mode").Argument
+		if err := vfs.ValidateLinkMode(linkMode); err != nil {
+			return err, nil
+		}
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -78,14 +92,14 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 	case 1:
 		mountPath := args[0]
 
-		if err := mountExplicit(store.DbPath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(store.DbPath, mountPath, mountOptions, linkMode); err != nil {
 			return err, nil
 		}
 	case 2:
 		databasePath := args[0]
 		mountPath := args[1]
 
-		if err := mountExplicit(databasePath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(databasePath, mountPath, mountOptions, linkMode); err != nil {
 			return err, nil
 		}
 	default:
@@ -96,7 +110,7 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 }
 
 func listMounts() error {
-	log.Info(2, "retrieving mount table.")
+	log.Info("retrieving mount table.")
 
 	mt, err := vfs.GetMountTable()
 	if err != nil {
@@ -104,7 +118,7 @@ func listMounts() error {
 	}
 
 	if len(mt) == 0 {
-		log.Info(2, "mount table is empty.")
+		log.Info("mount table is empty.")
 	}
 
 	dbPathWidth := 0
@@ -121,7 +135,10 @@ func listMounts() error {
 	return nil
 }
 
-func mountExplicit(databasePath string, mountPath string, mountOptions string) error {
+// The length of time to wait for the daemon to mount the virtual filesystem.
+const mountTimeout = 30 * time.Second
+
+func mountExplicit(databasePath string, mountPath string, mountOptions string, linkMode string) error {
 	if alreadyMounted(mountPath) {
 		return fmt.Errorf("%v: mount path already in use", mountPath)
 	}
@@ -145,43 +162,88 @@ func mountExplicit(databasePath string, mountPath string, mountOptions string) e
 		return fmt.Errorf("%v: database does not exist", databasePath)
 	}
 
-	log.Infof(2, "spawning daemon to mount VFS for database '%v' at '%v'", databasePath, mountPath)
+	log.Debugf("spawning daemon to mount VFS for database '%v' at '%v'", databasePath, mountPath)
 
-	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions}
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not create pipe: %v", err)
+	}
+	defer ready.Close()
+
+	// the write end of the pipe becomes file descriptor 3 in the daemon
+	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions, "--link-mode=" + linkMode, "--ready-fd=3"}
 	daemon := exec.Command(os.Args[0], args...)
+	daemon.ExtraFiles = []*os.File{readyWriter}
 
 	tempFile, err := ioutil.TempFile("", "tmsu-vfs-")
 	if err != nil {
+		readyWriter.Close()
 		return fmt.Errorf("could not get a temporary file: %v", err)
 	}
 	daemon.Stderr = tempFile
 
 	err = daemon.Start()
+	readyWriter.Close()
 	if err != nil {
 		return fmt.Errorf("could not start daemon: %v", err)
 	}
 
-	log.Info(2, "sleeping.")
+	log.Debug("waiting for daemon to mount the virtual filesystem.")
 
-	const halfSecond = 500000000
-	time.Sleep(halfSecond)
+	signalled := make(chan bool, 1)
+	go func() {
+		buffer := make([]byte, 1)
+		count, _ := ready.Read(buffer)
+		signalled <- count == 1
+	}()
+
+	select {
+	case mounted := <-signalled:
+		if mounted {
+			log.Debug("daemon mounted the virtual filesystem.")
+			return nil
+		}
+	case <-time.After(mountTimeout):
+		return fmt.Errorf("timed out waiting for the virtual filesystem to mount: see standard error output: %v", tempFile.Name())
+	}
 
-	log.Info(2, "checking whether daemon started successfully.")
+	log.Info("checking whether daemon exited.")
 
 	var waitStatus syscall.WaitStatus
 	var rusage syscall.Rusage
-	_, err = syscall.Wait4(daemon.Process.Pid, &waitStatus, syscall.WNOHANG, &rusage)
+	_, err = syscall.Wait4(daemon.Process.Pid, &waitStatus, 0, &rusage)
 	if err != nil {
 		return fmt.Errorf("could not check daemon status: %v", err)
 	}
 
-	if waitStatus.Exited() {
-		if waitStatus.ExitStatus() != 0 {
-			return fmt.Errorf("virtual filesystem mount failed: see standard error output: %v", tempFile.Name())
-		}
+	if waitStatus.Exited() && waitStatus.ExitStatus() == 0 {
+		return fmt.Errorf("virtual filesystem daemon exited without mounting")
 	}
 
-	return nil
+	return daemonFailure(tempFile)
+}
+
+// Builds the error for a failed daemon from the complete standard error output
+// it produced.
+func daemonFailure(stderrFile *os.File) error {
+	if _, err := stderrFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("virtual filesystem mount failed: see standard error output: %v", stderrFile.Name())
+	}
+
+	output, err := ioutil.ReadAll(stderrFile)
+	if err != nil {
+		return fmt.Errorf("virtual filesystem mount failed: see standard error output: %v", stderrFile.Name())
+	}
+
+	stderrFile.Close()
+	os.Remove(stderrFile.Name())
+
+	message := strings.TrimSpace(string(output))
+	if message == "" {
+		return fmt.Errorf("virtual filesystem mount failed")
+	}
+
+	return fmt.Errorf("virtual filesystem mount failed:\n%v", message)
 }
 
 func alreadyMounted(path string) bool {
@@ -0,0 +1,180 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var MvCommand = Command{
+	Name:     "mv",
+	Aliases:  []string{"move"},
+	Synopsis: "Move files, keeping their tags",
+	Usages: []string{"tmsu mv SOURCE DEST",
+		"tmsu mv SOURCE... DIRECTORY"},
+	Description: `Moves (renames) SOURCE to DEST, or each SOURCE into DIRECTORY, and updates the paths held in the database such that the files keep their tags. A directory is moved together with its contents and the paths of all the tagged files beneath it are updated.
+
+The database is updated in the same transaction as the files are moved so should a move fail the database is left unchanged for that file. Existing files are never overwritten: the move fails if DEST already exists. Files cannot be moved between filesystems.
+
+Files that are not in the database are moved nonetheless.`,
+	Examples: []string{"$ tmsu mv mountain.jpg mountain-2017.jpg",
+		"$ tmsu mv *.jpg ~/pictures",
+		"$ tmsu mv ~/music/jazz ~/music/archive/jazz"},
+	Options:  Options{},
+	Exec:     mvExec,
+	Modifies: true,
+}
+
+// unexported
+
+func mvExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments"), nil
+	}
+
+	sources := args[:len(args)-1]
+	dest := args[len(args)-1]
+
+	destIsDir := false
+	if stat, err := os.Stat(dest); err == nil {
+		destIsDir = stat.IsDir()
+	}
+	if len(sources) > 1 && !destIsDir {
+		return fmt.Errorf("%v: no such directory", dest), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	for _, source := range sources {
+		target := dest
+		if destIsDir {
+			target = filepath.Join(dest, filepath.Base(filepath.Clean(source)))
+		}
+
+		if err := tx.Savepoint("move"); err != nil {
+			return err, nil
+		}
+
+		if err := moveFile(store, tx, source, target); err != nil {
+			if rollbackErr := tx.RollbackToSavepoint("move"); rollbackErr != nil {
+				return rollbackErr, nil
+			}
+
+			return err, nil
+		}
+
+		if err := tx.ReleaseSavepoint("move"); err != nil {
+			return err, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Moves the file, with any contents, on the filesystem and in the database. The
+// database is updated first so that the move is undone by rolling back should
+// the filesystem move fail.
+func moveFile(store *storage.Storage, tx *storage.Tx, source, dest string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", source, err)
+	}
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", dest, err)
+	}
+
+	if _, err := os.Lstat(absSource); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%v: no such file", source)
+		}
+
+		return fmt.Errorf("%v: could not stat: %v", source, err)
+	}
+
+	if _, err := os.Lstat(absDest); err == nil {
+		return fmt.Errorf("%v: already exists", dest)
+	}
+
+	if strings.HasPrefix(absDest, absSource+string(filepath.Separator)) {
+		return fmt.Errorf("%v: cannot move a directory into itself", source)
+	}
+
+	log.Infof("%v: updating the database", source)
+
+	file, err := store.FileByPath(tx, absSource)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", source, err)
+	}
+	if file != nil {
+		if err := moveFilePath(store, tx, file, absDest); err != nil {
+			return err
+		}
+	} else {
+		log.Infof("%v: not in the database", source)
+	}
+
+	files, err := store.FilesByDirectory(tx, absSource)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve files beneath directory: %v", source, err)
+	}
+
+	for _, file := range files {
+		// the database matches directories by pattern so may include similarly named siblings
+		if !strings.HasPrefix(file.Path(), absSource+string(filepath.Separator)) {
+			continue
+		}
+
+		if err := moveFilePath(store, tx, file, absDest+strings.TrimPrefix(file.Path(), absSource)); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("%v: moving to %v", source, dest)
+
+	if err := os.Rename(absSource, absDest); err != nil {
+		return fmt.Errorf("%v: could not move: %v", source, err)
+	}
+
+	return nil
+}
+
+func moveFilePath(store *storage.Storage, tx *storage.Tx, file *entities.File, path string) error {
+	log.Infof("%v: updating path to %v", file.Path(), path)
+
+	if _, err := store.UpdateFile(tx, file.Id, path, file.Fingerprint, file.ModTime, file.Size, file.IsDir); err != nil {
+		return fmt.Errorf("%v: could not update path: %v", file.Path(), err)
+	}
+
+	return nil
+}
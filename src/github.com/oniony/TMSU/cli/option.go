@@ -65,6 +65,18 @@ func (options Options) Get(name string) *Option {
 	return nil
 }
 
+func (options Options) Arguments(name string) []string {
+	arguments := make([]string, 0, 1)
+
+	for _, option := range options {
+		if option.LongName == name || option.ShortName == name {
+			arguments = append(arguments, option.Argument)
+		}
+	}
+
+	return arguments
+}
+
 type OptionParser struct {
 	globalOptions Options
 	commandByName map[string]*Command
@@ -100,6 +112,12 @@ func (parser *OptionParser) Parse(args ...string) (command *Command, options Opt
 
 				option := lookupOption(possibleOptions, optionName)
 				if option == nil {
+					if combined := splitShortOptions(possibleOptions, arg); combined != nil {
+						args = append(args[:index:index], append(combined, args[index+1:]...)...)
+						index--
+						continue
+					}
+
 					err = fmt.Errorf("invalid option '%v'", optionName)
 					return
 				}
@@ -142,6 +160,29 @@ func (parser *OptionParser) Parse(args ...string) (command *Command, options Opt
 
 // unexported
 
+// Splits combined short options, such as '-vv', into the individual options
+// where each letter is a short option that takes no argument, returning nil
+// otherwise.
+func splitShortOptions(possibleOptions Options, arg string) []string {
+	if len(arg) < 3 || arg[1] == '-' {
+		return nil
+	}
+
+	shortNames := make([]string, 0, len(arg)-1)
+	for _, r := range arg[1:] {
+		shortName := "-" + string(r)
+
+		option := lookupOption(possibleOptions, shortName)
+		if option == nil || option.HasArgument {
+			return nil
+		}
+
+		shortNames = append(shortNames, shortName)
+	}
+
+	return shortNames
+}
+
 func buildCommandByNameMap(commands []*Command) map[string]*Command {
 	commandByName := make(map[string]*Command)
 
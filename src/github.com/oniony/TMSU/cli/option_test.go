@@ -67,6 +67,41 @@ func TestParseGlobalOptions(test *testing.T) {
 	}
 }
 
+func TestParseCombinedShortOptions(test *testing.T) {
+	parser := NewOptionParser(Options{Option{"--verbose", "-v", "verbose", false, ""}},
+		[]*Command{{Name: "a", Options: Options{Option{"--explicit", "-e", "explicit", false, ""}}}})
+
+	command, options, arguments, err := parser.Parse("-vv", "a", "-ve", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(options) != 4 {
+		test.Fatalf("Expected four options but were %v.", len(options))
+	}
+	if options.Count("--verbose") != 3 {
+		test.Fatalf("Expected three verbose options but were %v.", options.Count("--verbose"))
+	}
+	if !options.HasOption("--explicit") {
+		test.Fatal("Expected explicit option.")
+	}
+	if command.Name != "a" {
+		test.Fatalf("Expected command name of 'a' but was '%v'.", command.Name)
+	}
+	if len(arguments) != 1 || arguments[0] != "b" {
+		test.Fatalf("Expected argument of 'b' but were %v.", arguments)
+	}
+}
+
+func TestInvalidCombinedShortOptions(test *testing.T) {
+	parser := NewOptionParser(Options{Option{"--verbose", "-v", "verbose", false, ""}}, []*Command{{Name: "a"}})
+
+	_, _, _, err := parser.Parse("-vx", "a")
+
+	if err == nil {
+		test.Fatal("Invalid combined option not identified.")
+	}
+}
+
 func TestInvalidGlobalOption(test *testing.T) {
 	parser := NewOptionParser(Options{}, []*Command{})
 
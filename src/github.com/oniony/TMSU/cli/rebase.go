@@ -0,0 +1,141 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"path/filepath"
+	"strings"
+)
+
+var RebaseCommand = Command{
+	Name:     "rebase",
+	Synopsis: "Update the paths of files relocated together",
+	Usages:   []string{"tmsu rebase [OPTION]... OLDROOT NEWROOT"},
+	Description: `Updates the path of every file in the database at or beneath OLDROOT to be at the same place beneath NEWROOT, e.g. when an entire collection has been moved to a new mount point.
+
+Only the paths held in the database are changed: the files themselves are neither moved nor examined, so this is far faster than 'tmsu repair' after a bulk relocation and works even before the files are available at NEWROOT. The fingerprints, modification times and sizes are kept as they are.
+
+All of the paths are updated within a single transaction: should any update fail, e.g. because a file is already recorded at the new path, then no changes are made to the database.
+
+With --dry-run each change that would be made is listed without making it.`,
+	Examples: []string{"$ tmsu rebase /mnt/old-disk /mnt/new-disk\nrebased 12034 file(s)",
+		"$ tmsu rebase --dry-run /media/photos /srv/photos"},
+	Options:  Options{{"--dry-run", "-n", "list the changes that would be made without making them", false, ""}},
+	Exec:     rebaseExec,
+	Modifies: true,
+}
+
+// unexported
+
+func rebaseExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments"), nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	dryRun := options.HasOption("--dry-run")
+
+	oldRoot, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", args[0], err), nil
+	}
+
+	newRoot, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", args[1], err), nil
+	}
+
+	if oldRoot == newRoot {
+		return fmt.Errorf("the old and new roots are the same"), nil
+	}
+	if strings.HasPrefix(newRoot, oldRoot+string(filepath.Separator)) {
+		return fmt.Errorf("%v: cannot rebase onto a directory beneath the old root", args[1]), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	if err := rebaseFiles(store, tx, oldRoot, newRoot, dryRun); err != nil {
+		tx.Rollback()
+		return err, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), nil
+	}
+
+	return nil, nil
+}
+
+func rebaseFiles(store *storage.Storage, tx *storage.Tx, oldRoot, newRoot string, dryRun bool) error {
+	log.Infof("%v: retrieving files from the database", oldRoot)
+
+	files, err := filesBeneath(store, tx, oldRoot)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve files beneath directory: %v", oldRoot, err)
+	}
+
+	file, err := store.FileByPath(tx, oldRoot)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", oldRoot, err)
+	}
+	if file != nil {
+		files = append(entities.Files{file}, files...)
+	}
+
+	for _, file := range files {
+		path := newRoot + strings.TrimPrefix(file.Path(), oldRoot)
+
+		if dryRun {
+			fmt.Printf("%v: would update path to %v\n", file.Path(), path)
+			continue
+		}
+
+		existing, err := store.FileByPath(tx, path)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if existing != nil {
+			return fmt.Errorf("%v: cannot rebase %v as the path is already in the database", path, file.Path())
+		}
+
+		if err := moveFilePath(store, tx, file, path); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("would rebase %v file(s)\n", len(files))
+	} else {
+		fmt.Printf("rebased %v file(s)\n", len(files))
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/tmsu"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ReindexCommand = Command{
+	Name:     "reindex",
+	Synopsis: "Recalculate file fingerprints",
+	Usages:   []string{"tmsu reindex [OPTION]... [PATH]..."},
+	Description: `Recalculates the fingerprints of the files in the database, or of those at or beneath each PATH specified, and records them along with each file's current modification time and size.
+
+This is quicker than 'tmsu repair' when only the fingerprints are stale, e.g. after changing the 'fileFingerprintAlgorithm' setting, as no attempt is made to find moved files. Missing files are reported and left alone.
+
+With --modified only the files whose modification time or size differs from that recorded are fingerprinted. Otherwise every file is, which is necessary after changing the fingerprint algorithm.
+
+The fingerprints are computed concurrently using the number of threads specified by --threads, which defaults to the number of CPUs.
+
+To lessen the impact upon other programs, --io-throttle limits fingerprinting to N files per second or, with the suffix MB, to N megabytes read per second. By default there is no limit.
+
+Each file whose fingerprint has changed is listed, followed by the number of files reindexed and changed. A changed file may now be a duplicate of another: use 'tmsu dupes' to find out.`,
+	Examples: []string{"$ tmsu reindex",
+		"$ tmsu reindex --modified ~/photos",
+		"$ tmsu reindex --threads=2 --dry-run",
+		"$ tmsu reindex --io-throttle=20MB"},
+	Options: Options{{"--modified", "-m", "only recalculate the fingerprints of modified files", false, ""},
+		{"--threads", "", "the number of THREADS with which to fingerprint files", true, ""},
+		{"--io-throttle", "", "fingerprint at most N files, or NMB megabytes, per second", true, ""},
+		{"--dry-run", "-n", "list the changes that would be made without making them", false, ""}},
+	Exec:     reindexExec,
+	Modifies: true,
+}
+
+// unexported
+
+func reindexExec(options Options, args []string, databasePath string) (error, warnings) {
+	modifiedOnly := options.HasOption("--modified")
+	dryRun := options.HasOption("--dry-run")
+
+	threads, err := threadsOption(options)
+	if err != nil {
+		return err, nil
+	}
+
+	throttle, err := ioThrottleOption(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	files, err := filesToReindex(store, tx, args)
+	if err != nil {
+		return err, nil
+	}
+
+	pending := make(entities.Files, 0, len(files))
+	stats := make(map[entities.FileId]os.FileInfo, len(files))
+	complete := len(args) == 0 && !modifiedOnly
+	for _, file := range files {
+		stat, err := os.Stat(file.Path())
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				log.Warnf("%v: missing", file.Path())
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied", file.Path())
+			default:
+				log.Warnf("%v: could not stat: %v", file.Path(), err)
+			}
+
+			complete = false
+			continue
+		}
+
+		if modifiedOnly && file.ModTime.Equal(stat.ModTime().UTC()) && file.Size == stat.Size() {
+			log.Infof("%v: unmodified", file.Path())
+			continue
+		}
+
+		pending = append(pending, file)
+		stats[file.Id] = stat
+	}
+
+	paths := make([]string, len(pending))
+	for index, file := range pending {
+		paths[index] = file.Path()
+	}
+
+	fingerprinter := tmsu.NewFingerprinter(settings, threads)
+	fingerprinter.Throttle = throttle
+	fingerprinter.Prefetch(paths)
+
+	reindexed, changed := 0, 0
+	for _, file := range pending {
+		stat := stats[file.Id]
+
+		fingerprint, err := fingerprinter.Fingerprint(file.Path())
+		if err != nil {
+			log.Warnf("%v: could not create fingerprint: %v", file.Path(), err)
+			complete = false
+			continue
+		}
+
+		reindexed++
+
+		if fingerprint != file.Fingerprint {
+			changed++
+			fmt.Printf("%v: updated fingerprint\n", file.Path())
+		}
+
+		if dryRun {
+			continue
+		}
+
+		if _, err := store.UpdateFile(tx, file.Id, file.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir()); err != nil {
+			return fmt.Errorf("%v: could not update file in database: %v", file.Path(), err), nil
+		}
+	}
+
+	fmt.Printf("reindexed %v file(s): %v fingerprint(s) changed\n", reindexed, changed)
+
+	if settings.PreviousFileFingerprintAlgorithm() != "" && complete && !dryRun {
+		log.Infof("all fingerprints recalculated: forgetting previous fingerprint algorithm")
+
+		if err := store.DeleteSetting(tx, "previousFileFingerprintAlgorithm"); err != nil {
+			return fmt.Errorf("could not delete setting 'previousFileFingerprintAlgorithm': %v", err), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Retrieves the files in the database at or beneath each of the paths, or every
+// file if no paths are specified, in order of path and without repetition.
+func filesToReindex(store *storage.Storage, tx *storage.Tx, paths []string) (entities.Files, error) {
+	if len(paths) == 0 {
+		files, err := store.Files(tx, "path")
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve files: %v", err)
+		}
+
+		return files, nil
+	}
+
+	files := make(entities.Files, 0, 10)
+	seen := make(map[entities.FileId]bool)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+
+		beneath, err := store.FilesByDirectory(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve files beneath directory: %v", path, err)
+		}
+
+		if file == nil && len(beneath) == 0 {
+			log.Warnf("%v: not in the database", path)
+			continue
+		}
+		if file != nil {
+			beneath = append(entities.Files{file}, beneath...)
+		}
+
+		for _, file := range beneath {
+			// the database matches directories by pattern so may include similarly named siblings
+			if file.Path() != absPath && !strings.HasPrefix(file.Path(), absPath+string(filepath.Separator)) {
+				continue
+			}
+
+			if !seen[file.Id] {
+				seen[file.Id] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files, nil
+}
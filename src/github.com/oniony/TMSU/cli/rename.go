@@ -18,37 +18,61 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
+	"regexp"
+	"strings"
+	"unicode"
 )
 
 var RenameCommand = Command{
 	Name:     "rename",
-	Aliases:  []string{"mv"},
 	Synopsis: "Rename a tag or value",
-	Usages:   []string{"tmsu rename [OPTION]... OLD NEW"},
+	Usages: []string{"tmsu rename [OPTION]... OLD NEW",
+		"tmsu rename --value TAG OLD NEW",
+		"tmsu rename [OPTION]... --pattern=s/REGEX/REPLACEMENT/[FLAGS]"},
 	Description: `Renames a tag or value from OLD to NEW.
 
-Attempting to rename a tag or value with a name that already exists will result in an error. To merge tags or values use the 'merge' subcommand instead.`,
+Attempting to rename a tag or value with a name that already exists will result in an error. To merge tags or values use the 'merge' subcommand instead.
+
+When a TAG is specified with --value, only the taggings of TAG with value OLD are changed to use value NEW. Where a file is already tagged TAG=NEW the taggings are merged. The number of taggings affected is reported.
+
+With --pattern, every tag whose name matches REGEX is renamed using a sed-style substitution. Within REPLACEMENT, '&' is the matched text, '\1' to '\9' are the parenthesized groups and '\L', '\U' and '\E' start lowercase, start uppercase or end the case conversion of the text that follows. FLAGS may contain 'g', to replace every match rather than just the first, and 'i', to match ignoring case. Use --dry-run to list the renames without making them.
+
+Where two or more tags would be renamed to the same name, or a tag would be renamed to the name of an existing tag, the rename fails unless --on-collision=merge is specified, in which case the colliding tags are merged. No changes are made if any of the renames fail.`,
 	Examples: []string{"$ tmsu rename montain mountain",
-		"$ tmsu rename --value MMXVII 2017"},
-	Options: Options{{"--value", "", "rename a value", false, ""}},
-	Exec:    renameExec,
+		"$ tmsu rename --value MMXVII 2017",
+		"$ tmsu rename --value project projct project\n3 taggings affected",
+		"$ tmsu rename --dry-run --pattern='s/.*/\\L&/'\nMusic -> music\nPhotos -> photos",
+		"$ tmsu rename --pattern='s/^colour-/color-/' --on-collision=merge"},
+	Options: Options{{"--value", "", "rename a value", false, ""},
+		{"--pattern", "", "rename the tags matching a sed-style substitution", true, ""},
+		{"--on-collision", "", "when renamed tags collide: error, merge", true, ""},
+		{"--dry-run", "-n", "list the renames without making them", false, ""}},
+	Exec:     renameExec,
+	Modifies: true,
 }
 
 // unexported
 
 func renameExec(options Options, args []string, databasePath string) (error, warnings) {
+	if options.HasOption("--pattern") {
+		return renamePatternExec(options, args, databasePath)
+	}
+
+	if options.HasOption("--on-collision") || options.HasOption("--dry-run") {
+		return fmt.Errorf("the --on-collision and --dry-run options can only be used with --pattern"), nil
+	}
+
 	if len(args) < 2 {
 		return fmt.Errorf("too few arguments"), nil
 	}
 
-	if len(args) > 2 {
+	if len(args) > 3 || (len(args) > 2 && !options.HasOption("--value")) {
 		return fmt.Errorf("too many arguments"), nil
 	}
 
-	currentName := parseTagOrValueName(args[0])
-	newName := parseTagOrValueName(args[1])
-
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -62,10 +86,341 @@ func renameExec(options Options, args []string, databasePath string) (error, war
 	defer tx.Commit()
 
 	if options.HasOption("--value") {
-		return renameValue(store, tx, currentName, newName), nil
+		if len(args) == 3 {
+			tagName := parseTagOrValueName(args[0])
+			currentName := parseTagOrValueName(args[1])
+			newName := parseTagOrValueName(args[2])
+
+			return renameTagValue(store, tx, tagName, currentName, newName), nil
+		}
+
+		return renameValue(store, tx, parseTagOrValueName(args[0]), parseTagOrValueName(args[1])), nil
 	}
 
-	return renameTag(store, tx, currentName, newName), nil
+	return renameTag(store, tx, parseTagOrValueName(args[0]), parseTagOrValueName(args[1])), nil
+}
+
+func renamePatternExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("tags cannot be specified with --pattern"), nil
+	}
+	if options.HasOption("--value") {
+		return fmt.Errorf("the --pattern and --value options are mutually exclusive"), nil
+	}
+
+	sub, err := parseSubstitution(options.Get("--pattern").Argument)
+	if err != nil {
+		return err, nil
+	}
+
+	merge := false
+	if options.HasOption("--on-collision") {
+		switch options.Get("--on-collision").Argument {
+		case "error":
+			// default
+		case "merge":
+			merge = true
+		default:
+			return fmt.Errorf("invalid collision action '%v': expected error or merge", options.Get("--on-collision").Argument), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	err, warnings := renameTagsByPattern(store, tx, sub, merge, options.HasOption("--dry-run"))
+	if err != nil {
+		tx.Rollback()
+		return err, warnings
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), warnings
+	}
+
+	return nil, warnings
+}
+
+type tagRename struct {
+	from  string
+	to    string
+	merge bool // merged into 'to' rather than renamed
+}
+
+// Renames each tag matching the substitution. Renames are made once their new
+// name is free, so that chains such as 'a' to 'b' and 'b' to 'c' succeed.
+func renameTagsByPattern(store *storage.Storage, tx *storage.Tx, sub *substitution, merge, dryRun bool) (error, warnings) {
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err), nil
+	}
+
+	renames, err := tagRenames(tags, sub, merge)
+	if err != nil {
+		return err, nil
+	}
+	if len(renames) == 0 {
+		return nil, warnings{"no tags matched the pattern"}
+	}
+
+	if dryRun {
+		for _, rename := range renames {
+			if rename.merge {
+				fmt.Printf("%v -> %v (merged)\n", text.Escape(rename.from, '=', ' '), text.Escape(rename.to, '=', ' '))
+			} else {
+				fmt.Printf("%v -> %v\n", text.Escape(rename.from, '=', ' '), text.Escape(rename.to, '=', ' '))
+			}
+		}
+
+		return nil, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for len(renames) > 0 {
+		pending := make([]tagRename, 0, len(renames))
+
+		for _, rename := range renames {
+			destTag, err := store.TagByName(tx, rename.to)
+			if err != nil {
+				return fmt.Errorf("could not retrieve tag '%v': %v", rename.to, err), warnings
+			}
+
+			switch {
+			case rename.merge && destTag != nil:
+				err, mergeWarnings := mergeTags(store, tx, []string{rename.from}, rename.to, false)
+				warnings = append(warnings, mergeWarnings...)
+				if err != nil {
+					return err, warnings
+				}
+			case !rename.merge && destTag == nil:
+				if err := renameTag(store, tx, rename.from, rename.to); err != nil {
+					return err, warnings
+				}
+			default:
+				pending = append(pending, rename)
+			}
+		}
+
+		if len(pending) == len(renames) {
+			return fmt.Errorf("could not rename tag '%v' to '%v': the renames are cyclic", pending[0].from, pending[0].to), warnings
+		}
+
+		renames = pending
+	}
+
+	return nil, warnings
+}
+
+// Determines the new name of each tag matching the substitution. Where tags
+// collide, by being renamed to the same name or to that of a tag that is kept,
+// an error is returned unless merging, in which case the tag that is kept, or
+// else the first of the tags, takes the name and the others are merged into it.
+func tagRenames(tags entities.Tags, sub *substitution, merge bool) ([]tagRename, error) {
+	newNames := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		newName := sub.apply(tag.Name)
+		if newName == tag.Name {
+			continue
+		}
+
+		if err := entities.ValidateTagName(newName); err != nil {
+			return nil, fmt.Errorf("cannot rename tag '%v' to '%v': %v", tag.Name, newName, err)
+		}
+
+		newNames[tag.Name] = newName
+	}
+
+	renames := make([]tagRename, 0, len(newNames))
+	claimed := make(map[string]string, len(newNames))
+	for _, tag := range tags {
+		newName, ok := newNames[tag.Name]
+		if !ok {
+			if _, ok := claimed[tag.Name]; !ok {
+				claimed[tag.Name] = tag.Name
+			}
+			continue
+		}
+
+		claimant, collides := claimed[newName]
+		if !collides && tags.Any(func(other *entities.Tag) bool { return other.Name == newName }) {
+			if _, renamed := newNames[newName]; !renamed {
+				claimant, collides = newName, true
+			}
+		}
+
+		if collides && !merge {
+			if claimant == newName {
+				return nil, fmt.Errorf("cannot rename tag '%v' to '%v': tag '%v' already exists", tag.Name, newName, newName)
+			}
+
+			return nil, fmt.Errorf("cannot rename tag '%v' to '%v': tag '%v' would also be renamed to '%v'", tag.Name, newName, claimant, newName)
+		}
+
+		claimed[newName] = tag.Name
+		renames = append(renames, tagRename{tag.Name, newName, collides})
+	}
+
+	return renames, nil
+}
+
+// A sed-style substitution: 's/REGEX/REPLACEMENT/FLAGS'.
+type substitution struct {
+	pattern     *regexp.Regexp
+	replacement []replacementPart
+	global      bool
+}
+
+// Part of a substitution's replacement: literal text, a group (0 for the whole
+// match) or, where caseChange is set, a change of case for the parts following.
+type replacementPart struct {
+	text       string
+	group      int
+	caseChange rune // 'L', 'U' or 'E'
+}
+
+func parseSubstitution(text string) (*substitution, error) {
+	invalid := fmt.Errorf("invalid substitution '%v': expected s/REGEX/REPLACEMENT/FLAGS", text)
+
+	runes := []rune(text)
+	if len(runes) < 2 || runes[0] != 's' || runes[1] == '\\' || unicode.IsLetter(runes[1]) || unicode.IsDigit(runes[1]) || unicode.IsSpace(runes[1]) {
+		return nil, invalid
+	}
+
+	delimiter := runes[1]
+	fields := []string{""}
+	for index := 2; index < len(runes); index++ {
+		r := runes[index]
+
+		switch {
+		case r == '\\' && index+1 < len(runes) && runes[index+1] == delimiter:
+			fields[len(fields)-1] += string(delimiter)
+			index++
+		case r == '\\' && index+1 < len(runes):
+			fields[len(fields)-1] += string(runes[index : index+2])
+			index++
+		case r == delimiter:
+			fields = append(fields, "")
+		default:
+			fields[len(fields)-1] += string(r)
+		}
+	}
+
+	if len(fields) != 3 {
+		return nil, invalid
+	}
+
+	patternText, replacementText, flags := fields[0], fields[1], fields[2]
+
+	global := false
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			global = true
+		case 'i':
+			patternText = "(?i)" + patternText
+		default:
+			return nil, fmt.Errorf("invalid substitution flag '%c': expected g or i", flag)
+		}
+	}
+
+	pattern, err := regexp.Compile(patternText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%v': %v", fields[0], err)
+	}
+
+	return &substitution{pattern, parseReplacement(replacementText), global}, nil
+}
+
+func parseReplacement(text string) []replacementPart {
+	parts := make([]replacementPart, 0, 5)
+	literal := ""
+
+	addPart := func(part replacementPart) {
+		if literal != "" {
+			parts = append(parts, replacementPart{literal, -1, 0})
+			literal = ""
+		}
+		parts = append(parts, part)
+	}
+
+	runes := []rune(text)
+	for index := 0; index < len(runes); index++ {
+		r := runes[index]
+
+		switch {
+		case r == '&':
+			addPart(replacementPart{"", 0, 0})
+		case r == '\\' && index+1 < len(runes):
+			index++
+			r2 := runes[index]
+
+			switch {
+			case r2 >= '1' && r2 <= '9':
+				addPart(replacementPart{"", int(r2 - '0'), 0})
+			case r2 == 'L', r2 == 'U', r2 == 'E':
+				addPart(replacementPart{"", -1, r2})
+			default:
+				literal += string(r2)
+			}
+		default:
+			literal += string(r)
+		}
+	}
+
+	if literal != "" {
+		parts = append(parts, replacementPart{literal, -1, 0})
+	}
+
+	return parts
+}
+
+// Applies the substitution to the text, replacing the first match or, if the
+// substitution is global, every match.
+func (sub *substitution) apply(text string) string {
+	count := 1
+	if sub.global {
+		count = -1
+	}
+
+	result := ""
+	last := 0
+	for _, match := range sub.pattern.FindAllStringSubmatchIndex(text, count) {
+		result += text[last:match[0]]
+
+		caseChange := 'E'
+		for _, part := range sub.replacement {
+			if part.caseChange != 0 {
+				caseChange = part.caseChange
+				continue
+			}
+
+			partText := part.text
+			if part.group >= 0 && 2*part.group+1 < len(match) && match[2*part.group] >= 0 {
+				partText = text[match[2*part.group]:match[2*part.group+1]]
+			}
+
+			switch caseChange {
+			case 'L':
+				partText = strings.ToLower(partText)
+			case 'U':
+				partText = strings.ToUpper(partText)
+			}
+
+			result += partText
+		}
+
+		last = match[1]
+	}
+
+	return result + text[last:]
 }
 
 func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName string) error {
@@ -85,7 +440,7 @@ func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName stri
 		return fmt.Errorf("tag '%v' already exists", newName)
 	}
 
-	log.Infof(2, "renaming tag '%v' to '%v'.", currentName, newName)
+	log.Infof("renaming tag '%v' to '%v'.", currentName, newName)
 
 	_, err = store.RenameTag(tx, sourceTag.Id, newName)
 	if err != nil {
@@ -112,7 +467,7 @@ func renameValue(store *storage.Storage, tx *storage.Tx, currentName, newName st
 		return fmt.Errorf("value '%v' already exists", newName)
 	}
 
-	log.Infof(2, "renaming value '%v' to '%v'.", currentName, newName)
+	log.Infof("renaming value '%v' to '%v'.", currentName, newName)
 
 	_, err = store.RenameValue(tx, sourceValue.Id, newName)
 	if err != nil {
@@ -121,3 +476,61 @@ func renameValue(store *storage.Storage, tx *storage.Tx, currentName, newName st
 
 	return nil
 }
+
+func renameTagValue(store *storage.Storage, tx *storage.Tx, tagName, currentName, newName string) error {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag '%v'", tagName)
+	}
+
+	sourceValue, err := store.ValueByName(tx, currentName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value '%v': %v", currentName, err)
+	}
+	if sourceValue == nil {
+		return fmt.Errorf("no such value '%v'", currentName)
+	}
+
+	fileTags, err := store.FileTagsByTagId(tx, tag.Id, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve taggings for tag '%v': %v", tagName, err)
+	}
+
+	fileTags = fileTags.Where(func(fileTag entities.FileTag) bool { return fileTag.ValueId == sourceValue.Id })
+	if len(fileTags) == 0 {
+		return fmt.Errorf("tag '%v' does not have value '%v'", tagName, currentName)
+	}
+
+	destValue, err := store.ValueByName(tx, newName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value '%v': %v", newName, err)
+	}
+	if destValue != nil && destValue.Id == sourceValue.Id {
+		return fmt.Errorf("cannot rename value '%v' to itself", currentName)
+	}
+	if destValue == nil {
+		destValue, err = createValue(store, tx, newName)
+		if err != nil {
+			return fmt.Errorf("could not create value '%v': %v", newName, err)
+		}
+	}
+
+	log.Infof("changing value of tag '%v' from '%v' to '%v'.", tagName, currentName, newName)
+
+	for _, fileTag := range fileTags {
+		if _, err := store.AddFileTag(tx, fileTag.FileId, tag.Id, destValue.Id); err != nil {
+			return fmt.Errorf("could not apply value '%v' to file #%v: %v", newName, fileTag.FileId, err)
+		}
+
+		if err := store.DeleteFileTag(tx, fileTag.FileId, tag.Id, sourceValue.Id); err != nil {
+			return fmt.Errorf("could not remove value '%v' from file #%v: %v", currentName, fileTag.FileId, err)
+		}
+	}
+
+	fmt.Printf("%v taggings affected\n", len(fileTags))
+
+	return nil
+}
@@ -25,7 +25,9 @@ import (
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 var RepairCommand = Command{
@@ -36,30 +38,50 @@ var RepairCommand = Command{
 		"tmsu repair [OPTION]... repair --manual OLD NEW"},
 	Description: `Fixes broken paths and stale fingerprints in the database caused by file modifications and moves.
 
-Modified files are identified by a change to the file's modification time or file size. These files are repaired by updating the details in the database.
+Modified files are identified by a change to the file's modification time or file size. These files are repaired by updating the details in the database. Symbolic links that were tagged with 'tmsu tag --no-dereference' are examined without being followed, so changes to their targets do not cause them to be reported.
 
-An attempt is made to find missing files under PATHs specified. If a file with the same fingerprint is found then the database is updated with the new file's details. If no PATHs are specified, or no match can be found, then the file is instead reported as missing.
+An attempt is made to find missing files under the PATHs specified, and under any directories specified with --search-path. If a file with the same size and fingerprint is found then the database is updated with the new file's details. If no PATHs are specified, or no match can be found, then the file is instead reported as missing.
+
+If more than one candidate is found for a missing file then the candidates are reported and the file is left alone, unless --pick=first is specified in which case the first candidate, by path, is used.
 
 Files that have been both moved and modified cannot be repaired and must be manually relocated.
 
-When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.`,
+If the 'fileFingerprintAlgorithm' setting has been changed then moved files are also matched using the previous algorithm. Once all fingerprints have been recalculated with --unmodified the previous algorithm is forgotten.
+
+When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.
+
+When run with the --fold-case option, tags whose names differ only by case are merged into the tag that was created first. This should be run after setting 'caseSensitive' to 'no'. Files that have different values for the merged tags are reported. No further repairs are attempted in this mode.
+
+When run with the --dedup-taggings option, taggings that repeat the same file, tag and value as another are removed, keeping one of each, and the number removed is reported. Such duplicates are prevented by the database schema but may be present in databases modified by other programs. No further repairs are attempted in this mode.
+
+When run with the --dry-run option, each change that would be made is listed against the affected file, e.g. 'updated fingerprint', 'updated path to', 'removed', but the database is left untouched. This includes the relocations of --manual and the taggings that --rationalize would remove.`,
 	Examples: []string{"$ tmsu repair",
 		"$ tmsu repair /new/path  # look for missing files here",
+		"$ tmsu repair --search-path=/mnt/archive --pick=first",
 		"$ tmsu repair --path=/home/sally  # repair subset of database",
-		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths"},
+		"$ tmsu repair --dry-run --remove  # list changes without making them",
+		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths",
+		"$ tmsu repair --fold-case  # merge tags differing only by case",
+		"$ tmsu repair --dedup-taggings"},
 	Options: Options{{"--path", "-p", "limit repair to files in database under path", true, ""},
 		{"--pretend", "-P", "do not make any changes", false, ""},
+		{"--dry-run", "-n", "list the changes that would be made without making them", false, ""},
 		{"--remove", "-R", "remove missing files from the database", false, ""},
+		{"--search-path", "-s", "look for missing files under PATH (may be repeated)", true, ""},
+		{"--pick", "", "when a missing file has several candidates: 'first' to use the first", true, ""},
 		{"--manual", "-m", "manually relocate files", false, ""},
 		{"--unmodified", "-u", "recalculate fingerprints for unmodified files", false, ""},
-		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""}},
-	Exec: repairExec,
+		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""},
+		{"--fold-case", "", "merge tags whose names differ only by case", false, ""},
+		{"--dedup-taggings", "", "remove duplicate taggings of a file with the same tag and value", false, ""}},
+	Exec:     repairExec,
+	Modifies: true,
 }
 
 // unexported
 
 func repairExec(options Options, args []string, databasePath string) (error, warnings) {
-	pretend := options.HasOption("--pretend")
+	pretend := options.HasOption("--pretend") || options.HasOption("--dry-run")
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -73,6 +95,14 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--fold-case") {
+		return foldTagCase(store, tx, pretend)
+	}
+
+	if options.HasOption("--dedup-taggings") {
+		return dedupTaggings(store, tx, pretend), nil
+	}
+
 	if options.HasOption("--manual") {
 		if len(args) < 2 {
 			return errors.New("too few arguments"), nil
@@ -85,17 +115,27 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 			return err, nil
 		}
 	} else {
-		searchPaths := args
+		searchPaths := append(args, options.Arguments("--search-path")...)
 		removeMissing := options.HasOption("--remove")
 		recalcUnmodified := options.HasOption("--unmodified")
 		rationalize := options.HasOption("--rationalize")
 
+		pickFirst := false
+		if options.HasOption("--pick") {
+			switch pick := options.Get("--pick").Argument; pick {
+			case "first":
+				pickFirst = true
+			default:
+				return fmt.Errorf("invalid pick '%v': must be 'first'", pick), nil
+			}
+		}
+
 		limitPath := ""
 		if options.HasOption("--path") {
 			limitPath = options.Get("--path").Argument
 		}
 
-		if err := fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pretend); err != nil {
+		if err := fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pickFirst, pretend); err != nil {
 			return err, nil
 		}
 	}
@@ -114,7 +154,7 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		return fmt.Errorf("%v: could not determine absolute path", err)
 	}
 
-	log.Infof(2, "retrieving files under '%v' from the database", fromPath)
+	log.Infof("retrieving files under '%v' from the database", fromPath)
 
 	dbFile, err := store.FileByPath(tx, absFromPath)
 	if err != nil {
@@ -122,9 +162,11 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 	}
 
 	if dbFile != nil {
-		log.Infof(2, "%v: updating to %v", fromPath, toPath)
+		log.Infof("%v: updating to %v", fromPath, toPath)
 
-		if !pretend {
+		if pretend {
+			fmt.Printf("%v: updated path to %v\n", dbFile.Path(), absToPath)
+		} else {
 			if err := manualRepairFile(store, tx, dbFile, absToPath); err != nil {
 				return err
 			}
@@ -141,9 +183,11 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		absFileToPath := strings.Replace(dbFile.Path(), absFromPath, absToPath, 1)
 		relFileToPath := _path.Rel(absFileToPath)
 
-		log.Infof(2, "%v: updating to %v", relFileFromPath, relFileToPath)
+		log.Infof("%v: updating to %v", relFileFromPath, relFileToPath)
 
-		if !pretend {
+		if pretend {
+			fmt.Printf("%v: updated path to %v\n", dbFile.Path(), absFileToPath)
+		} else {
 			if err := manualRepairFile(store, tx, dbFile, absFileToPath); err != nil {
 				return err
 			}
@@ -186,7 +230,176 @@ func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.Fil
 	}
 }
 
-func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, limitPath string, removeMissing, recalcUnmodified, rationalize, pretend bool) error {
+func foldTagCase(store *storage.Storage, tx *storage.Tx, pretend bool) (error, warnings) {
+	log.Info("identifying tags differing only by case")
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err), nil
+	}
+
+	tagsByFoldedName := make(map[string]entities.Tags, len(tags))
+	foldedNames := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		foldedName := strings.ToLower(tag.Name)
+		if _, ok := tagsByFoldedName[foldedName]; !ok {
+			foldedNames = append(foldedNames, foldedName)
+		}
+
+		tagsByFoldedName[foldedName] = append(tagsByFoldedName[foldedName], tag)
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, foldedName := range foldedNames {
+		collidingTags := tagsByFoldedName[foldedName]
+		if len(collidingTags) < 2 {
+			continue
+		}
+
+		destTag := collidingTags[0]
+		for _, tag := range collidingTags[1:] {
+			if tag.Id < destTag.Id {
+				destTag = tag
+			}
+		}
+
+		for _, sourceTag := range collidingTags {
+			if sourceTag.Id == destTag.Id {
+				continue
+			}
+
+			tagWarnings, err := foldTag(store, tx, sourceTag, destTag, pretend)
+			warnings = append(warnings, tagWarnings...)
+			if err != nil {
+				return err, warnings
+			}
+
+			fmt.Printf("%v: merged into %v\n", sourceTag.Name, destTag.Name)
+		}
+	}
+
+	return nil, warnings
+}
+
+func dedupTaggings(store *storage.Storage, tx *storage.Tx, pretend bool) error {
+	log.Info("identifying duplicate taggings")
+
+	var count uint
+	var err error
+	if pretend {
+		count, err = store.DuplicateFileTagCount(tx)
+	} else {
+		count, err = store.DeleteDuplicateFileTags(tx)
+	}
+	if err != nil {
+		return fmt.Errorf("could not remove duplicate taggings: %v", err)
+	}
+
+	if pretend {
+		fmt.Printf("%v duplicate tagging(s) would be removed\n", count)
+	} else {
+		fmt.Printf("%v duplicate tagging(s) removed\n", count)
+	}
+
+	return nil
+}
+
+func foldTag(store *storage.Storage, tx *storage.Tx, sourceTag, destTag *entities.Tag, pretend bool) (warnings, error) {
+	log.Infof("merging tag '%v' into '%v'", sourceTag.Name, destTag.Name)
+
+	warnings := make(warnings, 0, 10)
+
+	fileTags, err := store.FileTagsByTagId(tx, sourceTag.Id, true)
+	if err != nil {
+		return warnings, fmt.Errorf("could not retrieve files for tag '%v': %v", sourceTag.Name, err)
+	}
+
+	destFileTags, err := store.FileTagsByTagId(tx, destTag.Id, true)
+	if err != nil {
+		return warnings, fmt.Errorf("could not retrieve files for tag '%v': %v", destTag.Name, err)
+	}
+
+	for _, fileTag := range fileTags {
+		existing := destFileTags.Where(func(ft entities.FileTag) bool { return ft.FileId == fileTag.FileId })
+		if len(existing) > 0 && !existing.Any(func(ft entities.FileTag) bool { return ft.ValueId == fileTag.ValueId }) {
+			file, err := store.File(tx, fileTag.FileId)
+			if err != nil {
+				return warnings, fmt.Errorf("could not retrieve file #%v: %v", fileTag.FileId, err)
+			}
+
+			warnings = append(warnings, fmt.Sprintf("%v: tags '%v' and '%v' have different values", file.Path(), sourceTag.Name, destTag.Name))
+		}
+
+		if pretend {
+			continue
+		}
+
+		if _, err = store.AddFileTag(tx, fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
+			return warnings, fmt.Errorf("could not apply tag '%v' to file #%v: %v", destTag.Name, fileTag.FileId, err)
+		}
+	}
+
+	implicationWarnings, err := foldImplications(store, tx, sourceTag, destTag, pretend)
+	warnings = append(warnings, implicationWarnings...)
+	if err != nil {
+		return warnings, err
+	}
+
+	if !pretend {
+		if err = store.DeleteTag(tx, sourceTag.Id); err != nil {
+			return warnings, fmt.Errorf("could not delete tag '%v': %v", sourceTag.Name, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+// Moves the implications of the source tag, both implying and implied, to the
+// destination tag. Those the destination tag already has, those by which it
+// would imply itself and those that would create a cycle are dropped.
+func foldImplications(store *storage.Storage, tx *storage.Tx, sourceTag, destTag *entities.Tag, pretend bool) (warnings, error) {
+	warnings := make(warnings, 0, 10)
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return warnings, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	for _, implication := range implications {
+		folded := *implication
+		if folded.ImplyingTag.Id == sourceTag.Id {
+			folded.ImplyingTag = *destTag
+		}
+		if folded.ImpliedTag.Id == sourceTag.Id {
+			folded.ImpliedTag = *destTag
+		}
+
+		if folded == *implication || folded.ImplyingTag.Id == folded.ImpliedTag.Id || implications.Contains(folded) {
+			continue
+		}
+
+		if pretend {
+			continue
+		}
+
+		err := store.AddImplication(tx, folded.ImplyingTagValuePair(), folded.ImpliedTagValuePair(), folded.InheritsValue, false)
+		if err != nil {
+			if _, ok := err.(storage.ImplicationCycleError); ok {
+				warnings = append(warnings, fmt.Sprintf("tag '%v': implication dropped: %v", sourceTag.Name, err))
+				continue
+			}
+
+			return warnings, fmt.Errorf("could not move implication to tag '%v': %v", destTag.Name, err)
+		}
+
+		implications = append(implications, &folded)
+	}
+
+	return warnings, nil
+}
+
+func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, limitPath string, removeMissing, recalcUnmodified, rationalize, pickFirst, pretend bool) error {
 	absLimitPath := ""
 	if limitPath != "" {
 		var err error
@@ -201,7 +414,7 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 		return err
 	}
 
-	log.Infof(2, "retrieving files under '%v' from the database", absLimitPath)
+	log.Infof("retrieving files under '%v' from the database", absLimitPath)
 
 	dbFiles, err := store.FilesByDirectory(tx, absLimitPath)
 	if err != nil {
@@ -217,7 +430,7 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 		dbFiles = append(dbFiles, dbFile)
 	}
 
-	log.Infof(2, "retrieved %v files from the database for path '%v'", len(dbFiles), absLimitPath)
+	log.Infof("retrieved %v files from the database for path '%v'", len(dbFiles), absLimitPath)
 
 	unmodfied, modified, missing := determineStatuses(dbFiles)
 
@@ -231,7 +444,7 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 		return err
 	}
 
-	if err = repairMoved(store, tx, missing, searchPaths, pretend, settings); err != nil {
+	if err = repairMoved(store, tx, missing, searchPaths, pickFirst, pretend, settings); err != nil {
 		return err
 	}
 
@@ -239,12 +452,26 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 		return err
 	}
 
-	if err = deleteUntaggedFiles(store, tx, dbFiles); err != nil {
-		return err
+	if previousAlgorithm := settings.PreviousFileFingerprintAlgorithm(); previousAlgorithm != "" {
+		if recalcUnmodified && absLimitPath == "" && !pretend && allRepaired(missing, removeMissing) {
+			log.Infof("all fingerprints recalculated: forgetting previous fingerprint algorithm")
+
+			if err := store.DeleteSetting(tx, "previousFileFingerprintAlgorithm"); err != nil {
+				return fmt.Errorf("could not delete setting 'previousFileFingerprintAlgorithm': %v", err)
+			}
+		} else {
+			warnFingerprintAlgorithmChanged(previousAlgorithm, settings.FileFingerprintAlgorithm())
+		}
+	}
+
+	if !pretend {
+		if err = deleteUntaggedFiles(store, tx, dbFiles); err != nil {
+			return err
+		}
 	}
 
 	if rationalize {
-		if err = rationalizeFileTags(store, tx, dbFiles); err != nil {
+		if err = rationalizeFileTags(store, tx, dbFiles, pretend); err != nil {
 			return err
 		}
 	}
@@ -253,7 +480,7 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 }
 
 func deleteUntaggedFiles(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
-	log.Infof(2, "purging untagged files")
+	log.Infof("purging untagged files")
 
 	fileIds := make([]entities.FileId, len(files))
 	for index, file := range files {
@@ -263,8 +490,8 @@ func deleteUntaggedFiles(store *storage.Storage, tx *storage.Tx, files entities.
 	return store.DeleteUntaggedFiles(tx, fileIds)
 }
 
-func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
-	log.Infof(2, "rationalizing file tags")
+func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.Files, pretend bool) error {
+	log.Infof("rationalizing file tags")
 
 	for _, file := range files {
 		fileTags, err := store.FileTagsByFileId(tx, file.Id, false)
@@ -274,7 +501,15 @@ func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.
 
 		for _, fileTag := range fileTags {
 			if fileTag.Implicit && fileTag.Explicit {
-				log.Infof(2, "%v: removing explicit tagging %v as implicit tagging exists", file.Path(), fileTag.TagId)
+				log.Infof("%v: removing explicit tagging %v as implicit tagging exists", file.Path(), fileTag.TagId)
+
+				if pretend {
+					if err := printRationalizedFileTag(store, tx, file, fileTag); err != nil {
+						return err
+					}
+
+					continue
+				}
 
 				if err := store.DeleteFileTag(tx, fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
 					return fmt.Errorf("could not delete file tag for file %v, tag %v and value %v", fileTag.FileId, fileTag.TagId, fileTag.ValueId)
@@ -286,15 +521,39 @@ func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.
 	return nil
 }
 
+func printRationalizedFileTag(store *storage.Storage, tx *storage.Tx, file *entities.File, fileTag *entities.FileTag) error {
+	tag, err := store.Tag(tx, fileTag.TagId)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag #%v: %v", fileTag.TagId, err)
+	}
+
+	value, err := store.Value(tx, fileTag.ValueId)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value #%v: %v", fileTag.ValueId, err)
+	}
+
+	tagName, valueName := "", ""
+	if tag != nil {
+		tagName = tag.Name
+	}
+	if value != nil {
+		valueName = value.Name
+	}
+
+	fmt.Printf("%v: removed explicit tagging %v\n", file.Path(), formatTagValueName(tagName, valueName, false, false, false))
+
+	return nil
+}
+
 func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing entities.Files) {
-	log.Infof(2, "determining file statuses")
+	log.Infof("determining file statuses")
 
 	unmodified = make(entities.Files, 0, 10)
 	modified = make(entities.Files, 0, 10)
 	missing = make(entities.Files, 0, 10)
 
 	for _, dbFile := range dbFiles {
-		stat, err := os.Stat(dbFile.Path())
+		stat, err := os.Lstat(dbFile.Path())
 		if err != nil {
 			switch {
 			case os.IsPermission(err):
@@ -303,17 +562,17 @@ func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing en
 				continue
 			case os.IsNotExist(err):
 				//TODO return as warning
-				log.Infof(2, "%v: missing", dbFile.Path())
+				log.Infof("%v: missing", dbFile.Path())
 				missing = append(missing, dbFile)
 				continue
 			}
 		}
 
 		if dbFile.ModTime.Equal(stat.ModTime().UTC()) && dbFile.Size == stat.Size() {
-			log.Infof(2, "%v: unmodified", dbFile.Path())
+			log.Infof("%v: unmodified", dbFile.Path())
 			unmodified = append(unmodified, dbFile)
 		} else {
-			log.Infof(2, "%v: modified", dbFile.Path())
+			log.Infof("%v: modified", dbFile.Path())
 			modified = append(modified, dbFile)
 		}
 	}
@@ -322,10 +581,10 @@ func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing en
 }
 
 func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "recalculating fingerprints for unmodified files")
+	log.Infof("recalculating fingerprints for unmodified files")
 
 	for _, dbFile := range unmodified {
-		stat, err := os.Stat(dbFile.Path())
+		stat, err := os.Lstat(dbFile.Path())
 		if err != nil {
 			return err
 		}
@@ -350,10 +609,10 @@ func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entitie
 }
 
 func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "repairing modified files")
+	log.Infof("repairing modified files")
 
 	for _, dbFile := range modified {
-		stat, err := os.Stat(dbFile.Path())
+		stat, err := os.Lstat(dbFile.Path())
 		if err != nil {
 			return err
 		}
@@ -377,8 +636,8 @@ func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Fi
 	return nil
 }
 
-func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "repairing moved files")
+func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pickFirst, pretend bool, settings entities.Settings) error {
+	log.Infof("repairing moved files")
 
 	if len(missing) == 0 || len(searchPaths) == 0 {
 		// don't bother enumerating filesystem if nothing to do
@@ -390,50 +649,158 @@ func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files,
 		return err
 	}
 
+	finder := candidateFinder{store, tx, settings, make(map[string]movedCandidate), make(map[string]bool)}
+
 	for index, dbFile := range missing {
-		log.Infof(2, "%v: searching for new location", dbFile.Path())
+		if dbFile.Fingerprint == fingerprint.Empty {
+			// cannot be matched, e.g. tagged with --allow-missing before it existed
+			continue
+		}
+
+		log.Infof("%v: searching for new location", dbFile.Path())
 
 		pathsOfSize := pathsBySize[dbFile.Size]
-		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
+		log.Infof("%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
+
+		candidates, err := finder.find(dbFile, pathsOfSize)
+		if err != nil {
+			return err
+		}
+
+		if len(candidates) == 0 {
+			continue
+		}
+
+		if len(candidates) > 1 && !pickFirst {
+			candidatePaths := make([]string, len(candidates))
+			for candidateIndex, candidate := range candidates {
+				candidatePaths[candidateIndex] = candidate.path
+			}
+
+			fmt.Printf("%v: ambiguous: %v candidates found: %v\n", dbFile.Path(), len(candidates), strings.Join(candidatePaths, ", "))
+			continue
+		}
 
-		for _, candidatePath := range pathsOfSize {
-			candidateFile, err := store.FileByPath(tx, candidatePath)
+		candidate := candidates[0]
+
+		if !pretend {
+			_, err := store.UpdateFile(tx, dbFile.Id, candidate.path, candidate.fingerprint, candidate.modTime, dbFile.Size, dbFile.IsDir)
 			if err != nil {
-				return err
+				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+			}
+		}
+
+		if candidate.matchedPreviousAlgorithm {
+			fmt.Printf("%v: updated path to %v (matched using previous fingerprint algorithm '%v')\n", dbFile.Path(), candidate.path, settings.PreviousFileFingerprintAlgorithm())
+		} else {
+			fmt.Printf("%v: updated path to %v\n", dbFile.Path(), candidate.path)
+		}
+
+		finder.claimed[candidate.path] = true
+		missing[index] = nil
+	}
+
+	return nil
+}
+
+type movedCandidate struct {
+	path                     string
+	fingerprint              fingerprint.Fingerprint
+	previousFingerprint      fingerprint.Fingerprint
+	modTime                  time.Time
+	matchedPreviousAlgorithm bool
+}
+
+type candidateFinder struct {
+	store      *storage.Storage
+	tx         *storage.Tx
+	settings   entities.Settings
+	candidates map[string]movedCandidate
+	claimed    map[string]bool
+}
+
+// Finds, in path order, the untagged files amongst the paths specified whose
+// fingerprint matches the missing file's.
+func (finder *candidateFinder) find(dbFile *entities.File, paths []string) ([]movedCandidate, error) {
+	matches := make([]movedCandidate, 0, 1)
+
+	for _, candidatePath := range paths {
+		if finder.claimed[candidatePath] {
+			continue
+		}
+
+		candidate, ok := finder.candidates[candidatePath]
+		if !ok {
+			candidateFile, err := finder.store.FileByPath(finder.tx, candidatePath)
+			if err != nil {
+				return nil, err
 			}
 			if candidateFile != nil {
 				// file is already tagged
+				finder.claimed[candidatePath] = true
 				continue
 			}
 
-			stat, err := os.Stat(candidatePath)
+			candidate, err = finder.create(candidatePath)
 			if err != nil {
-				return fmt.Errorf("%v: could not stat file: %v", candidatePath, err)
+				return nil, err
 			}
 
-			fingerprint, err := fingerprint.Create(candidatePath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
-			if err != nil {
-				return fmt.Errorf("%v: could not create fingerprint: %v", candidatePath, err)
-			}
+			finder.candidates[candidatePath] = candidate
+		}
 
-			if fingerprint == dbFile.Fingerprint {
-				if !pretend {
-					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
-					if err != nil {
-						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
-					}
-				}
+		switch {
+		case candidate.fingerprint == dbFile.Fingerprint:
+			candidate.matchedPreviousAlgorithm = false
+		case candidate.previousFingerprint != "" && candidate.previousFingerprint == dbFile.Fingerprint:
+			candidate.matchedPreviousAlgorithm = true
+		default:
+			continue
+		}
 
-				fmt.Printf("%v: updated path to %v\n", dbFile.Path(), candidatePath)
+		matches = append(matches, candidate)
+	}
 
-				missing[index] = nil
+	return matches, nil
+}
 
-				break
-			}
+func (finder *candidateFinder) create(path string) (movedCandidate, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return movedCandidate{}, fmt.Errorf("%v: could not stat file: %v", path, err)
+	}
+
+	settings := finder.settings
+
+	candidateFingerprint, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+	if err != nil {
+		return movedCandidate{}, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+	}
+
+	var previousFingerprint fingerprint.Fingerprint
+	if settings.PreviousFileFingerprintAlgorithm() != "" {
+		previousFingerprint, err = fingerprint.Create(path, settings.PreviousFileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		if err != nil {
+			return movedCandidate{}, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
 		}
 	}
 
-	return nil
+	return movedCandidate{path, candidateFingerprint, previousFingerprint, stat.ModTime(), false}, nil
+}
+
+// Determines whether every missing file was either relocated or removed.
+func allRepaired(missing entities.Files, removeMissing bool) bool {
+	if removeMissing {
+		return true
+	}
+
+	for _, dbFile := range missing {
+		if dbFile != nil {
+			return false
+		}
+	}
+
+	return true
 }
 
 func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.Files, pretend, force bool) error {
@@ -459,7 +826,7 @@ func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.File
 }
 
 func buildPathBySizeMap(paths []string) (map[int64][]string, error) {
-	log.Infof(2, "building map of paths by size")
+	log.Infof("building map of paths by size")
 
 	pathsBySize := make(map[int64][]string, 10)
 
@@ -469,11 +836,29 @@ func buildPathBySizeMap(paths []string) (map[int64][]string, error) {
 		}
 	}
 
-	log.Infof(2, "path by size map has %v sizes", len(pathsBySize))
+	// overlapping search paths find the same file more than once
+	for size, pathsOfSize := range pathsBySize {
+		sort.Strings(pathsOfSize)
+		pathsBySize[size] = uniqueSortedPaths(pathsOfSize)
+	}
+
+	log.Infof("path by size map has %v sizes", len(pathsBySize))
 
 	return pathsBySize, nil
 }
 
+// Removes the repeated paths from the sorted paths.
+func uniqueSortedPaths(paths []string) []string {
+	unique := paths[:0]
+	for index, path := range paths {
+		if index == 0 || path != paths[index-1] {
+			unique = append(unique, path)
+		}
+	}
+
+	return unique
+}
+
 func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -491,7 +876,7 @@ func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string)
 	}
 
 	if stat.IsDir() {
-		log.Infof(3, "%v: examining directory contents", absPath)
+		log.Debugf("%v: examining directory contents", absPath)
 
 		dir, err := os.Open(absPath)
 		if err != nil {
@@ -511,7 +896,7 @@ func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string)
 			}
 		}
 	} else {
-		log.Infof(3, "%v: file is of size %v", absPath, stat.Size())
+		log.Debugf("%v: file is of size %v", absPath, stat.Size())
 
 		filesOfSize, ok := pathBySizeMap[stat.Size()]
 		if ok {
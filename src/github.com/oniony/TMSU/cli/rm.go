@@ -0,0 +1,195 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var RmCommand = Command{
+	Name:     "rm",
+	Aliases:  []string{"remove"},
+	Synopsis: "Delete files and their taggings",
+	Usages:   []string{"tmsu rm [OPTION]... FILE..."},
+	Description: `Deletes each FILE from the filesystem and removes its taggings from the database, such that the database is not left referring to files that no longer exist.
+
+With --keep-file only the taggings are removed, as per 'tmsu untag --all', and with --keep-tags only the file is deleted, leaving the taggings in place, e.g. for the file to be restored later.
+
+Directories are only deleted, together with their contents and the taggings of the files within them, if --recursive is specified.
+
+The files to delete are listed and must be confirmed unless --yes is specified. The database is updated in the same transaction as the files are deleted so should a deletion fail the taggings of that file are kept.`,
+	Examples: []string{"$ tmsu rm blurry.jpg",
+		"$ tmsu rm --yes --recursive ~/pictures/rejects",
+		"$ tmsu rm --keep-file mountain.jpg"},
+	Options: Options{Option{"--keep-file", "", "remove the taggings but do not delete the files", false, ""},
+		Option{"--keep-tags", "", "delete the files but keep their taggings", false, ""},
+		Option{"--recursive", "-r", "delete directories and their contents", false, ""},
+		Option{"--yes", "-y", "do not ask for confirmation", false, ""}},
+	Exec:     rmExec,
+	Modifies: true,
+}
+
+// unexported
+
+func rmExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) == 0 {
+		return fmt.Errorf("files to delete must be specified"), nil
+	}
+
+	keepFile := options.HasOption("--keep-file")
+	keepTags := options.HasOption("--keep-tags")
+	recursive := options.HasOption("--recursive")
+
+	if keepFile && keepTags {
+		return fmt.Errorf("the --keep-file and --keep-tags options are mutually exclusive"), nil
+	}
+
+	for _, path := range args {
+		if err := checkRemovable(path, recursive, keepFile); err != nil {
+			return err, nil
+		}
+	}
+
+	if !options.HasOption("--yes") {
+		for _, path := range args {
+			fmt.Println(path)
+		}
+
+		prompt := fmt.Sprintf("delete %v file(s)?", len(args))
+		if keepFile {
+			prompt = fmt.Sprintf("remove the taggings of %v file(s)?", len(args))
+		}
+
+		if !confirm(prompt) {
+			return fmt.Errorf("no files were deleted"), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	for _, path := range args {
+		if err := tx.Savepoint("remove"); err != nil {
+			return err, nil
+		}
+
+		if err := removeFile(store, tx, path, keepFile, keepTags); err != nil {
+			if rollbackErr := tx.RollbackToSavepoint("remove"); rollbackErr != nil {
+				return rollbackErr, nil
+			}
+
+			return err, nil
+		}
+
+		if err := tx.ReleaseSavepoint("remove"); err != nil {
+			return err, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Checks that the file may be removed before anything is deleted.
+func checkRemovable(path string, recursive, keepFile bool) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err) && keepFile:
+			// the taggings of a missing file may still be removed
+			return nil
+		case os.IsNotExist(err):
+			return fmt.Errorf("%v: no such file", path)
+		default:
+			return fmt.Errorf("%v: could not stat: %v", path, err)
+		}
+	}
+
+	if _path.IsRoot(path) {
+		return fmt.Errorf("%v: will not delete the root directory", path)
+	}
+
+	if stat.IsDir() && !recursive {
+		return fmt.Errorf("%v: is a directory: use --recursive to delete it", path)
+	}
+
+	return nil
+}
+
+// Removes the file's taggings, and those of any files beneath it, and then the
+// file itself so that the taggings are restored by rolling back should the
+// deletion fail.
+func removeFile(store *storage.Storage, tx *storage.Tx, path string, keepFile, keepTags bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	if !keepTags {
+		log.Infof("%v: removing taggings", path)
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+
+		files, err := store.FilesByDirectory(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve files beneath directory: %v", path, err)
+		}
+		if file != nil {
+			files = append(entities.Files{file}, files...)
+		}
+
+		for _, file := range files {
+			// the database matches directories by pattern so may include similarly named siblings
+			if file.Path() != absPath && !strings.HasPrefix(file.Path(), absPath+string(filepath.Separator)) {
+				continue
+			}
+
+			if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
+				return fmt.Errorf("%v: could not remove taggings: %v", file.Path(), err)
+			}
+		}
+	}
+
+	if keepFile {
+		return nil
+	}
+
+	log.Infof("%v: deleting file", path)
+
+	if err := os.RemoveAll(absPath); err != nil {
+		return fmt.Errorf("%v: could not delete: %v", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+	"strings"
+)
+
+var ShellCommand = Command{
+	Name:     "shell",
+	Synopsis: "Run commands interactively",
+	Usages:   []string{"tmsu shell"},
+	Description: `Starts an interactive prompt at which the 'tag', 'untag', 'files', 'tags' and 'imply' subcommands can be run repeatedly without the cost of starting TMSU and opening the database each time.
+
+Each command is entered as it would be given to 'tmsu' on the command line, without the leading 'tmsu'. When run from a terminal the line can be edited and the previous commands recalled with the arrow keys.
+
+The commands run within a single database transaction. Enter 'commit' to save the changes made so far or 'rollback' to discard them. Any changes not yet committed are committed when the shell is left with 'exit' or end-of-file (Ctrl+D). A command that fails, including one that reports warnings such as a missing file, makes no changes.
+
+Enter 'help' to list the available commands.`,
+	Examples: []string{"$ tmsu shell\ntmsu> tag --tags=\"holiday beach\" img1.jpg img2.jpg\ntmsu> files holiday\nimg1.jpg\nimg2.jpg\ntmsu> rollback\ntmsu> exit"},
+	Options:  Options{},
+	Exec:     shellExec,
+}
+
+// unexported
+
+const shellPrompt = "tmsu> "
+
+var shellCommands = []*Command{&FilesCommand, &ImplyCommand, &TagCommand, &TagsCommand, &UntagCommand}
+
+// Reads the lines entered at the shell prompt.
+type shellReader interface {
+	ReadLine() (string, error)
+}
+
+type shell struct {
+	store *storage.Storage
+	tx    *storage.Tx
+}
+
+func shellExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	shell := shell{store, tx}
+
+	if err := shell.run(newShellReader()); err != nil {
+		shell.tx.Rollback()
+		return err, nil
+	}
+
+	if err := shell.tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), nil
+	}
+
+	return nil, nil
+}
+
+func newShellReader() shellReader {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		return &terminalShellReader{fd, terminal.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, shellPrompt)}
+	}
+
+	return &scannerShellReader{bufio.NewScanner(os.Stdin)}
+}
+
+func (shell *shell) run(reader shellReader) error {
+	for {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read command: %v", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch line {
+		case "exit", "quit":
+			return nil
+		case "help":
+			shell.help()
+		case "commit":
+			if err := shell.commit(); err != nil {
+				return err
+			}
+		case "rollback":
+			if err := shell.rollback(); err != nil {
+				return err
+			}
+		default:
+			if err := shell.execLine(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (shell *shell) help() {
+	for _, command := range shellCommands {
+		fmt.Printf("  %-10v %v\n", command.Name, command.Synopsis)
+	}
+
+	fmt.Printf("  %-10v %v\n", "commit", "Save the changes made so far")
+	fmt.Printf("  %-10v %v\n", "rollback", "Discard the changes made since the last commit")
+	fmt.Printf("  %-10v %v\n", "exit", "Commit the changes and leave the shell")
+	fmt.Println()
+	fmt.Println("Run 'tmsu help COMMAND' for command usage.")
+}
+
+func (shell *shell) commit() error {
+	log.Info("committing changes")
+
+	if err := shell.tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err)
+	}
+
+	return shell.begin()
+}
+
+func (shell *shell) rollback() error {
+	log.Info("discarding changes")
+
+	if err := shell.tx.Rollback(); err != nil {
+		return fmt.Errorf("could not roll back changes: %v", err)
+	}
+
+	return shell.begin()
+}
+
+func (shell *shell) begin() error {
+	tx, err := shell.store.Begin()
+	if err != nil {
+		return err
+	}
+
+	shell.tx = tx
+
+	return nil
+}
+
+// Runs the command within a savepoint such that the changes made by a command
+// that fails are undone. The failure is reported but does not end the shell.
+func (shell *shell) execLine(line string) error {
+	if err := shell.tx.Savepoint("command"); err != nil {
+		return fmt.Errorf("could not create savepoint: %v", err)
+	}
+
+	parser := NewOptionParser(Options{}, shellCommands)
+	command, options, args, err := parser.Parse(text.Tokenize(line)...)
+
+	var warnings warnings
+	if err == nil {
+		err, warnings = shell.execCommand(command, options, args)
+	}
+	if _, ok := err.(NoMatchesError); ok {
+		err = nil
+	}
+
+	for _, warning := range warnings {
+		log.Error(warning)
+	}
+
+	// a command that only partially succeeded has failed all the same
+	if err == nil && len(warnings) > 0 && command.Modifies {
+		err = fmt.Errorf("command failed with warnings: no changes were made")
+	}
+
+	if err != nil {
+		log.Error(err.Error())
+
+		if err := shell.tx.RollbackToSavepoint("command"); err != nil {
+			return fmt.Errorf("could not roll back to savepoint: %v", err)
+		}
+
+		return nil
+	}
+
+	if err := shell.tx.ReleaseSavepoint("command"); err != nil {
+		return fmt.Errorf("could not release savepoint: %v", err)
+	}
+
+	return nil
+}
+
+func (shell *shell) execCommand(command *Command, options Options, args []string) (error, warnings) {
+	switch {
+	case command == nil:
+		return fmt.Errorf("missing command: enter 'help' for the list of commands"), nil
+	case readOnlyDatabase && command.Modifies:
+		return ReadOnlyError{"run '" + command.Name + "'"}, nil
+	case command.Name == FilesCommand.Name:
+		return filesInTx(shell.store, shell.tx, options, args)
+	case command.Name == ImplyCommand.Name:
+		return implyInTx(shell.store, shell.tx, options, args)
+	case command.Name == TagCommand.Name:
+		return tagInTx(shell.store, shell.tx, options, args)
+	case command.Name == TagsCommand.Name:
+		return tagsInTx(shell.store, shell.tx, options, args)
+	case command.Name == UntagCommand.Name:
+		return untagInTx(shell.store, shell.tx, options, args)
+	}
+
+	return fmt.Errorf("invalid command '%v': enter 'help' for the list of commands", command.Name), nil
+}
+
+// Reads lines from a terminal with line editing and history. The terminal is
+// only placed in raw mode whilst a line is being read so that the output of
+// the commands is unaffected.
+type terminalShellReader struct {
+	fd       int
+	terminal *terminal.Terminal
+}
+
+func (reader *terminalShellReader) ReadLine() (string, error) {
+	state, err := terminal.MakeRaw(reader.fd)
+	if err != nil {
+		return "", err
+	}
+	defer terminal.Restore(reader.fd, state)
+
+	return reader.terminal.ReadLine()
+}
+
+// Reads lines from a file or pipe, without prompting.
+type scannerShellReader struct {
+	scanner *bufio.Scanner
+}
+
+func (reader *scannerShellReader) ReadLine() (string, error) {
+	if !reader.scanner.Scan() {
+		if err := reader.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	return reader.scanner.Text(), nil
+}
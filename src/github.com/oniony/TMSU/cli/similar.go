@@ -0,0 +1,122 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// unexported
+
+// The maximum number of edits by which a new tag name may differ from an
+// existing one to be considered a likely typo.
+const maxSuggestionDistance = 2
+
+// Names shorter than this are too readily within reach of one another to be
+// worth suggesting.
+const minSuggestionLength = 5
+
+// Checks whether a tag about to be created is likely a typo of an existing tag.
+// If so the similar tags are suggested and, when run interactively, the user is
+// asked to confirm the creation of the new tag.
+func checkSimilarTagNames(tagName string, tags entities.Tags) error {
+	similarNames := similarTagNames(tagName, tags)
+	if len(similarNames) == 0 {
+		return nil
+	}
+
+	log.Warnf("no such tag '%v': did you mean '%v'?", tagName, strings.Join(similarNames, "', '"))
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("tag '%v' not created: use --force to create it", tagName)
+	}
+
+	if !confirm(fmt.Sprintf("create new tag '%v'?", tagName)) {
+		return fmt.Errorf("tag '%v' not created", tagName)
+	}
+
+	return nil
+}
+
+// Identifies the tags whose names are within a small edit distance of the
+// name, ignoring case.
+func similarTagNames(name string, tags entities.Tags) []string {
+	names := make([]string, 0, 1)
+	if utf8.RuneCountInString(name) < minSuggestionLength {
+		return names
+	}
+
+	lowerName := strings.ToLower(name)
+	for _, tag := range tags {
+		if tag.Name == name || utf8.RuneCountInString(tag.Name) < minSuggestionLength {
+			continue
+		}
+
+		if editDistance(lowerName, strings.ToLower(tag.Name)) <= maxSuggestionDistance {
+			names = append(names, tag.Name)
+		}
+	}
+
+	return names
+}
+
+// Calculates the Levenshtein distance between two strings: the minimum number
+// of single character insertions, deletions and substitutions to turn one into
+// the other.
+func editDistance(a, b string) int {
+	source := []rune(a)
+	target := []rune(b)
+
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for index := range previous {
+		previous[index] = index
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(target)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+
+	return min
+}
@@ -0,0 +1,55 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"testing"
+)
+
+func TestEditDistance(test *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"landscape", "landscape", 0},
+		{"lanscape", "landscape", 1},
+		{"landscpae", "landscape", 2},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"café", "cafe", 1},
+	}
+
+	for _, testCase := range cases {
+		if distance := editDistance(testCase.a, testCase.b); distance != testCase.distance {
+			test.Fatalf("Expected distance between '%v' and '%v' of %v but was %v.", testCase.a, testCase.b, testCase.distance, distance)
+		}
+	}
+}
+
+func TestSimilarTagNames(test *testing.T) {
+	tags := entities.Tags{&entities.Tag{1, "landscape"}, &entities.Tag{2, "Landscapes"}, &entities.Tag{3, "portrait"}, &entities.Tag{4, "cat"}}
+
+	names := similarTagNames("lanscape", tags)
+	if len(names) != 2 || names[0] != "landscape" || names[1] != "Landscapes" {
+		test.Fatalf("Unexpected similar names: %v", names)
+	}
+
+	if names := similarTagNames("car", tags); len(names) != 0 {
+		test.Fatalf("Expected no suggestions for short names but were: %v", names)
+	}
+}
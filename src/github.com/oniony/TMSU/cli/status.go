@@ -32,7 +32,7 @@ import (
 var StatusCommand = Command{
 	Name:     "status",
 	Synopsis: "List the file tagging status",
-	Usages:   []string{"tmsu status [PATH]..."},
+	Usages:   []string{"tmsu status [OPTION]... [PATH]..."},
 	Description: `Shows the status of PATHs.
 
 Where PATHs are not specified the status of the database is shown.
@@ -44,12 +44,35 @@ Where PATHs are not specified the status of the database is shown.
 
 Status codes of T, M and ! mean that the file has been tagged (and thus is in the TMSU database). Modified files are those with a different modification time or size to that in the database. Missing files are those in the database but that no longer exist in the file-system.
 
+The --state option restricts the output to files in the specified STATE, one of 'tagged', 'modified', 'missing' or 'untagged'. It may be specified more than once.
+
+With --count the number of files in each state is shown instead of the files themselves. If --state is also specified then only the total number of files in the specified states is shown.
+
+Files matching the patterns in any .tmsuignore file are not reported as untagged unless --no-ignore is specified. See 'tmsu help tag' for the format of these files.
+
+Symbolic links to directories found whilst looking for untagged files are reported but not descended into unless --follow-symlinks is specified. Each directory is examined at most once, so links that form cycles are safe to follow.
+
+To lessen the impact upon other programs, --io-throttle limits the examination of files to N per second. As status does not read the contents of files, a limit in megabytes, with the suffix MB, has no effect. By default there is no limit.
+
+Paths are shown relative to the working directory, or to DIR with --relative-to, where possible. Use --absolute to always show absolute paths. With --shell-quote each path is quoted, where necessary, as per the POSIX shell, so that the output may be pasted into a shell safely.
+
 Note: The 'repair' subcommand can be used to fix problems caused by files that have been modified or moved on disk.`,
 	Examples: []string{"$ tmsu status",
 		"$ tmsu status .",
-		"$ tmsu status --directory *"},
+		"$ tmsu status --directory *",
+		"$ tmsu status --state=missing --state=modified",
+		"$ tmsu status --count",
+		"$ tmsu status --io-throttle=500"},
 	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
-		Option{"--no-dereference", "-P", "do not follow symbolic links", false, ""}},
+		Option{"--state", "-s", "list only files in STATE (may be repeated)", true, ""},
+		Option{"--count", "-c", "list the number of files in each state rather than their names", false, ""},
+		Option{"--no-dereference", "-P", "do not follow symbolic links", false, ""},
+		Option{"--follow-symlinks", "-L", "descend into symbolic links to directories when looking for untagged files", false, ""},
+		Option{"--no-ignore", "", "do not skip files matched by .tmsuignore files", false, ""},
+		Option{"--io-throttle", "", "examine at most N files per second", true, ""},
+		Option{"--relative-to", "", "show paths relative to DIR", true, ""},
+		Option{"--absolute", "", "show absolute paths", false, ""},
+		Option{"--shell-quote", "", "quote paths for the shell where necessary", false, ""}},
 	Exec: statusExec,
 }
 
@@ -62,6 +85,11 @@ const (
 	MISSING  Status = '!'
 )
 
+var statusesByStateName = map[string]Status{"tagged": TAGGED, "modified": MODIFIED, "missing": MISSING, "untagged": UNTAGGED}
+
+// The order in which statuses are reported.
+var reportedStatuses = []Status{TAGGED, MODIFIED, MISSING, UNTAGGED}
+
 type StatusReport struct {
 	Rows []Row
 }
@@ -80,6 +108,19 @@ func (report *StatusReport) ContainsRow(path string) bool {
 	return false
 }
 
+// Counts the rows with any of the specified statuses.
+func (report *StatusReport) Count(statuses ...Status) uint {
+	var count uint
+
+	for _, row := range report.Rows {
+		if containsStatus(statuses, row.Status) {
+			count++
+		}
+	}
+
+	return count
+}
+
 type Row struct {
 	Path   string
 	Status Status
@@ -94,6 +135,36 @@ func NewReport() *StatusReport {
 func statusExec(options Options, args []string, databasePath string) (error, warnings) {
 	dirOnly := options.HasOption("--directory")
 	followSymlinks := !options.HasOption("--no-dereference")
+	count := options.HasOption("--count")
+
+	statuses, err := parseStates(options.Arguments("--state"))
+	if err != nil {
+		return err, nil
+	}
+	filtered := len(statuses) > 0
+	if !filtered {
+		statuses = reportedStatuses
+	}
+
+	style, err := pathStyleFor(options)
+	if err != nil {
+		return err, nil
+	}
+
+	// the file-system need only be walked when looking for untagged files
+	findUntagged := containsStatus(statuses, UNTAGGED)
+
+	var ignorer *_path.Ignorer
+	if !options.HasOption("--no-ignore") {
+		ignorer = _path.NewIgnorer()
+	}
+
+	walk := _path.NewWalk(options.HasOption("--follow-symlinks"))
+
+	throttle, err := ioThrottleOption(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -107,40 +178,89 @@ func statusExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	if previousAlgorithm := settings.PreviousFileFingerprintAlgorithm(); previousAlgorithm != "" {
+		warnFingerprintAlgorithmChanged(previousAlgorithm, settings.FileFingerprintAlgorithm())
+	}
+
 	var report *StatusReport
 
 	if len(args) == 0 {
-		report, err = statusDatabase(store, tx, dirOnly, followSymlinks)
+		report, err = statusDatabase(store, tx, dirOnly, followSymlinks, findUntagged, ignorer, walk, throttle)
 		if err != nil {
 			return err, nil
 		}
 	} else {
-		report, err = statusPaths(store, tx, args, dirOnly, followSymlinks)
+		report, err = statusPaths(store, tx, args, dirOnly, followSymlinks, findUntagged, ignorer, walk, throttle)
 		if err != nil {
 			return err, nil
 		}
 	}
 
-	printReport(report)
+	log.EndProgress()
+
+	switch {
+	case count && filtered:
+		fmt.Println(report.Count(statuses...))
+	case count:
+		printCounts(report, statuses)
+	default:
+		printReport(report, statuses, style)
+	}
 
 	return nil, nil
 }
 
-func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymlinks bool) (*StatusReport, error) {
+func parseStates(stateNames []string) ([]Status, error) {
+	statuses := make([]Status, 0, len(stateNames))
+
+	for _, stateName := range stateNames {
+		status, ok := statusesByStateName[strings.ToLower(stateName)]
+		if !ok {
+			return nil, fmt.Errorf("invalid state '%v': must be one of tagged, modified, missing, untagged", stateName)
+		}
+
+		if !containsStatus(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+func containsStatus(statuses []Status, status Status) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymlinks, findUntagged bool, ignorer *_path.Ignorer, walk *_path.Walk, throttle *_path.Throttle) (*StatusReport, error) {
 	report := NewReport()
 
-	log.Info(2, "retrieving all files from database.")
+	log.Info("retrieving all files from database.")
 
-	files, err := store.Files(tx, "name")
+	files, err := store.Files(tx, "path")
 	if err != nil {
 		return nil, fmt.Errorf("could not retrieve files: %v", err)
 	}
 
-	err = statusCheckFiles(files, report)
+	err = statusCheckFiles(files, report, throttle)
 	if err != nil {
 		return nil, err
 	}
 
+	if !findUntagged {
+		return report, nil
+	}
+
 	tree := _path.NewTree()
 	for _, file := range files {
 		tree.Add(file.Path(), file.IsDir)
@@ -152,7 +272,7 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymli
 	}
 
 	for _, path := range topLevelPaths {
-		if err = findNewFiles(path, report, dirOnly, followSymlinks); err != nil {
+		if err = findNewFiles(path, report, dirOnly, followSymlinks, ignorer, walk, throttle); err != nil {
 			return nil, err
 		}
 	}
@@ -160,7 +280,7 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymli
 	return report, nil
 }
 
-func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly, followSymlinks bool) (*StatusReport, error) {
+func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly, followSymlinks, findUntagged bool, ignorer *_path.Ignorer, walk *_path.Walk, throttle *_path.Throttle) (*StatusReport, error) {
 	report := NewReport()
 
 	for _, path := range paths {
@@ -169,7 +289,7 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
 
-		log.Infof(2, "%v: resolving file", path)
+		log.Infof("%v: resolving file", path)
 
 		resolvedPath := absPath
 
@@ -188,60 +308,68 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 			}
 		}
 
-		log.Infof(2, "%v: checking file in database", path)
+		log.Infof("%v: checking file in database", path)
 
 		file, err := store.FileByPath(tx, resolvedPath)
 		if err != nil {
 			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
 		}
 		if file != nil {
-			err = statusCheckFile(absPath, file, report)
+			err = statusCheckFile(absPath, file, report, throttle)
 			if err != nil {
 				return nil, err
 			}
 		}
 
 		if !dirOnly && (stat.Mode()&os.ModeSymlink == 0 || followSymlinks) {
-			log.Infof(2, "%v: retrieving files from database.", path)
+			log.Infof("%v: retrieving files from database.", path)
 
 			files, err := store.FilesByDirectory(tx, resolvedPath)
 			if err != nil {
 				return nil, fmt.Errorf("%v: could not retrieve files for directory: %v", path, err)
 			}
 
-			err = statusCheckFiles(files, report)
+			err = statusCheckFiles(files, report, throttle)
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		err = findNewFiles(absPath, report, dirOnly, followSymlinks)
-		if err != nil {
-			return nil, err
+		if findUntagged {
+			err = findNewFiles(absPath, report, dirOnly, followSymlinks, ignorer, walk, throttle)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return report, nil
 }
 
-func statusCheckFiles(files entities.Files, report *StatusReport) error {
+func statusCheckFiles(files entities.Files, report *StatusReport, throttle *_path.Throttle) error {
+	log.AddProgressTotal(uint(len(files)))
+
 	for _, file := range files {
-		if err := statusCheckFile(file.Path(), file, report); err != nil {
+		if err := statusCheckFile(file.Path(), file, report, throttle); err != nil {
 			return err
 		}
+
+		log.IncrementProgress()
 	}
 
 	return nil
 }
 
-func statusCheckFile(absPath string, file *entities.File, report *StatusReport) error {
-	log.Infof(2, "%v: checking file status.", absPath)
+func statusCheckFile(absPath string, file *entities.File, report *StatusReport, throttle *_path.Throttle) error {
+	log.Infof("%v: checking file status.", absPath)
+
+	throttle.Examined(0)
 
 	stat, err := os.Stat(file.Path())
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
-			log.Infof(2, "%v: file is missing.", absPath)
+			log.Infof("%v: file is missing.", absPath)
 
 			report.AddRow(Row{absPath, MISSING})
 			return nil
@@ -255,11 +383,11 @@ func statusCheckFile(absPath string, file *entities.File, report *StatusReport)
 		}
 	} else {
 		if stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime) {
-			log.Infof(2, "%v: file is modified.", absPath)
+			log.Infof("%v: file is modified.", absPath)
 
 			report.AddRow(Row{absPath, MODIFIED})
 		} else {
-			log.Infof(2, "%v: file is unchanged.", absPath)
+			log.Infof("%v: file is unchanged.", absPath)
 
 			report.AddRow(Row{absPath, TAGGED})
 		}
@@ -268,8 +396,10 @@ func statusCheckFile(absPath string, file *entities.File, report *StatusReport)
 	return nil
 }
 
-func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlinks bool) error {
-	log.Infof(2, "%v: finding new files.", searchPath)
+func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlinks bool, ignorer *_path.Ignorer, walk *_path.Walk, throttle *_path.Throttle) error {
+	log.Infof("%v: finding new files.", searchPath)
+
+	throttle.Examined(0)
 
 	absPath, err := filepath.Abs(searchPath)
 	if err != nil {
@@ -294,6 +424,11 @@ func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlin
 	}
 
 	if !dirOnly && stat.IsDir() {
+		if !walk.Enter(absPath) {
+			log.Infof("%v: skipping directory already examined via a symbolic link.", searchPath)
+			return nil
+		}
+
 		dir, err := os.Open(absPath)
 		if err != nil {
 			return fmt.Errorf("%v: could not open file: %v", searchPath, err)
@@ -306,34 +441,67 @@ func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlin
 
 		sort.Strings(dirNames)
 
+		log.AddProgressTotal(uint(len(dirNames)))
+
 		for _, dirName := range dirNames {
 			dirPath := filepath.Join(absPath, dirName)
-			err = findNewFiles(dirPath, report, dirOnly, followSymlinks)
+
+			ignored, err := ignorer.Ignored(dirPath)
 			if err != nil {
 				return err
 			}
+			if ignored {
+				log.Infof("%v: ignored.", dirPath)
+				log.IncrementProgress()
+				continue
+			}
+
+			if !walk.Follows(dirPath) {
+				log.Infof("%v: not descending into symbolic link.", dirPath)
+				if !report.ContainsRow(dirPath) {
+					report.AddRow(Row{dirPath, UNTAGGED})
+				}
+				log.IncrementProgress()
+				continue
+			}
+
+			err = findNewFiles(dirPath, report, dirOnly, followSymlinks, ignorer, walk, throttle)
+			if err != nil {
+				return err
+			}
+
+			log.IncrementProgress()
 		}
 	}
 
 	return nil
 }
 
-func printReport(report *StatusReport) {
-	printRows(report.Rows, TAGGED)
-	printRows(report.Rows, MODIFIED)
-	printRows(report.Rows, MISSING)
-	printRows(report.Rows, UNTAGGED)
+func printReport(report *StatusReport, statuses []Status, style pathStyle) {
+	for _, status := range reportedStatuses {
+		if containsStatus(statuses, status) {
+			printRows(report.Rows, status, style)
+		}
+	}
+}
+
+func printCounts(report *StatusReport, statuses []Status) {
+	for _, status := range reportedStatuses {
+		if containsStatus(statuses, status) {
+			fmt.Printf("%v %v\n", string(status), report.Count(status))
+		}
+	}
 }
 
-func printRows(rows []Row, status Status) {
+func printRows(rows []Row, status Status, style pathStyle) {
 	for _, row := range rows {
 		if row.Status == status {
-			printRow(row)
+			printRow(row, style)
 		}
 	}
 }
 
-func printRow(row Row) {
-	relPath := _path.Rel(row.Path)
+func printRow(row Row, style pathStyle) {
+	relPath := style.format(row.Path)
 	fmt.Printf("%v %v\n", string(row.Status), relPath)
 }
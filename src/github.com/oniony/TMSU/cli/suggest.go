@@ -0,0 +1,108 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/text"
+	"strconv"
+)
+
+var SuggestCommand = Command{
+	Name:     "suggest",
+	Synopsis: "Suggest tags for a file",
+	Usages:   []string{"tmsu suggest [OPTION]... FILE"},
+	Description: `Suggests tags for FILE based upon the tags of similarly tagged files.
+
+The files that share at least one tag with FILE are examined and the tags applied to them, but not to FILE, are listed with the most common first. Tags that FILE has by implication are not suggested.
+
+A file that is not in the database is matched to a tagged file with the same fingerprint, as with the 'diff' subcommand.`,
+	Examples: []string{"$ tmsu suggest beach.jpg\nholiday\nsea",
+		"$ tmsu suggest --frequency beach.jpg\nholiday: 12\nsea: 3",
+		"$ tmsu suggest --top=1 beach.jpg\nholiday"},
+	Options: Options{{"--top", "", "list at most TOP tags, or all tags if 0 (default: 10)", true, ""},
+		{"--frequency", "-f", "show the number of similarly tagged files with each tag", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links", false, ""}},
+	Exec: suggestExec,
+}
+
+// unexported
+
+func suggestExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 1 {
+		return fmt.Errorf("too few arguments"), nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	showFrequency := options.HasOption("--frequency")
+	followSymlinks := !options.HasOption("--no-dereference")
+
+	top := 10
+	if options.HasOption("--top") {
+		argument := options.Get("--top").Argument
+
+		var err error
+		top, err = strconv.Atoi(argument)
+		if err != nil || top < 0 {
+			return fmt.Errorf("invalid number of tags '%v': must be a non-negative integer", argument), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	path := args[0]
+
+	file, err := resolveFileOrCopy(store, tx, path, followSymlinks)
+	if err != nil {
+		return err, nil
+	}
+	if file == nil {
+		return nil, warnings{fmt.Sprintf("%v: not tagged", path)}
+	}
+
+	suggestions, err := store.CooccurringTags(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve suggested tags: %v", path, err), nil
+	}
+
+	if top > 0 && len(suggestions) > top {
+		suggestions = suggestions[:top]
+	}
+
+	for _, suggestion := range suggestions {
+		tagName := text.Escape(suggestion.Name, '=', ' ')
+
+		if showFrequency {
+			fmt.Printf("%v: %v\n", tagName, suggestion.FileCount)
+		} else {
+			fmt.Println(tagName)
+		}
+	}
+
+	return nil, nil
+}
@@ -18,16 +18,21 @@ package cli
 import (
 	"bufio"
 	"fmt"
-	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/metadata"
 	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/tmsu"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var TagCommand = Command{
@@ -35,7 +40,10 @@ var TagCommand = Command{
 	Synopsis: "Apply tags to files",
 	Usages: []string{"tmsu tag [OPTION]... FILE TAG[=VALUE]...",
 		`tmsu tag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
+		`tmsu tag [OPTION]... --tags="TAG[=VALUE]..." -`,
+		"tmsu tag [OPTION]... --tags-from=TAGFILE FILE...",
 		"tmsu tag [OPTION]... --from=SOURCE FILE...",
+		"tmsu tag [OPTION]... --like=SOURCE FILE...",
 		"tmsu tag [OPTION]... --where=QUERY TAG[=VALUE]...",
 		"tmsu tag [OPTION]... --create {TAG|=VALUE}...",
 		"tmsu tag [OPTION[... -"},
@@ -43,40 +51,83 @@ var TagCommand = Command{
 
 Optionally tags applied to files may be attributed with a VALUE using the TAG=VALUE syntax.
 
-Tag and value names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names cannot contain the slash '/' or backslash '\' characters.
+Tag and value names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names cannot contain the backslash '\' character. The slash '/' may be used to organise tags hierarchically, e.g. 'location/europe/france': see the 'files' subcommand.
 
 Tags will not be applied if they are already implied by tag implications. This behaviour can be overridden with the --explicit option. See the 'imply' subcommand for more information.
 
+With --allow-missing, files that do not yet exist, e.g. those about to be downloaded, may be tagged. They are recorded without a fingerprint, which 'tmsu repair' calculates once the file is present.
+
+With --no-create, only tags that already exist (or their aliases) may be applied: should any of the tags not exist then no tags are applied and the command fails. With --skip-missing-tags, such tags are instead skipped with a warning and the remaining tags applied. Either option ensures that typos cannot create new tags, e.g. when enforcing a controlled vocabulary in scripts.
+
+To catch typos, a new tag whose name is within two edits of an existing tag's name, e.g. 'lanscape' for 'landscape', is not created without confirmation. The similar tags are suggested and, when run from a terminal, the creation of the new tag must be confirmed. Otherwise it must be forced with --force.
+
+When tagging recursively, the fingerprints of new files are computed concurrently using the number of threads specified by --threads, which defaults to the number of CPUs. Database updates are still applied one at a time in a single transaction.
+
+When tagging recursively, files and directories matching the glob patterns listed in a .tmsuignore file are skipped. The patterns in a .tmsuignore file apply to the directory containing it and all of its descendants. Patterns without a slash, e.g. '*.o', match any file name whilst those with a slash, e.g. '/build/*.tmp', match against the path relative to the directory containing the .tmsuignore file. A trailing slash, e.g. 'cache/', matches directories only. Blank lines and lines beginning with '#' are ignored. Use --no-ignore to tag these files regardless.
+
+When tagging recursively, symbolic links to directories within the directories being tagged are tagged but not descended into unless --follow-symlinks is specified. Each directory is tagged at most once, however it is reached, so links that form cycles are safe to follow. Symbolic links specified as FILE arguments are always descended into.
+
+By default a symbolic link is dereferenced and its target is tagged. With --no-dereference the link itself is added to the database and tagged instead, with the link's own modification time and size. The link is fingerprinted according to the 'symlinkFingerprintAlgorithm' setting: the default, 'follow', fingerprints the target's contents whilst 'targetName' fingerprints the path the link points to. 'tmsu repair' likewise examines such links without following them, so a link is only reported as modified when the link itself changes.
+
+When tagging recursively with --modified-since, files last modified before TIME are skipped: neither added to the database and fingerprinted nor tagged. TIME may be a date (YYYY-MM-DD), a time (YYYY-MM-DDTHH:MM:SS) or a duration (e.g. 12h or 7d) indicating how long ago. Directories are always descended. This makes periodically re-tagging a large collection considerably faster.
+
+The --from option, or its synonym --like, applies the tags and values of the SOURCE file to each FILE, which is useful when tagging a series of similar files. Only the tags explicitly applied to SOURCE are copied unless --include-implied is specified, in which case its implied tags are copied too.
+
 If a single argument of - is passed, TMSU will read lines from standard input in the format 'FILE TAG[=VALUE]...'.
 
-Note: The equals '=' and whitespace characters must be escaped with a backslash '\' when used within a tag or value name. However, your shell may use the backslash for its own purposes: this can normally be avoided by enclosing the argument in single quotation marks or by escaping the backslash with an additional backslash '\\'.`,
+The --tags-from option reads the TAGs and VALUEs to apply from TAGFILE, one or more per line. Blank lines and lines beginning with '#' are ignored. It may be combined with --tags.
+
+If the tags are specified with --tags or --tags-from and a single FILE argument of - is passed, TMSU will instead read the paths of the files to tag from standard input, one per line (or delimited by NUL characters if --null is specified). This avoids command-line length limits when tagging large numbers of files.
+
+With --from-exif, tags are additionally applied to each file from the metadata embedded within it, currently the EXIF and XMP metadata of JPEG images, or held within an XMP sidecar file of the same name, e.g. 'photo.xmp' for 'photo.jpg'. The 'metadataTags' setting determines which fields are applied: by default the keywords are applied as tags, the original date as a 'date' value and the camera model as a 'camera' value. Files without metadata are tagged with just the tags specified. See the 'config' subcommand.
+
+If the 'postTagHook' setting names an executable then it is run for each file to which tags are applied by this subcommand, e.g. to generate a thumbnail. It is passed the file's path followed by the tags applied as TAG or TAG=VALUE arguments. These are also available in the environment variables TMSU_FILE and TMSU_TAGS. The hook is run whilst the database is being updated so should not itself apply tags. Should the hook fail a warning is shown but the tags are still applied. See the 'config' subcommand.
+
+Each TAG=VALUE is split at the first equals '=' character, so an equals character within a tag name must be escaped with a backslash '\', e.g. 'one\=two', whereas a value may contain further equals characters as they are, e.g. 'formula=a=b'. Where tags are given as separate arguments a value may contain whitespace, commas and colons, e.g. 'title=A, B: and C'. With --tags, --tags-from and standard input, where the tags are separated by whitespace, a value containing whitespace must instead be enclosed in single or double quotation marks, e.g. --tags='title="A, B: and C" year=2017', or the whitespace escaped with a backslash. Within quotation marks only the quotation mark and the backslash may be escaped.
+
+Note: Your shell may use the backslash, quotation marks and other punctuation for its own purposes: this can normally be avoided by enclosing the argument in single quotation marks or by escaping the backslash with an additional backslash '\\'.`,
 	Examples: []string{"$ tmsu tag mountain1.jpg photo landscape holiday good country=france",
 		"$ tmsu tag --from=mountain1.jpg mountain2.jpg",
+		"$ tmsu tag --like=episode1.mkv --include-implied episode2.mkv episode3.mkv",
+		"$ tmsu tag --from-exif --recursive ~/pictures photo",
 		`$ tmsu tag --tags="landscape" field1.jpg field2.jpg`,
+		`$ find . -name '*.jpg' -print0 | tmsu tag --null --tags="photo" -`,
+		"$ tmsu tag --tags-from=holiday-tags.txt *.jpg",
+		"$ tmsu tag --recursive --modified-since=1d --tags=photo ~/pictures",
+		"$ tmsu tag --no-create holiday.jpg beach sunset",
 		"$ tmsu tag --create bad rubbish awful =2017",
 		`$ tmsu tag --where="bad and good" confused`,
-		"$ tmsu tag sheep.jpg '<tag>'"},
+		"$ tmsu tag sheep.jpg '<tag>'",
+		"$ tmsu tag book.pdf 'title=A, B: and C' 'formula=a=b'",
+		`$ tmsu tag --tags='title="A, B: and C" lang=日本語' book.pdf`},
 	Options: Options{{"--tags", "-t", "the set of tags to apply", true, ""},
+		{"--tags-from", "-T", "read the set of tags to apply from TAGFILE", true, ""},
 		{"--recursive", "-r", "recursively apply tags to directory contents", false, ""},
 		{"--include-hidden", "-H", "don't skip hidden files/directories when tagging recursively", false, ""},
+		{"--no-ignore", "", "don't skip files matched by .tmsuignore files when tagging recursively", false, ""},
+		{"--threads", "", "the number of THREADS with which to fingerprint files when tagging recursively", true, ""},
+		{"--modified-since", "", "skip files last modified before TIME when tagging recursively", true, ""},
 		{"--from", "-f", "copy tags from the SOURCE file", true, ""},
+		{"--like", "", "copy tags from the SOURCE file (synonym of --from)", true, ""},
+		{"--include-implied", "", "also copy the implied tags of the SOURCE file", false, ""},
+		{"--from-exif", "", "also apply tags from the files' EXIF and XMP metadata", false, ""},
 		{"--where", "-w", "tags files matching QUERY", true, ""},
 		{"--create", "-c", "create tags or values without tagging any files", false, ""},
 		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
-		{"--force", "-F", "apply tags to non-existent or non-permissioned paths", false, ""},
-		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""}},
-	Exec: tagExec,
+		{"--allow-missing", "", "apply tags to paths that do not yet exist", false, ""},
+		{"--no-create", "", "fail rather than create tags that do not already exist", false, ""},
+		{"--skip-missing-tags", "", "skip tags that do not already exist with a warning rather than create them", false, ""},
+		{"--force", "-F", "apply tags to non-existent or non-permissioned paths and create tags similar to existing ones", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""},
+		{"--follow-symlinks", "-L", "descend into symbolic links to directories when tagging recursively", false, ""},
+		{"--null", "-0", "paths read from standard input are delimited by NUL rather than newline", false, ""}},
+	Exec:     tagExec,
+	Modifies: true,
 }
 
 // unexported
 
 func tagExec(options Options, args []string, databasePath string) (error, warnings) {
-	recursive := options.HasOption("--recursive")
-	includeHidden := options.HasOption("--include-hidden")
-	explicit := options.HasOption("--explicit")
-	force := options.HasOption("--force")
-	followSymlinks := !options.HasOption("--no-dereference")
-
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -89,19 +140,84 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 	}
 	defer tx.Commit()
 
+	return tagInTx(store, tx, options, args)
+}
+
+// Applies the tags specified by the options and arguments within an existing
+// transaction.
+func tagInTx(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
+	recursive := options.HasOption("--recursive")
+	includeHidden := options.HasOption("--include-hidden")
+	explicit := options.HasOption("--explicit")
+	force := options.HasOption("--force")
+	allowMissing := options.HasOption("--allow-missing")
+	followSymlinks := !options.HasOption("--no-dereference")
+	skipMissingTags := options.HasOption("--skip-missing-tags")
+	noCreate := options.HasOption("--no-create") || skipMissingTags
+
+	var ignorer *_path.Ignorer
+	if !options.HasOption("--no-ignore") {
+		ignorer = _path.NewIgnorer()
+	}
+
+	walk := _path.NewWalk(options.HasOption("--follow-symlinks"))
+
+	threads, err := threadsOption(options)
+	if err != nil {
+		return err, nil
+	}
+
+	var modifiedSince time.Time
+	if options.HasOption("--modified-since") {
+		if !recursive {
+			return fmt.Errorf("the --modified-since option requires --recursive"), nil
+		}
+
+		argument := options.Get("--modified-since").Argument
+
+		var ok bool
+		modifiedSince, ok = query.ParseTime(argument, time.Now())
+		if !ok {
+			return fmt.Errorf("invalid time '%v': expected YYYY-MM-DD, YYYY-MM-DDTHH:MM:SS or a duration such as 7d", argument), nil
+		}
+	}
+
+	var extractor metadata.Extractor
+	if options.HasOption("--from-exif") {
+		extractor = metadata.NewExtractor()
+	}
+
 	switch {
 	case options.HasOption("--create"):
+		if noCreate {
+			return fmt.Errorf("the --create option cannot be combined with --no-create or --skip-missing-tags"), nil
+		}
 		if len(args) == 0 {
 			return fmt.Errorf("too few arguments"), nil
 		}
 
 		return createTagsValues(store, tx, args)
-	case options.HasOption("--tags"):
+	case options.HasOption("--tags"), options.HasOption("--tags-from"):
 		if len(args) < 1 {
 			return fmt.Errorf("too few arguments"), nil
 		}
 
-		tagArgs := text.Tokenize(options.Get("--tags").Argument)
+		tagArgs := []string{}
+		if options.HasOption("--tags") {
+			tagArgs = text.Tokenize(options.Get("--tags").Argument)
+		}
+
+		if options.HasOption("--tags-from") {
+			lines, err := readCommentedLines(options.Get("--tags-from").Argument)
+			if err != nil {
+				return err, nil
+			}
+
+			for _, line := range lines {
+				tagArgs = append(tagArgs, text.Tokenize(line)...)
+			}
+		}
+
 		if len(tagArgs) == 0 {
 			return fmt.Errorf("too few arguments"), nil
 		}
@@ -111,20 +227,46 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 			return fmt.Errorf("too few arguments"), nil
 		}
 
-		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, followSymlinks)
-	case options.HasOption("--from"):
+		if len(paths) == 1 && paths[0] == "-" {
+			if options.HasOption("--tags-from") && options.Get("--tags-from").Argument == "-" {
+				return fmt.Errorf("cannot read both tags and paths from standard input"), nil
+			}
+
+			delimiter := byte('\n')
+			if options.HasOption("--null") {
+				delimiter = '\000'
+			}
+
+			var err error
+			paths, err = readStandardInputPaths(delimiter)
+			if err != nil {
+				return err, nil
+			}
+		}
+
+		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, noCreate, skipMissingTags, threads, ignorer, walk, modifiedSince, extractor)
+	case options.HasOption("--from"), options.HasOption("--like"):
+		if options.HasOption("--from") && options.HasOption("--like") {
+			return fmt.Errorf("the --from and --like options are mutually exclusive"), nil
+		}
 		if len(args) < 1 {
 			return fmt.Errorf("too few arguments"), nil
 		}
 
-		fromPath, err := filepath.Abs(options.Get("--from").Argument)
+		source := options.Get("--from")
+		if source == nil {
+			source = options.Get("--like")
+		}
+
+		fromPath, err := filepath.Abs(source.Argument)
 		if err != nil {
 			return fmt.Errorf("%v: could not get absolute path: %v", fromPath, err), nil
 		}
 
 		paths := args
+		includeImplied := options.HasOption("--include-implied")
 
-		return tagFrom(store, tx, fromPath, paths, explicit, recursive, includeHidden, force, followSymlinks)
+		return tagFrom(store, tx, fromPath, paths, explicit, includeImplied, recursive, includeHidden, force, allowMissing, followSymlinks, threads, ignorer, walk, modifiedSince, extractor)
 	case options.HasOption("--where"):
 		if len(args) < 1 {
 			return fmt.Errorf("too few arguments"), nil
@@ -133,9 +275,9 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 		query := options.Get("--where").Argument
 		tagArgs := args
 
-		return tagWhere(store, tx, query, explicit, tagArgs)
+		return tagWhere(store, tx, query, explicit, force, noCreate, skipMissingTags, tagArgs)
 	case len(args) == 1 && args[0] == "-":
-		return readStandardInput(store, tx, recursive, includeHidden, explicit, force, followSymlinks)
+		return readStandardInput(store, tx, recursive, includeHidden, explicit, force, allowMissing, followSymlinks, noCreate, skipMissingTags, threads, ignorer, walk, modifiedSince, extractor)
 	default:
 		if len(args) < 2 {
 			return fmt.Errorf("too few arguments"), nil
@@ -144,7 +286,7 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 		paths := args[0:1]
 		tagArgs := args[1:]
 
-		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, followSymlinks)
+		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, noCreate, skipMissingTags, threads, ignorer, walk, modifiedSince, extractor)
 	}
 }
 
@@ -188,23 +330,26 @@ func createTagsValues(store *storage.Storage, tx *storage.Tx, tagArgs []string)
 	return nil, warnings
 }
 
-func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, includeHidden, force, followSymlinks bool) (error, warnings) {
+func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, noCreate, skipMissingTags bool, threads int, ignorer *_path.Ignorer, walk *_path.Walk, modifiedSince time.Time, extractor metadata.Extractor) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
-	log.Infof(2, "loading settings")
+	log.Infof("loading settings")
 
-	settings, err := store.Settings(tx)
+	batch, err := tmsu.NewBatch(store, tx)
 	if err != nil {
 		return err, warnings
 	}
+	settings := batch.Settings()
 
-	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, warnings)
+	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, force, noCreate, skipMissingTags, warnings)
 	if err != nil {
 		return err, warnings
 	}
 
+	fingerprinter := tmsu.NewFingerprinter(settings, threads)
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, batch, path, pairs, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, fingerprinter, ignorer, walk, modifiedSince, extractor); err != nil {
 			switch {
 			case os.IsPermission(err):
 				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
@@ -219,34 +364,27 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 	return nil, warnings
 }
 
-func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, recursive, includeHidden, force, followSymlinks bool) (error, warnings) {
-	log.Infof(2, "loading settings")
+func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, includeImplied, recursive, includeHidden, force, allowMissing, followSymlinks bool, threads int, ignorer *_path.Ignorer, walk *_path.Walk, modifiedSince time.Time, extractor metadata.Extractor) (error, warnings) {
+	log.Infof("loading settings")
 
-	settings, err := store.Settings(tx)
+	batch, err := tmsu.NewBatch(store, tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve settings: %v", err), nil
+		return err, nil
 	}
 
-	stat, err := os.Lstat(fromPath)
-	if err != nil {
+	if _, err := os.Lstat(fromPath); err != nil {
 		return err, nil
 	}
-	if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-		fromPath, err = _path.Dereference(fromPath)
-		if err != nil {
-			return err, nil
-		}
-	}
 
-	file, err := store.FileByPath(tx, fromPath)
+	fromPath, file, err := batch.ResolveFile(fromPath, followSymlinks)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", fromPath, err), nil
+		return err, nil
 	}
 	if file == nil {
 		return fmt.Errorf("%v: path is not tagged", fromPath), nil
 	}
 
-	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, !includeImplied)
 	if err != nil {
 		return fmt.Errorf("%v: could not retrieve filetags: %v", fromPath, err), nil
 	}
@@ -258,8 +396,10 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 
 	warnings := make(warnings, 0, 10)
 
+	fingerprinter := tmsu.NewFingerprinter(batch.Settings(), threads)
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, batch, path, pairs, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, fingerprinter, ignorer, walk, modifiedSince, extractor); err != nil {
 			switch {
 			case os.IsPermission(err):
 				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
@@ -274,135 +414,97 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 	return nil, warnings
 }
 
-func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit bool, tagArgs []string) (error, warnings) {
+func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit, force, noCreate, skipMissingTags bool, tagArgs []string) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
-	log.Infof(2, "loading settings")
+	log.Infof("loading settings")
 
-	settings, err := store.Settings(tx)
+	batch, err := tmsu.NewBatch(store, tx)
 	if err != nil {
 		return err, warnings
 	}
 
-	log.Info(2, "parsing query")
+	log.Info("parsing query")
 
 	expression, err := query.Parse(queryText)
 	if err != nil {
 		return fmt.Errorf("could not parse query: %v", err), warnings
 	}
 
-	log.Info(2, "querying files")
+	log.Info("querying files")
 
-	files, err := store.FilesForQuery(tx, expression, "", explicit, false, "none")
+	files, err := batch.Files(expression, "", explicit, false, "none", false, 0, 0)
 	if err != nil {
 		return err, warnings
 	}
 
-	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, warnings)
+	pairs, warnings, err := parseTagValuePairs(store, tx, batch.Settings(), tagArgs, force, noCreate, skipMissingTags, warnings)
 	if err != nil {
 		return err, warnings
 	}
 
-	log.Infof(2, "applying tags to %v files", len(files))
+	log.Infof("applying tags to %v files", len(files))
 
 	for _, file := range files {
-		for _, pair := range pairs {
-			if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
-				return fmt.Errorf("could not apply tags: %v", err), warnings
+		if _, err := batch.TagFile(file, pairs, true); err != nil {
+			if _, ok := err.(tmsu.PostTagHookError); !ok {
+				return err, warnings
 			}
+
+			log.Warn(err.Error())
 		}
 	}
 
 	return nil, warnings
 }
 
-func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
-	}
+func tagPath(store *storage.Storage, tx *storage.Tx, batch *tmsu.Batch, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, force, allowMissing, followSymlinks bool, fingerprinter *tmsu.Fingerprinter, ignorer *_path.Ignorer, walk *_path.Walk, modifiedSince time.Time, extractor metadata.Extractor) error {
+	log.Infof("%v: resolving path", path)
 
-	log.Infof(2, "%v: resolving path", path)
-
-	stat, err := os.Lstat(absPath)
+	file, err := batch.AddFile(path, tmsu.AddOptions{followSymlinks, allowMissing, force, fingerprinter})
 	if err != nil {
-		switch {
-		case os.IsNotExist(err), os.IsPermission(err):
-			if force {
-				// force tag even though can't access file
-				stat = emptyStat{}
-			} else {
-				return err
-			}
-		default:
-			return err
-		}
-	} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-		absPath, err = _path.Dereference(absPath)
-		if err != nil {
-			// can't honour 'force' as we don't know the target path
-			return err
-		}
-
-		stat, err = os.Lstat(absPath)
-		if err != nil {
-			return err
-		}
+		return err
+	}
+	if file.Duplicate {
+		log.Warnf("'%v' is a duplicate", path)
 	}
 
-	log.Infof(2, "%v: checking if file exists in database", path)
+	absPath := file.Path()
 
-	file, err := store.FileByPath(tx, absPath)
-	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	stat := file.Stat
+	if stat == nil {
+		// force tag even though can't access file
+		stat = emptyStat{}
 	}
-	if file == nil {
-		log.Infof(2, "%v: creating fingerprint", path)
 
-		fp, err := fingerprint.Create(absPath, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg)
+	if extractor != nil && !stat.IsDir() && stat.Size() > 0 {
+		metadataPairs, err := metadataTagValuePairs(store, tx, batch.Settings(), extractor, absPath)
 		if err != nil {
-			if !force || !(os.IsNotExist(err) || os.IsPermission(err)) {
-				return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
-			}
+			return fmt.Errorf("%v: could not apply metadata tags: %v", path, err)
 		}
 
-		if fp != fingerprint.Empty && reportDuplicates {
-			log.Infof(2, "%v: checking for duplicates", path)
-
-			count, err := store.FileCountByFingerprint(tx, fp)
-			if err != nil {
-				return fmt.Errorf("%v: could not identify duplicates: %v", path, err)
-			}
-			if count != 0 {
-				log.Warnf("'%v' is a duplicate", path)
-			}
-		}
+		// copied so as not to alter the pairs shared with other files
+		pairs = append(pairs[:len(pairs):len(pairs)], metadataPairs...)
+	}
 
-		log.Infof(2, "%v: adding file", path)
+	log.Infof("%v: applying tags.", path)
 
-		file, err = store.AddFile(tx, absPath, fp, stat.ModTime(), int64(stat.Size()), stat.IsDir())
-		if err != nil {
-			return fmt.Errorf("%v: could not add file to database: %v", path, err)
+	pairs, err = batch.TagFile(file.File, pairs, explicit)
+	if err != nil {
+		if _, ok := err.(tmsu.PostTagHookError); !ok {
+			return err
 		}
-	}
 
-	if !explicit {
-		pairs, err = removeAlreadyAppliedTagValuePairs(store, tx, pairs, file)
-		if err != nil {
-			return fmt.Errorf("%v: could not remove applied tags: %v", path, err)
-		}
+		log.Warn(err.Error())
 	}
 
-	log.Infof(2, "%v: applying tags.", path)
-
-	for _, pair := range pairs {
-		if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
-			return fmt.Errorf("%v: could not apply tags: %v", path, err)
+	if recursive && isWalkableDirectory(absPath, stat, walk) {
+		if !walk.Enter(absPath) {
+			log.Infof("%v: skipping directory already tagged via a symbolic link", path)
+			return nil
 		}
-	}
 
-	if recursive && stat.IsDir() {
-		if err = tagRecursively(store, tx, absPath, pairs, explicit, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		if err = tagRecursively(store, tx, batch, absPath, pairs, explicit, includeHidden, force, allowMissing, followSymlinks, fingerprinter, ignorer, walk, modifiedSince, extractor); err != nil {
 			return err
 		}
 	}
@@ -410,10 +512,11 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 	return nil
 }
 
-func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entities.Settings, tagArgs []string, warnings warnings) (entities.TagIdValueIdPairs, warnings, error) {
-	log.Info(2, "parsing tag/value pairs")
+func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entities.Settings, tagArgs []string, force, noCreate, skipMissingTags bool, warnings warnings) (entities.TagIdValueIdPairs, warnings, error) {
+	log.Info("parsing tag/value pairs")
 
 	pairs := make(entities.TagIdValueIdPairs, 0, len(tagArgs))
+	var existingTags entities.Tags
 
 	for _, tagArg := range tagArgs {
 		tagName, valueName := parseTagEqValueName(tagArg)
@@ -423,17 +526,40 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 			return nil, warnings, err
 		}
 		if tag == nil {
-			if settings.AutoCreateTags() {
+			switch {
+			case skipMissingTags:
+				warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
+				continue
+			case noCreate:
+				return nil, warnings, NoSuchTagError{tagName}
+			case settings.AutoCreateTags():
+				if !force {
+					if existingTags == nil {
+						existingTags, err = store.Tags(tx)
+						if err != nil {
+							return nil, warnings, fmt.Errorf("could not retrieve tags: %v", err)
+						}
+					}
+
+					if err := checkSimilarTagNames(tagName, existingTags); err != nil {
+						return nil, warnings, err
+					}
+				}
+
 				tag, err = createTag(store, tx, tagName)
 				if err != nil {
 					return nil, warnings, err
 				}
-			} else {
+			default:
 				warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
 				continue
 			}
 		}
 
+		if err := store.ValidateValue(tx, tag, valueName); err != nil {
+			return nil, warnings, err
+		}
+
 		value, err := store.ValueByName(tx, valueName)
 		if err != nil {
 			return nil, warnings, err
@@ -456,7 +582,7 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 	return pairs, warnings, nil
 }
 
-func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includeHidden, explicit, force, followSymlinks bool) (error, warnings) {
+func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includeHidden, explicit, force, allowMissing, followSymlinks, noCreate, skipMissingTags bool, threads int, ignorer *_path.Ignorer, walk *_path.Walk, modifiedSince time.Time, extractor metadata.Extractor) (error, warnings) {
 	reader := bufio.NewReader(os.Stdin)
 
 	warnings := make(warnings, 0, 10)
@@ -481,7 +607,7 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 		path := words[0]
 		tagArgs := words[1:]
 
-		err, commandWarnings := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, includeHidden, force, followSymlinks)
+		err, commandWarnings := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, noCreate, skipMissingTags, threads, ignorer, walk, modifiedSince, extractor)
 		if err != nil {
 			warnings = append(warnings, err.Error())
 		}
@@ -493,7 +619,38 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 	return nil, warnings
 }
 
-func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
+func readStandardInputPaths(delimiter byte) ([]string, error) {
+	log.Info("reading paths from standard input")
+
+	reader := bufio.NewReader(os.Stdin)
+
+	paths := make([]string, 0, 10)
+	for {
+		path, err := reader.ReadString(delimiter)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("could not read standard input: %v", err)
+		}
+
+		if len(path) > 0 && path[len(path)-1] == delimiter {
+			path = path[:len(path)-1]
+		}
+		if delimiter == '\n' {
+			// lines may have Windows line endings
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return paths, nil
+}
+
+func tagRecursively(store *storage.Storage, tx *storage.Tx, batch *tmsu.Batch, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, force, allowMissing, followSymlinks bool, fingerprinter *tmsu.Fingerprinter, ignorer *_path.Ignorer, walk *_path.Walk, modifiedSince time.Time, extractor metadata.Extractor) error {
 	osFile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not open path: %v", path, err)
@@ -505,54 +662,136 @@ func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs [
 		return fmt.Errorf("%v: could not retrieve directory contents: %v", path, err)
 	}
 
+	childPaths := make([]string, 0, len(childNames))
 	for _, childName := range childNames {
 		childPath := filepath.Join(path, childName)
 		if childName[0] == '.' && !includeHidden {
-			log.Infof(2, "%v: skipping hidden file/directory", childPath)
+			log.Infof("%v: skipping hidden file/directory", childPath)
 			continue
 		}
 
-		if err = tagPath(store, tx, childPath, pairs, explicit, true, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		ignored, err := ignorer.Ignored(childPath)
+		if err != nil {
+			return err
+		}
+		if ignored {
+			log.Infof("%v: skipping ignored file/directory", childPath)
+			continue
+		}
+
+		if !modifiedSince.IsZero() && !modifiedSinceTime(childPath, modifiedSince, followSymlinks) {
+			log.Infof("%v: skipping unmodified file", childPath)
+			continue
+		}
+
+		childPaths = append(childPaths, childPath)
+	}
+
+	if err := prefetchFingerprints(store, tx, childPaths, fingerprinter); err != nil {
+		return err
+	}
+
+	log.AddProgressTotal(uint(len(childPaths)))
+
+	for _, childPath := range childPaths {
+		recursive := walk.Follows(childPath)
+		if !recursive {
+			log.Infof("%v: not descending into symbolic link", childPath)
+		}
+
+		if err = tagPath(store, tx, batch, childPath, pairs, explicit, recursive, includeHidden, force, allowMissing, followSymlinks, fingerprinter, ignorer, walk, modifiedSince, extractor); err != nil {
 			return err
 		}
+
+		log.IncrementProgress()
 	}
 
 	return nil
 }
 
-func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, pairs []entities.TagIdValueIdPair, file *entities.File) ([]entities.TagIdValueIdPair, error) {
-	log.Infof(2, "%v: determining existing file-tags", file.Path())
-
-	existingFileTags, err := store.FileTagsByFileId(tx, file.Id, false)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
+// Determines whether the tagged file is a directory whose contents should be
+// tagged: a symbolic link that was not dereferenced is walked only if symbolic
+// links are being followed.
+func isWalkableDirectory(absPath string, stat os.FileInfo, walk *_path.Walk) bool {
+	if stat.Mode()&os.ModeSymlink == 0 {
+		return stat.IsDir()
+	}
+	if !walk.FollowSymlinks {
+		return false
 	}
 
-	log.Infof(2, "%v: determining implied tags", file.Path())
+	targetStat, err := os.Stat(absPath)
+	return err == nil && targetStat.IsDir()
+}
 
-	newImplications, err := store.ImplicationsFor(tx, pairs...)
+// Determines whether the file was modified at or after the time specified.
+// Directories are always considered modified so that their contents are
+// checked, as modifying a file does not update the times of its ancestors.
+func modifiedSinceTime(path string, since time.Time, followSymlinks bool) bool {
+	stat, err := os.Lstat(path)
+	if err == nil && stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		stat, err = os.Stat(path)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
+		// left for tagPath to deal with
+		return true
 	}
 
-	log.Infof(2, "%v: revising set of tags to apply", file.Path())
-
-	revisedPairs := make([]entities.TagIdValueIdPair, 0, len(pairs))
-	for _, pair := range pairs {
-		predicate := func(ft entities.FileTag) bool {
-			return ft.TagId == pair.TagId && ft.ValueId == pair.ValueId
-		}
+	return stat.IsDir() || !stat.ModTime().Before(since)
+}
 
-		if existingFileTags.Any(predicate) {
+// Computes, concurrently, the fingerprints of those regular files amongst the
+// paths specified that are not yet in the database.
+func prefetchFingerprints(store *storage.Storage, tx *storage.Tx, paths []string, fingerprinter *tmsu.Fingerprinter) error {
+	newPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Lstat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			// left for tagPath to deal with
 			continue
 		}
 
-		if newImplications.Implies(pair) {
-			continue
+		file, err := store.FileByPath(tx, path)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
 		}
+		if file == nil {
+			newPaths = append(newPaths, path)
+		}
+	}
+
+	if len(newPaths) > 1 && fingerprinter.Threads() > 1 {
+		log.Infof("creating fingerprints for %v files using %v threads", len(newPaths), fingerprinter.Threads())
+	}
+
+	fingerprinter.Prefetch(newPaths)
+
+	return nil
+}
+
+// The number of threads with which to fingerprint files, as specified by the
+// --threads option, which defaults to the number of CPUs.
+func threadsOption(options Options) (int, error) {
+	if !options.HasOption("--threads") {
+		return runtime.NumCPU(), nil
+	}
+
+	argument := options.Get("--threads").Argument
+
+	threads, err := strconv.Atoi(argument)
+	if err != nil || threads < 1 {
+		return 0, fmt.Errorf("invalid number of threads '%v': must be a positive integer", argument)
+	}
+
+	return threads, nil
+}
 
-		revisedPairs = append(revisedPairs, pair)
+// Parses the --io-throttle option, returning nil, for no limit, if it is not
+// specified.
+func ioThrottleOption(options Options) (*_path.Throttle, error) {
+	if !options.HasOption("--io-throttle") {
+		return nil, nil
 	}
 
-	return revisedPairs, nil
+	return _path.ParseThrottle(options.Get("--io-throttle").Argument)
 }
@@ -21,11 +21,15 @@ import (
 	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/terminal"
 	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var TagsCommand = Command{
@@ -34,6 +38,22 @@ var TagsCommand = Command{
 	Usages:   []string{"tmsu tags [OPTION]... [FILE]..."},
 	Description: `Lists the tags applied to FILEs. If no FILE is specified then all tags in the database are listed.
 
+When --count is specified without any FILE, each tag is listed with the number of files it is applied to. These are sorted by descending file count unless --sort=name is specified.
+
+When --show-aliases is specified without any FILE, the aliases of each tag are listed in parentheses after it. See the 'alias' subcommand for more information on tag aliases.
+
+When --show-last-used is specified without any FILE, each tag is listed with the time at which it was last applied to a file, or 'never'. This can be used to find stale tags that are candidates for deletion. For tags applied before this was recorded, the time the most recently added of the tagged files was added is shown instead.
+
+When --tree is specified without any FILE, the tags are listed as a tree: the slash '/' within a tag name, e.g. 'location/europe/france', separates the levels of the hierarchy. Each level is listed beneath its parent, indented, including those levels that are not themselves tags. See the 'files' subcommand for querying the tags beneath a level.
+
+When --with-values is specified without any FILE, only the tags applied with a value to at least one file are listed. Likewise --without-values lists only the tags applied without a value to at least one file. Specifying both lists the tags used in both ways, which may indicate that a tag is used inconsistently.
+
+Tags can be given a description, to record what they mean, with --describe TAG TEXT. If TEXT is omitted the description is removed. When --show-descriptions is specified without any FILE, each tag is listed with its description, if it has one.
+
+Tags can also be given free-form metadata, such as a display colour for a graphical interface, with --set-meta TAG KEY=VALUE... An empty VALUE removes the item. The metadata is listed, as KEY=VALUE lines in order of key, with --get-meta TAG, or just the items for each KEY specified with --get-meta TAG KEY... TMSU stores the metadata without interpreting it, so different programs may record their own hints.
+
+The --format=csv option lists the tags as CSV, with a header row, for use in spreadsheets and other programs. Without any FILE there is a row for each tag, with a column for each of --count, --show-aliases, --show-last-used and --show-descriptions specified. Otherwise there is a row for each FILE, or VALUE with --value, with its tags separated by semicolons.
+
 When color is turned on, tags are shown in the following colors:
 
   Normal  An explicitly applied (regular) tag
@@ -45,19 +65,59 @@ See the 'imply' subcommand for more information on implied tags.`,
 		"$ tmsu tags tralala.mp3\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3 boom.mp3\n./tralala.mp3: mp3 music opera\n./boom.mp3: mp3 music drum-n-bass",
 		"$ tmsu tags --count tralala.mp3",
-		"$ tmsu tags --value 2009 red"},
+		"$ tmsu tags --count\nmusic: 120\nmp3: 85\nopera: 2",
+		"$ tmsu tags --value 2009 red",
+		"$ tmsu tags -1 --show-aliases\nblack-and-white (bw)\ncolour",
+		"$ tmsu tags --show-last-used\nmp3: 2018-03-01 19:02:14\nopera: never",
+		"$ tmsu tags --tree\nlocation\n  asia\n  europe\n    france\n    spain",
+		"$ tmsu tags --with-values --without-values\nyear",
+		"$ tmsu tags --describe bw 'photographs in black and white'",
+		"$ tmsu tags --show-descriptions\nbw: photographs in black and white\ncolour",
+		"$ tmsu tags --set-meta bw colour=#808080 icon=camera",
+		"$ tmsu tags --get-meta bw\ncolour=#808080\nicon=camera",
+		"$ tmsu tags --format=csv --count\ntag,files\nmusic,120\nmp3,85",
+		"$ tmsu tags --format=csv tralala.mp3\npath,tags\ntralala.mp3,mp3;music;opera"},
 	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, ""},
 		{"", "-1", "list one tag per line", false, ""},
 		{"--explicit", "-e", "do not show implied tags", false, ""},
 		{"--name", "-n", "when to print the file/value name: auto, always, never", true, ""},
 		{"--no-dereference", "-P", "do not follow symlinks (show tags for symlink itself)", false, ""},
-		{"--value", "-u", "show tags which utilise values", false, ""}},
+		{"--value", "-u", "show tags which utilise values", false, ""},
+		{"--sort", "-s", "sort tag file counts: count, name", true, ""},
+		{"--show-aliases", "-a", "show the aliases of each tag", false, ""},
+		{"--show-last-used", "", "show when each tag was last applied", false, ""},
+		{"--describe", "", "set the description of TAG", true, ""},
+		{"--show-descriptions", "", "show the description of each tag", false, ""},
+		{"--tree", "", "list the tags as a tree of the levels separated by '/'", false, ""},
+		{"--with-values", "", "list only tags applied with a value", false, ""},
+		{"--without-values", "", "list only tags applied without a value", false, ""},
+		{"--set-meta", "", "set items of metadata for TAG", true, ""},
+		{"--get-meta", "", "show the metadata of TAG", true, ""},
+		{"--format", "", "output format: text, csv", true, ""}},
 	Exec: tagsExec,
 }
 
 // unexported
 
 func tagsExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	return tagsInTx(store, tx, options, args)
+}
+
+// Lists the tags specified by the options and arguments within an existing
+// transaction.
+func tagsInTx(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
 	explicitOnly := options.HasOption("--explicit")
@@ -67,128 +127,379 @@ func tagsExec(options Options, args []string, databasePath string) (error, warni
 		return err, nil
 	}
 
+	sort := "count"
+	if options.HasOption("--sort") {
+		sort = options.Get("--sort").Argument
+	}
+
+	switch sort {
+	case "count", "name":
+	default:
+		return fmt.Errorf("invalid sort '%v': must be one of count, name", sort), nil
+	}
+
 	printName := "auto"
 	if options.HasOption("--name") {
 		printName = options.Get("--name").Argument
 	}
 
-	store, err := openDatabase(databasePath)
-	if err != nil {
-		return err, nil
+	format := "text"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
 	}
-	defer store.Close()
 
-	tx, err := store.Begin()
-	if err != nil {
-		return err, nil
+	switch format {
+	case "text", "csv":
+	default:
+		return fmt.Errorf("invalid format '%v': must be one of text, csv", format), nil
+	}
+
+	if options.HasOption("--describe") {
+		return describeTag(store, tx, options.Get("--describe").Argument, args)
+	}
+
+	if options.HasOption("--set-meta") {
+		return setTagMeta(store, tx, options.Get("--set-meta").Argument, args)
+	}
+
+	if options.HasOption("--get-meta") {
+		return listTagMeta(store, tx, options.Get("--get-meta").Argument, args)
+	}
+
+	withValues := options.HasOption("--with-values")
+	withoutValues := options.HasOption("--without-values")
+	if withValues || withoutValues {
+		if len(args) > 0 || options.HasOption("--value") {
+			return fmt.Errorf("the --with-values and --without-values options cannot be used with files or values"), nil
+		}
+		if format != "text" || showCount || options.HasOption("--show-last-used") || options.HasOption("--show-descriptions") || options.HasOption("--tree") {
+			return fmt.Errorf("the --with-values and --without-values options can only be used to list tag names"), nil
+		}
+
+		return listTagsByValueUsage(store, tx, withValues, withoutValues, onePerLine, options.HasOption("--show-aliases")), nil
+	}
+
+	if format == "csv" {
+		if options.HasOption("--value") {
+			return listTagsForValuesAsCsv(store, tx, args, showCount)
+		}
+
+		if len(args) == 0 {
+			return listAllTagsAsCsv(store, tx, sort, showCount, options.HasOption("--show-aliases"), options.HasOption("--show-last-used"), options.HasOption("--show-descriptions")), nil
+		}
+
+		return listTagsForPathsAsCsv(store, tx, args, showCount, explicitOnly, followSymlinks)
 	}
-	defer tx.Commit()
 
 	if options.HasOption("--value") {
 		return listTagsForValues(store, tx, args, showCount, onePerLine, colour, printName)
 	}
 
 	if len(args) == 0 {
-		return listAllTags(store, tx, showCount, onePerLine), nil
+		if options.HasOption("--show-last-used") {
+			return listTagLastUsedTimes(store, tx), nil
+		}
+
+		if options.HasOption("--show-descriptions") {
+			return listTagDescriptions(store, tx), nil
+		}
+
+		if showCount {
+			return listTagFileCounts(store, tx, sort), nil
+		}
+
+		if options.HasOption("--tree") {
+			return listTagTree(store, tx), nil
+		}
+
+		return listAllTags(store, tx, onePerLine, options.HasOption("--show-aliases")), nil
+	}
+
+	if options.HasOption("--tree") {
+		return fmt.Errorf("the --tree option cannot be used with files"), nil
 	}
 
 	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, colour, followSymlinks, printName)
 }
 
-func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
-	log.Info(2, "retrieving all tags.")
+func listAllTags(store *storage.Storage, tx *storage.Tx, onePerLine, showAliases bool) error {
+	log.Info("retrieving all tags.")
 
-	if showCount {
-		count, err := store.TagCount(tx)
-		if err != nil {
-			return fmt.Errorf("could not retrieve tag count: %v", err)
-		}
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
 
-		fmt.Println(count)
-	} else {
-		tags, err := store.Tags(tx)
+	return listTags(store, tx, tags, onePerLine, showAliases)
+}
+
+func listTagsByValueUsage(store *storage.Storage, tx *storage.Tx, withValues, withoutValues, onePerLine, showAliases bool) error {
+	log.Info("retrieving tags by value usage.")
+
+	tags, err := store.TagsByValueUsage(tx, withValues, withoutValues)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	return listTags(store, tx, tags, onePerLine, showAliases)
+}
+
+func listTags(store *storage.Storage, tx *storage.Tx, tags entities.Tags, onePerLine, showAliases bool) error {
+	var aliases entities.Aliases
+	if showAliases {
+		log.Info("retrieving tag aliases.")
+
+		var err error
+		aliases, err = store.Aliases(tx)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tags: %v", err)
+			return fmt.Errorf("could not retrieve aliases: %v", err)
 		}
+	}
+
+	tagNames := make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[index] = text.Escape(tag.Name, '=', ' ')
 
-		if onePerLine {
-			for _, tag := range tags {
-				fmt.Println(escape(tag.Name, '=', ' '))
+		if aliasNames := aliases.NamesForTag(tag.Id); len(aliasNames) > 0 {
+			for aliasIndex, aliasName := range aliasNames {
+				aliasNames[aliasIndex] = text.Escape(aliasName, '=', ' ')
 			}
-		} else {
-			tagNames := make([]string, len(tags))
-			for index, tag := range tags {
-				tagNames[index] = escape(tag.Name, '=', ' ')
+
+			tagNames[index] += " (" + strings.Join(aliasNames, ", ") + ")"
+		}
+	}
+
+	if onePerLine {
+		for _, tagName := range tagNames {
+			fmt.Println(tagName)
+		}
+	} else {
+		terminal.PrintColumns(tagNames)
+	}
+
+	return nil
+}
+
+// A level of the tag hierarchy, keyed by the name of each level beneath it.
+type tagTreeNode map[string]tagTreeNode
+
+func listTagTree(store *storage.Storage, tx *storage.Tx) error {
+	log.Info("retrieving all tags.")
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	root := make(tagTreeNode)
+	for _, tag := range tags {
+		node := root
+		for _, level := range strings.Split(tag.Name, "/") {
+			child, ok := node[level]
+			if !ok {
+				child = make(tagTreeNode)
+				node[level] = child
 			}
 
-			terminal.PrintColumns(tagNames)
+			node = child
 		}
 	}
 
+	root.print(0)
+
 	return nil
 }
 
-func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, colour, followSymlinks bool, printPathWhen string) (error, warnings) {
-	warnings := make(warnings, 0, 10)
+func (node tagTreeNode) print(depth int) {
+	levels := make([]string, 0, len(node))
+	for level := range node {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
 
-	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
+	for _, level := range levels {
+		fmt.Printf("%v%v\n", strings.Repeat("  ", depth), text.Escape(level, '=', ' '))
+		node[level].print(depth + 1)
+	}
+}
 
-	for index, path := range paths {
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return err, warnings
+func listTagFileCounts(store *storage.Storage, tx *storage.Tx, sort string) error {
+	log.Info("retrieving tag file counts.")
+
+	tagFileCounts, err := store.TagFileCounts(tx, sort)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag file counts: %v", err)
+	}
+
+	for _, tagFileCount := range tagFileCounts {
+		fmt.Printf("%v: %v\n", text.Escape(tagFileCount.Name, '=', ' '), tagFileCount.FileCount)
+	}
+
+	return nil
+}
+
+func listTagLastUsedTimes(store *storage.Storage, tx *storage.Tx) error {
+	log.Info("retrieving tag last used times.")
+
+	tagLastUsedTimes, err := store.TagLastUsedTimes(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag last used times: %v", err)
+	}
+
+	for _, tagLastUsed := range tagLastUsedTimes {
+		lastUsed := "never"
+		if !tagLastUsed.LastUsed.IsZero() {
+			lastUsed = tagLastUsed.LastUsed.Local().Format("2006-01-02 15:04:05")
 		}
 
-		log.Infof(2, "%v: resolving path", absPath)
+		fmt.Printf("%v: %v\n", text.Escape(tagLastUsed.Name, '=', ' '), lastUsed)
+	}
 
-		stat, err := os.Lstat(absPath)
-		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				stat = emptyStat{}
-			default:
-				warnings = append(warnings, err.Error())
-				continue
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
-			if err != nil {
-				warnings = append(warnings, err.Error())
-				continue
-			}
+	return nil
+}
+
+func listTagDescriptions(store *storage.Storage, tx *storage.Tx) error {
+	log.Info("retrieving tag descriptions.")
+
+	tagDescriptions, err := store.TagDescriptions(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag descriptions: %v", err)
+	}
+
+	for _, tagDescription := range tagDescriptions {
+		tagName := text.Escape(tagDescription.Name, '=', ' ')
+
+		if tagDescription.Description == "" {
+			fmt.Println(tagName)
+		} else {
+			fmt.Printf("%v: %v\n", tagName, tagDescription.Description)
 		}
+	}
 
-		log.Infof(2, "%v: retrieving tags", absPath)
+	return nil
+}
 
-		file, err := store.FileByPath(tx, absPath)
-		if err != nil {
-			warnings = append(warnings, err.Error())
-			continue
+func describeTag(store *storage.Storage, tx *storage.Tx, tagName string, args []string) (error, warnings) {
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments: quote the description if it contains whitespace"), nil
+	}
+	if err := checkWritable("describe tag"); err != nil {
+		return err, nil
+	}
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	description := ""
+	if len(args) == 1 {
+		description = strings.TrimSpace(args[0])
+	}
+
+	log.Infof("setting description of tag '%v'", tag.Name)
+
+	if err := store.DescribeTag(tx, tag.Id, description); err != nil {
+		return fmt.Errorf("could not set description of tag '%v': %v", tag.Name, err), nil
+	}
+
+	return nil, nil
+}
+
+func setTagMeta(store *storage.Storage, tx *storage.Tx, tagName string, args []string) (error, warnings) {
+	if len(args) == 0 {
+		return fmt.Errorf("metadata to set must be specified as KEY=VALUE"), nil
+	}
+	if err := checkWritable("set tag metadata"); err != nil {
+		return err, nil
+	}
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	for _, arg := range args {
+		index := strings.Index(arg, "=")
+		if index < 1 {
+			return fmt.Errorf("invalid metadata '%v': expected KEY=VALUE", arg), nil
 		}
 
-		var tagNames []string
-		if file != nil {
-			tagNames, err = tagNamesForFile(store, tx, file.Id, explicitOnly, colour)
-			if err != nil {
-				return err, warnings
-			}
-		} else {
-			_, err := os.Stat(absPath)
-			if err != nil {
-				switch {
-				case os.IsPermission(err):
-					warnings = append(warnings, fmt.Sprintf("%v: permission denied", absPath))
-					continue
-				case os.IsNotExist(err):
-					warnings = append(warnings, fmt.Sprintf("%v: no such file", absPath))
-					continue
-				default:
-					return fmt.Errorf("%v: could not stat file: %v", absPath, err), warnings
-				}
+		key, value := arg[:index], arg[index+1:]
+
+		log.Infof("setting metadata '%v' of tag '%v'", key, tag.Name)
+
+		if err := store.SetTagMeta(tx, tag.Id, key, value); err != nil {
+			return fmt.Errorf("could not set metadata '%v' of tag '%v': %v", key, tag.Name, err), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func listTagMeta(store *storage.Storage, tx *storage.Tx, tagName string, keys []string) (error, warnings) {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	metas, err := store.TagMetaByTagId(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve metadata of tag '%v': %v", tag.Name, err), nil
+	}
+
+	if len(keys) == 0 {
+		for _, meta := range metas {
+			fmt.Printf("%v=%v\n", meta.Key, meta.Value)
+		}
+
+		return nil, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, key := range keys {
+		found := false
+		for _, meta := range metas {
+			if meta.Key == key {
+				fmt.Printf("%v=%v\n", meta.Key, meta.Value)
+				found = true
+				break
 			}
 		}
 
-		escapedPath := escape(path, '\\', ':')
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("tag '%v' has no metadata '%v'", tag.Name, key))
+		}
+	}
+
+	return nil, warnings
+}
+
+func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, colour, followSymlinks bool, printPathWhen string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
+
+	for index, path := range paths {
+		tagNames, warning, err := tagNamesForPath(store, tx, path, explicitOnly, colour, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+			continue
+		}
+
+		escapedPath := text.Escape(path, '\\', ':')
 		switch {
 		case showCount:
 			if printPath {
@@ -226,13 +537,68 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 	return nil, warnings
 }
 
+// Retrieves the names of the tags applied to the file at the path. A problem
+// with the path that should not halt a listing is returned as a warning.
+func tagNamesForPath(store *storage.Storage, tx *storage.Tx, path string, explicitOnly, colour, followSymlinks bool) ([]string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log.Infof("%v: resolving path", absPath)
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err), os.IsPermission(err):
+			stat = emptyStat{}
+		default:
+			return nil, err.Error(), nil
+		}
+	} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return nil, err.Error(), nil
+		}
+	}
+
+	log.Infof("%v: retrieving tags", absPath)
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, err.Error(), nil
+	}
+
+	var tagNames []string
+	if file != nil {
+		tagNames, err = tagNamesForFile(store, tx, file.Id, explicitOnly, colour)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		_, err := os.Stat(absPath)
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				return nil, fmt.Sprintf("%v: permission denied", absPath), nil
+			case os.IsNotExist(err):
+				return nil, fmt.Sprintf("%v: no such file", absPath), nil
+			default:
+				return nil, "", fmt.Errorf("%v: could not stat file: %v", absPath, err)
+			}
+		}
+	}
+
+	return tagNames, "", nil
+}
+
 func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []string, showCount, onePerLine, colour bool, printTagWhen string) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
 	printTag := printTagWhen != "never" && (printTagWhen == "always" || len(valueNames) > 1 || !stdoutIsCharDevice())
 
 	for index, valueName := range valueNames {
-		log.Infof(2, "%v: looking up value", valueName)
+		log.Infof("%v: looking up value", valueName)
 
 		value, err := store.ValueByName(tx, valueName)
 		if err != nil {
@@ -243,7 +609,7 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 			continue
 		}
 
-		log.Infof(2, "%v: retrieving tags", valueName)
+		log.Infof("%v: retrieving tags", valueName)
 
 		var tagNames []string
 		if value != nil {
@@ -293,6 +659,166 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 	return nil, warnings
 }
 
+func listAllTagsAsCsv(store *storage.Storage, tx *storage.Tx, sort string, showCount, showAliases, showLastUsed, showDescriptions bool) error {
+	// tags are only ordered by count when the count is shown
+	if !showCount {
+		sort = "name"
+	}
+
+	log.Info("retrieving tag file counts.")
+
+	tagFileCounts, err := store.TagFileCounts(tx, sort)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag file counts: %v", err)
+	}
+
+	header := []string{"tag"}
+	if showCount {
+		header = append(header, "files")
+	}
+
+	var aliases entities.Aliases
+	if showAliases {
+		log.Info("retrieving tag aliases.")
+
+		aliases, err = store.Aliases(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve aliases: %v", err)
+		}
+
+		header = append(header, "aliases")
+	}
+
+	lastUsedTimes := make(map[entities.TagId]time.Time)
+	if showLastUsed {
+		log.Info("retrieving tag last used times.")
+
+		tagLastUsedTimes, err := store.TagLastUsedTimes(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag last used times: %v", err)
+		}
+
+		for _, tagLastUsed := range tagLastUsedTimes {
+			lastUsedTimes[tagLastUsed.Id] = tagLastUsed.LastUsed
+		}
+
+		header = append(header, "last_used")
+	}
+
+	descriptions := make(map[entities.TagId]string)
+	if showDescriptions {
+		log.Info("retrieving tag descriptions.")
+
+		tagDescriptions, err := store.TagDescriptions(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag descriptions: %v", err)
+		}
+
+		for _, tagDescription := range tagDescriptions {
+			descriptions[tagDescription.Id] = tagDescription.Description
+		}
+
+		header = append(header, "description")
+	}
+
+	records := make([][]string, 0, len(tagFileCounts)+1)
+	records = append(records, header)
+	for _, tagFileCount := range tagFileCounts {
+		record := []string{tagFileCount.Name}
+
+		if showCount {
+			record = append(record, strconv.FormatUint(uint64(tagFileCount.FileCount), 10))
+		}
+		if showAliases {
+			record = append(record, strings.Join(aliases.NamesForTag(tagFileCount.Id), ";"))
+		}
+		if showLastUsed {
+			lastUsed := ""
+			if lastUsedTime := lastUsedTimes[tagFileCount.Id]; !lastUsedTime.IsZero() {
+				lastUsed = lastUsedTime.Local().Format("2006-01-02 15:04:05")
+			}
+
+			record = append(record, lastUsed)
+		}
+		if showDescriptions {
+			record = append(record, descriptions[tagFileCount.Id])
+		}
+
+		records = append(records, record)
+	}
+
+	return printCsv(records)
+}
+
+func listTagsForPathsAsCsv(store *storage.Storage, tx *storage.Tx, paths []string, showCount, explicitOnly, followSymlinks bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	records := make([][]string, 0, len(paths)+1)
+	if showCount {
+		records = append(records, []string{"path", "count"})
+	} else {
+		records = append(records, []string{"path", "tags"})
+	}
+
+	for _, path := range paths {
+		tagNames, warning, err := tagNamesForPath(store, tx, path, explicitOnly, false, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+			continue
+		}
+
+		if showCount {
+			records = append(records, []string{path, strconv.Itoa(len(tagNames))})
+		} else {
+			records = append(records, []string{path, strings.Join(tagNames, ";")})
+		}
+	}
+
+	return printCsv(records), warnings
+}
+
+func listTagsForValuesAsCsv(store *storage.Storage, tx *storage.Tx, valueNames []string, showCount bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	records := make([][]string, 0, len(valueNames)+1)
+	if showCount {
+		records = append(records, []string{"value", "count"})
+	} else {
+		records = append(records, []string{"value", "tags"})
+	}
+
+	for _, valueName := range valueNames {
+		log.Infof("%v: looking up value", valueName)
+
+		value, err := store.ValueByName(tx, valueName)
+		if err != nil {
+			return err, warnings
+		}
+		if value == nil {
+			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+			continue
+		}
+
+		log.Infof("%v: retrieving tags", valueName)
+
+		tagNames, err := tagNamesForValue(store, tx, value.Id)
+		if err != nil {
+			return err, warnings
+		}
+
+		if showCount {
+			records = append(records, []string{valueName, strconv.Itoa(len(tagNames))})
+		} else {
+			records = append(records, []string{valueName, strings.Join(tagNames, ";")})
+		}
+	}
+
+	return printCsv(records), warnings
+}
+
 func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, explicitOnly, colour bool) ([]string, error) {
 	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
 	if err != nil {
@@ -0,0 +1,138 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+)
+
+var UndoCommand = Command{
+	Name:     "undo",
+	Synopsis: "Undo the last destructive operation",
+	Usages:   []string{"tmsu undo [OPTION]..."},
+	Description: `Undoes the most recent deletion of tags or values, merge of tags or values, or removal of tags from files, restoring the affected tags, values, taggings and implications as they were beforehand. Only the most recent such operation may be undone and, once undone, it is forgotten.
+
+Changes made since to the tags, values and files affected by the operation are lost. Should one of the deleted tags or values have since been recreated, or an untagged file have since been tagged afresh, then nothing is undone.
+
+With --dry-run the operation that would be undone is shown without undoing it.`,
+	Examples: []string{"$ tmsu delete pineapple\n$ tmsu undo\nundid: delete tag 'pineapple'",
+		"$ tmsu undo --dry-run\n2018-03-01 19:05:40 merge 2 tags into 'scenery'"},
+	Options: Options{{"--dry-run", "-n", "show the operation that would be undone without undoing it", false, ""}},
+	Exec:    undoExec,
+}
+
+// unexported
+
+func undoExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) != 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	if options.HasOption("--dry-run") {
+		defer tx.Commit()
+
+		operation, err := store.UndoOperation(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve the operation to undo: %v", err), nil
+		}
+		if operation == nil {
+			return fmt.Errorf("nothing to undo"), nil
+		}
+
+		fmt.Printf("%v %v\n", operation.Time.Local().Format("2006-01-02 15:04:05"), operation.Description)
+
+		return nil, nil
+	}
+
+	if err := checkWritable("undo"); err != nil {
+		tx.Rollback()
+		return err, nil
+	}
+
+	operation, err := store.Undo(tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not undo: %v", err), nil
+	}
+	if operation == nil {
+		tx.Rollback()
+		return fmt.Errorf("nothing to undo"), nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), nil
+	}
+
+	fmt.Printf("undid: %v\n", operation.Description)
+
+	return nil, nil
+}
+
+// Starts recording the operation so that it may be undone with 'tmsu undo'.
+func beginUndo(store *storage.Storage, tx *storage.Tx, description string) error {
+	if err := store.BeginUndo(tx, description); err != nil {
+		return fmt.Errorf("could not record the operation for undoing: %v", err)
+	}
+
+	return nil
+}
+
+// Describes an operation by its action and the names of the things, of the
+// specified kind, that it is applied to.
+func undoDescription(action, kind string, names []string) string {
+	if len(names) == 1 {
+		return fmt.Sprintf("%v %v '%v'", action, kind, names[0])
+	}
+
+	return fmt.Sprintf("%v %v %vs", action, len(names), kind)
+}
+
+// Starts recording the operation upon the tags so that it may be undone.
+func beginUndoTags(store *storage.Storage, tx *storage.Tx, action string, tags entities.Tags) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(tags))
+	for index, tag := range tags {
+		names[index] = tag.Name
+	}
+
+	if err := beginUndo(store, tx, undoDescription(action, "tag", names)); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := store.SaveUndoTag(tx, tag.Id); err != nil {
+			return fmt.Errorf("could not record tag '%v' for undoing: %v", tag.Name, err)
+		}
+	}
+
+	return nil
+}
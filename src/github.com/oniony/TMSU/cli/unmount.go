@@ -23,6 +23,8 @@ import (
 	"github.com/oniony/TMSU/vfs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 var UnmountCommand = Command{
@@ -30,17 +32,33 @@ var UnmountCommand = Command{
 	Aliases:  []string{"umount"},
 	Synopsis: "Unmount the virtual filesystem",
 	Usages: []string{"tmsu unmount MOUNTPOINT",
-		"tmsu unmount --all"},
-	Description: "Unmounts the virtual file-system at MOUNTPOINT.",
-	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
-	Exec:        unmountExec,
+		"tmsu unmount --all",
+		"tmsu unmount --prefix DIR"},
+	Description: `Unmounts the virtual file-system at MOUNTPOINT.
+
+With --all every mounted TMSU virtual file-system is unmounted. With --prefix only those mounted at or beneath DIR are, e.g. to unmount the several databases mounted under one directory.
+
+When unmounting more than one file-system, each is reported as it is unmounted. Should any fail to unmount, the remainder are still unmounted and the failures reported.`,
+	Examples: []string{"$ tmsu unmount mp",
+		"$ tmsu unmount --prefix ~/mounts\n/home/bob/mounts/music: unmounted\n/home/bob/mounts/photos: unmounted\nunmounted 2 of 2 virtual filesystems"},
+	Options: Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""},
+		{"--prefix", "-p", "unmounts the TMSU file-systems mounted at or beneath DIR", false, ""}},
+	Exec: unmountExec,
 }
 
 // unexported
 
 func unmountExec(options Options, args []string, databasePath string) (error, warnings) {
 	if options.HasOption("--all") {
-		return unmountAll(), nil
+		return unmountAll("")
+	}
+
+	if options.HasOption("--prefix") {
+		if len(args) != 1 {
+			return fmt.Errorf("a single directory must be specified"), nil
+		}
+
+		return unmountAll(args[0])
 	}
 
 	if len(args) < 1 {
@@ -51,21 +69,21 @@ func unmountExec(options Options, args []string, databasePath string) (error, wa
 }
 
 func unmount(path string) error {
-	log.Info(2, "searching path for fusermount.")
+	log.Info("searching path for fusermount.")
 
 	fusermountPath, err := exec.LookPath("fusermount")
 	if err != nil {
 		return fmt.Errorf("could not find 'fusermount': ensure fuse is installed: %v", err)
 	}
 
-	log.Infof(2, "running: %v -u %v.", fusermountPath, path)
+	log.Infof("running: %v -u %v.", fusermountPath, path)
 
 	process, err := os.StartProcess(fusermountPath, []string{fusermountPath, "-u", path}, &os.ProcAttr{})
 	if err != nil {
 		return fmt.Errorf("could not start 'fusermount': %v", err)
 	}
 
-	log.Info(2, "waiting for process to exit.")
+	log.Info("waiting for process to exit.")
 
 	processState, err := process.Wait()
 	if err != nil {
@@ -78,24 +96,65 @@ func unmount(path string) error {
 	return nil
 }
 
-func unmountAll() error {
-	log.Info(2, "retrieving mount table.")
+// Unmounts every mounted TMSU virtual filesystem or, if a prefix directory is
+// specified, those mounted at or beneath it.
+func unmountAll(prefix string) (error, warnings) {
+	log.Info("retrieving mount table.")
 
 	mt, err := vfs.GetMountTable()
 	if err != nil {
-		return fmt.Errorf("could not get mount table: %v", err)
+		return fmt.Errorf("could not get mount table: %v", err), nil
+	}
+
+	if prefix != "" {
+		dir, err := filepath.Abs(prefix)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", prefix, err), nil
+		}
+
+		// the mount table records the paths with any symbolic links resolved
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+
+		mt = mountsUnder(mt, dir)
 	}
 
 	if len(mt) == 0 {
-		log.Info(2, "mount table is empty.")
+		log.Info("mount table is empty.")
+		return nil, nil
 	}
 
+	warnings := make(warnings, 0, 10)
+	unmounted := 0
 	for _, mount := range mt {
-		err = unmount(mount.MountPath)
-		if err != nil {
-			return err
+		if err := unmount(mount.MountPath); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: %v", mount.MountPath, err))
+			continue
 		}
+
+		if prefix != "" {
+			fmt.Printf("%v: unmounted\n", mount.MountPath)
+		}
+
+		unmounted++
 	}
 
-	return nil
+	fmt.Printf("unmounted %v of %v virtual filesystems\n", unmounted, len(mt))
+
+	return nil, warnings
+}
+
+// The mounts whose mountpoints are the directory or beneath it.
+func mountsUnder(mounts []vfs.Mount, dir string) []vfs.Mount {
+	dir = filepath.Clean(dir)
+
+	under := make([]vfs.Mount, 0, len(mounts))
+	for _, mount := range mounts {
+		if mount.MountPath == dir || strings.HasPrefix(mount.MountPath, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			under = append(under, mount)
+		}
+	}
+
+	return under
 }
@@ -0,0 +1,46 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"github.com/oniony/TMSU/vfs"
+	"testing"
+)
+
+func TestMountsUnder(test *testing.T) {
+	mounts := []vfs.Mount{{"/db1", "/home/bob/mounts/music"},
+		{"/db2", "/home/bob/mounts/photos"},
+		{"/db3", "/home/bob/mounts-old/music"},
+		{"/db4", "/home/bob/mounts"},
+		{"/db5", "/mnt/tmsu"}}
+
+	under := mountsUnder(mounts, "/home/bob/mounts/")
+	if len(under) != 3 || under[0].DatabasePath != "/db1" || under[1].DatabasePath != "/db2" || under[2].DatabasePath != "/db4" {
+		test.Fatalf("Expected the mounts of /db1, /db2 and /db4 but were %v.", under)
+	}
+
+	under = mountsUnder(mounts, "/")
+	if len(under) != len(mounts) {
+		test.Fatalf("Expected every mount but were %v.", under)
+	}
+
+	under = mountsUnder(mounts, "/home/bob/mounts/music/album")
+	if len(under) != 0 {
+		test.Fatalf("Expected no mounts but were %v.", under)
+	}
+}
@@ -18,12 +18,13 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
-	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
-	"os"
+	"github.com/oniony/TMSU/tmsu"
 	"path/filepath"
+	"strings"
 )
 
 var UntagCommand = Command{
@@ -31,16 +32,27 @@ var UntagCommand = Command{
 	Synopsis: "Remove tags from files",
 	Usages: []string{"tmsu untag [OPTION]... FILE TAG[=VALUE]...",
 		"tmsu untag [OPTION]... --all FILE...",
-		`tmsu untag [OPTION]... --tags="TAG[=VALUE]..." FILE...`},
-	Description: "Disassociates FILE with the TAGs specified.",
+		`tmsu untag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
+		"tmsu untag [OPTION]... --where=QUERY TAG[=VALUE]..."},
+	Description: `Disassociates FILE with the TAGs specified.
+
+With --recursive the TAGs are also removed from the files beneath each directory FILE. Only those files that are explicitly tagged are touched and the number of files untagged is reported.
+
+With --where the TAGs are instead removed from every file matching QUERY, within a single transaction, and the number of files untagged is reported. Tags that are only implied are left in place. See the 'files' subcommand for the query syntax.
+
+The most recent removal of tags may be undone with 'tmsu undo'.`,
 	Examples: []string{"$ tmsu untag mountain.jpg hill county=germany",
 		"$ tmsu untag --all mountain-copy.jpg",
-		`$ tmsu untag --tags="river underwater year=2017" forest.jpg desert.jpg`},
+		`$ tmsu untag --tags="river underwater year=2017" forest.jpg desert.jpg`,
+		"$ tmsu untag --recursive photos draft",
+		`$ tmsu untag --where=published review`},
 	Options: Options{{"--all", "-a", "strip each file of all tags", false, ""},
 		{"--tags", "-t", "the set of tags to remove", true, ""},
+		{"--where", "-w", "remove tags from the files matching QUERY", true, ""},
 		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""},
 		{"--no-dereference", "-P", "do not follow symbolic links (untag the link itself)", false, ""}},
-	Exec: untagExec,
+	Exec:     untagExec,
+	Modifies: true,
 }
 
 // unexported
@@ -50,9 +62,6 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 		return fmt.Errorf("too few arguments"), nil
 	}
 
-	recursive := options.HasOption("--recursive")
-	followSymlinks := !options.HasOption("--no-dereference")
-
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -65,6 +74,24 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer tx.Commit()
 
+	return untagInTx(store, tx, options, args)
+}
+
+// Removes the tags specified by the options and arguments within an existing
+// transaction.
+func untagInTx(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
+	if len(args) < 1 {
+		return fmt.Errorf("too few arguments"), nil
+	}
+
+	recursive := options.HasOption("--recursive")
+	followSymlinks := !options.HasOption("--no-dereference")
+
+	batch, err := tmsu.NewBatch(store, tx)
+	if err != nil {
+		return err, nil
+	}
+
 	if options.HasOption("--all") {
 		if len(args) < 1 {
 			return fmt.Errorf("files to untag must be specified"), nil
@@ -72,7 +99,12 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 
 		paths := args
 
-		return untagPathsAll(store, tx, paths, recursive, followSymlinks)
+		return untagPathsAll(store, tx, batch, paths, recursive, followSymlinks)
+	} else if options.HasOption("--where") {
+		queryText := options.Get("--where").Argument
+		tagArgs := args
+
+		return untagWhere(store, tx, batch, queryText, tagArgs)
 	} else if options.HasOption("--tags") {
 		tagArgs := text.Tokenize(options.Get("--tags").Argument)
 		if len(tagArgs) == 0 {
@@ -84,7 +116,7 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 			return fmt.Errorf("at least one file to untag must be specified"), nil
 		}
 
-		return untagPaths(store, tx, paths, tagArgs, recursive, followSymlinks)
+		return untagPaths(store, tx, batch, paths, tagArgs, recursive, followSymlinks)
 	} else {
 		if len(args) < 2 {
 			return fmt.Errorf("tags to remove and files to untag must be specified"), nil
@@ -93,61 +125,62 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 		paths := args[0:1]
 		tagArgs := args[1:]
 
-		return untagPaths(store, tx, paths, tagArgs, recursive, followSymlinks)
+		return untagPaths(store, tx, batch, paths, tagArgs, recursive, followSymlinks)
 	}
 }
 
-func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) (error, warnings) {
+func untagPathsAll(store *storage.Storage, tx *storage.Tx, batch *tmsu.Batch, paths []string, recursive, followSymlinks bool) (error, warnings) {
 	warnings := make(warnings, 0, 10)
+	undoing := false
 
 	for _, path := range paths {
-		absPath, err := filepath.Abs(path)
+		log.Infof("%v: resolving path", path)
+
+		absPath, file, err := batch.ResolveFile(path, followSymlinks)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+			return err, warnings
 		}
 
-		log.Infof(2, "%v: resolving path", path)
-
-		stat, err := os.Lstat(absPath)
-		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				// ignore
-			default:
-				return err, nil
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
+		var childFiles entities.Files
+		if recursive {
+			childFiles, err = filesBeneath(store, tx, absPath)
 			if err != nil {
-				return err, nil
+				return fmt.Errorf("%v: could not retrieve files for directory: %v", path, err), warnings
 			}
 		}
 
-		file, err := store.FileByPath(tx, absPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not retrieve file: %v", path, err), warnings
-		}
-		if file == nil {
+		if file == nil && len(childFiles) == 0 {
 			warnings = append(warnings, fmt.Sprintf("%v: file is not tagged.", path))
 			continue
 		}
 
-		log.Infof(2, "%v: removing all tags.", path)
+		if !undoing {
+			if err := beginUndo(store, tx, undoDescription("untag", "file", paths)); err != nil {
+				return err, warnings
+			}
 
-		if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
-			return fmt.Errorf("%v: could not remove file's tags: %v", path, err), warnings
+			undoing = true
 		}
 
-		if recursive {
-			childFiles, err := store.FilesByDirectory(tx, file.Path())
-			if err != nil {
-				return fmt.Errorf("%v: could not retrieve files for directory: %v", path, err), warnings
+		if file != nil {
+			log.Infof("%v: removing all tags.", path)
+
+			if err := store.SaveUndoFile(tx, file.Id); err != nil {
+				return fmt.Errorf("%v: could not record file for undoing: %v", path, err), warnings
 			}
 
-			for _, childFile := range childFiles {
-				if err := store.DeleteFileTagsByFileId(tx, childFile.Id); err != nil {
-					return fmt.Errorf("%v: could not remove file's tags: %v", childFile.Path(), err), warnings
-				}
+			if err := batch.UntagFileAll(file); err != nil {
+				return fmt.Errorf("%v: could not remove file's tags: %v", path, err), warnings
+			}
+		}
+
+		for _, childFile := range childFiles {
+			if err := store.SaveUndoFile(tx, childFile.Id); err != nil {
+				return fmt.Errorf("%v: could not record file for undoing: %v", childFile.Path(), err), warnings
+			}
+
+			if err := batch.UntagFileAll(childFile); err != nil {
+				return fmt.Errorf("%v: could not remove file's tags: %v", childFile.Path(), err), warnings
 			}
 		}
 	}
@@ -155,54 +188,67 @@ func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recur
 	return nil, warnings
 }
 
-func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string, recursive, followSymlinks bool) (error, warnings) {
+func untagPaths(store *storage.Storage, tx *storage.Tx, batch *tmsu.Batch, paths, tagArgs []string, recursive, followSymlinks bool) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
+	// files beneath a directory are untagged only where they carry the tag
 	files := make(entities.Files, 0, len(paths))
+	beneath := make(map[entities.FileId]bool)
+	seen := make(map[entities.FileId]bool)
 	for _, path := range paths {
-		absPath, err := filepath.Abs(path)
+		log.Infof("%v: resolving path", path)
+
+		absPath, file, err := batch.ResolveFile(path, followSymlinks)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+			return err, warnings
 		}
 
-		log.Infof(2, "%v: resolving path", path)
-
-		stat, err := os.Lstat(absPath)
-		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				// ignore
-			default:
-				return err, nil
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
+		var childFiles entities.Files
+		if recursive {
+			childFiles, err = filesBeneath(store, tx, absPath)
 			if err != nil {
-				return err, nil
+				return fmt.Errorf("%v: could not retrieve files for directory: %v", path, err), warnings
 			}
 		}
 
-		file, err := store.FileByPath(tx, absPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not retrieve file: %v", path, err), warnings
-		}
-		if file == nil {
+		if file == nil && len(childFiles) == 0 {
 			warnings = append(warnings, fmt.Sprintf("%v: file is not tagged", path))
 			continue
 		}
 
-		files = append(files, file)
+		if file != nil {
+			if !seen[file.Id] {
+				files = append(files, file)
+				seen[file.Id] = true
+			}
+			delete(beneath, file.Id)
+		}
 
-		if recursive {
-			childFiles, err := store.FilesByDirectory(tx, file.Path())
-			if err != nil {
-				return fmt.Errorf("%v: could not retrieve files for directory: %v", file.Path(), err), warnings
+		for _, childFile := range childFiles {
+			if seen[childFile.Id] {
+				continue
 			}
 
-			files = append(files, childFiles...)
+			files = append(files, childFile)
+			seen[childFile.Id] = true
+			beneath[childFile.Id] = true
+		}
+	}
+
+	if len(files) > 0 {
+		if err := beginUndo(store, tx, undoDescription("untag", "file", paths)); err != nil {
+			return err, warnings
+		}
+
+		for _, file := range files {
+			if err := store.SaveUndoFile(tx, file.Id); err != nil {
+				return fmt.Errorf("%v: could not record file for undoing: %v", file.Path(), err), warnings
+			}
 		}
 	}
 
+	untagged := make(map[entities.FileId]bool)
+
 	for _, tagArg := range tagArgs {
 		tagName, valueName := parseTagEqValueName(tagArg)
 
@@ -225,7 +271,17 @@ func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string,
 		}
 
 		for _, file := range files {
-			if err := store.DeleteFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+			if beneath[file.Id] {
+				exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, true)
+				if err != nil {
+					return fmt.Errorf("could not check if tag exists: %v", err), warnings
+				}
+				if !exists {
+					continue
+				}
+			}
+
+			if err := batch.UntagFile(file, entities.TagIdValueIdPair{tag.Id, value.Id}); err != nil {
 				switch err.(type) {
 				case storage.FileTagDoesNotExist:
 					exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, false)
@@ -249,9 +305,118 @@ func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string,
 				default:
 					return fmt.Errorf("%v: could not remove tag '%v', value '%v': %v", file.Path(), tag.Name, value.Name, err), warnings
 				}
+
+				continue
+			}
+
+			untagged[file.Id] = true
+		}
+	}
+
+	if recursive {
+		fmt.Printf("%v files untagged\n", len(untagged))
+	}
+
+	return nil, warnings
+}
+
+// Retrieves the files beneath the directory, excluding the similarly named
+// siblings that the database's pattern match also returns.
+func filesBeneath(store *storage.Storage, tx *storage.Tx, absPath string) (entities.Files, error) {
+	files, err := store.FilesByDirectory(tx, absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := absPath + string(filepath.Separator)
+	matches := make(entities.Files, 0, len(files))
+	for _, file := range files {
+		if strings.HasPrefix(file.Path(), prefix) {
+			matches = append(matches, file)
+		}
+	}
+
+	return matches, nil
+}
+
+func untagWhere(store *storage.Storage, tx *storage.Tx, batch *tmsu.Batch, queryText string, tagArgs []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	log.Info("parsing query")
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return fmt.Errorf("could not parse query: %v", err), warnings
+	}
+
+	log.Info("querying files")
+
+	files, err := batch.Files(expression, "", false, false, "none", false, 0, 0)
+	if err != nil {
+		return err, warnings
+	}
+
+	pairs := make(entities.TagIdValueIdPairs, 0, len(tagArgs))
+	for _, tagArg := range tagArgs {
+		tagName, valueName := parseTagEqValueName(tagArg)
+
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
+			continue
+		}
+
+		value, err := store.ValueByName(tx, valueName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve value '%v': %v", valueName, err), warnings
+		}
+		if value == nil {
+			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+			continue
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{tag.Id, value.Id})
+	}
+
+	if len(files) > 0 {
+		if err := beginUndo(store, tx, fmt.Sprintf("untag files matching '%v'", queryText)); err != nil {
+			return err, warnings
+		}
+
+		for _, file := range files {
+			if err := store.SaveUndoFile(tx, file.Id); err != nil {
+				return fmt.Errorf("%v: could not record file for undoing: %v", file.Path(), err), warnings
+			}
+		}
+	}
+
+	log.Infof("removing tags from %v files", len(files))
+
+	untagged := 0
+	for _, file := range files {
+		removed := false
+
+		for _, pair := range pairs {
+			if err := batch.UntagFile(file, pair); err != nil {
+				if _, ok := err.(storage.FileTagDoesNotExist); ok {
+					continue
+				}
+
+				return fmt.Errorf("%v: could not remove tags: %v", file.Path(), err), warnings
 			}
+
+			removed = true
+		}
+
+		if removed {
+			untagged++
 		}
 	}
 
+	fmt.Printf("%v files untagged\n", untagged)
+
 	return nil, warnings
 }
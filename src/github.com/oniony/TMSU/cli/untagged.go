@@ -22,6 +22,7 @@ import (
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 var UntaggedCommand = Command{
@@ -30,12 +31,35 @@ var UntaggedCommand = Command{
 	Usages:   []string{"tmsu untagged [OPTION]... [PATH]..."},
 	Description: `Identify untagged files in the filesystem.  
 
-Where PATHs are not specified, untagged items under the current working directory are shown.`,
+Where PATHs are not specified, untagged items under the current working directory are shown.
+
+Files and directories whose name matches any --exclude GLOB are skipped together with their contents. The --max-depth option limits how many levels below each PATH are examined: a depth of 1 lists only the immediate contents of a directory.
+
+Files matching the patterns in any .tmsuignore file are also skipped unless --no-ignore is specified. See 'tmsu help tag' for the format of these files.
+
+Symbolic links to directories found whilst examining a directory's contents are not descended into unless --follow-symlinks is specified. Each directory is examined at most once, however it is reached, so links that form cycles are safe to follow.
+
+Use --print0 when piping the output to other programs, e.g. 'xargs -0', as this is safe for paths that contain whitespace or newline characters.
+
+Paths are shown relative to the working directory, or to DIR with --relative-to, where possible. Use --absolute to always show absolute paths. With --shell-quote each path is quoted, where necessary, as per the POSIX shell, so that the output may be pasted into a shell safely.
+
+If no untagged files are found and the global --exit-nonzero-on-empty option is specified, the exit status is 2.`,
 	Examples: []string{"$ tmsu untagged",
-		"$ tmsu untagged /home/fred/drawings"},
+		"$ tmsu untagged /home/fred/drawings",
+		"$ tmsu untagged --exclude=.git --exclude=node_modules ~/code",
+		"$ tmsu untagged --max-depth=2",
+		"$ tmsu untagged -0 | xargs -0 tmsu tag --tags=new"},
 	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
 		Option{"--count", "-c", "list the number of files rather than their names", false, ""},
-		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, ""}},
+		Option{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
+		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, ""},
+		Option{"--follow-symlinks", "-L", "descend into symbolic links to directories", false, ""},
+		Option{"--exclude", "", "skip files and directories matching GLOB (may be repeated)", true, ""},
+		Option{"--max-depth", "", "examine at most DEPTH levels below each path", true, ""},
+		Option{"--no-ignore", "", "do not skip files matched by .tmsuignore files", false, ""},
+		Option{"--relative-to", "", "show paths relative to DIR", true, ""},
+		Option{"--absolute", "", "show absolute paths", false, ""},
+		Option{"--shell-quote", "", "quote paths for the shell where necessary", false, ""}},
 	Exec: untaggedExec,
 }
 
@@ -45,14 +69,51 @@ func untaggedExec(options Options, args []string, databasePath string) (error, w
 	recursive := !options.HasOption("--directory")
 	count := options.HasOption("--count")
 	followSymlinks := !options.HasOption("--no-dereference")
+	print0 := options.HasOption("--print0")
+
+	if print0 && count {
+		return fmt.Errorf("the --print0 and --count options are mutually exclusive"), nil
+	}
+	if print0 && options.HasOption("--shell-quote") {
+		return fmt.Errorf("the --print0 and --shell-quote options are mutually exclusive"), nil
+	}
+
+	style, err := pathStyleFor(options)
+	if err != nil {
+		return err, nil
+	}
+
+	limits := walkLimits{options.Arguments("--exclude"), -1, nil, _path.NewWalk(options.HasOption("--follow-symlinks"))}
+	if !options.HasOption("--no-ignore") {
+		limits.ignorer = _path.NewIgnorer()
+	}
+	for _, glob := range limits.excludes {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern '%v': %v", glob, err), nil
+		}
+	}
+
+	if options.HasOption("--max-depth") {
+		argument := options.Get("--max-depth").Argument
+
+		var err error
+		limits.maxDepth, err = strconv.Atoi(argument)
+		if err != nil || limits.maxDepth < 0 {
+			return fmt.Errorf("invalid depth '%v': must be a non-negative integer", argument), nil
+		}
+	}
 
 	paths := args
+	depth := 0
 	if len(paths) == 0 {
 		var err error
-		paths, err = directoryEntries(".")
+		paths, err = limits.entries(".")
 		if err != nil {
 			return err, nil
 		}
+
+		limits.walk.Enter(".")
+		depth = 1
 	}
 
 	store, err := openDatabase(databasePath)
@@ -67,44 +128,63 @@ func untaggedExec(options Options, args []string, databasePath string) (error, w
 	}
 	defer tx.Commit()
 
+	var found uint
 	if count {
-		count, err := findUntaggedCount(store, tx, paths, recursive, followSymlinks)
+		found, err = findUntaggedCount(store, tx, paths, depth, recursive, followSymlinks, limits)
 		if err != nil {
 			return err, nil
 		}
 
-		fmt.Println(count)
+		fmt.Println(found)
 	} else {
-		if err := findUntagged(store, tx, paths, recursive, followSymlinks); err != nil {
+		found, err = findUntagged(store, tx, paths, depth, recursive, followSymlinks, print0, limits, style)
+		if err != nil {
 			return err, nil
 		}
 	}
 
+	if found == 0 {
+		return NoMatchesError{}, nil
+	}
+
 	return nil, nil
 }
 
-func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) error {
+func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, depth int, recursive, followSymlinks, print0 bool, limits walkLimits, style pathStyle) (uint, error) {
+	var count uint
 	var action = func(absPath string) {
-		relPath := _path.Rel(absPath)
-		fmt.Println(relPath)
+		log.ClearProgress()
+		count++
+
+		relPath := style.format(absPath)
+		if print0 {
+			fmt.Printf("%v\000", relPath)
+		} else {
+			fmt.Println(relPath)
+		}
 	}
 
-	return findUntaggedFunc(store, tx, paths, recursive, followSymlinks, action)
+	err := findUntaggedFunc(store, tx, paths, depth, recursive, followSymlinks, limits, action)
+	return count, err
 }
 
-func findUntaggedCount(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) (uint, error) {
+func findUntaggedCount(store *storage.Storage, tx *storage.Tx, paths []string, depth int, recursive, followSymlinks bool, limits walkLimits) (uint, error) {
 	var count uint
 
 	var action = func(absPath string) {
 		count++
 	}
 
-	err := findUntaggedFunc(store, tx, paths, recursive, followSymlinks, action)
+	err := findUntaggedFunc(store, tx, paths, depth, recursive, followSymlinks, limits, action)
 
 	return count, err
 }
 
-func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool, action func(absPath string)) error {
+func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, depth int, recursive, followSymlinks bool, limits walkLimits, action func(absPath string)) error {
+	if recursive {
+		log.AddProgressTotal(uint(len(paths)))
+	}
+
 	for _, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
@@ -112,7 +192,7 @@ func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, re
 		}
 
 		if followSymlinks {
-			log.Infof(2, "%v: resolving path", path)
+			log.Infof("%v: resolving path", path)
 
 			absPath, err = _path.Dereference(absPath)
 			if err != nil {
@@ -130,18 +210,95 @@ func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, re
 		}
 
 		if recursive {
-			entries, err := directoryEntries(path)
+			log.IncrementProgress()
+		}
+
+		if recursive && limits.descend(depth) && limits.follows(path, depth) {
+			if !limits.walk.Enter(path) {
+				log.Infof("%v: skipping directory already examined via a symbolic link", path)
+				continue
+			}
+
+			entries, err := limits.entries(path)
 			if err != nil {
 				return err
 			}
 
-			findUntaggedFunc(store, tx, entries, true, followSymlinks, action)
+			if err := findUntaggedFunc(store, tx, entries, depth+1, true, followSymlinks, limits, action); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// Limits on the files examined when walking a directory tree.
+type walkLimits struct {
+	excludes []string
+	maxDepth int
+	ignorer  *_path.Ignorer
+	walk     *_path.Walk
+}
+
+// Determines whether the contents of a directory at the specified depth should
+// be examined.
+func (limits walkLimits) descend(depth int) bool {
+	return limits.maxDepth < 0 || depth < limits.maxDepth
+}
+
+// Determines whether the path at the specified depth may be descended into:
+// symbolic links specified as arguments are always descended into whereas
+// those found within directories are only if symbolic links are being followed.
+func (limits walkLimits) follows(path string, depth int) bool {
+	if depth == 0 || limits.walk.Follows(path) {
+		return true
+	}
+
+	log.Infof("%v: not descending into symbolic link", path)
+	return false
+}
+
+// Determines whether the file or directory with the specified name is excluded.
+func (limits walkLimits) excluded(name string) bool {
+	for _, glob := range limits.excludes {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retrieves the directory entries that are not excluded.
+func (limits walkLimits) entries(path string) ([]string, error) {
+	entries, err := directoryEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	included := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if limits.excluded(filepath.Base(entry)) {
+			log.Infof("%v: excluded", entry)
+			continue
+		}
+
+		ignored, err := limits.ignorer.Ignored(entry)
+		if err != nil {
+			return nil, err
+		}
+		if ignored {
+			log.Infof("%v: ignored", entry)
+			continue
+		}
+
+		included = append(included, entry)
+	}
+
+	return included, nil
+}
+
 func directoryEntries(path string) ([]string, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
@@ -0,0 +1,91 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"os"
+)
+
+var VacuumCommand = Command{
+	Name:     "vacuum",
+	Synopsis: "Compact and optimize the database",
+	Usages:   []string{"tmsu vacuum"},
+	Description: `Rebuilds the database file to reclaim the space left unused by deleted tags, files and taggings, and updates the statistics used to plan queries. The size of the database file before and after is reported.
+
+The database cannot be vacuumed whilst it is mounted as a virtual filesystem: unmount it first.`,
+	Examples: []string{"$ tmsu vacuum\n2.4 MiB -> 1.1 MiB"},
+	Options:  Options{},
+	Exec:     vacuumExec,
+	Modifies: true,
+}
+
+// unexported
+
+func vacuumExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	if err := checkNotMounted(databasePath); err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	stat, err := os.Stat(store.DbPath)
+	if err != nil {
+		return fmt.Errorf("could not stat database '%v': %v", store.DbPath, err), nil
+	}
+	sizeBefore := stat.Size()
+
+	log.Infof("vacuuming database '%v'.", store.DbPath)
+
+	if err := store.Vacuum(); err != nil {
+		return err, nil
+	}
+
+	stat, err = os.Stat(store.DbPath)
+	if err != nil {
+		return fmt.Errorf("could not stat database '%v': %v", store.DbPath, err), nil
+	}
+
+	fmt.Printf("%v -> %v\n", formatByteSize(sizeBefore), formatByteSize(stat.Size()))
+
+	return nil, nil
+}
+
+func formatByteSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%v B", size)
+	}
+
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(byteSizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %v", value, byteSizeUnits[unit])
+}
+
+var byteSizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
@@ -0,0 +1,53 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/vfs"
+	"path/filepath"
+)
+
+// unexported
+
+// Ensures the database is not mounted as a virtual filesystem, as rebuilding
+// the database beneath it could corrupt it.
+func checkNotMounted(databasePath string) error {
+	absDatabasePath, err := filepath.Abs(databasePath)
+	if err != nil {
+		return fmt.Errorf("could not get absolute path of database '%v': %v", databasePath, err)
+	}
+
+	mt, err := vfs.GetMountTable()
+	if err != nil {
+		return fmt.Errorf("could not get mount table: %v", err)
+	}
+
+	for _, mount := range mt {
+		mountedDatabasePath, err := filepath.Abs(mount.DatabasePath)
+		if err != nil {
+			continue
+		}
+
+		if mountedDatabasePath == absDatabasePath {
+			return fmt.Errorf("database '%v' is mounted at '%v': unmount it first", databasePath, mount.MountPath)
+		}
+	}
+
+	return nil
+}
@@ -19,19 +19,24 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/common/terminal"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"strings"
 )
 
 var ValuesCommand = Command{
-	Name:        "values",
-	Synopsis:    "List values",
-	Usages:      []string{"tmsu values [OPTION]... [TAG]..."},
-	Description: "Lists the values for TAGs. If no TAG is specified then all tags are listed.",
+	Name:     "values",
+	Synopsis: "List values",
+	Usages:   []string{"tmsu values [OPTION]... [TAG]..."},
+	Description: `Lists the values for TAGs. If no TAG is specified then all values are listed.
+
+When --count is specified with TAGs, each value is listed with the number of files tagged with it. Without TAGs the total number of values is shown.`,
 	Examples: []string{"$ tmsu values year\n2000\n2001\n2017",
 		"$ tmsu values\n2000\n2001\n2017\ncheese\nopera",
-		"$ tmsu values --count year\n3"},
-	Options: Options{{"--count", "-c", "lists the number of values rather than their names", false, ""},
+		"$ tmsu values --count year\n2000: 12\n2001: 3\n2017: 1",
+		"$ tmsu values --count\n5"},
+	Options: Options{{"--count", "-c", "lists the number of files using each value (or the number of values if no TAG is specified)", false, ""},
 		{"", "-1", "list one value per line", false, ""}},
 	Exec: valuesExec,
 }
@@ -62,7 +67,7 @@ func valuesExec(options Options, args []string, databasePath string) (error, war
 }
 
 func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
-	log.Info(2, "retrieving all values.")
+	log.Info("retrieving all values.")
 
 	if showCount {
 		count, err := store.ValueCount(tx)
@@ -79,12 +84,12 @@ func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine
 
 		if onePerLine {
 			for _, value := range values {
-				fmt.Println(escape(value.Name))
+				fmt.Println(text.Escape(value.Name))
 			}
 		} else {
 			valueNames := make([]string, len(values))
 			for index, value := range values {
-				valueNames[index] = escape(value.Name)
+				valueNames[index] = text.Escape(value.Name)
 			}
 
 			terminal.PrintColumns(valueNames)
@@ -119,28 +124,28 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 		return fmt.Errorf("no such tag, '%v'", tagName)
 	}
 
-	log.Infof(2, "retrieving values for tag '%v'.", tagName)
+	if showCount {
+		return listValueFileCountsForTag(store, tx, tag)
+	}
+
+	log.Infof("retrieving values for tag '%v'.", tagName)
 
 	values, err := store.ValuesByTag(tx, tag.Id)
 	if err != nil {
 		return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err)
 	}
 
-	if showCount {
-		fmt.Println(len(values))
+	if onePerLine {
+		for _, value := range values {
+			fmt.Println(text.Escape(value.Name, '=', ' '))
+		}
 	} else {
-		if onePerLine {
-			for _, value := range values {
-				fmt.Println(escape(value.Name, '=', ' '))
-			}
-		} else {
-			valueNames := make([]string, len(values))
-			for index, value := range values {
-				valueNames[index] = escape(value.Name, '=', ' ')
-			}
-
-			terminal.PrintColumns(valueNames)
+		valueNames := make([]string, len(values))
+		for index, value := range values {
+			valueNames[index] = text.Escape(value.Name, '=', ' ')
 		}
+
+		terminal.PrintColumns(valueNames)
 	}
 
 	return nil
@@ -159,32 +164,53 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 			continue
 		}
 
-		log.Infof(2, "retrieving values for tag '%v'.", tagName)
+		if showCount {
+			fmt.Println(tagName)
+			if err := listValueFileCountsForTag(store, tx, tag); err != nil {
+				return err, warnings
+			}
+			fmt.Println()
+
+			continue
+		}
+
+		log.Infof("retrieving values for tag '%v'.", tagName)
 
 		values, err := store.ValuesByTag(tx, tag.Id)
 		if err != nil {
 			return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err), warnings
 		}
 
-		if showCount {
-			fmt.Printf("%v: %v\n", tagName, len(values))
+		if onePerLine {
+			fmt.Println(tagName)
+			for _, value := range values {
+				fmt.Println(text.Escape(value.Name, '=', ' '))
+			}
+			fmt.Println()
 		} else {
-			if onePerLine {
-				fmt.Println(tagName)
-				for _, value := range values {
-					fmt.Println(escape(value.Name, '=', ' '))
-				}
-				fmt.Println()
-			} else {
-				valueNames := make([]string, len(values))
-				for index, value := range values {
-					valueNames[index] = escape(value.Name, '=', ' ')
-				}
-
-				fmt.Printf("%v: %v\n", tagName, strings.Join(valueNames, " "))
+			valueNames := make([]string, len(values))
+			for index, value := range values {
+				valueNames[index] = text.Escape(value.Name, '=', ' ')
 			}
+
+			fmt.Printf("%v: %v\n", tagName, strings.Join(valueNames, " "))
 		}
 	}
 
 	return nil, warnings
 }
+
+func listValueFileCountsForTag(store *storage.Storage, tx *storage.Tx, tag *entities.Tag) error {
+	log.Infof("retrieving value file counts for tag '%v'.", tag.Name)
+
+	valueFileCounts, err := store.ValueFileCountsByTag(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value file counts for tag '%v': %v", tag.Name, err)
+	}
+
+	for _, valueFileCount := range valueFileCounts {
+		fmt.Printf("%v: %v\n", text.Escape(valueFileCount.Name, '=', ' '), valueFileCount.FileCount)
+	}
+
+	return nil
+}
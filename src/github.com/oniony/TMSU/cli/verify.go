@@ -0,0 +1,152 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+)
+
+var VerifyCommand = Command{
+	Name:     "verify",
+	Synopsis: "Check the database for corruption",
+	Usages:   []string{"tmsu verify [OPTION]..."},
+	Description: `Checks the integrity of the database, reporting the number of problems found of each of the following kinds:
+
+  integrity     problems reported by SQLite's own check of the database file
+  taggings      taggings of files, tags or values that no longer exist
+  implications  implications of or by tags or values that no longer exist
+  fingerprints  fingerprints shared by files of differing sizes
+
+With --fix the orphaned taggings and broken implications are removed. Corruption of the database file itself cannot be repaired this way: restore a backup or use 'tmsu export' and 'tmsu import' to rebuild the database. Mismatched fingerprints are typically stale: use 'tmsu repair --unmodified' to recalculate them.
+
+The exit code is non-zero if any problems remain.`,
+	Examples: []string{"$ tmsu verify\nintegrity: 0\ntaggings: 2\nimplications: 0\nfingerprints: 0",
+		"$ tmsu verify --fix\nintegrity: 0\ntaggings: 2 (fixed)\nimplications: 0\nfingerprints: 0"},
+	Options: Options{{"--fix", "-f", "remove orphaned taggings and broken implications", false, ""}},
+	Exec:    verifyExec,
+}
+
+// unexported
+
+func verifyExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	fix := options.HasOption("--fix")
+	if fix {
+		if err := checkWritable("fix the database"); err != nil {
+			return err, nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	remaining, err := verifyDatabase(store, tx, fix)
+	if err != nil {
+		tx.Rollback()
+		return err, nil
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("the database has %v problem(s)", remaining), nil
+	}
+
+	return nil, nil
+}
+
+// Reports the number of problems of each kind, fixing those that may be fixed
+// safely if requested, and returns the number of problems that remain.
+func verifyDatabase(store *storage.Storage, tx *storage.Tx, fix bool) (uint, error) {
+	log.Info("checking database file integrity")
+
+	integrityProblems, err := store.IntegrityProblems(tx)
+	if err != nil {
+		return 0, fmt.Errorf("could not check database integrity: %v", err)
+	}
+	for _, problem := range integrityProblems {
+		log.Warn(problem)
+	}
+
+	remaining := uint(len(integrityProblems))
+	fmt.Printf("integrity: %v\n", len(integrityProblems))
+
+	log.Info("checking for orphaned taggings")
+
+	count, fixed, err := verifyProblem(store.OrphanedFileTagCount, store.DeleteOrphanedFileTags, tx, fix)
+	if err != nil {
+		return 0, fmt.Errorf("could not check file-tags: %v", err)
+	}
+	remaining += count - fixed
+	printVerifyCount("taggings", count, fixed)
+
+	log.Info("checking for broken implications")
+
+	count, fixed, err = verifyProblem(store.BrokenImplicationCount, store.DeleteBrokenImplications, tx, fix)
+	if err != nil {
+		return 0, fmt.Errorf("could not check implications: %v", err)
+	}
+	remaining += count - fixed
+	printVerifyCount("implications", count, fixed)
+
+	log.Info("checking for mismatched fingerprints")
+
+	count, err = store.MismatchedFingerprintCount(tx)
+	if err != nil {
+		return 0, fmt.Errorf("could not check fingerprints: %v", err)
+	}
+	remaining += count
+	printVerifyCount("fingerprints", count, 0)
+
+	return remaining, nil
+}
+
+func verifyProblem(countFunc, fixFunc func(*storage.Tx) (uint, error), tx *storage.Tx, fix bool) (uint, uint, error) {
+	count, err := countFunc(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count == 0 || !fix {
+		return count, 0, nil
+	}
+
+	fixed, err := fixFunc(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, fixed, nil
+}
+
+func printVerifyCount(kind string, count, fixed uint) {
+	if fixed > 0 {
+		fmt.Printf("%v: %v (fixed)\n", kind, count)
+	} else {
+		fmt.Printf("%v: %v\n", kind, count)
+	}
+}
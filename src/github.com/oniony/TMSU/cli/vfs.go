@@ -19,7 +19,10 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/vfs"
+	"os"
+	"strconv"
 	"strings"
 )
 
@@ -30,7 +33,9 @@ var VfsCommand = Command{
 	Description: `This subcommand is the foreground process which hosts the virtual filesystem. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
 
 It is not normally necessary to issue this subcommand manually unless debugging the virtual filesystem. For debug output use the --verbose option.`,
-	Options: Options{{"--options", "-o", "mount options", true, ""}},
+	Options: Options{{"--options", "-o", "mount options", true, ""},
+		{"--link-mode", "", "present files as symlink or hardlink entries", true, ""},
+		{"--ready-fd", "", "write to file descriptor FD once mounted", true, ""}},
 	Exec:    vfsExec,
 	Hidden:  true,
 }
@@ -49,19 +54,56 @@ func vfsExec(options Options, args []string, databasePath string) (error, warnin
 
 	mountPath := args[0]
 
+	linkMode := vfs.SymlinkMode
+	if options.HasOption("--link-mode") {
+		linkMode = options.Get("--link-mode").Argument
+	}
+
+	var ready *os.File
+	if options.HasOption("--ready-fd") {
+		argument := options.Get("--ready-fd").Argument
+
+		fd, err := strconv.Atoi(argument)
+		if err != nil || fd < 0 {
+			return fmt.Errorf("invalid file descriptor '%v': must be a non-negative integer", argument), nil
+		}
+
+		ready = os.NewFile(uintptr(fd), "ready")
+		defer ready.Close()
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
 	}
 	defer store.Close()
 
-	vfs, err := vfs.MountVfs(store, mountPath, mountOptions)
+	vfs, err := vfs.MountVfs(store, mountPath, mountOptions, linkMode)
 	if err != nil {
 		return fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err), nil
 	}
 	defer vfs.Unmount()
 
+	if ready != nil {
+		go signalMounted(vfs, ready)
+	}
+
 	vfs.Serve()
 
 	return nil, nil
 }
+
+// Signals the process that spawned the daemon once the virtual filesystem is
+// available by writing to the readiness file descriptor.
+func signalMounted(fuseVfs *vfs.FuseVfs, ready *os.File) {
+	if err := fuseVfs.WaitMount(); err != nil {
+		log.Warnf("could not wait for virtual filesystem to mount: %v", err)
+		return
+	}
+
+	if _, err := ready.Write([]byte{1}); err != nil {
+		log.Warnf("could not signal that the virtual filesystem is mounted: %v", err)
+	}
+
+	ready.Close()
+}
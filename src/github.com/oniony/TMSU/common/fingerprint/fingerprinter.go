@@ -22,6 +22,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -60,9 +61,32 @@ func Create(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) (F
 	}
 }
 
+// Validates that the specified file fingerprint algorithm is supported.
+func ValidateFileAlgorithm(algorithm string) error {
+	if _, ok := parseDynamicSize(algorithm); ok {
+		return nil
+	}
+
+	for _, fileAlgorithm := range fileAlgorithms {
+		if algorithm == fileAlgorithm {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+}
+
 // unexported
 
+var fileAlgorithms = []string{"dynamic:SHA256", "dynamic:SHA1", "dynamic:MD5", "dynamic:BLAKE2b", "SHA256", "SHA1", "MD5", "BLAKE2b", "none"}
+
+var sizeSuffixes = map[byte]int64{'K': 1024, 'M': 1024 * 1024, 'G': 1024 * 1024 * 1024}
+
 func createFileFingerprint(path, algorithm string, stat os.FileInfo) (Fingerprint, error) {
+	if size, ok := parseDynamicSize(algorithm); ok {
+		return sizedFingerprint(path, sha256.New(), stat.Size(), size)
+	}
+
 	switch algorithm {
 	case "dynamic:SHA256", "":
 		return dynamicFingerprint(path, sha256.New(), stat.Size())
@@ -135,6 +159,65 @@ func dynamicFingerprint(path string, h hash.Hash, fileSize int64) (Fingerprint,
 	return calculateRegularFingerprint(path, h)
 }
 
+// Parses the size from a 'dynamic:SIZE' algorithm name, where SIZE is a number
+// of bytes optionally suffixed with K, M or G.
+func parseDynamicSize(algorithm string) (int64, bool) {
+	if !strings.HasPrefix(algorithm, "dynamic:") {
+		return 0, false
+	}
+
+	text := algorithm[len("dynamic:"):]
+	if text == "" {
+		return 0, false
+	}
+
+	multiplier := int64(1)
+	if suffixMultiplier, ok := sizeSuffixes[text[len(text)-1]]; ok {
+		multiplier = suffixMultiplier
+		text = text[:len(text)-1]
+	}
+
+	size, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, false
+	}
+
+	return size * multiplier, true
+}
+
+// Hashes the first and last sampleSize bytes of a file along with its size. Files
+// no larger than twice the sample size are hashed in their entirety.
+func sizedFingerprint(path string, h hash.Hash, fileSize, sampleSize int64) (Fingerprint, error) {
+	if fileSize <= 2*sampleSize {
+		return calculateRegularFingerprint(path, h)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	if _, err := io.CopyN(h, file, sampleSize); err != nil {
+		return Empty, err
+	}
+
+	if _, err := file.Seek(-sampleSize, 2); err != nil {
+		return Empty, err
+	}
+
+	if _, err := io.CopyN(h, file, sampleSize); err != nil {
+		return Empty, err
+	}
+
+	h.Write([]byte(strconv.FormatInt(fileSize, 10)))
+
+	sum := h.Sum(make([]byte, 0, 64))
+	fingerprint := hex.EncodeToString(sum)
+
+	return Fingerprint(fingerprint), nil
+}
+
 // Uses the symbolic target's filename as the fingerprint
 func symlinkTargetNameFingerprint(path string, includeExtension bool) (Fingerprint, error) {
 	target, err := os.Readlink(path)
@@ -66,6 +66,11 @@ func TestDynamicBLAKE2bGeneration(test *testing.T) {
 	testCreateForLargeFile(test, "dynamic:BLAKE2b", "137c5b1e9e8107c176de7fb7a38f7670bb31364fadb2b5b883737c8732c78327")
 }
 
+func TestDynamicSizeGeneration(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:1M", "cdf701ac9e4258a8efec453930c73d698d12d7e83c38a049a1f1a64375fbf776")
+	testCreateForLargeFile(test, "dynamic:1M", "841ee7d2c2fda0c513807f0ddcaab65ba678fdf7be90844bb6a34d1cc866a623")
+}
+
 func TestNoneGeneration(test *testing.T) {
 	testCreateForSmallFile(test, "none", "")
 	testCreateForLargeFile(test, "none", "")
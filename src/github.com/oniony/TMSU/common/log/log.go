@@ -22,7 +22,25 @@ import (
 	"time"
 )
 
-var Verbosity uint = 1
+// The importance of a message. Messages are shown only if their level is at or
+// below the Threshold.
+type Level uint
+
+const (
+	ErrorLevel Level = iota // problems that prevent an operation
+	WarnLevel               // noteworthy events, such as the creation of a tag
+	InfoLevel               // the progress of an operation
+	DebugLevel              // fine detail, such as the database queries run
+)
+
+// The level of the least important messages shown. By default errors and
+// warnings are shown.
+var Threshold = WarnLevel
+
+// Whether messages of the level are shown.
+func Enabled(level Level) bool {
+	return level <= Threshold
+}
 
 func Fatal(values ...interface{}) {
 	log(os.Stderr, values...)
@@ -34,34 +52,58 @@ func Fatalf(format string, values ...interface{}) {
 	os.Exit(1)
 }
 
-func Warn(values ...interface{}) {
+func Error(values ...interface{}) {
 	log(os.Stderr, values...)
 }
 
-func Warnf(format string, values ...interface{}) {
+func Errorf(format string, values ...interface{}) {
 	logf(os.Stderr, format, values...)
 }
 
-func Info(verbosity uint, values ...interface{}) {
-	if verbosity > Verbosity {
-		return
+func Warn(values ...interface{}) {
+	if Enabled(WarnLevel) {
+		log(os.Stderr, values...)
 	}
+}
 
-	log(os.Stdout, values...)
+func Warnf(format string, values ...interface{}) {
+	if Enabled(WarnLevel) {
+		logf(os.Stderr, format, values...)
+	}
 }
 
-func Infof(verbosity uint, format string, values ...interface{}) {
-	if verbosity > Verbosity {
-		return
+func Info(values ...interface{}) {
+	if Enabled(InfoLevel) {
+		log(os.Stderr, values...)
 	}
+}
 
-	logf(os.Stdout, format, values...)
+func Infof(format string, values ...interface{}) {
+	if Enabled(InfoLevel) {
+		logf(os.Stderr, format, values...)
+	}
+}
+
+func Debug(values ...interface{}) {
+	if Enabled(DebugLevel) {
+		log(os.Stderr, values...)
+	}
+}
+
+func Debugf(format string, values ...interface{}) {
+	if Enabled(DebugLevel) {
+		logf(os.Stderr, format, values...)
+	}
 }
 
 // unexported
 
+// Messages are written to standard error so as not to mix with output, with
+// the time included when debugging.
 func log(dest io.Writer, values ...interface{}) {
-	if Verbosity > 1 {
+	ClearProgress()
+
+	if Enabled(DebugLevel) {
 		fmt.Fprintf(dest, "%v: ", time.Now())
 	}
 
@@ -70,8 +112,10 @@ func log(dest io.Writer, values ...interface{}) {
 }
 
 func logf(dest io.Writer, format string, values ...interface{}) {
-	if Verbosity > 1 {
-		fmt.Printf("%v: ", time.Now())
+	ClearProgress()
+
+	if Enabled(DebugLevel) {
+		fmt.Fprintf(dest, "%v: ", time.Now())
 	}
 
 	format = "tmsu: " + format + "\n"
@@ -0,0 +1,101 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Whether the progress of long-running operations is reported. This should
+// only be enabled when standard error is a terminal.
+var Progress = false
+
+// Records that a further count items are to be processed.
+func AddProgressTotal(count uint) {
+	progress.Lock()
+	defer progress.Unlock()
+
+	progress.total += count
+}
+
+// Records that an item has been processed, redrawing the progress indicator
+// if it has not been drawn recently.
+func IncrementProgress() {
+	progress.Lock()
+	defer progress.Unlock()
+
+	progress.processed++
+
+	if !Progress || time.Since(progress.drawn) < progressInterval {
+		return
+	}
+
+	progress.clear()
+
+	text := fmt.Sprintf("tmsu: %v/%v processed", progress.processed, progress.total)
+	fmt.Fprint(os.Stderr, text)
+
+	progress.width = len(text)
+	progress.drawn = time.Now()
+}
+
+// Removes the progress indicator from the terminal so that other output may
+// be written. It is redrawn upon the next update.
+func ClearProgress() {
+	progress.Lock()
+	defer progress.Unlock()
+
+	progress.clear()
+}
+
+// Removes the progress indicator and resets the counts once the operation is
+// complete.
+func EndProgress() {
+	progress.Lock()
+	defer progress.Unlock()
+
+	progress.clear()
+	progress.processed = 0
+	progress.total = 0
+	progress.drawn = time.Time{}
+}
+
+// unexported
+
+const progressInterval = 100 * time.Millisecond
+
+var progress progressIndicator
+
+type progressIndicator struct {
+	sync.Mutex
+	processed uint
+	total     uint
+	width     int
+	drawn     time.Time
+}
+
+func (indicator *progressIndicator) clear() {
+	if indicator.width == 0 {
+		return
+	}
+
+	fmt.Fprint(os.Stderr, "\r"+strings.Repeat(" ", indicator.width)+"\r")
+	indicator.width = 0
+}
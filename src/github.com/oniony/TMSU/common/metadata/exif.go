@@ -0,0 +1,246 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// unexported
+
+var exifHeader = []byte("Exif\x00\x00")
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+const (
+	makeTag             = 0x010f
+	modelTag            = 0x0110
+	exifIfdTag          = 0x8769
+	dateTimeOriginalTag = 0x9003
+	xpKeywordsTag       = 0x9c9e
+)
+
+// the sizes, in bytes, of the TIFF field types
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+type exifEntry struct {
+	fieldType uint16
+	value     []byte
+}
+
+// Reads the EXIF and XMP segments of a JPEG file. Nil segments are returned
+// for files that are not JPEGs or lack the metadata.
+func readJpegMetadata(path string) ([]byte, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(reader, soi[:]); err != nil || soi[0] != 0xff || soi[1] != 0xd8 {
+		return nil, nil, nil
+	}
+
+	var exifData, xmpData []byte
+	for {
+		marker, err := readJpegMarker(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid JPEG: %v", err)
+		}
+
+		switch {
+		case marker == 0xda, marker == 0xd9:
+			// start of image data or end of image: no further metadata
+			return exifData, xmpData, nil
+		case marker == 0x01, marker >= 0xd0 && marker <= 0xd7:
+			// standalone markers
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, nil, fmt.Errorf("invalid JPEG segment length")
+		}
+
+		if marker != 0xe1 {
+			if _, err := io.CopyN(ioutil.Discard, reader, int64(length-2)); err != nil {
+				return nil, nil, fmt.Errorf("invalid JPEG: %v", err)
+			}
+
+			continue
+		}
+
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, nil, fmt.Errorf("invalid JPEG: %v", err)
+		}
+
+		switch {
+		case bytes.HasPrefix(data, exifHeader):
+			exifData = data[len(exifHeader):]
+		case bytes.HasPrefix(data, xmpHeader):
+			xmpData = data[len(xmpHeader):]
+		}
+	}
+}
+
+func readJpegMarker(reader *bufio.Reader) (byte, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xff {
+		return 0, fmt.Errorf("expected segment marker")
+	}
+
+	// markers may be preceded by any number of fill bytes
+	for b == 0xff {
+		if b, err = reader.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+// Parses the TIFF structure of EXIF data, adding the fields found.
+func parseExif(data []byte, fields Fields) error {
+	if len(data) < 8 {
+		return fmt.Errorf("invalid EXIF data")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid EXIF byte order")
+	}
+
+	if order.Uint16(data[2:4]) != 42 {
+		return fmt.Errorf("invalid EXIF data")
+	}
+
+	entries, err := readExifIfd(data, order, order.Uint32(data[4:8]))
+	if err != nil {
+		return err
+	}
+
+	if entry, ok := entries[makeTag]; ok && entry.fieldType == 2 {
+		fields.add(MakeField, exifString(entry.value))
+	}
+	if entry, ok := entries[modelTag]; ok && entry.fieldType == 2 {
+		fields.add(ModelField, exifString(entry.value))
+	}
+	if entry, ok := entries[xpKeywordsTag]; ok {
+		for _, keyword := range strings.Split(utf16String(entry.value), ";") {
+			fields.add(KeywordsField, keyword)
+		}
+	}
+
+	if entry, ok := entries[exifIfdTag]; ok && len(entry.value) == 4 {
+		exifEntries, err := readExifIfd(data, order, order.Uint32(entry.value))
+		if err != nil {
+			return err
+		}
+
+		if entry, ok := exifEntries[dateTimeOriginalTag]; ok && entry.fieldType == 2 {
+			if date, err := time.Parse("2006:01:02 15:04:05", exifString(entry.value)); err == nil {
+				fields.add(DateTimeOriginalField, date.Format("2006-01-02"))
+			}
+		}
+	}
+
+	return nil
+}
+
+func readExifIfd(data []byte, order binary.ByteOrder, offset uint32) (map[uint16]exifEntry, error) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid EXIF directory offset")
+	}
+
+	count := uint32(order.Uint16(data[offset : offset+2]))
+	if uint64(offset)+2+uint64(count)*12 > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid EXIF directory length")
+	}
+
+	entries := make(map[uint16]exifEntry, count)
+	for index := uint32(0); index < count; index++ {
+		entry := data[offset+2+index*12 : offset+2+index*12+12]
+
+		tag := order.Uint16(entry[0:2])
+		fieldType := order.Uint16(entry[2:4])
+		valueCount := order.Uint32(entry[4:8])
+
+		size, ok := exifTypeSizes[fieldType]
+		if !ok {
+			continue
+		}
+
+		length := uint64(size) * uint64(valueCount)
+		if length <= 4 {
+			entries[tag] = exifEntry{fieldType, entry[8 : 8+length]}
+			continue
+		}
+
+		valueOffset := uint64(order.Uint32(entry[8:12]))
+		if valueOffset+length > uint64(len(data)) {
+			// skip the entry rather than rejecting the other metadata
+			continue
+		}
+
+		entries[tag] = exifEntry{fieldType, data[valueOffset : valueOffset+length]}
+	}
+
+	return entries, nil
+}
+
+func exifString(value []byte) string {
+	if index := bytes.IndexByte(value, 0); index != -1 {
+		value = value[:index]
+	}
+
+	return strings.TrimSpace(string(value))
+}
+
+// Decodes the little-endian UTF-16 strings used by the Windows 'XP' EXIF tags,
+// irrespective of the byte order of the EXIF data.
+func utf16String(value []byte) string {
+	units := make([]uint16, 0, len(value)/2)
+	for index := 0; index+1 < len(value); index += 2 {
+		unit := binary.LittleEndian.Uint16(value[index : index+2])
+		if unit == 0 {
+			break
+		}
+
+		units = append(units, unit)
+	}
+
+	return string(utf16.Decode(units))
+}
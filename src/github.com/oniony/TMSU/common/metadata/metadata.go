@@ -0,0 +1,137 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The names of the metadata fields extracted.
+const (
+	MakeField             = "Make"
+	ModelField            = "Model"
+	DateTimeOriginalField = "DateTimeOriginal"
+	KeywordsField         = "Keywords"
+)
+
+var FieldNames = []string{MakeField, ModelField, DateTimeOriginalField, KeywordsField}
+
+// The values of a file's metadata fields, by field name. Dates are given in
+// the form YYYY-MM-DD.
+type Fields map[string][]string
+
+// Extracts the metadata fields of files.
+type Extractor interface {
+	Extract(path string) (Fields, error)
+}
+
+// Creates an extractor that reads the EXIF and XMP metadata embedded in JPEG
+// files along with any XMP sidecar file, e.g. 'photo.xmp' for 'photo.jpg'.
+func NewExtractor() Extractor {
+	return jpegExtractor{}
+}
+
+// Determines whether the name is that of a metadata field.
+func IsField(name string) bool {
+	for _, fieldName := range FieldNames {
+		if name == fieldName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unexported
+
+type jpegExtractor struct{}
+
+func (extractor jpegExtractor) Extract(path string) (Fields, error) {
+	fields := make(Fields)
+
+	exifData, xmpData, err := readJpegMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if exifData != nil {
+		if err := parseExif(exifData, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	if xmpData != nil {
+		if err := parseXmp(xmpData, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	extension := filepath.Ext(path)
+	for _, sidecarPath := range []string{strings.TrimSuffix(path, extension) + ".xmp", path + ".xmp"} {
+		if sidecarPath == path {
+			continue
+		}
+
+		data, err := readFile(sidecarPath)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+
+		if err := parseXmp(data, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+// Adds a value to a field. Fields other than the keywords take only their
+// first value, such that embedded metadata takes precedence over a sidecar.
+func (fields Fields) add(name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	values := fields[name]
+	if name != KeywordsField && len(values) > 0 {
+		return
+	}
+
+	for _, existing := range values {
+		if existing == value {
+			return
+		}
+	}
+
+	fields[name] = append(values, value)
+}
+
+// Reads the file, if it exists.
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
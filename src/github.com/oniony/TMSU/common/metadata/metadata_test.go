@@ -0,0 +1,204 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestExtractExif(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-metadata-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "photo.jpg")
+	if err := ioutil.WriteFile(path, buildJpeg(binary.LittleEndian), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	fields, err := NewExtractor().Extract(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := Fields{MakeField: {"Canon"},
+		ModelField:            {"EOS 5D"},
+		DateTimeOriginalField: {"2017-06-01"},
+		KeywordsField:         {"beach", "sunset"}}
+	if !reflect.DeepEqual(fields, expected) {
+		test.Fatalf("Expected %v but was %v.", expected, fields)
+	}
+}
+
+func TestExtractBigEndianExif(test *testing.T) {
+	fields := make(Fields)
+	if err := parseExif(buildTiff(binary.BigEndian), fields); err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fields[ModelField], []string{"EOS 5D"}) {
+		test.Fatalf("Unexpected fields %v.", fields)
+	}
+}
+
+func TestExtractXmpSidecar(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-metadata-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "photo.jpg")
+	if err := ioutil.WriteFile(path, buildJpeg(binary.BigEndian), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	sidecar := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/"
+                   xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+                   tiff:Model="Other">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>sunset</rdf:li>
+     <rdf:li>holiday</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+	if err := ioutil.WriteFile(filepath.Join(root, "photo.xmp"), []byte(sidecar), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	fields, err := NewExtractor().Extract(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fields[KeywordsField], []string{"beach", "sunset", "holiday"}) {
+		test.Fatalf("Unexpected keywords %v.", fields[KeywordsField])
+	}
+	if !reflect.DeepEqual(fields[ModelField], []string{"EOS 5D"}) {
+		test.Fatalf("Expected the embedded model to take precedence but was %v.", fields[ModelField])
+	}
+}
+
+func TestExtractNonJpeg(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-metadata-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "notes.txt")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	fields, err := NewExtractor().Extract(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fields) != 0 {
+		test.Fatalf("Expected no fields but was %v.", fields)
+	}
+}
+
+func TestParseTruncatedExif(test *testing.T) {
+	data := buildTiff(binary.LittleEndian)
+	if err := parseExif(data[:12], make(Fields)); err == nil {
+		test.Fatal("Expected truncated EXIF data to be rejected.")
+	}
+}
+
+// unexported
+
+func buildJpeg(order binary.ByteOrder) []byte {
+	segment := append([]byte("Exif\x00\x00"), buildTiff(order)...)
+
+	buffer := new(bytes.Buffer)
+	buffer.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	binary.Write(buffer, binary.BigEndian, uint16(len(segment)+2))
+	buffer.Write(segment)
+	buffer.Write([]byte{0xff, 0xda, 0x00, 0x02, 0xff, 0xd9})
+
+	return buffer.Bytes()
+}
+
+// Builds TIFF data with a primary directory holding the make, model and
+// keywords and an EXIF directory holding the original date.
+func buildTiff(order binary.ByteOrder) []byte {
+	keywords := make([]byte, 0, 32)
+	for _, unit := range utf16.Encode([]rune("beach;sunset\x00")) {
+		keywords = append(keywords, byte(unit), byte(unit>>8))
+	}
+
+	type entry struct {
+		tag       uint16
+		fieldType uint16
+		value     []byte
+	}
+
+	const ifd0Offset = 8
+	const exifIfdOffset = 200
+	const dataOffset = 300
+
+	data := make([]byte, 400)
+	copy(data, map[bool]string{true: "II", false: "MM"}[order == binary.LittleEndian])
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], ifd0Offset)
+
+	exifPointer := make([]byte, 4)
+	order.PutUint32(exifPointer, exifIfdOffset)
+
+	next := uint32(dataOffset)
+	writeIfd := func(offset uint32, entries []entry) {
+		order.PutUint16(data[offset:], uint16(len(entries)))
+		for index, entry := range entries {
+			position := offset + 2 + uint32(index)*12
+			order.PutUint16(data[position:], entry.tag)
+			order.PutUint16(data[position+2:], entry.fieldType)
+			order.PutUint32(data[position+4:], uint32(len(entry.value))/exifTypeSizes[entry.fieldType])
+
+			if len(entry.value) <= 4 {
+				copy(data[position+8:], entry.value)
+				continue
+			}
+
+			order.PutUint32(data[position+8:], next)
+			copy(data[next:], entry.value)
+			next += uint32(len(entry.value))
+		}
+	}
+
+	writeIfd(ifd0Offset, []entry{{makeTag, 2, []byte("Canon\x00")},
+		{modelTag, 2, []byte("EOS 5D\x00")},
+		{exifIfdTag, 4, exifPointer},
+		{xpKeywordsTag, 1, keywords}})
+	writeIfd(exifIfdOffset, []entry{{dateTimeOriginalTag, 2, []byte("2017:06:01 10:20:30\x00")}})
+
+	return data
+}
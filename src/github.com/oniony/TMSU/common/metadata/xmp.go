@@ -0,0 +1,108 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// unexported
+
+type xmpProperty struct {
+	namespace string
+	name      string
+}
+
+var xmpProperties = map[xmpProperty]string{
+	{"http://ns.adobe.com/tiff/1.0/", "Make"}:             MakeField,
+	{"http://ns.adobe.com/tiff/1.0/", "Model"}:            ModelField,
+	{"http://ns.adobe.com/exif/1.0/", "DateTimeOriginal"}: DateTimeOriginalField,
+	{"http://ns.adobe.com/photoshop/1.0/", "DateCreated"}: DateTimeOriginalField,
+	{"http://purl.org/dc/elements/1.1/", "subject"}:       KeywordsField,
+}
+
+// Parses an XMP packet, adding the fields found. Properties may be given
+// either as elements, with their values in any nested 'rdf:li' elements, or
+// as attributes.
+func parseXmp(data []byte, fields Fields) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	// the field of each open element, or "" for those that are not properties
+	openFields := make([]string, 0, 10)
+	currentField := ""
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XMP: %v", err)
+		}
+
+		switch typedToken := token.(type) {
+		case xml.StartElement:
+			for _, attribute := range typedToken.Attr {
+				if field, ok := xmpProperties[xmpProperty{attribute.Name.Space, attribute.Name.Local}]; ok {
+					addXmpValue(fields, field, attribute.Value)
+				}
+			}
+
+			field := xmpProperties[xmpProperty{typedToken.Name.Space, typedToken.Name.Local}]
+			openFields = append(openFields, field)
+			if field != "" {
+				currentField = field
+			}
+		case xml.EndElement:
+			if len(openFields) > 0 {
+				openFields = openFields[:len(openFields)-1]
+			}
+
+			currentField = ""
+			for _, field := range openFields {
+				if field != "" {
+					currentField = field
+				}
+			}
+		case xml.CharData:
+			if currentField != "" {
+				addXmpValue(fields, currentField, string(typedToken))
+			}
+		}
+	}
+}
+
+func addXmpValue(fields Fields, field, value string) {
+	value = strings.TrimSpace(value)
+
+	if field == DateTimeOriginalField {
+		if len(value) < 10 {
+			return
+		}
+		if _, err := time.Parse("2006-01-02", value[:10]); err != nil {
+			return
+		}
+
+		value = value[:10]
+	}
+
+	fields.add(field, value)
+}
@@ -0,0 +1,180 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the file, in any directory, listing the glob patterns of the
+// files and directories to ignore within it.
+const IgnoreFileName = ".tmsuignore"
+
+// Determines which paths are ignored by .tmsuignore files. A nil Ignorer
+// ignores nothing.
+type Ignorer struct {
+	patternsByDir map[string][]ignorePattern
+}
+
+func NewIgnorer() *Ignorer {
+	return &Ignorer{make(map[string][]ignorePattern)}
+}
+
+// Determines whether the path is ignored by a .tmsuignore file in any of the
+// directories above it.
+//
+// Patterns without a slash are matched against each path component beneath
+// the directory containing the .tmsuignore file whilst patterns with a slash
+// are matched against the path relative to that directory. A trailing slash
+// restricts a pattern to directories.
+func (ignorer *Ignorer) Ignored(path string) (bool, error) {
+	if ignorer == nil {
+		return false, nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		patterns, err := ignorer.patterns(dir)
+		if err != nil {
+			return false, err
+		}
+
+		if len(patterns) > 0 {
+			relPath, err := filepath.Rel(dir, absPath)
+			if err != nil {
+				return false, err
+			}
+
+			if matchIgnorePatterns(patterns, absPath, strings.Split(relPath, string(filepath.Separator))) {
+				return true, nil
+			}
+		}
+
+		if IsRoot(dir) {
+			return false, nil
+		}
+	}
+}
+
+// unexported
+
+type ignorePattern struct {
+	glob     string
+	anchored bool
+	dirOnly  bool
+}
+
+func (ignorer *Ignorer) patterns(dir string) ([]ignorePattern, error) {
+	if patterns, ok := ignorer.patternsByDir[dir]; ok {
+		return patterns, nil
+	}
+
+	patterns, err := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	ignorer.patternsByDir[dir] = patterns
+
+	return patterns, nil
+}
+
+func readIgnoreFile(path string) ([]ignorePattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%v: could not open ignore file: %v", path, err)
+	}
+	defer file.Close()
+
+	patterns := make([]ignorePattern, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		pattern := ignorePattern{line, false, false}
+
+		if strings.HasSuffix(pattern.glob, "/") {
+			pattern.glob = strings.TrimRight(pattern.glob, "/")
+			pattern.dirOnly = true
+		}
+
+		if strings.Contains(pattern.glob, "/") {
+			pattern.glob = strings.TrimLeft(pattern.glob, "/")
+			pattern.anchored = true
+		}
+
+		if pattern.glob == "" {
+			continue
+		}
+
+		if _, err := filepath.Match(pattern.glob, ""); err != nil {
+			return nil, fmt.Errorf("%v: invalid pattern '%v': %v", path, line, err)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: could not read ignore file: %v", path, err)
+	}
+
+	return patterns, nil
+}
+
+func matchIgnorePatterns(patterns []ignorePattern, absPath string, components []string) bool {
+	for index := range components {
+		isLast := index == len(components)-1
+
+		for _, pattern := range patterns {
+			var matched bool
+			if pattern.anchored {
+				matched, _ = filepath.Match(pattern.glob, strings.Join(components[:index+1], "/"))
+			} else {
+				matched, _ = filepath.Match(pattern.glob, components[index])
+			}
+
+			if !matched {
+				continue
+			}
+
+			if pattern.dirOnly && isLast {
+				stat, err := os.Stat(absPath)
+				if err != nil || !stat.IsDir() {
+					continue
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
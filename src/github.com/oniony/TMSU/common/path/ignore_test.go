@@ -0,0 +1,97 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-ignore-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"a/build", "a/b/build", "a/b/c", "d"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	writeIgnoreFile(test, root, "# object files\n*.o\nbuild/\n")
+	writeIgnoreFile(test, filepath.Join(root, "a", "b"), "/c/*.txt\n")
+	writeFile(test, filepath.Join(root, "d", "build"))
+
+	ignorer := NewIgnorer()
+
+	assertIgnored(test, ignorer, filepath.Join(root, "x.o"), true)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "b", "x.o"), true)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "build"), true)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "b", "build", "x"), true)
+	assertIgnored(test, ignorer, filepath.Join(root, "d", "build"), false)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "b", "c", "x.txt"), true)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "b", "x.txt"), false)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "c", "x.txt"), false)
+	assertIgnored(test, ignorer, filepath.Join(root, "a", "x.c"), false)
+}
+
+func TestIgnoredWithNilIgnorer(test *testing.T) {
+	var ignorer *Ignorer
+
+	assertIgnored(test, ignorer, "/some/path", false)
+}
+
+func TestIgnoredWithInvalidPattern(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-ignore-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeIgnoreFile(test, root, "[\n")
+
+	if _, err := NewIgnorer().Ignored(filepath.Join(root, "x")); err == nil {
+		test.Fatal("Expected invalid pattern to be reported.")
+	}
+}
+
+// unexported
+
+func writeIgnoreFile(test *testing.T, dir, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, IgnoreFileName), []byte(content), 0644); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func writeFile(test *testing.T, path string) {
+	if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func assertIgnored(test *testing.T, ignorer *Ignorer, path string, expected bool) {
+	ignored, err := ignorer.Ignored(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if ignored != expected {
+		test.Fatalf("Expected '%v' ignored to be %v but was %v.", path, expected, ignored)
+	}
+}
@@ -88,18 +88,24 @@ func UnescapeOctal(path string) string {
 	return octalEscapePattern.ReplaceAllStringFunc(path, decodeChar)
 }
 
+// Resolves the chain of symbolic links, if any, at the path. Relative link
+// targets are resolved relative to the directory containing the link.
 func Dereference(path string) (string, error) {
 	stat, err := os.Lstat(path)
 	if err != nil {
 		return "", err
 	}
 	if stat.Mode()&os.ModeSymlink != 0 {
-		path, err := os.Readlink(path)
+		target, err := os.Readlink(path)
 		if err != nil {
 			return "", err
 		}
 
-		return Dereference(path)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+
+		return Dereference(target)
 	}
 
 	return path, nil
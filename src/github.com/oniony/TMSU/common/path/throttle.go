@@ -0,0 +1,87 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits the rate at which files are examined, either by the number of files or
+// by the number of bytes read from them, by sleeping as required. A nil Throttle
+// imposes no limit.
+type Throttle struct {
+	perSecond float64
+	bySize    bool
+	start     time.Time
+	used      float64
+	mutex     sync.Mutex
+}
+
+// Parses a limit of N, for N files per second, or NMB, for N megabytes per
+// second.
+func ParseThrottle(text string) (*Throttle, error) {
+	number := text
+	bySize := false
+	if strings.HasSuffix(strings.ToUpper(text), "MB") {
+		number = text[:len(text)-2]
+		bySize = true
+	}
+
+	limit, err := strconv.ParseFloat(number, 64)
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid limit '%v': expected a number of files, or megabytes with the suffix MB, per second", text)
+	}
+
+	if bySize {
+		limit *= 1024 * 1024
+	}
+
+	return &Throttle{perSecond: limit, bySize: bySize}, nil
+}
+
+// Records the examination of a file from which the specified number of bytes
+// were read, sleeping for as long as necessary to keep within the limit. It is
+// safe to call concurrently.
+func (throttle *Throttle) Examined(bytesRead int64) {
+	if throttle == nil {
+		return
+	}
+
+	throttle.mutex.Lock()
+
+	now := time.Now()
+	if throttle.start.IsZero() {
+		throttle.start = now
+	}
+
+	if throttle.bySize {
+		throttle.used += float64(bytesRead)
+	} else {
+		throttle.used++
+	}
+
+	due := throttle.start.Add(time.Duration(throttle.used / throttle.perSecond * float64(time.Second)))
+
+	throttle.mutex.Unlock()
+
+	if wait := due.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+}
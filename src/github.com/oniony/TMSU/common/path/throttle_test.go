@@ -0,0 +1,82 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseThrottle(test *testing.T) {
+	throttle, err := ParseThrottle("20")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if throttle.bySize || throttle.perSecond != 20 {
+		test.Fatalf("Expected 20 files per second but was %v (by size: %v).", throttle.perSecond, throttle.bySize)
+	}
+
+	throttle, err = ParseThrottle("1.5MB")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !throttle.bySize || throttle.perSecond != 1.5*1024*1024 {
+		test.Fatalf("Expected 1.5MB per second but was %v bytes (by size: %v).", throttle.perSecond, throttle.bySize)
+	}
+
+	for _, text := range []string{"", "0", "-5", "fast", "MB"} {
+		if _, err := ParseThrottle(text); err == nil {
+			test.Fatalf("Expected '%v' to be rejected.", text)
+		}
+	}
+}
+
+func TestThrottleLimitsFiles(test *testing.T) {
+	throttle, err := ParseThrottle("100")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	start := time.Now()
+	for index := 0; index < 10; index++ {
+		throttle.Examined(0)
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		test.Fatalf("Expected ten files at 100 per second to take at least 90ms but took %v.", elapsed)
+	}
+}
+
+func TestThrottleIgnoresFilesWhenLimitingSize(test *testing.T) {
+	throttle, err := ParseThrottle("1MB")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	start := time.Now()
+	for index := 0; index < 1000; index++ {
+		throttle.Examined(0)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		test.Fatalf("Expected files without content to be unthrottled but took %v.", elapsed)
+	}
+}
+
+func TestNilThrottle(test *testing.T) {
+	var throttle *Throttle
+	throttle.Examined(1024 * 1024 * 1024)
+}
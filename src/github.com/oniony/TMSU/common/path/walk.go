@@ -0,0 +1,73 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Tracks the directories entered whilst walking a directory tree such that
+// symbolic links to directories may be followed without looping forever.
+type Walk struct {
+	FollowSymlinks bool
+	entered        map[string]bool
+}
+
+func NewWalk(followSymlinks bool) *Walk {
+	return &Walk{followSymlinks, make(map[string]bool)}
+}
+
+// Determines whether the directory entry at the path may be descended into: a
+// symbolic link is only descended into if FollowSymlinks is set.
+func (walk *Walk) Follows(path string) bool {
+	if walk.FollowSymlinks {
+		return true
+	}
+
+	stat, err := os.Lstat(path)
+	return err != nil || stat.Mode()&os.ModeSymlink == 0
+}
+
+// Records the directory at the path as entered, returning false if it has
+// already been entered, e.g. via a symbolic link that creates a cycle. Other
+// types of file are not recorded.
+func (walk *Walk) Enter(path string) bool {
+	stat, err := os.Stat(path)
+	if err != nil || !stat.IsDir() {
+		// errors are left for the walk to report
+		return true
+	}
+
+	key := directoryKey(path, stat)
+	if walk.entered[key] {
+		return false
+	}
+
+	walk.entered[key] = true
+	return true
+}
+
+// unexported
+
+func resolvedPathKey(path string) string {
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	return resolvedPath
+}
@@ -0,0 +1,81 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkFollowsSymlinks(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-walk-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	link := filepath.Join(root, "link")
+	if err := os.Symlink("dir", link); err != nil {
+		test.Skipf("could not create symbolic link: %v", err)
+	}
+
+	if !NewWalk(false).Follows(dir) {
+		test.Fatal("Expected directory to be followed.")
+	}
+	if NewWalk(false).Follows(link) {
+		test.Fatal("Expected symbolic link not to be followed.")
+	}
+	if !NewWalk(true).Follows(link) {
+		test.Fatal("Expected symbolic link to be followed.")
+	}
+}
+
+func TestWalkEntersDirectoryOnce(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-walk-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	loop := filepath.Join(dir, "loop")
+	if err := os.Symlink("..", loop); err != nil {
+		test.Skipf("could not create symbolic link: %v", err)
+	}
+
+	walk := NewWalk(true)
+
+	if !walk.Enter(root) {
+		test.Fatal("Expected root to be entered.")
+	}
+	if !walk.Enter(dir) {
+		test.Fatal("Expected directory to be entered.")
+	}
+	if walk.Enter(loop) {
+		test.Fatal("Expected cycle back to root not to be entered.")
+	}
+}
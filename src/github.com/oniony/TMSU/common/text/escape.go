@@ -0,0 +1,30 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"strings"
+)
+
+// Escapes each occurrence of the characters with a backslash, e.g. so that a
+// tag name containing '=' can be told apart from a tag and value.
+func Escape(text string, chars ...rune) string {
+	for _, char := range chars {
+		text = strings.Replace(text, string(char), `\`+string(char), -1)
+	}
+
+	return text
+}
@@ -0,0 +1,48 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"strings"
+)
+
+// Quotes the text so that a POSIX shell reads it as a single word with the same
+// characters. Text consisting only of characters that are not special to the
+// shell is left as is; otherwise it is enclosed in single quotation marks, with
+// any single quotation mark within it closing the quotation, appearing escaped
+// and then reopening the quotation.
+func ShellQuote(text string) string {
+	if text == "" {
+		return "''"
+	}
+
+	if strings.IndexFunc(text, isShellSpecial) == -1 {
+		return text
+	}
+
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+// unexported
+
+func isShellSpecial(char rune) bool {
+	switch {
+	case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		return false
+	}
+
+	return !strings.ContainsRune("@%+=:,./-_", char)
+}
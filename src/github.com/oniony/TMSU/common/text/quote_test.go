@@ -0,0 +1,41 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"testing"
+)
+
+func TestShellQuote(test *testing.T) {
+	cases := map[string]string{
+		"":                    "''",
+		"/home/bob/photo.jpg": "/home/bob/photo.jpg",
+		"./a-b_c,d=e+f@g%h:i": "./a-b_c,d=e+f@g%h:i",
+		"my photo.jpg":        "'my photo.jpg'",
+		"children's.txt":      `'children'\''s.txt'`,
+		"$HOME/*.txt":         "'$HOME/*.txt'",
+		"line\nbreak":         "'line\nbreak'",
+		"~bob":                "'~bob'",
+		"a\\b":                `'a\b'`,
+		"café":                "'café'",
+	}
+
+	for text, expected := range cases {
+		if actual := ShellQuote(text); actual != expected {
+			test.Fatalf("Expected '%v' to be quoted as %v but was %v.", text, expected, actual)
+		}
+	}
+}
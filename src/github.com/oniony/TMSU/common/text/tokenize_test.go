@@ -82,3 +82,11 @@ func TestComplex(test *testing.T) {
 		test.Fatalf("tokenization failed: %v", words)
 	}
 }
+
+func TestQuotedValue(test *testing.T) {
+	words := Tokenize(`title="A, B: and C" formula='a=b' lang=日本語`)
+
+	if len(words) != 3 || words[0] != "title=A, B: and C" || words[1] != "formula=a=b" || words[2] != "lang=日本語" {
+		test.Fatalf("tokenization failed: %v", words)
+	}
+}
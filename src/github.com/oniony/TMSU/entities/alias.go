@@ -0,0 +1,51 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"strings"
+)
+
+// An alternative name by which a tag may be referred to.
+type Alias struct {
+	Name string
+	Tag  Tag
+}
+
+type Aliases []*Alias
+
+// Determines whether there is an alias of the specified name.
+func (aliases Aliases) ContainsCasedName(name string, ignoreCase bool) bool {
+	for _, alias := range aliases {
+		if alias.Name == name || ignoreCase && strings.EqualFold(alias.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retrieves the names of the aliases of the specified tag.
+func (aliases Aliases) NamesForTag(tagId TagId) []string {
+	names := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if alias.Tag.Id == tagId {
+			names = append(names, alias.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,36 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"time"
+)
+
+// A change to the database recorded, when the 'auditLog' setting is enabled,
+// for accountability. The names rather than the identifiers of the tag, value
+// and file are recorded so that entries remain meaningful once these are
+// deleted. Detail holds anything further, such as the destination of a merge.
+type AuditEntry struct {
+	Time      time.Time
+	User      string
+	Operation string
+	Tag       string
+	Value     string
+	Path      string
+	Detail    string
+}
+
+type AuditEntries []*AuditEntry
@@ -15,11 +15,17 @@
 
 package entities
 
+// An implication such that files tagged with ImplyingTag, with ImplyingValue if
+// not zero, are also tagged ImpliedTag, with ImpliedValue if not zero. Where
+// InheritsValue is set the implied tag has whatever value the implying tag has:
+// such implications are stored without values and are given the inherited value
+// when retrieved for a particular tag and value pair.
 type Implication struct {
 	ImplyingTag   Tag
 	ImplyingValue Value
 	ImpliedTag    Tag
 	ImpliedValue  Value
+	InheritsValue bool
 }
 
 func (implication Implication) ImplyingTagValuePair() TagIdValueIdPair {
@@ -34,6 +34,10 @@ func (settings Settings) Swap(i, j int) {
 	settings[i], settings[j] = settings[j], settings[i]
 }
 
+func (settings Settings) AuditLog() bool {
+	return settings.BoolValue("auditLog")
+}
+
 func (settings Settings) AutoCreateTags() bool {
 	return settings.BoolValue("autoCreateTags")
 }
@@ -42,10 +46,18 @@ func (settings Settings) AutoCreateValues() bool {
 	return settings.BoolValue("autoCreateValues")
 }
 
+func (settings Settings) CaseSensitive() bool {
+	return settings.BoolValue("caseSensitive")
+}
+
 func (settings Settings) FileFingerprintAlgorithm() string {
 	return settings.Value("fileFingerprintAlgorithm")
 }
 
+func (settings Settings) PreviousFileFingerprintAlgorithm() string {
+	return settings.Value("previousFileFingerprintAlgorithm")
+}
+
 func (settings Settings) DirectoryFingerprintAlgorithm() string {
 	return settings.Value("directoryFingerprintAlgorithm")
 }
@@ -54,6 +66,18 @@ func (settings Settings) SymlinkFingerprintAlgorithm() string {
 	return settings.Value("symlinkFingerprintAlgorithm")
 }
 
+func (settings Settings) JournalMode() string {
+	return settings.Value("journalMode")
+}
+
+func (settings Settings) MetadataTags() string {
+	return settings.Value("metadataTags")
+}
+
+func (settings Settings) PostTagHook() string {
+	return settings.Value("postTagHook")
+}
+
 func (settings Settings) ReportDuplicates() bool {
 	return settings.BoolValue("reportDuplicates")
 }
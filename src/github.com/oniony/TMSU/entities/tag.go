@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -121,6 +122,31 @@ type TagFileCount struct {
 	FileCount uint
 }
 
+// When a tag was last applied to a file. LastUsed is the zero time if this is
+// not known.
+type TagLastUsed struct {
+	Id       TagId
+	Name     string
+	LastUsed time.Time
+}
+
+// What a tag means. Description is empty if the tag has not been described.
+type TagDescription struct {
+	Id          TagId
+	Name        string
+	Description string
+}
+
+// A free-form item of metadata recorded against a tag, such as a display colour
+// for a user interface. TMSU stores these without interpreting them.
+type TagMeta struct {
+	TagId TagId
+	Key   string
+	Value string
+}
+
+type TagMetas []*TagMeta
+
 func ValidateTagName(tagName string) error {
 	switch tagName {
 	case "":
@@ -115,6 +115,12 @@ func (values Values) Any(predicate func(*Value) bool) bool {
 	return false
 }
 
+type ValueFileCount struct {
+	Id        ValueId
+	Name      string
+	FileCount uint
+}
+
 func ValidateValueName(valueName string) error {
 	switch valueName {
 	case "":
@@ -0,0 +1,146 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Restricts the values that may be applied with a tag.
+type ValueConstraint struct {
+	TagId TagId
+	Type  string
+}
+
+type ValueConstraints []*ValueConstraint
+
+func (constraints ValueConstraints) Len() int {
+	return len(constraints)
+}
+
+func (constraints ValueConstraints) Swap(i, j int) {
+	constraints[i], constraints[j] = constraints[j], constraints[i]
+}
+
+func (constraints ValueConstraints) Less(i, j int) bool {
+	return constraints[i].TagId < constraints[j].TagId
+}
+
+// Validates a constraint type: one of 'int', 'int-range:MIN..MAX', 'date' or
+// 'enum:VALUE,...'.
+func ValidateConstraintType(constraintType string) error {
+	_, err := parseConstraintType(constraintType)
+	return err
+}
+
+// Validates a value name against the constraint.
+func (constraint ValueConstraint) Validate(valueName string) error {
+	validator, err := parseConstraintType(constraint.Type)
+	if err != nil {
+		return err
+	}
+
+	return validator(valueName)
+}
+
+// unexported
+
+const constraintDateLayout = "2006-01-02"
+
+type valueValidator func(valueName string) error
+
+func parseConstraintType(constraintType string) (valueValidator, error) {
+	name, argument := constraintType, ""
+	if index := strings.Index(constraintType, ":"); index != -1 {
+		name, argument = constraintType[:index], constraintType[index+1:]
+	}
+
+	switch name {
+	case "int":
+		if argument != "" {
+			break
+		}
+
+		return validateInt, nil
+	case "int-range":
+		parts := strings.SplitN(argument, "..", 2)
+		if len(parts) != 2 {
+			break
+		}
+
+		min, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			break
+		}
+
+		max, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || max < min {
+			break
+		}
+
+		return func(valueName string) error {
+			value, err := strconv.ParseInt(valueName, 10, 64)
+			if err != nil || value < min || value > max {
+				return fmt.Errorf("must be an integer from %v to %v", min, max)
+			}
+
+			return nil
+		}, nil
+	case "date":
+		if argument != "" {
+			break
+		}
+
+		return validateDate, nil
+	case "enum":
+		if argument == "" {
+			break
+		}
+
+		permitted := strings.Split(argument, ",")
+
+		return func(valueName string) error {
+			for _, permittedName := range permitted {
+				if valueName == permittedName {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("must be one of %v", strings.Join(permitted, ", "))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid constraint type '%v': must be one of int, int-range:MIN..MAX, date or enum:VALUE,...", constraintType)
+}
+
+func validateInt(valueName string) error {
+	if _, err := strconv.ParseInt(valueName, 10, 64); err != nil {
+		return fmt.Errorf("must be an integer")
+	}
+
+	return nil
+}
+
+func validateDate(valueName string) error {
+	if _, err := time.Parse(constraintDateLayout, valueName); err != nil {
+		return fmt.Errorf("must be a date of the form YYYY-MM-DD")
+	}
+
+	return nil
+}
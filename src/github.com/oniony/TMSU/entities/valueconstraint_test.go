@@ -0,0 +1,74 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestValueConstraintValidate(test *testing.T) {
+	// set-up
+
+	cases := []struct {
+		constraintType string
+		valueName      string
+		valid          bool
+	}{
+		{"int", "42", true},
+		{"int", "-7", true},
+		{"int", "4.2", false},
+		{"int-range:1..5", "1", true},
+		{"int-range:1..5", "5", true},
+		{"int-range:1..5", "6", false},
+		{"int-range:1..5", "five", false},
+		{"date", "2018-02-28", true},
+		{"date", "2018-02-30", false},
+		{"date", "28/02/2018", false},
+		{"enum:red,green,blue", "green", true},
+		{"enum:red,green,blue", "Green", false},
+	}
+
+	for _, testCase := range cases {
+		constraint := ValueConstraint{1, testCase.constraintType}
+
+		// test
+
+		err := constraint.Validate(testCase.valueName)
+
+		// validate
+
+		if testCase.valid && err != nil {
+			test.Fatalf("%v: expected '%v' to be valid: %v", testCase.constraintType, testCase.valueName, err)
+		}
+		if !testCase.valid && err == nil {
+			test.Fatalf("%v: expected '%v' to be invalid", testCase.constraintType, testCase.valueName)
+		}
+	}
+}
+
+func TestValidateConstraintType(test *testing.T) {
+	for _, constraintType := range []string{"int", "int-range:-10..10", "date", "enum:a,b"} {
+		if err := ValidateConstraintType(constraintType); err != nil {
+			test.Fatalf("expected '%v' to be valid: %v", constraintType, err)
+		}
+	}
+
+	for _, constraintType := range []string{"", "float", "int:1", "int-range:5..1", "int-range:1", "enum:", "date:iso"} {
+		if err := ValidateConstraintType(constraintType); err == nil {
+			test.Fatalf("expected '%v' to be invalid", constraintType)
+		}
+	}
+}
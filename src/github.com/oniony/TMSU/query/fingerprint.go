@@ -0,0 +1,57 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unexported
+
+const fingerprintPrefix = "fingerprint:"
+
+func isFingerprintPredicate(name string) bool {
+	return strings.HasPrefix(name, fingerprintPrefix)
+}
+
+// Builds a fingerprint expression from the text following 'fingerprint:' or,
+// where the predicate is separated from the fingerprint by whitespace, from the
+// next symbol.
+func (parser Parser) fingerprint(text string) (Expression, error) {
+	prefix := strings.TrimPrefix(text, fingerprintPrefix)
+
+	if prefix == "" {
+		token, err := parser.scanner.LookAhead()
+		if err != nil {
+			return nil, err
+		}
+
+		if symbol, ok := token.(SymbolToken); ok {
+			if _, err := parser.scanner.Next(); err != nil {
+				return nil, err
+			}
+
+			prefix = symbol.name
+		}
+	}
+
+	if prefix == "" {
+		return nil, fmt.Errorf("the '%v' predicate must be followed by a fingerprint or the start of one, e.g. %v3a7bd3e2", fingerprintPrefix, fingerprintPrefix)
+	}
+
+	return FingerprintExpression{prefix}, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parses a position such as '51.5,-0.12' into its latitude and longitude in
+// degrees. Text that is not a pair of numbers in range is rejected.
+func ParseCoordinates(text string) (float64, float64, bool) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || !(latitude >= -90 && latitude <= 90) {
+		return 0, 0, false
+	}
+
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || !(longitude >= -180 && longitude <= 180) {
+		return 0, 0, false
+	}
+
+	return latitude, longitude, true
+}
+
+// Calculates the great-circle distance, in metres, between two positions
+// using the haversine formula.
+func Distance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	phi1 := latitude1 * math.Pi / 180
+	phi2 := latitude2 * math.Pi / 180
+	deltaPhi := (latitude2 - latitude1) * math.Pi / 180
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Determines whether the value name is a position within range of the
+// expression's point. Value names that are not positions never match.
+func (expression NearExpression) Matches(valueName string) bool {
+	latitude, longitude, ok := ParseCoordinates(valueName)
+	if !ok {
+		return false
+	}
+
+	return Distance(expression.Latitude, expression.Longitude, latitude, longitude) <= expression.Radius
+}
+
+// Determines whether an expression contains any 'near' comparisons.
+func ContainsNear(expression Expression) bool {
+	switch exp := expression.(type) {
+	case NearExpression:
+		return true
+	case NotExpression:
+		return ContainsNear(exp.Operand)
+	case AndExpression:
+		return ContainsNear(exp.LeftOperand) || ContainsNear(exp.RightOperand)
+	case OrExpression:
+		return ContainsNear(exp.LeftOperand) || ContainsNear(exp.RightOperand)
+	case XorExpression:
+		return ContainsNear(exp.LeftOperand) || ContainsNear(exp.RightOperand)
+	}
+
+	return false
+}
+
+// Records against each 'near' comparison within an expression which of the
+// value names are in range.
+func ResolveNearValues(expression Expression, valueNames []string) Expression {
+	switch exp := expression.(type) {
+	case NearExpression:
+		exp.ValueNames = make([]string, 0, 10)
+		for _, valueName := range valueNames {
+			if exp.Matches(valueName) {
+				exp.ValueNames = append(exp.ValueNames, valueName)
+			}
+		}
+		return exp
+	case NotExpression:
+		exp.Operand = ResolveNearValues(exp.Operand, valueNames)
+		return exp
+	case AndExpression:
+		exp.LeftOperand = ResolveNearValues(exp.LeftOperand, valueNames)
+		exp.RightOperand = ResolveNearValues(exp.RightOperand, valueNames)
+		return exp
+	case OrExpression:
+		exp.LeftOperand = ResolveNearValues(exp.LeftOperand, valueNames)
+		exp.RightOperand = ResolveNearValues(exp.RightOperand, valueNames)
+		return exp
+	case XorExpression:
+		exp.LeftOperand = ResolveNearValues(exp.LeftOperand, valueNames)
+		exp.RightOperand = ResolveNearValues(exp.RightOperand, valueNames)
+		return exp
+	}
+
+	return expression
+}
+
+// unexported
+
+// mean radius of the Earth, in metres
+const earthRadius = 6371008.8
+
+var distancePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(m|km|mi)$`)
+
+var distanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+}
+
+func nearExpression(tag TagExpression, pointText, radiusText string) (Expression, error) {
+	latitude, longitude, ok := ParseCoordinates(pointText)
+	if !ok {
+		return nil, fmt.Errorf("invalid position '%v' for 'near': expected a latitude and longitude, e.g. 51.5,-0.12", pointText)
+	}
+
+	matches := distancePattern.FindStringSubmatch(radiusText)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid distance '%v' for 'within': expected a number followed by m, km or mi, e.g. 10km", radiusText)
+	}
+
+	radius, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance '%v' for 'within': %v", radiusText, err)
+	}
+
+	return NearExpression{tag, latitude, longitude, radius * distanceUnits[matches[2]], nil}, nil
+}
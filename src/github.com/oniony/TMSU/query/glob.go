@@ -0,0 +1,125 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Stands in for the slash when matching: it cannot occur in a tag name.
+const hierarchySeparator = "\x00"
+
+// Determines whether the tag name matches the glob pattern.
+func (expression GlobExpression) Matches(tagName string, ignoreCase bool) bool {
+	pattern := expression.Pattern
+	if ignoreCase {
+		pattern = strings.ToLower(pattern)
+		tagName = strings.ToLower(tagName)
+	}
+
+	// the separator is substituted so that the wildcards also match the slash
+	// of hierarchical tag names, e.g. 'location/*' matches 'location/europe/france'
+	pattern = strings.Replace(pattern, "/", hierarchySeparator, -1)
+	tagName = strings.Replace(tagName, "/", hierarchySeparator, -1)
+
+	matched, _ := path.Match(pattern, tagName)
+	return matched
+}
+
+// Determines whether an expression contains any glob patterns.
+func ContainsGlob(expression Expression) bool {
+	switch exp := expression.(type) {
+	case GlobExpression:
+		return true
+	case NotExpression:
+		return ContainsGlob(exp.Operand)
+	case AndExpression:
+		return ContainsGlob(exp.LeftOperand) || ContainsGlob(exp.RightOperand)
+	case OrExpression:
+		return ContainsGlob(exp.LeftOperand) || ContainsGlob(exp.RightOperand)
+	case XorExpression:
+		return ContainsGlob(exp.LeftOperand) || ContainsGlob(exp.RightOperand)
+	}
+
+	return false
+}
+
+// Replaces each glob pattern within an expression with an 'or' of the
+// matching tag names. A glob pattern that matches no tags is replaced by an
+// expression that matches no files.
+func ExpandGlobs(expression Expression, tagNames []string, ignoreCase bool) (Expression, error) {
+	var err error
+
+	switch exp := expression.(type) {
+	case EmptyExpression, TagExpression, ComparisonExpression, AnyValueExpression, NearExpression, RegexExpression, TimeExpression, TagCountExpression, SizeExpression, PathExpression, FingerprintExpression:
+		return exp, nil
+	case GlobExpression:
+		return expandGlob(exp, tagNames, ignoreCase), nil
+	case NotExpression:
+		exp.Operand, err = ExpandGlobs(exp.Operand, tagNames, ignoreCase)
+		return exp, err
+	case AndExpression:
+		if exp.LeftOperand, err = ExpandGlobs(exp.LeftOperand, tagNames, ignoreCase); err != nil {
+			return nil, err
+		}
+
+		exp.RightOperand, err = ExpandGlobs(exp.RightOperand, tagNames, ignoreCase)
+		return exp, err
+	case OrExpression:
+		if exp.LeftOperand, err = ExpandGlobs(exp.LeftOperand, tagNames, ignoreCase); err != nil {
+			return nil, err
+		}
+
+		exp.RightOperand, err = ExpandGlobs(exp.RightOperand, tagNames, ignoreCase)
+		return exp, err
+	case XorExpression:
+		if exp.LeftOperand, err = ExpandGlobs(exp.LeftOperand, tagNames, ignoreCase); err != nil {
+			return nil, err
+		}
+
+		exp.RightOperand, err = ExpandGlobs(exp.RightOperand, tagNames, ignoreCase)
+		return exp, err
+	}
+
+	return nil, fmt.Errorf("unsupported token type '%t'", expression)
+}
+
+// unexported
+
+func expandGlob(expression GlobExpression, tagNames []string, ignoreCase bool) Expression {
+	var expanded Expression
+
+	for _, tagName := range tagNames {
+		if !expression.Matches(tagName, ignoreCase) {
+			continue
+		}
+
+		if expanded == nil {
+			expanded = TagExpression{tagName}
+		} else {
+			expanded = OrExpression{expanded, TagExpression{tagName}}
+		}
+	}
+
+	if expanded == nil {
+		// not the empty expression, which matches every file
+		return NotExpression{EmptyExpression{}}
+	}
+
+	return expanded
+}
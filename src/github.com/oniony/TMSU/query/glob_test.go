@@ -0,0 +1,81 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+)
+
+func TestGlobMatches(test *testing.T) {
+	glob := GlobExpression{"client-*"}
+
+	if !glob.Matches("client-acme", false) {
+		test.Fatal("Expected 'client-acme' to match.")
+	}
+	if glob.Matches("Client-acme", false) {
+		test.Fatal("Expected 'Client-acme' not to match case-sensitively.")
+	}
+	if !glob.Matches("Client-acme", true) {
+		test.Fatal("Expected 'Client-acme' to match case-insensitively.")
+	}
+	if glob.Matches("former-client-acme", false) {
+		test.Fatal("Expected 'former-client-acme' not to match.")
+	}
+}
+
+func TestGlobMatchesHierarchicalTagNames(test *testing.T) {
+	glob := GlobExpression{"location/europe/*"}
+
+	if !glob.Matches("location/europe/france", false) {
+		test.Fatal("Expected 'location/europe/france' to match.")
+	}
+	if !glob.Matches("location/europe/france/paris", false) {
+		test.Fatal("Expected 'location/europe/france/paris' to match.")
+	}
+	if glob.Matches("location/europe", false) {
+		test.Fatal("Expected 'location/europe' not to match.")
+	}
+	if glob.Matches("location/asia/japan", false) {
+		test.Fatal("Expected 'location/asia/japan' not to match.")
+	}
+}
+
+func TestExpandGlobs(test *testing.T) {
+	expression := AndExpression{GlobExpression{"client-*"}, NotExpression{GlobExpression{"?rchived"}}}
+	tagNames := []string{"archived", "client-acme", "client-initech", "photo"}
+
+	expanded, err := ExpandGlobs(expression, tagNames, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	and := validateAnd(expanded)
+	or := validateOr(and.LeftOperand)
+	validateTag(or.LeftOperand, "client-acme", test)
+	validateTag(or.RightOperand, "client-initech", test)
+	validateTag(validateNot(and.RightOperand).Operand, "archived", test)
+}
+
+func TestExpandUnmatchedGlob(test *testing.T) {
+	expanded, err := ExpandGlobs(GlobExpression{"client-*"}, []string{"photo"}, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, ok := validateNot(expanded).Operand.(EmptyExpression); !ok {
+		test.Fatalf("Expected unmatched glob to match no files but was '%v'.", expanded)
+	}
+}
@@ -17,6 +17,8 @@ package query
 
 import (
 	"fmt"
+	"regexp"
+	"time"
 )
 
 type Parser struct {
@@ -31,6 +33,17 @@ func (parser Parser) Parse() (Expression, error) {
 	return parser.expression()
 }
 
+// A query that is not well-formed, identifying the character position, from 1,
+// of the offending token.
+type SyntaxError struct {
+	Message  string
+	Position int
+}
+
+func (err SyntaxError) Error() string {
+	return fmt.Sprintf("%v at position %v", err.Message, err.Position)
+}
+
 type Expression interface {
 }
 
@@ -42,6 +55,12 @@ type OrExpression struct {
 	RightOperand Expression
 }
 
+// Matches files that match exactly one of the operands.
+type XorExpression struct {
+	LeftOperand  Expression
+	RightOperand Expression
+}
+
 type AndExpression struct {
 	LeftOperand  Expression
 	RightOperand Expression
@@ -53,6 +72,68 @@ type ComparisonExpression struct {
 	Value    ValueExpression
 }
 
+type TimeExpression struct {
+	Field    string
+	Operator string
+	Time     time.Time
+	DateOnly bool
+}
+
+// Matches files by the number of distinct tags applied to them. Implied tags
+// are only counted if Implied is set.
+type TagCountExpression struct {
+	Operator string
+	Count    uint
+	Implied  bool
+}
+
+// Matches files by their size in bytes.
+type SizeExpression struct {
+	Operator string
+	Size     int64
+}
+
+// Matches files whose value for the tag is a 'lat,lon' position within Radius
+// metres of the point. ValueNames holds the value names found to be in range
+// and must be populated, with ResolveNearValues, before the query is run.
+type NearExpression struct {
+	Tag        TagExpression
+	Latitude   float64
+	Longitude  float64
+	Radius     float64
+	ValueNames []string
+}
+
+// Matches files whose value for the tag matches the regular expression. As the
+// database cannot evaluate regular expressions, the matching values are held in
+// ValueNames and must be populated, with ResolveRegexValues, before the query is
+// run.
+type RegexExpression struct {
+	Tag           TagExpression
+	Pattern       *regexp.Regexp
+	FoldedPattern *regexp.Regexp // case-insensitive
+	ValueNames    []string
+}
+
+// Matches files whose path matches the glob pattern, in which '*' also matches
+// path separators. Root is the root path against which root-relative file paths
+// are resolved and must be set, with ResolvePaths, before the query is run.
+type PathExpression struct {
+	Pattern string
+	Root    string
+}
+
+// Matches files whose fingerprint is, or begins with, Prefix.
+type FingerprintExpression struct {
+	Prefix string
+}
+
+// Matches files tagged with the tag and any value, as per 'rating=*'. Unlike a
+// bare TagExpression, files tagged with the tag but without a value do not match.
+type AnyValueExpression struct {
+	Tag TagExpression
+}
+
 type NotExpression struct {
 	Operand Expression
 }
@@ -61,6 +142,11 @@ type TagExpression struct {
 	Name string
 }
 
+// Matches any of the tags whose names match the glob pattern.
+type GlobExpression struct {
+	Pattern string
+}
+
 type ValueExpression struct {
 	Name string
 }
@@ -91,13 +177,15 @@ func (parser Parser) expression() (Expression, error) {
 	switch token.(type) {
 	case EndToken:
 		return expression, nil
+	case CloseParenToken:
+		return nil, SyntaxError{"unmatched ')'", parser.scanner.Position()}
 	default:
-		return nil, fmt.Errorf("unexpected token: %v.", Type(token))
+		return nil, parser.unexpected(token)
 	}
 }
 
 func (parser Parser) or() (Expression, error) {
-	leftOperand, err := parser.and()
+	leftOperand, err := parser.xor()
 	if err != nil {
 		return OrExpression{}, err
 	}
@@ -110,8 +198,10 @@ func (parser Parser) or() (Expression, error) {
 
 		switch token.(type) {
 		case OrOperatorToken:
-			parser.scanner.Next()
-			rightOperand, err := parser.and()
+			if _, err := parser.scanner.Next(); err != nil {
+				return nil, err
+			}
+			rightOperand, err := parser.xor()
 			if err != nil {
 				return nil, err
 			}
@@ -120,7 +210,38 @@ func (parser Parser) or() (Expression, error) {
 		case EndToken, CloseParenToken:
 			return leftOperand, nil
 		default:
-			return nil, fmt.Errorf("unexpected token: %v.", Type(token))
+			return nil, parser.unexpected(token)
+		}
+	}
+}
+
+func (parser Parser) xor() (Expression, error) {
+	leftOperand, err := parser.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, err := parser.scanner.LookAhead()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.(type) {
+		case XorOperatorToken:
+			if _, err := parser.scanner.Next(); err != nil {
+				return nil, err
+			}
+			rightOperand, err := parser.and()
+			if err != nil {
+				return nil, err
+			}
+
+			leftOperand = XorExpression{leftOperand, rightOperand}
+		case OrOperatorToken, EndToken, CloseParenToken:
+			return leftOperand, nil
+		default:
+			return nil, parser.unexpected(token)
 		}
 	}
 }
@@ -139,14 +260,16 @@ func (parser Parser) and() (Expression, error) {
 
 		switch token.(type) {
 		case AndOperatorToken:
-			parser.scanner.Next()
+			if _, err := parser.scanner.Next(); err != nil {
+				return nil, err
+			}
 			rightOperand, err := parser.not()
 			if err != nil {
 				return nil, err
 			}
 
 			leftOperand = AndExpression{leftOperand, rightOperand}
-		case OrOperatorToken, CloseParenToken, EndToken:
+		case OrOperatorToken, XorOperatorToken, CloseParenToken, EndToken:
 			return leftOperand, nil
 		case NotOperatorToken, SymbolToken, OpenParenToken:
 			rightOperand, err := parser.not()
@@ -156,7 +279,7 @@ func (parser Parser) and() (Expression, error) {
 
 			leftOperand = AndExpression{leftOperand, rightOperand}
 		default:
-			return nil, fmt.Errorf("unexpected token: %v.", Type(token))
+			return nil, parser.unexpected(token)
 		}
 	}
 }
@@ -169,7 +292,9 @@ func (parser Parser) not() (Expression, error) {
 
 	switch token.(type) {
 	case NotOperatorToken:
-		parser.scanner.Next()
+		if _, err := parser.scanner.Next(); err != nil {
+			return nil, err
+		}
 
 		operand, err := parser.not()
 		if err != nil {
@@ -178,23 +303,31 @@ func (parser Parser) not() (Expression, error) {
 
 		return NotExpression{operand}, nil
 	case OpenParenToken:
-		parser.scanner.Next()
+		position := parser.scanner.Position()
+		if _, err := parser.scanner.Next(); err != nil {
+			return nil, err
+		}
 
 		operand, err := parser.or()
 		if err != nil {
 			return nil, err
 		}
 
-		token2, err := parser.scanner.Next()
+		token2, err := parser.scanner.LookAhead()
 		if err != nil {
 			return nil, err
 		}
 
 		switch token2.(type) {
 		case CloseParenToken:
+			if _, err := parser.scanner.Next(); err != nil {
+				return nil, err
+			}
 			return operand, nil
+		case EndToken:
+			return nil, SyntaxError{"unmatched '('", position}
 		default:
-			return nil, fmt.Errorf("unexpected token: %v", Type(token2))
+			return nil, parser.unexpected(token2)
 		}
 	case SymbolToken:
 		operand, err := parser.comparison()
@@ -204,60 +337,192 @@ func (parser Parser) not() (Expression, error) {
 
 		return operand, nil
 	default:
-		return nil, fmt.Errorf("unexpected token: %v.", Type(token))
+		return nil, parser.unexpected(token)
 	}
 }
 
 func (parser Parser) comparison() (Expression, error) {
+	token, err := parser.scanner.LookAhead()
+	if err != nil {
+		return nil, err
+	}
+
+	var glob string
+	var quoted bool
+	if symbol, ok := token.(SymbolToken); ok {
+		glob = symbol.glob
+		quoted = symbol.quoted
+	}
+
 	tag, err := parser.tag()
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := parser.scanner.LookAhead()
+	token, err = parser.scanner.LookAhead()
 	if err != nil {
 		return nil, err
 	}
 
-	switch typedToken := token.(type) {
+	switch typedToken := wordOperator(token).(type) {
 	case ComparisonOperatorToken:
-		parser.scanner.Next()
+		if _, err := parser.scanner.Next(); err != nil {
+			return nil, err
+		}
+
+		token, err = parser.scanner.LookAhead()
+		if err != nil {
+			return nil, err
+		}
+
+		var valueGlob string
+		if symbol, ok := token.(SymbolToken); ok {
+			valueGlob = symbol.glob
+		}
 
 		value, err := parser.value()
 		if err != nil {
 			return nil, err
 		}
 
+		if valueGlob == "*" {
+			switch typedToken.operator {
+			case "=", "==":
+				return AnyValueExpression{tag}, nil
+			case "!=":
+				return NotExpression{AnyValueExpression{tag}}, nil
+			}
+		}
+
+		// a quoted name is always a tag, never a file field
+		timeField := isTimeField(tag.Name) && !quoted
+
+		if typedToken.operator == "near" {
+			return parser.near(tag, value)
+		}
+		if typedToken.operator == "~" {
+			return regexExpression(tag, value.Name)
+		}
+		if typedToken.operator == "within" {
+			if !timeField {
+				return nil, fmt.Errorf("the 'within' operator can only be used with %v", timeFieldNames())
+			}
+
+			return withinExpression(tag.Name, value.Name, time.Now())
+		}
+		if timeField {
+			if expression, ok := timeExpression(tag.Name, typedToken.operator, value.Name, time.Now()); ok {
+				return expression, nil
+			}
+		}
+		if tag.Name == tagCountField && !quoted {
+			if expression, ok := tagCountExpression(typedToken.operator, value.Name); ok {
+				return expression, nil
+			}
+		}
+		if tag.Name == sizeField && !quoted {
+			if expression, ok := sizeExpression(typedToken.operator, value.Name); ok {
+				return expression, nil
+			}
+		}
+
 		return ComparisonExpression{tag, typedToken.operator, value}, nil
 	}
 
+	if isPathPredicate(tag.Name) {
+		return pathExpression(tag.Name, glob)
+	}
+
+	if isFingerprintPredicate(tag.Name) {
+		return parser.fingerprint(tag.Name)
+	}
+
+	if glob != "" {
+		return GlobExpression{glob}, nil
+	}
+
 	return tag, nil
 }
 
-func (parser Parser) tag() (TagExpression, error) {
+func (parser Parser) near(tag TagExpression, point ValueExpression) (Expression, error) {
 	token, err := parser.scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	if operator, ok := wordOperator(token).(ComparisonOperatorToken); !ok || operator.operator != "within" {
+		return nil, fmt.Errorf("the 'near' operator must be followed by 'within' and a distance, e.g. 'near 51.5,-0.12 within 10km'")
+	}
+
+	radius, err := parser.value()
+	if err != nil {
+		return nil, err
+	}
+
+	return nearExpression(tag, point.Name, radius.Name)
+}
+
+func (parser Parser) tag() (TagExpression, error) {
+	token, err := parser.scanner.LookAhead()
 	if err != nil {
 		return TagExpression{}, err
 	}
 
 	switch typedToken := token.(type) {
 	case SymbolToken:
+		if _, err := parser.scanner.Next(); err != nil {
+			return TagExpression{}, err
+		}
+
 		return TagExpression{typedToken.name}, nil
 	default:
-		return TagExpression{}, fmt.Errorf("unexpected token: %v.", Type(token))
+		return TagExpression{}, parser.unexpected(token)
 	}
 }
 
 func (parser Parser) value() (ValueExpression, error) {
-	token, err := parser.scanner.Next()
+	token, err := parser.scanner.LookAhead()
 	if err != nil {
 		return ValueExpression{}, err
 	}
 
 	switch typedToken := token.(type) {
 	case SymbolToken:
+		if _, err := parser.scanner.Next(); err != nil {
+			return ValueExpression{}, err
+		}
+
 		return ValueExpression{typedToken.name}, nil
 	default:
-		return ValueExpression{}, fmt.Errorf("unexpected token: %v", Type(token))
+		return ValueExpression{}, parser.unexpected(token)
+	}
+}
+
+// The words 'near' and 'within' are only operators where a comparison operator
+// may appear, i.e. following a tag, such that elsewhere they are tag names.
+func wordOperator(token Token) Token {
+	if symbol, ok := token.(SymbolToken); ok && !symbol.quoted {
+		switch symbol.name {
+		case "within", "WITHIN":
+			return ComparisonOperatorToken{"within"}
+		case "near", "NEAR":
+			return ComparisonOperatorToken{"near"}
+		}
+	}
+
+	return token
+}
+
+// The error for a token that cannot appear at the current position.
+func (parser Parser) unexpected(token Token) error {
+	switch typedToken := token.(type) {
+	case EndToken:
+		return SyntaxError{"unexpected end of query", parser.scanner.Position()}
+	case SymbolToken:
+		return SyntaxError{fmt.Sprintf("unexpected '%v'", typedToken.name), parser.scanner.Position()}
+	case ComparisonOperatorToken:
+		return SyntaxError{fmt.Sprintf("unexpected '%v'", typedToken.operator), parser.scanner.Position()}
+	default:
+		return SyntaxError{"unexpected " + Type(token), parser.scanner.Position()}
 	}
 }
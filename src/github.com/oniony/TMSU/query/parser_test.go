@@ -18,6 +18,7 @@ package query
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestTagParsing(test *testing.T) {
@@ -377,12 +378,624 @@ func TestAndParenOrParsing(test *testing.T) {
 	validateTag(or.RightOperand, "sweetcorn", test)
 }
 
+func TestModifiedAfterDateParsing(test *testing.T) {
+	scanner := NewScanner("modified > 2023-01-01")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	timeExpression := validateTime(expression, "modified", ">", test)
+	if !timeExpression.Time.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)) || !timeExpression.DateOnly {
+		test.Fatalf("Expected date 2023-01-01 but was '%v'.", timeExpression.Time)
+	}
+}
+
+func TestAddedWithinDurationParsing(test *testing.T) {
+	scanner := NewScanner("added within 7d")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	timeExpression := validateTime(expression, "added", ">=", test)
+	age := time.Since(timeExpression.Time)
+	if age < 7*24*time.Hour || age > 7*24*time.Hour+time.Minute {
+		test.Fatalf("Expected time seven days ago but was '%v'.", timeExpression.Time)
+	}
+}
+
+func TestTimeTagParsing(test *testing.T) {
+	cases := []struct {
+		query    string
+		tag      string
+		operator string
+		value    string
+	}{
+		{"modified = yes", "modified", "=", "yes"},
+		{"added != never", "added", "!=", "never"},
+		{"modified > 2023-13-01", "modified", ">", "2023-13-01"},
+	}
+
+	for _, c := range cases {
+		scanner := NewScanner(c.query)
+		parser := NewParser(scanner)
+
+		expression, err := parser.Parse()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		comparison := validateComparison(expression, c.operator, test)
+		validateTag(comparison.Tag, c.tag, test)
+		validateValue(comparison.Value, c.value, test)
+	}
+
+	expression, err := NewParser(NewScanner("added = *")).Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	validateAnyValue(expression, "added", test)
+}
+
+func TestQuotedTimeTagParsing(test *testing.T) {
+	scanner := NewScanner("'modified' = 2020-01-01")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	comparison := validateComparison(expression, "=", test)
+	validateTag(comparison.Tag, "modified", test)
+	validateValue(comparison.Value, "2020-01-01", test)
+}
+
+func TestInvalidWithinDurationParsing(test *testing.T) {
+	scanner := NewScanner("modified within soon")
+	parser := NewParser(scanner)
+
+	_, err := parser.Parse()
+	if err == nil {
+		test.Fatal("Expected invalid duration error.")
+	}
+}
+
+func TestTagCountParsing(test *testing.T) {
+	scanner := NewScanner("music and tagcount < 3")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "music", test)
+	tagCount := and.RightOperand.(TagCountExpression)
+	if tagCount.Operator != "<" || tagCount.Count != 3 || tagCount.Implied {
+		test.Fatalf("Unexpected tag count expression: %v", tagCount)
+	}
+
+	tagCount = validateAnd(CountImpliedTags(expression)).RightOperand.(TagCountExpression)
+	if !tagCount.Implied {
+		test.Fatal("Expected implied tags to be counted.")
+	}
+}
+
+func TestTagCountTagParsing(test *testing.T) {
+	scanner := NewScanner("tagcount > few")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	comparison := validateComparison(expression, ">", test)
+	validateTag(comparison.Tag, "tagcount", test)
+	validateValue(comparison.Value, "few", test)
+
+	expression, err = NewParser(NewScanner("tagcount = *")).Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	validateAnyValue(expression, "tagcount", test)
+
+	expression, err = NewParser(NewScanner("'tagcount' = 3")).Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	comparison = validateComparison(expression, "=", test)
+	validateTag(comparison.Tag, "tagcount", test)
+}
+
+func TestPathParsing(test *testing.T) {
+	scanner := NewScanner("landscape and path:photos/2023/* and not path:/mnt/a\\*b/")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	expression = ResolvePaths(expression, "/home/bob")
+
+	and := validateAnd(expression)
+	right := validateNot(and.RightOperand)
+	and = validateAnd(and.LeftOperand)
+	validateTag(and.LeftOperand, "landscape", test)
+
+	path := and.RightOperand.(PathExpression)
+	if path.Pattern != "/home/bob/photos/2023/*" || path.Root != "/home/bob" {
+		test.Fatalf("Unexpected path expression: %v", path)
+	}
+
+	path = right.Operand.(PathExpression)
+	if path.Pattern != "/mnt/a\\*b/*" {
+		test.Fatalf("Unexpected path expression: %v", path)
+	}
+}
+
+func TestInvalidPathParsing(test *testing.T) {
+	scanner := NewScanner("landscape and path:")
+	parser := NewParser(scanner)
+
+	_, err := parser.Parse()
+	if err == nil {
+		test.Fatal("Expected missing path pattern error.")
+	}
+}
+
+func TestFingerprintParsing(test *testing.T) {
+	scanner := NewScanner("fingerprint:3a7bd3e2 or (fingerprint: 5feceb66 and photo)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	or := validateOr(expression)
+
+	fingerprint := or.LeftOperand.(FingerprintExpression)
+	if fingerprint.Prefix != "3a7bd3e2" {
+		test.Fatalf("Unexpected fingerprint expression: %v", fingerprint)
+	}
+
+	and := validateAnd(or.RightOperand)
+	validateTag(and.RightOperand, "photo", test)
+
+	fingerprint = and.LeftOperand.(FingerprintExpression)
+	if fingerprint.Prefix != "5feceb66" {
+		test.Fatalf("Unexpected fingerprint expression: %v", fingerprint)
+	}
+}
+
+func TestInvalidFingerprintParsing(test *testing.T) {
+	scanner := NewScanner("fingerprint: and photo")
+	parser := NewParser(scanner)
+
+	_, err := parser.Parse()
+	if err == nil {
+		test.Fatal("Expected missing fingerprint error.")
+	}
+}
+
+func TestSizeParsing(test *testing.T) {
+	scanner := NewScanner("video and size > 1.5GiB")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "video", test)
+	size := and.RightOperand.(SizeExpression)
+	if size.Operator != ">" || size.Size != 1610612736 {
+		test.Fatalf("Unexpected size expression: %v", size)
+	}
+
+	for text, expected := range map[string]int64{"500": 500, "500mb": 500000000, "2KiB": 2048, "1TB": 1000000000000} {
+		if size, ok := ParseSize(text); !ok || size != expected {
+			test.Fatalf("Expected '%v' to be %v bytes but was %v.", text, expected, size)
+		}
+	}
+}
+
+func TestSizeTagParsing(test *testing.T) {
+	cases := []struct {
+		query    string
+		operator string
+		value    string
+	}{
+		{"size = large", "=", "large"},
+		{"size < 5XB", "<", "5XB"},
+		{"size != -1", "!=", "-1"},
+	}
+
+	for _, c := range cases {
+		scanner := NewScanner(c.query)
+		parser := NewParser(scanner)
+
+		expression, err := parser.Parse()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		comparison := validateComparison(expression, c.operator, test)
+		validateTag(comparison.Tag, "size", test)
+		validateValue(comparison.Value, c.value, test)
+	}
+
+	expression, err := NewParser(NewScanner("size = *")).Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	validateAnyValue(expression, "size", test)
+
+	expression, err = NewParser(NewScanner("'size' = 10")).Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	comparison := validateComparison(expression, "=", test)
+	validateTag(comparison.Tag, "size", test)
+}
+
+func TestNearAndWithinTagParsing(test *testing.T) {
+	scanner := NewScanner("near and not within")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "near", test)
+	validateTag(validateNot(and.RightOperand).Operand, "within", test)
+}
+
+func TestNearParsing(test *testing.T) {
+	scanner := NewScanner("gps near 51.5,-0.12 within 10km")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	near := expression.(NearExpression)
+	validateTag(near.Tag, "gps", test)
+	if near.Latitude != 51.5 || near.Longitude != -0.12 || near.Radius != 10000 {
+		test.Fatalf("Unexpected near expression: %v", near)
+	}
+
+	near = ResolveNearValues(expression, []string{"51.51,-0.13", "48.86,2.35", "north", "91,0"}).(NearExpression)
+	if len(near.ValueNames) != 1 || near.ValueNames[0] != "51.51,-0.13" {
+		test.Fatalf("Expected only the nearby value to match but was %v.", near.ValueNames)
+	}
+}
+
+func TestInvalidNearParsing(test *testing.T) {
+	for _, text := range []string{"gps near 51.5 within 10km", "gps near 51.5,-0.12", "gps near 51.5,-0.12 within far"} {
+		scanner := NewScanner(text)
+		parser := NewParser(scanner)
+
+		if _, err := parser.Parse(); err == nil {
+			test.Fatalf("Expected invalid near error for '%v'.", text)
+		}
+	}
+}
+
+func TestRegexParsing(test *testing.T) {
+	scanner := NewScanner(`version ~ '^2\.\d+' and (build ~ rc[0-9])`)
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	regex := and.LeftOperand.(RegexExpression)
+	validateTag(regex.Tag, "version", test)
+	if regex.Pattern.String() != `^2\.\d+` {
+		test.Fatalf("Expected pattern '^2\\.\\d+' but was '%v'.", regex.Pattern)
+	}
+
+	regex = ResolveRegexValues(regex, []string{"2.10", "2.x", "12.1", "V2.3"}, false).(RegexExpression)
+	if len(regex.ValueNames) != 1 || regex.ValueNames[0] != "2.10" {
+		test.Fatalf("Expected only the matching value but was %v.", regex.ValueNames)
+	}
+
+	build := and.RightOperand.(RegexExpression)
+	validateTag(build.Tag, "build", test)
+	build = ResolveRegexValues(build, []string{"RC1", "beta"}, true).(RegexExpression)
+	if len(build.ValueNames) != 1 || build.ValueNames[0] != "RC1" {
+		test.Fatalf("Expected the value to match ignoring case but was %v.", build.ValueNames)
+	}
+}
+
+func TestInvalidRegexParsing(test *testing.T) {
+	for _, text := range []string{"version ~ '(2'", "version ~ [", "version ~ 'x", "version ~"} {
+		scanner := NewScanner(text)
+		parser := NewParser(scanner)
+
+		if _, err := parser.Parse(); err == nil {
+			test.Fatalf("Expected invalid regular expression error for '%v'.", text)
+		}
+	}
+}
+
+func TestDistance(test *testing.T) {
+	// London to Paris
+	distance := Distance(51.5074, -0.1278, 48.8566, 2.3522)
+	if distance < 343000 || distance > 345000 {
+		test.Fatalf("Expected a distance of about 344km but was %vm.", distance)
+	}
+}
+
+func TestGlobParsing(test *testing.T) {
+	scanner := NewScanner("client-* and not a?c")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateGlob(and.LeftOperand, "client-*", test)
+	validateGlob(validateNot(and.RightOperand).Operand, "a?c", test)
+}
+
+func TestEscapedGlobParsing(test *testing.T) {
+	scanner := NewScanner(`star\* [x]*`)
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "star*", test)
+	validateGlob(and.RightOperand, `\[x\]*`, test)
+}
+
+func TestGlobComparisonParsing(test *testing.T) {
+	scanner := NewScanner("client-*=acme")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	comparison := validateComparison(expression, "=", test)
+	validateTag(comparison.Tag, "client-*", test)
+}
+
+func TestAnyValueParsing(test *testing.T) {
+	scanner := NewScanner("rating and rating=5 and rating=* and rating != * and rating='*'")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and1 := validateAnd(expression)
+	and2 := validateAnd(and1.LeftOperand)
+	and3 := validateAnd(and2.LeftOperand)
+	and4 := validateAnd(and3.LeftOperand)
+
+	// any value or none
+	validateTag(and4.LeftOperand, "rating", test)
+
+	// a specific value
+	comparison := validateComparison(and4.RightOperand, "=", test)
+	validateTag(comparison.Tag, "rating", test)
+	validateValue(comparison.Value, "5", test)
+
+	// any value but not none
+	validateAnyValue(and3.RightOperand, "rating", test)
+
+	// without a value or without the tag
+	validateAnyValue(validateNot(and2.RightOperand).Operand, "rating", test)
+
+	// a quoted wildcard is the literal value
+	comparison = validateComparison(and1.RightOperand, "=", test)
+	validateValue(comparison.Value, "*", test)
+}
+
 // unexported
 
+func TestGroupedParsing(test *testing.T) {
+	scanner := NewScanner("(cheese or tomato) and not (sweetcorn or ham)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	or1 := validateOr(and.LeftOperand)
+	validateTag(or1.LeftOperand, "cheese", test)
+	validateTag(or1.RightOperand, "tomato", test)
+	not := validateNot(and.RightOperand)
+	or2 := validateOr(not.Operand)
+	validateTag(or2.LeftOperand, "sweetcorn", test)
+	validateTag(or2.RightOperand, "ham", test)
+}
+
+func TestDeeplyNestedParsing(test *testing.T) {
+	scanner := NewScanner("((cheese and (tomato or (not ((ham))))))")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "cheese", test)
+	or := validateOr(and.RightOperand)
+	validateTag(or.LeftOperand, "tomato", test)
+	not := validateNot(or.RightOperand)
+	validateTag(not.Operand, "ham", test)
+}
+
+func TestPrecedenceParsing(test *testing.T) {
+	scanner := NewScanner("cheese or tomato and not ham")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	or := validateOr(expression)
+	validateTag(or.LeftOperand, "cheese", test)
+	and := validateAnd(or.RightOperand)
+	validateTag(and.LeftOperand, "tomato", test)
+	not := validateNot(and.RightOperand)
+	validateTag(not.Operand, "ham", test)
+}
+
+func TestXorParsing(test *testing.T) {
+	scanner := NewScanner("cheese xor tomato")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	xor := validateXor(expression)
+	validateTag(xor.LeftOperand, "cheese", test)
+	validateTag(xor.RightOperand, "tomato", test)
+}
+
+func TestXorPrecedenceParsing(test *testing.T) {
+	scanner := NewScanner("cheese or tomato xor ham and not sweetcorn or (bread XOR butter)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	or1 := validateOr(expression)
+	or2 := validateOr(or1.LeftOperand)
+	validateTag(or2.LeftOperand, "cheese", test)
+	xor1 := validateXor(or2.RightOperand)
+	validateTag(xor1.LeftOperand, "tomato", test)
+	and := validateAnd(xor1.RightOperand)
+	validateTag(and.LeftOperand, "ham", test)
+	not := validateNot(and.RightOperand)
+	validateTag(not.Operand, "sweetcorn", test)
+	xor2 := validateXor(or1.RightOperand)
+	validateTag(xor2.LeftOperand, "bread", test)
+	validateTag(xor2.RightOperand, "butter", test)
+}
+
+func TestSyntaxErrorParsing(test *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"(cheese or tomato", "unmatched '(' at position 1"},
+		{"cheese and ((tomato or ham)", "unmatched '(' at position 12"},
+		{"cheese or tomato)", "unmatched ')' at position 17"},
+		{"(cheese))", "unmatched ')' at position 9"},
+		{"cheese and", "unexpected end of query at position 11"},
+		{"cheese ()", "unexpected ')' at position 9"},
+		{"year < ", "unexpected end of query at position 8"},
+		{"year = = 2000", "unexpected '=' at position 8"},
+		{"café or", "unexpected end of query at position 8"},
+		{"cheese xor", "unexpected end of query at position 11"},
+		{"xor cheese", "unexpected 'xor' at position 1"},
+	}
+
+	for _, c := range cases {
+		_, err := NewParser(NewScanner(c.query)).Parse()
+		if err == nil {
+			test.Fatalf("%v: expected syntax error.", c.query)
+		}
+		if _, ok := err.(SyntaxError); !ok {
+			test.Fatalf("%v: expected syntax error but was '%v'.", c.query, err)
+		}
+		if err.Error() != c.expected {
+			test.Fatalf("%v: expected error '%v' but was '%v'.", c.query, c.expected, err)
+		}
+	}
+}
+
+func validateTime(expression Expression, field, operator string, test *testing.T) TimeExpression {
+	timeExpression := expression.(TimeExpression)
+	if timeExpression.Field != field {
+		test.Fatalf("Expected '%v' time field but was '%v'.", field, timeExpression.Field)
+	}
+	if timeExpression.Operator != operator {
+		test.Fatalf("Expected '%v' comparison operator but was '%v'.", operator, timeExpression.Operator)
+	}
+
+	return timeExpression
+}
+
 func validateNot(expression Expression) NotExpression {
 	return expression.(NotExpression)
 }
 
+func validateXor(expression Expression) XorExpression {
+	return expression.(XorExpression)
+}
+
 func validateOr(expression Expression) OrExpression {
 	return expression.(OrExpression)
 }
@@ -400,6 +1013,13 @@ func validateComparison(expression Expression, operator string, test *testing.T)
 	return comparisonExpression
 }
 
+func validateAnyValue(expression Expression, expectedTagName string, test *testing.T) AnyValueExpression {
+	anyValue := expression.(AnyValueExpression)
+	validateTag(anyValue.Tag, expectedTagName, test)
+
+	return anyValue
+}
+
 func validateTag(expression Expression, expectedName string, test *testing.T) TagExpression {
 	tag := expression.(TagExpression)
 	if tag.Name != expectedName {
@@ -409,6 +1029,15 @@ func validateTag(expression Expression, expectedName string, test *testing.T) Ta
 	return tag
 }
 
+func validateGlob(expression Expression, expectedPattern string, test *testing.T) GlobExpression {
+	glob := expression.(GlobExpression)
+	if glob.Pattern != expectedPattern {
+		test.Fatalf("Expected '%v' glob but was '%v'.", expectedPattern, glob.Pattern)
+	}
+
+	return glob
+}
+
 func validateValue(expression Expression, expectedName string, test *testing.T) ValueExpression {
 	value := expression.(ValueExpression)
 	if value.Name != expectedName {
@@ -426,7 +1055,9 @@ func dump(expression Expression) {
 func dumpBranch(expression Expression) {
 	switch exp := expression.(type) {
 	case TagExpression:
-		fmt.Printf(exp.Name)
+		fmt.Print(exp.Name)
+	case GlobExpression:
+		fmt.Print(exp.Pattern)
 	case NotExpression:
 		fmt.Printf("Not(")
 		dumpBranch(exp.Operand)
@@ -443,5 +1074,11 @@ func dumpBranch(expression Expression) {
 		fmt.Printf(", ")
 		dumpBranch(exp.RightOperand)
 		fmt.Printf(")")
+	case XorExpression:
+		fmt.Printf("Xor(")
+		dumpBranch(exp.LeftOperand)
+		fmt.Printf(", ")
+		dumpBranch(exp.RightOperand)
+		fmt.Printf(")")
 	}
 }
@@ -0,0 +1,94 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Resolves each 'path:' predicate within an expression against the root path,
+// so that relative patterns are interpreted relative to the root and the root
+// is available for matching root-relative file paths.
+func ResolvePaths(expression Expression, rootPath string) Expression {
+	switch exp := expression.(type) {
+	case PathExpression:
+		if !filepath.IsAbs(exp.Pattern) {
+			exp.Pattern = escapeGlob(rootPath) + string(filepath.Separator) + exp.Pattern
+		}
+		exp.Pattern = filepath.Clean(exp.Pattern)
+		exp.Root = rootPath
+		return exp
+	case NotExpression:
+		exp.Operand = ResolvePaths(exp.Operand, rootPath)
+		return exp
+	case AndExpression:
+		exp.LeftOperand = ResolvePaths(exp.LeftOperand, rootPath)
+		exp.RightOperand = ResolvePaths(exp.RightOperand, rootPath)
+		return exp
+	case OrExpression:
+		exp.LeftOperand = ResolvePaths(exp.LeftOperand, rootPath)
+		exp.RightOperand = ResolvePaths(exp.RightOperand, rootPath)
+		return exp
+	case XorExpression:
+		exp.LeftOperand = ResolvePaths(exp.LeftOperand, rootPath)
+		exp.RightOperand = ResolvePaths(exp.RightOperand, rootPath)
+		return exp
+	}
+
+	return expression
+}
+
+// unexported
+
+const pathPrefix = "path:"
+
+func isPathPredicate(name string) bool {
+	return strings.HasPrefix(name, pathPrefix)
+}
+
+// Builds a path expression from the text following 'path:'. The glob, if
+// given, is the escaped form of the text and is used if it has wildcards.
+func pathExpression(text, glob string) (Expression, error) {
+	text = strings.TrimPrefix(text, pathPrefix)
+	glob = strings.TrimPrefix(glob, pathPrefix)
+
+	if text == "" {
+		return nil, fmt.Errorf("the '%v' predicate must be followed by a path pattern, e.g. %vphotos/*", pathPrefix, pathPrefix)
+	}
+
+	pattern := glob
+	if pattern == "" {
+		pattern = escapeGlob(text)
+	}
+
+	// a trailing separator matches everything within the directory
+	if strings.HasSuffix(pattern, string(filepath.Separator)) {
+		pattern += "*"
+	}
+
+	return PathExpression{pattern, ""}, nil
+}
+
+func escapeGlob(text string) string {
+	escaped := ""
+	for _, r := range text {
+		escaped += escapeGlobRune(r)
+	}
+
+	return escaped
+}
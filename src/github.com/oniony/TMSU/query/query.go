@@ -47,15 +47,138 @@ func TagNames(expression Expression) ([]string, error) {
 	return tagNames(expression, names)
 }
 
-// Retrieves the set of value names from an expression where the name is matched on exactly
+// Retrieves the set of value names from an expression where the name is matched on exactly.
+// Numbers are excluded as these may match other representations of the same number.
 func ExactValueNames(expression Expression) ([]string, error) {
 	names := make([]string, 0, 10)
 
 	return exactValueNames(expression, names)
 }
 
+// Retrieves the tag and comparison expressions that are not negated within an
+// expression, i.e. those that can contribute to a file matching
+func PositiveTerms(expression Expression) ([]Expression, error) {
+	terms := make([]Expression, 0, 10)
+
+	return positiveTerms(expression, false, terms)
+}
+
+// Renames the tags within an expression according to the mapping of current to
+// new names. Tags absent from the mapping are left as they are.
+func RenameTags(expression Expression, tagNames map[string]string) Expression {
+	switch exp := expression.(type) {
+	case TagExpression:
+		return renameTag(exp, tagNames)
+	case ComparisonExpression:
+		exp.Tag = renameTag(exp.Tag, tagNames)
+		return exp
+	case AnyValueExpression:
+		exp.Tag = renameTag(exp.Tag, tagNames)
+		return exp
+	case NearExpression:
+		exp.Tag = renameTag(exp.Tag, tagNames)
+		return exp
+	case RegexExpression:
+		exp.Tag = renameTag(exp.Tag, tagNames)
+		return exp
+	case NotExpression:
+		exp.Operand = RenameTags(exp.Operand, tagNames)
+		return exp
+	case AndExpression:
+		exp.LeftOperand = RenameTags(exp.LeftOperand, tagNames)
+		exp.RightOperand = RenameTags(exp.RightOperand, tagNames)
+		return exp
+	case OrExpression:
+		exp.LeftOperand = RenameTags(exp.LeftOperand, tagNames)
+		exp.RightOperand = RenameTags(exp.RightOperand, tagNames)
+		return exp
+	case XorExpression:
+		exp.LeftOperand = RenameTags(exp.LeftOperand, tagNames)
+		exp.RightOperand = RenameTags(exp.RightOperand, tagNames)
+		return exp
+	}
+
+	return expression
+}
+
 // unexported
 
+func renameTag(expression TagExpression, tagNames map[string]string) TagExpression {
+	if name, ok := tagNames[expression.Name]; ok {
+		return TagExpression{name}
+	}
+
+	return expression
+}
+
+func positiveTerms(expression Expression, negated bool, terms []Expression) ([]Expression, error) {
+	var err error
+
+	switch exp := expression.(type) {
+	case EmptyExpression:
+		// nowt
+	case TagExpression, GlobExpression:
+		if !negated {
+			terms = append(terms, exp)
+		}
+	case NotExpression:
+		terms, err = positiveTerms(exp.Operand, !negated, terms)
+		if err != nil {
+			return nil, err
+		}
+	case AndExpression:
+		terms, err = positiveTerms(exp.LeftOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+
+		terms, err = positiveTerms(exp.RightOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+	case OrExpression:
+		terms, err = positiveTerms(exp.LeftOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+
+		terms, err = positiveTerms(exp.RightOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+	case XorExpression:
+		terms, err = positiveTerms(exp.LeftOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+
+		terms, err = positiveTerms(exp.RightOperand, negated, terms)
+		if err != nil {
+			return nil, err
+		}
+	case ComparisonExpression:
+		// '!=' is the negation of '=='
+		if exp.Operator == "!=" {
+			exp.Operator = "=="
+			negated = !negated
+		}
+
+		if !negated {
+			terms = append(terms, exp)
+		}
+	case AnyValueExpression, NearExpression, RegexExpression:
+		if !negated {
+			terms = append(terms, exp)
+		}
+	case TimeExpression, TagCountExpression, SizeExpression, PathExpression, FingerprintExpression:
+		// nowt
+	default:
+		return nil, fmt.Errorf("unsupported token type '%t'", exp)
+	}
+
+	return terms, nil
+}
+
 func tagNames(expression Expression, names []string) ([]string, error) {
 	var err error
 
@@ -64,6 +187,8 @@ func tagNames(expression Expression, names []string) ([]string, error) {
 		// nowt
 	case TagExpression:
 		names = append(names, exp.Name)
+	case GlobExpression:
+		// nowt
 	case NotExpression:
 		names, err = tagNames(exp.Operand, names)
 		if err != nil {
@@ -85,12 +210,30 @@ func tagNames(expression Expression, names []string) ([]string, error) {
 			return nil, err
 		}
 
+		names, err = tagNames(exp.RightOperand, names)
+		if err != nil {
+			return nil, err
+		}
+	case XorExpression:
+		names, err = tagNames(exp.LeftOperand, names)
+		if err != nil {
+			return nil, err
+		}
+
 		names, err = tagNames(exp.RightOperand, names)
 		if err != nil {
 			return nil, err
 		}
 	case ComparisonExpression:
 		names = append(names, exp.Tag.Name)
+	case AnyValueExpression:
+		names = append(names, exp.Tag.Name)
+	case NearExpression:
+		names = append(names, exp.Tag.Name)
+	case RegexExpression:
+		names = append(names, exp.Tag.Name)
+	case TimeExpression, TagCountExpression, SizeExpression, PathExpression, FingerprintExpression:
+		// nowt
 	default:
 		return nil, fmt.Errorf("unsupported token type '%t'", exp)
 	}
@@ -104,7 +247,7 @@ func exactValueNames(expression Expression, names []string) ([]string, error) {
 	switch exp := expression.(type) {
 	case EmptyExpression:
 		// nowt
-	case TagExpression:
+	case TagExpression, GlobExpression:
 		// nowt
 	case NotExpression:
 		names, err = exactValueNames(exp.Operand, names)
@@ -127,6 +270,16 @@ func exactValueNames(expression Expression, names []string) ([]string, error) {
 			return nil, err
 		}
 
+		names, err = exactValueNames(exp.RightOperand, names)
+		if err != nil {
+			return nil, err
+		}
+	case XorExpression:
+		names, err = exactValueNames(exp.LeftOperand, names)
+		if err != nil {
+			return nil, err
+		}
+
 		names, err = exactValueNames(exp.RightOperand, names)
 		if err != nil {
 			return nil, err
@@ -134,12 +287,16 @@ func exactValueNames(expression Expression, names []string) ([]string, error) {
 	case ComparisonExpression:
 		switch exp.Operator {
 		case "=", "==", "!=":
-			names = append(names, exp.Value.Name)
+			if _, isNumber := ParseNumber(exp.Value.Name); !isNumber {
+				names = append(names, exp.Value.Name)
+			}
 		case "<", ">", "<=", ">=":
 			// do nowt
 		default:
 			return nil, fmt.Errorf("unsupported operator '%v'", exp.Operator)
 		}
+	case AnyValueExpression, NearExpression, RegexExpression, TimeExpression, TagCountExpression, SizeExpression, PathExpression, FingerprintExpression:
+		// nowt
 	default:
 		return nil, fmt.Errorf("unsupported token type '%t'", exp)
 	}
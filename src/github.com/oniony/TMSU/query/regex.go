@@ -0,0 +1,94 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Determines whether the value name matches the expression's regular
+// expression.
+func (expression RegexExpression) Matches(valueName string, ignoreCase bool) bool {
+	if ignoreCase {
+		return expression.FoldedPattern.MatchString(valueName)
+	}
+
+	return expression.Pattern.MatchString(valueName)
+}
+
+// Determines whether an expression contains any '~' comparisons.
+func ContainsRegex(expression Expression) bool {
+	switch exp := expression.(type) {
+	case RegexExpression:
+		return true
+	case NotExpression:
+		return ContainsRegex(exp.Operand)
+	case AndExpression:
+		return ContainsRegex(exp.LeftOperand) || ContainsRegex(exp.RightOperand)
+	case OrExpression:
+		return ContainsRegex(exp.LeftOperand) || ContainsRegex(exp.RightOperand)
+	case XorExpression:
+		return ContainsRegex(exp.LeftOperand) || ContainsRegex(exp.RightOperand)
+	}
+
+	return false
+}
+
+// Records against each '~' comparison within an expression which of the value
+// names match its regular expression.
+func ResolveRegexValues(expression Expression, valueNames []string, ignoreCase bool) Expression {
+	switch exp := expression.(type) {
+	case RegexExpression:
+		exp.ValueNames = make([]string, 0, 10)
+		for _, valueName := range valueNames {
+			if exp.Matches(valueName, ignoreCase) {
+				exp.ValueNames = append(exp.ValueNames, valueName)
+			}
+		}
+		return exp
+	case NotExpression:
+		exp.Operand = ResolveRegexValues(exp.Operand, valueNames, ignoreCase)
+		return exp
+	case AndExpression:
+		exp.LeftOperand = ResolveRegexValues(exp.LeftOperand, valueNames, ignoreCase)
+		exp.RightOperand = ResolveRegexValues(exp.RightOperand, valueNames, ignoreCase)
+		return exp
+	case OrExpression:
+		exp.LeftOperand = ResolveRegexValues(exp.LeftOperand, valueNames, ignoreCase)
+		exp.RightOperand = ResolveRegexValues(exp.RightOperand, valueNames, ignoreCase)
+		return exp
+	case XorExpression:
+		exp.LeftOperand = ResolveRegexValues(exp.LeftOperand, valueNames, ignoreCase)
+		exp.RightOperand = ResolveRegexValues(exp.RightOperand, valueNames, ignoreCase)
+		return exp
+	}
+
+	return expression
+}
+
+// unexported
+
+func regexExpression(tag TagExpression, patternText string) (Expression, error) {
+	pattern, err := regexp.Compile(patternText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%v' for '~': %v", patternText, err)
+	}
+
+	foldedPattern := regexp.MustCompile("(?i)" + patternText)
+
+	return RegexExpression{tag, pattern, foldedPattern, nil}, nil
+}
@@ -20,6 +20,7 @@ import (
 	"io"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var symbolChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
@@ -41,6 +42,8 @@ func Type(token Token) string {
 		return "'and'"
 	case OrOperatorToken:
 		return "'or'"
+	case XorOperatorToken:
+		return "'xor'"
 	case ComparisonOperatorToken:
 		return typedToken.operator
 	case EndToken:
@@ -62,7 +65,9 @@ type CloseParenToken struct {
 }
 
 type SymbolToken struct {
-	name string
+	name   string
+	glob   string // the name as a glob pattern if it contains unescaped wildcards
+	quoted bool   // whether the name was enclosed in quotation marks
 }
 
 type NotOperatorToken struct {
@@ -74,17 +79,29 @@ type AndOperatorToken struct {
 type OrOperatorToken struct {
 }
 
+type XorOperatorToken struct {
+}
+
 type ComparisonOperatorToken struct {
 	operator string
 }
 
 type Scanner struct {
-	stream    *strings.Reader
-	lookAhead Token
+	query       string
+	stream      *strings.Reader
+	lookAhead   Token
+	position    int  // the character position of the look-ahead token, from 1
+	readPattern bool // whether the next token is the pattern following '~'
 }
 
 func NewScanner(query string) *Scanner {
-	return &Scanner{strings.NewReader(query), nil}
+	return &Scanner{query, strings.NewReader(query), nil, 0, false}
+}
+
+// The character position, from 1, of the look-ahead token, or one beyond the
+// last character at the end of the query.
+func (scanner *Scanner) Position() int {
+	return scanner.position
 }
 
 func (scanner *Scanner) LookAhead() (Token, error) {
@@ -117,18 +134,27 @@ func (scanner *Scanner) Next() (Token, error) {
 // unexported
 
 func (scanner *Scanner) readToken() (Token, error) {
-	r, _, err := scanner.stream.ReadRune()
+	r, size, err := scanner.stream.ReadRune()
 	for err == nil && unicode.IsSpace(r) {
-		r, _, err = scanner.stream.ReadRune()
+		r, size, err = scanner.stream.ReadRune()
 	}
 
 	if err == io.EOF {
+		scanner.position = utf8.RuneCountInString(scanner.query) + 1
 		return EndToken{}, nil
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	offset := int(scanner.stream.Size()) - scanner.stream.Len() - size
+	scanner.position = utf8.RuneCountInString(scanner.query[:offset]) + 1
+
+	if scanner.readPattern {
+		scanner.readPattern = false
+		return scanner.readPatternToken(r)
+	}
+
 	switch {
 	case r == rune('('):
 		return OpenParenToken{}, nil
@@ -136,6 +162,9 @@ func (scanner *Scanner) readToken() (Token, error) {
 		return CloseParenToken{}, nil
 	case r == rune('!'), r == rune('='), r == rune('<'), r == rune('>'):
 		return scanner.readComparisonOperatorToken(r)
+	case r == rune('~'):
+		scanner.readPattern = true
+		return ComparisonOperatorToken{"~"}, nil
 	case unicode.IsOneOf(symbolChars, r), r == rune('\\'):
 		scanner.stream.UnreadRune()
 		return scanner.readTextToken()
@@ -145,10 +174,14 @@ func (scanner *Scanner) readToken() (Token, error) {
 }
 
 func (scanner *Scanner) readTextToken() (Token, error) {
-	text, err := scanner.readString()
+	text, glob, quoted, err := scanner.readString()
 	if err != nil {
 		return nil, err
 	}
+	if quoted {
+		// a quoted keyword is a tag or value name
+		return SymbolToken{text, glob, true}, nil
+	}
 
 	switch text {
 	case "not", "NOT":
@@ -157,6 +190,8 @@ func (scanner *Scanner) readTextToken() (Token, error) {
 		return AndOperatorToken{}, nil
 	case "or", "OR":
 		return OrOperatorToken{}, nil
+	case "xor", "XOR":
+		return XorOperatorToken{}, nil
 	case "eq", "EQ":
 		return ComparisonOperatorToken{"="}, nil
 	case "ne", "NE":
@@ -171,13 +206,16 @@ func (scanner *Scanner) readTextToken() (Token, error) {
 		return ComparisonOperatorToken{">="}, nil
 	}
 
-	return SymbolToken{text}, nil
+	return SymbolToken{text, glob, false}, nil
 }
 
 func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 	switch r {
 	case rune('='), rune('!'), rune('<'), rune('>'):
 		r2, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			return ComparisonOperatorToken{string(r)}, nil
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -194,22 +232,88 @@ func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 	}
 }
 
-func (scanner *Scanner) readString() (string, error) {
+// Reads a regular expression, which may be enclosed in single or double
+// quotation marks. Backslashes are retained as they are significant to the
+// pattern, except where escaping the closing quotation mark.
+func (scanner *Scanner) readPatternToken(r rune) (Token, error) {
+	var quote rune
+	if r == rune('\'') || r == rune('"') {
+		quote = r
+	} else {
+		scanner.stream.UnreadRune()
+	}
+
 	text := ""
+	for {
+		r, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			if quote != 0 {
+				return nil, fmt.Errorf("unterminated pattern: missing closing %c", quote)
+			}
+
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if quote != 0 {
+			if r == quote {
+				break
+			}
+
+			if r == rune('\\') {
+				r2, _, err := scanner.stream.ReadRune()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated pattern: missing closing %c", quote)
+				}
+
+				if r2 != quote {
+					text += string(r)
+				}
+				text += string(r2)
+				continue
+			}
+		} else if unicode.IsSpace(r) || r == rune(')') {
+			scanner.stream.UnreadRune()
+			break
+		}
+
+		text += string(r)
+	}
+
+	if text == "" && quote == 0 {
+		return nil, fmt.Errorf("the '~' operator must be followed by a regular expression")
+	}
+
+	return SymbolToken{text, "", quote != 0}, nil
+}
+
+// Reads a string, returning both its text and, if it contains unescaped
+// wildcards, the corresponding glob pattern. A string beginning with a single or
+// double quotation mark is taken literally up to the closing quotation mark,
+// such that it may contain whitespace, operators, parentheses and wildcards:
+// elsewhere quotation marks are ordinary characters, e.g. in "children's".
+func (scanner *Scanner) readString() (string, string, bool, error) {
+	text := ""
+	pattern := ""
+	wildcard := false
 	escaped := false
+	quoted := false
 	stop := false
 
 	for !stop {
 		r, _, err := scanner.stream.ReadRune()
 		if err == io.EOF {
-			return text, nil
+			break
 		}
 		if err != nil {
-			return "", err
+			return "", "", false, err
 		}
 
 		if escaped {
 			text += string(r)
+			pattern += escapeGlobRune(r)
 			escaped = false
 			continue
 		}
@@ -219,16 +323,80 @@ func (scanner *Scanner) readString() (string, error) {
 			continue
 		}
 
+		if text == "" && !quoted && (r == rune('\'') || r == rune('"')) {
+			quotedText, err := scanner.readQuoted(r)
+			if err != nil {
+				return "", "", false, err
+			}
+
+			for _, qr := range quotedText {
+				pattern += escapeGlobRune(qr)
+			}
+			text += quotedText
+			quoted = true
+			continue
+		}
+
 		switch {
 		case unicode.IsSpace(r), r == rune(')'), r == rune('('), r == rune('='), r == rune('!'), r == rune('<'), r == rune('>'):
 			scanner.stream.UnreadRune()
-			return text, nil
+			stop = true
+		case r == rune('*'), r == rune('?'):
+			text += string(r)
+			pattern += string(r)
+			wildcard = true
 		case unicode.IsOneOf(symbolChars, r):
 			text += string(r)
+			pattern += escapeGlobRune(r)
+		default:
+			return "", "", false, fmt.Errorf("Unexpected character '%v'.", r)
+		}
+	}
+
+	if !wildcard {
+		pattern = ""
+	}
+
+	return text, pattern, quoted, nil
+}
+
+// Reads the text up to the closing quotation mark. Within it only the quotation
+// mark and the backslash itself may be escaped with a backslash.
+func (scanner *Scanner) readQuoted(quote rune) (string, error) {
+	text := ""
+	for {
+		r, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			return "", fmt.Errorf("unterminated name: missing closing %c", quote)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case quote:
+			return text, nil
+		case rune('\\'):
+			r2, _, err := scanner.stream.ReadRune()
+			if err != nil {
+				return "", fmt.Errorf("unterminated name: missing closing %c", quote)
+			}
+
+			if r2 != quote && r2 != rune('\\') {
+				text += string(r)
+			}
+			text += string(r2)
 		default:
-			return "", fmt.Errorf("Unexpected character '%v'.", r)
+			text += string(r)
 		}
 	}
+}
+
+func escapeGlobRune(r rune) string {
+	switch r {
+	case '*', '?', '[', ']', '\\':
+		return "\\" + string(r)
+	}
 
-	panic("unreachable")
+	return string(r)
 }
@@ -204,6 +204,113 @@ func TestComplexQuery(test *testing.T) {
 
 // unexported
 
+func TestQuotedValue(test *testing.T) {
+	scanner := NewScanner(`title = "A, B: and (C)" formula='a=b' 'and' children's "say \"hi\""`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "title", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "=", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "A, B: and (C)", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "formula", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "=", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "a=b", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "and", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "children's", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, `say "hi"`, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateEnd(token, test)
+}
+
+func TestQuotedWildcardsAreLiteral(test *testing.T) {
+	scanner := NewScanner(`"client-*"`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "client-*", test)
+
+	if glob := token.(SymbolToken).glob; glob != "" {
+		test.Fatalf("Expected no glob pattern but was '%v'.", glob)
+	}
+}
+
+func TestUnicodeValue(test *testing.T) {
+	scanner := NewScanner(`lang=日本語 drink='café ☕'`)
+
+	for _, expected := range []string{"lang", "=", "日本語", "drink", "=", "café ☕"} {
+		token, err := scanner.Next()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if expected == "=" {
+			validateComparisonOperator(token, expected, test)
+		} else {
+			validateSymbolToken(token, expected, test)
+		}
+	}
+}
+
+func TestUnterminatedQuote(test *testing.T) {
+	scanner := NewScanner(`title = "A, B`)
+
+	if _, err := scanner.Next(); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := scanner.Next(); err == nil {
+		test.Fatal("Unterminated quotation not identified.")
+	}
+}
+
 func validateSymbolToken(token Token, expectedName string, test *testing.T) {
 	tag := token.(SymbolToken)
 	if tag.name != expectedName {
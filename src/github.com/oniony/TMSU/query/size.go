@@ -0,0 +1,79 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parses a size such as '500', '1.5GB' or '4KiB' into a number of bytes. The
+// decimal units KB, MB, GB and TB are powers of 1000 whereas the binary units
+// KiB, MiB, GiB and TiB are powers of 1024. Units are not case-sensitive.
+func ParseSize(text string) (int64, bool) {
+	matches := sizePattern.FindStringSubmatch(text)
+	if matches == nil {
+		return 0, false
+	}
+
+	number, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(matches[2])]
+	if !ok {
+		return 0, false
+	}
+
+	return int64(number * float64(unit)), true
+}
+
+// unexported
+
+const sizeField = "size"
+
+var sizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z]*)$`)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// Builds a size expression for a comparison of the file size against a number
+// of bytes, or returns false if the text is not a size such that the comparison
+// is instead against a tag named 'size'.
+func sizeExpression(operator, text string) (Expression, bool) {
+	size, ok := ParseSize(text)
+	if !ok {
+		return nil, false
+	}
+
+	if operator == "=" {
+		operator = "=="
+	}
+
+	return SizeExpression{operator, size}, true
+}
@@ -0,0 +1,66 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strconv"
+)
+
+// Sets each tag count within an expression to include the implied tags.
+func CountImpliedTags(expression Expression) Expression {
+	switch exp := expression.(type) {
+	case TagCountExpression:
+		exp.Implied = true
+		return exp
+	case NotExpression:
+		exp.Operand = CountImpliedTags(exp.Operand)
+		return exp
+	case AndExpression:
+		exp.LeftOperand = CountImpliedTags(exp.LeftOperand)
+		exp.RightOperand = CountImpliedTags(exp.RightOperand)
+		return exp
+	case OrExpression:
+		exp.LeftOperand = CountImpliedTags(exp.LeftOperand)
+		exp.RightOperand = CountImpliedTags(exp.RightOperand)
+		return exp
+	case XorExpression:
+		exp.LeftOperand = CountImpliedTags(exp.LeftOperand)
+		exp.RightOperand = CountImpliedTags(exp.RightOperand)
+		return exp
+	}
+
+	return expression
+}
+
+// unexported
+
+const tagCountField = "tagcount"
+
+// Builds a tag count expression for a comparison of the number of tags applied
+// to a file, or returns false if the text is not a count such that the
+// comparison is instead against a tag named 'tagcount'.
+func tagCountExpression(operator, text string) (Expression, bool) {
+	count, err := strconv.ParseUint(text, 10, 32)
+	if err != nil {
+		return nil, false
+	}
+
+	if operator == "=" {
+		operator = "=="
+	}
+
+	return TagCountExpression{operator, uint(count), false}, true
+}
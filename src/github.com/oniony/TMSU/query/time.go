@@ -0,0 +1,116 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Parses a duration such as '90s', '12h' or '7d': a number followed by one of
+// the units s, m, h, d or w.
+func ParseDuration(text string) (time.Duration, bool) {
+	matches := durationPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return 0, false
+	}
+
+	count, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(count) * durationUnits[matches[2]], true
+}
+
+// Parses a date (YYYY-MM-DD), a time (YYYY-MM-DDTHH:MM:SS or RFC 3339) or a
+// duration before now, e.g. '7d'. Dates and times without a timezone are
+// interpreted as UTC.
+func ParseTime(text string, now time.Time) (time.Time, bool) {
+	if duration, ok := ParseDuration(text); ok {
+		return now.UTC().Add(-duration), true
+	}
+
+	for _, layout := range timeLayouts {
+		if parsed, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return parsed.UTC(), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// unexported
+
+var timeFields = []string{"modified", "added"}
+
+const dateLayout = "2006-01-02"
+
+var timeLayouts = []string{dateLayout, "2006-01-02T15:04:05", time.RFC3339}
+
+var durationPattern = regexp.MustCompile(`^([0-9]+)([smhdw])$`)
+
+var durationUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+func isTimeField(name string) bool {
+	for _, field := range timeFields {
+		if name == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func timeFieldNames() string {
+	return fmt.Sprintf("'%v' or '%v'", timeFields[0], timeFields[1])
+}
+
+// Builds a time expression for a comparison of a time field against a date or a
+// duration relative to now, or returns false if the text is neither such that
+// the comparison is instead against a tag of the same name. Dates without a
+// timezone are interpreted as UTC.
+func timeExpression(field, operator, text string, now time.Time) (Expression, bool) {
+	if duration, ok := ParseDuration(text); ok {
+		return TimeExpression{field, operator, now.UTC().Add(-duration), false}, true
+	}
+
+	for _, layout := range timeLayouts {
+		if parsed, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return TimeExpression{field, operator, parsed.UTC(), layout == dateLayout}, true
+		}
+	}
+
+	return nil, false
+}
+
+// Builds a time expression for a time field being within a duration of now.
+func withinExpression(field, text string, now time.Time) (Expression, error) {
+	duration, ok := ParseDuration(text)
+	if !ok {
+		return nil, fmt.Errorf("invalid duration '%v' for 'within': expected a number followed by s, m, h, d or w, e.g. 7d", text)
+	}
+
+	return TimeExpression{field, ">=", now.UTC().Add(-duration), false}, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parses a value name that is to be treated as a number when compared.
+// Infinities and NaN are not numbers for this purpose, matching the database.
+func ParseNumber(valueName string) (float64, bool) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(valueName), 64)
+	if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// Compares a value name with that of a comparison expression using the
+// expression's operator.
+//
+// The comparison is numeric when both names are numbers, e.g. '9' < '10', and
+// textual otherwise, e.g. 'high' > '4'. It is thus possible for a tag with a
+// mixture of numeric and textual values to match both numerically and
+// textually within the same query.
+func CompareValueNames(valueName, operator, queryValueName string, ignoreCase bool) bool {
+	var comparison int
+
+	number, isNumber := ParseNumber(valueName)
+	queryNumber, isQueryNumber := ParseNumber(queryValueName)
+
+	if isNumber && isQueryNumber {
+		switch {
+		case number < queryNumber:
+			comparison = -1
+		case number > queryNumber:
+			comparison = 1
+		}
+	} else {
+		if ignoreCase {
+			valueName = strings.ToLower(valueName)
+			queryValueName = strings.ToLower(queryValueName)
+		}
+
+		comparison = strings.Compare(valueName, queryValueName)
+	}
+
+	switch operator {
+	case "=", "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		return comparison < 0
+	case ">":
+		return comparison > 0
+	case "<=":
+		return comparison <= 0
+	case ">=":
+		return comparison >= 0
+	}
+
+	return false
+}
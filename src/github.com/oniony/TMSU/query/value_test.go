@@ -0,0 +1,76 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+)
+
+func TestParseNumber(test *testing.T) {
+	for _, valueName := range []string{"4", "-2.5", "1e3", "007", "4.0"} {
+		if _, ok := ParseNumber(valueName); !ok {
+			test.Fatalf("Expected '%v' to be a number.", valueName)
+		}
+	}
+
+	for _, valueName := range []string{"", "abc", "4abc", "inf", "NaN", "0x10"} {
+		if _, ok := ParseNumber(valueName); ok {
+			test.Fatalf("Expected '%v' not to be a number.", valueName)
+		}
+	}
+}
+
+func TestCompareNumericValueNames(test *testing.T) {
+	assertComparison(test, "10", ">", "9", true)
+	assertComparison(test, "10", "<", "9", false)
+	assertComparison(test, "4.0", "==", "4", true)
+	assertComparison(test, "4.0", "!=", "4", false)
+	assertComparison(test, "-1", "<=", "0", true)
+	assertComparison(test, "5", ">=", "4", true)
+}
+
+func TestCompareTextualValueNames(test *testing.T) {
+	assertComparison(test, "apple", "<", "banana", true)
+	assertComparison(test, "Apple", "=", "apple", false)
+	assertComparison(test, "BANANA", ">", "apple", false)
+}
+
+func TestCompareMixedValueNames(test *testing.T) {
+	// numeric query value against textual values compares textually
+	assertComparison(test, "high", ">=", "4", true)
+	assertComparison(test, "10abc", "<", "9", true)
+
+	// textual query value against numeric values compares textually
+	assertComparison(test, "10", "<", "9a", true)
+	assertComparison(test, "4", "==", "four", false)
+}
+
+func TestCompareValueNamesIgnoringCase(test *testing.T) {
+	if !CompareValueNames("Apple", "=", "apple", true) {
+		test.Fatal("Expected 'Apple' to equal 'apple' when ignoring case.")
+	}
+	if !CompareValueNames("BANANA", ">", "apple", true) {
+		test.Fatal("Expected 'BANANA' to be greater than 'apple' when ignoring case.")
+	}
+}
+
+// unexported
+
+func assertComparison(test *testing.T, valueName, operator, queryValueName string, expected bool) {
+	if actual := CompareValueNames(valueName, operator, queryValueName, false); actual != expected {
+		test.Fatalf("Expected '%v' %v '%v' to be %v but was %v.", valueName, operator, queryValueName, expected, actual)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage/database"
+	"strings"
+)
+
+// The complete set of tag aliases.
+func (storage *Storage) Aliases(tx *Tx) (entities.Aliases, error) {
+	return database.Aliases(tx.tx)
+}
+
+// Retrieves the aliases with the specified names.
+func (storage *Storage) AliasesByNames(tx *Tx, names []string, ignoreCase bool) (entities.Aliases, error) {
+	ignoreCase, err := storage.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.AliasesByNames(tx.tx, names, ignoreCase)
+}
+
+// Adds an alias by which the specified tag may also be referred to.
+func (storage *Storage) AddAlias(tx *Tx, name string, tag entities.Tag) (*entities.Alias, error) {
+	if err := entities.ValidateTagName(name); err != nil {
+		return nil, err
+	}
+
+	ignoreCase, err := storage.ignoreTagCase(tx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := database.TagByName(tx.tx, name, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("tag '%v' already exists", existing.Name)
+	}
+
+	if err := storage.checkNotAlias(tx, name); err != nil {
+		return nil, err
+	}
+
+	return database.InsertAlias(tx.tx, name, tag)
+}
+
+// Removes the named alias.
+func (storage *Storage) DeleteAlias(tx *Tx, name string) error {
+	return database.DeleteAlias(tx.tx, name)
+}
+
+// Removes the aliases of the specified tag.
+func (storage *Storage) DeleteAliasesByTagId(tx *Tx, tagId entities.TagId) error {
+	return database.DeleteAliasesByTagId(tx.tx, tagId)
+}
+
+// Replaces any aliases within the query with the names of the tags to which
+// they refer.
+func (storage *Storage) ResolveAliases(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	names, err := query.TagNames(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames, err := storage.aliasedTagNames(tx, names, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if len(tagNames) == 0 {
+		return expression, nil
+	}
+
+	return query.RenameTags(expression, tagNames), nil
+}
+
+// unexported
+
+// Maps each of the names that is an alias to the name of the tag to which it
+// refers. Aliases are resolved here and nowhere else so that tagging and
+// querying treat them alike.
+func (storage *Storage) aliasedTagNames(tx *Tx, names []string, ignoreCase bool) (map[string]string, error) {
+	ignoreCase, err := storage.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := database.AliasesByNames(tx.tx, names, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := make(map[string]string, len(aliases))
+	for _, name := range names {
+		for _, alias := range aliases {
+			if alias.Name == name || ignoreCase && strings.EqualFold(alias.Name, name) {
+				tagNames[name] = alias.Tag.Name
+				break
+			}
+		}
+	}
+
+	return tagNames, nil
+}
+
+// Checks that the name is not already in use as an alias.
+func (storage *Storage) checkNotAlias(tx *Tx, name string) error {
+	tagNames, err := storage.aliasedTagNames(tx, []string{name}, false)
+	if err != nil {
+		return err
+	}
+	if tagName, ok := tagNames[name]; ok {
+		return fmt.Errorf("'%v' is an alias of tag '%v'", name, tagName)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Retrieves the audit entries recorded at or after the specified time, oldest
+// first.
+func (storage *Storage) AuditEntriesSince(tx *Tx, since time.Time) (entities.AuditEntries, error) {
+	return database.AuditEntriesSince(tx.tx, since)
+}
+
+// Records the operation in the audit log, against the current user, if the
+// 'auditLog' setting is enabled.
+func (storage *Storage) Audit(tx *Tx, entry entities.AuditEntry) error {
+	auditing, err := storage.auditing(tx)
+	if err != nil || !auditing {
+		return err
+	}
+
+	entry.User = currentUserName()
+
+	return database.InsertAuditEntry(tx.tx, entry)
+}
+
+// unexported
+
+// Whether operations are to be recorded in the audit log. The setting is read
+// once per transaction so as to add little overhead when disabled.
+func (storage *Storage) auditing(tx *Tx) (bool, error) {
+	if tx.auditing == nil {
+		setting, err := storage.Setting(tx, "auditLog")
+		if err != nil {
+			return false, err
+		}
+
+		auditing := entities.Settings{setting}.AuditLog()
+		tx.auditing = &auditing
+	}
+
+	return *tx.auditing, nil
+}
+
+// Records the operation on a file's tagging in the audit log. As the names
+// must be looked up the tagging is checked to be audited first.
+func (storage *Storage) auditFileTag(tx *Tx, operation string, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	auditing, err := storage.auditing(tx)
+	if err != nil || !auditing {
+		return err
+	}
+
+	entry := entities.AuditEntry{Operation: operation}
+
+	file, err := storage.File(tx, fileId)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		entry.Path = file.Path()
+	}
+
+	tag, err := storage.Tag(tx, tagId)
+	if err != nil {
+		return err
+	}
+	if tag != nil {
+		entry.Tag = tag.Name
+	}
+
+	if valueId != 0 {
+		value, err := storage.Value(tx, valueId)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			entry.Value = value.Name
+		}
+	}
+
+	return storage.Audit(tx, entry)
+}
+
+func currentUserName() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,162 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+	"strings"
+)
+
+// The complete set of tag aliases.
+func Aliases(tx *Tx) (entities.Aliases, error) {
+	sql := `
+SELECT alias.name, tag.id, tag.name
+FROM alias
+INNER JOIN tag ON alias.tag_id = tag.id
+ORDER BY alias.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAliases(rows, make(entities.Aliases, 0, 10))
+}
+
+// Retrieves the set of named aliases.
+func AliasesByNames(tx *Tx, names []string, ignoreCase bool) (entities.Aliases, error) {
+	if len(names) == 0 {
+		return make(entities.Aliases, 0), nil
+	}
+
+	collation := collationFor(ignoreCase)
+
+	sql := `
+SELECT alias.name, tag.id, tag.name
+FROM alias
+INNER JOIN tag ON alias.tag_id = tag.id
+WHERE alias.name ` + collation + ` IN (?`
+	sql += strings.Repeat(",?", len(names)-1)
+	sql += ")"
+
+	params := make([]interface{}, len(names))
+	for index, name := range names {
+		params[index] = name
+	}
+
+	rows, err := tx.Query(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAliases(rows, make(entities.Aliases, 0, len(names)))
+}
+
+// Adds an alias for the specified tag.
+func InsertAlias(tx *Tx, name string, tag entities.Tag) (*entities.Alias, error) {
+	sql := `
+INSERT INTO alias (name, tag_id)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, name, tag.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected")
+	}
+
+	return &entities.Alias{name, tag}, nil
+}
+
+// Removes the named alias.
+func DeleteAlias(tx *Tx, name string) error {
+	sql := `
+DELETE FROM alias
+WHERE name = ?`
+
+	result, err := tx.Exec(sql, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchAliasError{name}
+	}
+
+	return nil
+}
+
+// Removes the aliases of the specified tag.
+func DeleteAliasesByTagId(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM alias
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readAlias(rows *sql.Rows) (*entities.Alias, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var name string
+	var tagId entities.TagId
+	var tagName string
+	if err := rows.Scan(&name, &tagId, &tagName); err != nil {
+		return nil, err
+	}
+
+	return &entities.Alias{name, entities.Tag{tagId, tagName}}, nil
+}
+
+func readAliases(rows *sql.Rows, aliases entities.Aliases) (entities.Aliases, error) {
+	for {
+		alias, err := readAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		if alias == nil {
+			break
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+	"time"
+)
+
+// Retrieves the audit entries recorded at or after the specified time, oldest
+// first.
+func AuditEntriesSince(tx *Tx, since time.Time) (entities.AuditEntries, error) {
+	sql := `
+SELECT time, user, operation, tag, value, path, detail
+FROM audit
+WHERE datetime(time) >= ?
+ORDER BY id`
+
+	rows, err := tx.Query(sql, since.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAuditEntries(rows, make(entities.AuditEntries, 0, 10))
+}
+
+// Appends an entry to the audit log, recording it against the current time.
+func InsertAuditEntry(tx *Tx, entry entities.AuditEntry) error {
+	sql := `
+INSERT INTO audit (time, user, operation, tag, value, path, detail)
+VALUES (datetime('now'), ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(sql, entry.User, entry.Operation, entry.Tag, entry.Value, entry.Path, entry.Detail)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected")
+	}
+
+	return nil
+}
+
+// unexported
+
+func readAuditEntry(rows *sql.Rows) (*entities.AuditEntry, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var entry entities.AuditEntry
+	if err := rows.Scan(&entry.Time, &entry.User, &entry.Operation, &entry.Tag, &entry.Value, &entry.Path, &entry.Detail); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func readAuditEntries(rows *sql.Rows, entries entities.AuditEntries) (entities.AuditEntries, error) {
+	for {
+		entry, err := readAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -18,19 +18,37 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3" // initialised Sqlite3
 	"github.com/oniony/TMSU/common/log"
+	"net/url"
 	"os"
+	"strings"
 )
 
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	readDb *sql.DB
+}
+
+// The journal modes that may be configured.
+var JournalModes = []string{"wal", "delete", "truncate", "persist"}
+
+// Validates the name of a journal mode.
+func ValidateJournalMode(mode string) error {
+	for _, journalMode := range JournalModes {
+		if mode == journalMode {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid journal mode '%v': must be one of %v", mode, strings.Join(JournalModes, ", "))
 }
 
 func CreateAt(path string) error {
-	log.Infof(2, "creating database at '%v'.", path)
+	log.Infof("creating database at '%v'.", path)
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open("sqlite3", dataSourceName(path, ""))
 	if err != nil {
 		return DatabaseAccessError{path, err}
 	}
@@ -53,19 +71,13 @@ func CreateAt(path string) error {
 }
 
 func OpenAt(path string) (*Database, error) {
-	log.Infof(2, "opening database at '%v'.", path)
+	log.Infof("opening database at '%v'.", path)
 
-	_, err := os.Stat(path)
-	if err != nil {
-		switch {
-		case os.IsNotExist(err):
-			return nil, DatabaseNotFoundError{path}
-		default:
-			return nil, DatabaseAccessError{path, err}
-		}
+	if err := checkExists(path); err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open("sqlite3", dataSourceName(path, "_busy_timeout="+busyTimeout))
 	if err != nil {
 		return nil, DatabaseAccessError{path, err}
 	}
@@ -83,13 +95,108 @@ func OpenAt(path string) (*Database, error) {
 		return nil, DatabaseTransactionError{path, err}
 	}
 
-	return &Database{db}, nil
+	readDb, err := sql.Open("sqlite3", dataSourceName(path, "_query_only=true&_busy_timeout="+busyTimeout))
+	if err != nil {
+		db.Close()
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	return &Database{db, readDb}, nil
+}
+
+// Opens the database such that it cannot be modified. As the schema cannot be
+// upgraded, a database with an older schema cannot be opened read-only.
+func OpenReadOnlyAt(path string) (*Database, error) {
+	log.Infof("opening database at '%v' read-only.", path)
+
+	if err := checkExists(path); err != nil {
+		return nil, err
+	}
+
+	dataSource := dataSourceName(path, "_query_only=true&_busy_timeout="+busyTimeout)
+
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	version := currentSchemaVersion(tx)
+	tx.Rollback()
+
+	if version.LessThan(latestSchemaVersion) {
+		db.Close()
+		return nil, DatabaseOutOfDateError{path}
+	}
+
+	readDb, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		db.Close()
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	return &Database{db, readDb}, nil
+}
+
+func checkExists(path string) error {
+	_, err := os.Stat(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return DatabaseNotFoundError{path}
+		default:
+			return DatabaseAccessError{path, err}
+		}
+	}
+
+	return nil
 }
 
 func (database *Database) Close() error {
+	if err := database.readDb.Close(); err != nil {
+		return err
+	}
+
 	return database.db.Close()
 }
 
+// Switches the database to the specified journal mode, returning the journal
+// mode actually in use, which may differ if the mode is not supported.
+func (database *Database) SetJournalMode(mode string) (string, error) {
+	if err := ValidateJournalMode(mode); err != nil {
+		return "", err
+	}
+
+	var journalMode string
+	if err := database.db.QueryRow("PRAGMA journal_mode = " + mode).Scan(&journalMode); err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(journalMode), nil
+}
+
+// Rebuilds the database file, reclaiming the space left by deleted rows, and
+// then updates the statistics used by the query planner. This cannot be done
+// within a transaction.
+func (database *Database) Vacuum() error {
+	if _, err := database.db.Exec("VACUUM"); err != nil {
+		return err
+	}
+
+	// in WAL mode the rebuilt pages are only written back to the database at a checkpoint
+	if _, err := database.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return err
+	}
+
+	_, err := database.db.Exec("ANALYZE")
+	return err
+}
+
 func (database *Database) Begin() (*Tx, error) {
 	tx, err := database.db.Begin()
 	if err != nil {
@@ -99,38 +206,88 @@ func (database *Database) Begin() (*Tx, error) {
 	return &Tx{tx}, nil
 }
 
+// Begins a transaction on a separate, query-only connection to the database.
+func (database *Database) BeginRead() (*Tx, error) {
+	tx, err := database.readDb.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx}, nil
+}
+
 type Tx struct {
 	tx *sql.Tx
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	log.Info(3, query)
-	log.Infof(3, "params: %v", args)
+	log.Debug(query)
+	log.Debugf("params: %v", args)
 
 	return tx.tx.Exec(query, args...)
 }
 
 func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	log.Info(3, query)
-	log.Infof(3, "params: %v", args)
+	log.Debug(query)
+	log.Debugf("params: %v", args)
 
 	return tx.tx.Query(query, args...)
 }
 
 func (tx *Tx) Commit() error {
-	log.Info(2, "committing transaction")
+	log.Info("committing transaction")
 
 	return tx.tx.Commit()
 }
 
 func (tx *Tx) Rollback() error {
-	log.Info(2, "rolling back transaction")
+	log.Info("rolling back transaction")
 
 	return tx.tx.Rollback()
 }
 
+// Marks a point within the transaction to which the changes may later be
+// rolled back.
+func (tx *Tx) Savepoint(name string) error {
+	_, err := tx.Exec("SAVEPOINT " + name)
+	return err
+}
+
+// Discards the changes made since the savepoint of the specified name.
+func (tx *Tx) RollbackToSavepoint(name string) error {
+	log.Infof("rolling back to savepoint '%v'", name)
+
+	if _, err := tx.Exec("ROLLBACK TO SAVEPOINT " + name); err != nil {
+		return err
+	}
+
+	return tx.ReleaseSavepoint(name)
+}
+
+// Removes a savepoint, retaining the changes made since.
+func (tx *Tx) ReleaseSavepoint(name string) error {
+	_, err := tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
 // unexported
 
+// The number of milliseconds to wait for another connection to release its
+// lock on the database.
+const busyTimeout = "5000"
+
+// Builds the 'file:' URI for the database at the path with the specified
+// options, escaping the path so that characters such as '?' and '#' are taken
+// as part of it.
+func dataSourceName(path, options string) string {
+	dataSource := "file:" + url.PathEscape(path)
+	if options != "" {
+		dataSource += "?" + options
+	}
+
+	return dataSource
+}
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("could not get count")
@@ -148,6 +305,12 @@ func readCount(rows *sql.Rows) (uint, error) {
 	return count, nil
 }
 
+// The upper bound, exclusive, of the range of names starting with the
+// specified prefix. Querying by range allows the name index to be used.
+func prefixUpperBound(prefix string) string {
+	return prefix + "\U0010FFFF"
+}
+
 func collationFor(ignoreCase bool) string {
 	if ignoreCase {
 		return " COLLATE NOCASE"
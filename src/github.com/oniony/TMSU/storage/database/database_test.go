@@ -0,0 +1,62 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAtPathWithReservedCharacters(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "my db?#1 %20")
+	if err := CreateAt(path); err != nil {
+		test.Fatal(err)
+	}
+
+	database, err := OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO tag (name) VALUES ('aubergine')"); err != nil {
+		test.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "my db?#1 %20" && entry.Name() != "my db?#1 %20-journal" {
+			test.Fatalf("Expected the database at '%v' but found '%v'.", path, entry.Name())
+		}
+	}
+}
@@ -28,6 +28,14 @@ func (err DatabaseNotFoundError) Error() string {
 	return fmt.Sprintf("no database at '%v'", err.Path)
 }
 
+type DatabaseOutOfDateError struct {
+	Path string
+}
+
+func (err DatabaseOutOfDateError) Error() string {
+	return fmt.Sprintf("database at '%v' must be upgraded before it can be opened read-only", err.Path)
+}
+
 type DatabaseAccessError struct {
 	DatabasePath string
 	Reason       error
@@ -106,3 +114,11 @@ type NoSuchSettingError struct {
 func (err NoSuchSettingError) Error() string {
 	return fmt.Sprintf("no such setting '%v'", err.Name)
 }
+
+type NoSuchAliasError struct {
+	Name string
+}
+
+func (err NoSuchAliasError) Error() string {
+	return fmt.Sprintf("no such alias '%v'", err.Name)
+}
@@ -21,7 +21,7 @@ import (
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 )
 
@@ -46,7 +46,7 @@ func Files(tx *Tx, sort string) (entities.Files, error) {
 SELECT id, directory, name, fingerprint, mod_time, size, is_dir
 FROM file `)
 
-	buildSort(sort, builder)
+	buildSort(sort, false, builder)
 
 	rows, err := tx.Query(builder.Sql())
 	if err != nil {
@@ -133,6 +133,22 @@ WHERE fingerprint = ?`
 	return readCount(rows)
 }
 
+// Retrieves the number of fingerprinted files with the specified size.
+func FileCountBySize(tx *Tx, size int64) (uint, error) {
+	sql := `
+SELECT count(id)
+FROM file
+WHERE size = ? AND fingerprint != ''`
+
+	rows, err := tx.Query(sql, size)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
 // Retrieves the set of files with the specified fingerprint.
 func FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.Files, error) {
 	sql := `
@@ -181,8 +197,10 @@ func FileCountForQuery(tx *Tx, expression query.Expression, path string, pathCon
 }
 
 // Retrieves the set of files matching the specified query and matching the specified path.
-func FilesForQuery(tx *Tx, expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
-	builder := buildQuery(expression, path, pathContainsRoot, explicitOnly, ignoreCase, sort)
+// The files are ordered by sort, in reverse if specified, and at most limit files
+// are retrieved, if not zero, after skipping the first offset files.
+func FilesForQuery(tx *Tx, expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit, offset uint) (entities.Files, error) {
+	builder := buildQuery(expression, path, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit, offset)
 
 	rows, err := tx.Query(builder.Sql(), builder.Params()...)
 	if err != nil {
@@ -258,8 +276,8 @@ func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTim
 	name := filepath.Base(path)
 
 	sql := `
-INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
-VALUES (?, ?, ?, ?, ?, ?)`
+INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir, added_time)
+VALUES (?, ?, ?, ?, ?, ?, datetime('now'))`
 
 	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir)
 	if err != nil {
@@ -404,7 +422,7 @@ WHERE`)
 	return builder
 }
 
-func buildQuery(expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string) *SqlBuilder {
+func buildQuery(expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit, offset uint) *SqlBuilder {
 	builder := NewBuilder()
 
 	builder.AppendSql(`
@@ -413,7 +431,8 @@ FROM file
 WHERE`)
 	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
 	buildPathClause(path, pathContainsRoot, builder)
-	buildSort(sort, builder)
+	buildSort(sort, reverse, builder)
+	buildLimit(limit, offset, builder)
 
 	return builder
 }
@@ -424,12 +443,30 @@ func buildQueryBranch(expression query.Expression, builder *SqlBuilder, explicit
 		buildTagQueryBranch(exp, builder, explicitOnly, ignoreCase)
 	case query.ComparisonExpression:
 		buildComparisonQueryBranch(exp, builder, explicitOnly, ignoreCase)
+	case query.AnyValueExpression:
+		buildAnyValueQueryBranch(exp, builder, explicitOnly, ignoreCase)
+	case query.NearExpression:
+		buildValueNamesQueryBranch(exp.Tag, exp.ValueNames, builder, explicitOnly, ignoreCase)
+	case query.RegexExpression:
+		buildValueNamesQueryBranch(exp.Tag, exp.ValueNames, builder, explicitOnly, ignoreCase)
+	case query.TimeExpression:
+		buildTimeQueryBranch(exp, builder)
+	case query.TagCountExpression:
+		buildTagCountQueryBranch(exp, builder)
+	case query.SizeExpression:
+		buildSizeQueryBranch(exp, builder)
+	case query.PathExpression:
+		buildPathQueryBranch(exp, builder, ignoreCase)
+	case query.FingerprintExpression:
+		buildFingerprintQueryBranch(exp, builder)
 	case query.NotExpression:
 		buildNotQueryBranch(exp, builder, explicitOnly, ignoreCase)
 	case query.AndExpression:
 		buildAndQueryBranch(exp, builder, explicitOnly, ignoreCase)
 	case query.OrExpression:
 		buildOrQueryBranch(exp, builder, explicitOnly, ignoreCase)
+	case query.XorExpression:
+		buildXorQueryBranch(exp, builder, explicitOnly, ignoreCase)
 	case query.EmptyExpression:
 		builder.AppendSql("1 == 1")
 	default:
@@ -463,10 +500,10 @@ id IN (SELECT file_id
 		builder.AppendParam(expression.Name)
 		builder.AppendSql(`
                        UNION ALL
-                       SELECT b.tag_id, b.value_id
+                       SELECT b.tag_id, CASE WHEN b.inherits_value THEN working.value_id ELSE b.value_id END
                        FROM implication b, working
                        WHERE b.implied_tag_id = working.tag_id AND
-                             (b.implied_value_id = working.value_id OR working.value_id = 0)
+                             (b.implied_value_id = working.value_id OR working.value_id = 0 OR b.inherits_value)
                    )
                    SELECT tag_id, value_id
                    FROM working
@@ -478,22 +515,14 @@ id IN (SELECT file_id
 }
 
 func buildComparisonQueryBranch(expression query.ComparisonExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
-	collation := collationFor(ignoreCase)
-
-	var valueTerm string
-	_, err := strconv.ParseFloat(expression.Value.Name, 64)
-	if err == nil {
-		valueTerm = "CAST(v.name AS float)"
-	} else {
-		valueTerm = "v.name"
-	}
-
 	if expression.Operator == "!=" {
 		// reinterprent as otherwise it won't work for multiple values of same tag
 		expression.Operator = "=="
 		builder.AppendSql(" not ")
 	}
 
+	collation := collationFor(ignoreCase)
+
 	if explicitOnly {
 		builder.AppendSql(`
 id IN (SELECT file_id
@@ -503,10 +532,10 @@ id IN (SELECT file_id
                        WHERE name` + collation + ` = `)
 		builder.AppendParam(expression.Tag.Name)
 		builder.AppendSql(`) AND
-             value_id = (SELECT id
-                         FROM value
-                         WHERE name` + collation + ` = `)
-		builder.AppendParam(expression.Value.Name)
+             value_id IN (SELECT v.id
+                          FROM value v
+                          WHERE `)
+		buildValueComparison(expression, builder, collation)
 		builder.AppendSql(`)
      )`)
 	} else {
@@ -517,14 +546,96 @@ id IN (WITH RECURSIVE impft (tag_id, value_id) AS
            FROM tag t, value v
            WHERE t.name` + collation + ` = `)
 		builder.AppendParam(expression.Tag.Name)
-		builder.AppendSql("AND " + valueTerm + collation + " " + expression.Operator + " ")
+		builder.AppendSql("AND ")
+		buildValueComparison(expression, builder, collation)
+		builder.AppendSql(`
+           UNION ALL
+           SELECT b.tag_id, CASE WHEN b.inherits_value THEN impft.value_id ELSE b.value_id END
+           FROM implication b, impft
+           WHERE b.implied_tag_id = impft.tag_id AND
+                 (b.implied_value_id = impft.value_id OR impft.value_id = 0 OR b.inherits_value)
+       )
+
+       SELECT file_id
+       FROM file_tag
+       INNER JOIN impft
+       ON file_tag.tag_id = impft.tag_id AND
+          file_tag.value_id = impft.value_id
+      )`)
+	}
+}
+
+// Compares the value name 'v.name' per query.CompareValueNames: numerically
+// where both it and the expression's value are numbers, otherwise textually.
+func buildValueComparison(expression query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	number, isNumber := query.ParseNumber(expression.Value.Name)
+	if !isNumber {
+		builder.AppendSql("v.name" + collation + " " + expression.Operator + " ")
 		builder.AppendParam(expression.Value.Name)
+		return
+	}
+
+	// comparing with the cast applies numeric affinity to the name, so only
+	// names that are well-formed numbers compare equal
+	builder.AppendSql("(CASE WHEN CAST(v.name AS float) = v.name THEN CAST(v.name AS float) " + expression.Operator + " ")
+	builder.AppendParam(number)
+	builder.AppendSql(" ELSE v.name" + collation + " " + expression.Operator + " ")
+	builder.AppendParam(expression.Value.Name)
+	builder.AppendSql(" END) ")
+}
+
+// Matches files tagged with the tag and any of the values, for comparisons
+// such as 'near' and '~' whose matching values are determined beforehand.
+func buildValueNamesQueryBranch(tag query.TagExpression, valueNames []string, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	buildTagValuesQueryBranch(tag, builder, explicitOnly, ignoreCase, func(builder *SqlBuilder) {
+		buildValueNamesClause(valueNames, builder)
+	})
+}
+
+// Matches files tagged with the tag and any value. Valueless taggings, having
+// a value identifier of zero, match no value and so are excluded.
+func buildAnyValueQueryBranch(expression query.AnyValueExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	buildTagValuesQueryBranch(expression.Tag, builder, explicitOnly, ignoreCase, func(builder *SqlBuilder) {
+		builder.AppendSql("v.id != 0 ")
+	})
+}
+
+// Matches files tagged with the tag and any of the values 'v' for which the
+// clause holds.
+func buildTagValuesQueryBranch(tag query.TagExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool, buildValueClause func(*SqlBuilder)) {
+	collation := collationFor(ignoreCase)
+
+	if explicitOnly {
+		builder.AppendSql(`
+id IN (SELECT file_id
+       FROM file_tag
+       WHERE tag_id = (SELECT id
+                       FROM tag
+                       WHERE name` + collation + ` = `)
+		builder.AppendParam(tag.Name)
+		builder.AppendSql(`) AND
+             value_id IN (SELECT v.id
+                          FROM value v
+                          WHERE `)
+		buildValueClause(builder)
+		builder.AppendSql(`)
+     )`)
+	} else {
+		builder.AppendSql(`
+id IN (WITH RECURSIVE impft (tag_id, value_id) AS
+       (
+           SELECT t.id, v.id
+           FROM tag t, value v
+           WHERE t.name` + collation + ` = `)
+		builder.AppendParam(tag.Name)
+		builder.AppendSql("AND ")
+		buildValueClause(builder)
 		builder.AppendSql(`
            UNION ALL
-           SELECT b.tag_id, b.value_id
+           SELECT b.tag_id, CASE WHEN b.inherits_value THEN impft.value_id ELSE b.value_id END
            FROM implication b, impft
            WHERE b.implied_tag_id = impft.tag_id AND
-                 (b.implied_value_id = impft.value_id OR impft.value_id = 0)
+                 (b.implied_value_id = impft.value_id OR impft.value_id = 0 OR b.inherits_value)
        )
 
        SELECT file_id
@@ -536,6 +647,173 @@ id IN (WITH RECURSIVE impft (tag_id, value_id) AS
 	}
 }
 
+// The value names are matched exactly, as they are those of the values in the
+// database, with no names matching nothing.
+func buildValueNamesClause(valueNames []string, builder *SqlBuilder) {
+	if len(valueNames) == 0 {
+		builder.AppendSql("0 ")
+		return
+	}
+
+	builder.AppendSql("v.name IN (")
+	for _, valueName := range valueNames {
+		builder.AppendParam(valueName)
+	}
+	builder.AppendSql(") ")
+}
+
+func buildTimeQueryBranch(expression query.TimeExpression, builder *SqlBuilder) {
+	column := "mod_time"
+	if expression.Field == "added" {
+		column = "added_time"
+	}
+
+	// times are compared in UTC: datetime() and date() convert from the stored offset
+	function, layout := "datetime", "2006-01-02 15:04:05"
+	if expression.DateOnly {
+		function, layout = "date", "2006-01-02"
+	}
+
+	builder.AppendSql(" " + function + "(" + column + ") " + expression.Operator + " ")
+	builder.AppendParam(expression.Time.UTC().Format(layout))
+}
+
+func buildTagCountQueryBranch(expression query.TagCountExpression, builder *SqlBuilder) {
+	// counted per file, rather than grouped, so that files without tags are matched too
+	if expression.Implied {
+		builder.AppendSql(`
+(WITH RECURSIVE working (tag_id, value_id) AS
+ (
+     SELECT tag_id, value_id
+     FROM file_tag
+     WHERE file_id = file.id
+     UNION
+     SELECT b.implied_tag_id, CASE WHEN b.inherits_value THEN working.value_id ELSE b.implied_value_id END
+     FROM implication b, working
+     WHERE b.tag_id = working.tag_id AND
+           (b.value_id = working.value_id OR b.value_id = 0)
+ )
+ SELECT count(DISTINCT tag_id)
+ FROM working
+) ` + expression.Operator + " ")
+	} else {
+		builder.AppendSql(`
+(SELECT count(DISTINCT tag_id)
+ FROM file_tag
+ WHERE file_id = file.id
+) ` + expression.Operator + " ")
+	}
+
+	builder.AppendParam(expression.Count)
+}
+
+func buildSizeQueryBranch(expression query.SizeExpression, builder *SqlBuilder) {
+	builder.AppendSql(" size " + expression.Operator + " ")
+	builder.AppendParam(expression.Size)
+}
+
+func buildPathQueryBranch(expression query.PathExpression, builder *SqlBuilder, ignoreCase bool) {
+	// root-relative paths are made absolute so that both forms match alike
+	root := strings.TrimSuffix(expression.Root, string(filepath.Separator))
+	parent := strings.TrimSuffix(filepath.Dir(expression.Root), string(filepath.Separator))
+
+	builder.AppendSql(`
+(CASE WHEN directory = '.' THEN `)
+	builder.AppendParam(root)
+	builder.AppendSql(`
+      WHEN substr(directory, 1, 1) = '/' THEN directory
+      WHEN directory = '..' THEN `)
+	builder.AppendParam(parent)
+	builder.AppendSql(`
+      WHEN substr(directory, 1, 3) = '../' THEN `)
+	builder.AppendParam(parent)
+	builder.AppendSql(` || substr(directory, 3)
+      ELSE `)
+	builder.AppendParam(root)
+	builder.AppendSql(` || '/' || directory
+ END || '/' || name)`)
+
+	// LIKE is case-insensitive whereas GLOB is not
+	if ignoreCase {
+		builder.AppendSql(" LIKE ")
+		builder.AppendParam(globToLike(expression.Pattern))
+		builder.AppendSql(` ESCAPE '\'`)
+	} else {
+		builder.AppendSql(" GLOB ")
+		builder.AppendParam(globToSqliteGlob(expression.Pattern))
+	}
+}
+
+func buildFingerprintQueryBranch(expression query.FingerprintExpression, builder *SqlBuilder) {
+	// a range, unlike LIKE or substr, can be satisfied from the fingerprint index
+	builder.AppendSql(" (fingerprint >= ")
+	builder.AppendParam(expression.Prefix)
+	builder.AppendSql(" AND fingerprint < ")
+	builder.AppendParam(prefixUpperBound(expression.Prefix))
+	builder.AppendSql(")")
+}
+
+// Converts an escaped glob pattern to a LIKE pattern using '\' as the escape
+// character.
+func globToLike(pattern string) string {
+	like := ""
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			like += escapeLikeRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			like += "%"
+		case r == '?':
+			like += "_"
+		default:
+			like += escapeLikeRune(r)
+		}
+	}
+
+	return like
+}
+
+func escapeLikeRune(r rune) string {
+	switch r {
+	case '%', '_', '\\':
+		return `\` + string(r)
+	}
+
+	return string(r)
+}
+
+// Converts an escaped glob pattern to an SQLite GLOB pattern, which has no
+// escape character, so literal wildcards are expressed as character classes.
+func globToSqliteGlob(pattern string) string {
+	glob := ""
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			if r == '*' || r == '?' || r == '[' {
+				glob += "[" + string(r) + "]"
+			} else {
+				glob += string(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '[':
+			glob += "[[]"
+		default:
+			glob += string(r)
+		}
+	}
+
+	return glob
+}
+
 func buildNotQueryBranch(expression query.NotExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
 	builder.AppendSql("NOT")
 	buildQueryBranch(expression.Operand, builder, explicitOnly, ignoreCase)
@@ -555,6 +833,15 @@ func buildOrQueryBranch(expression query.OrExpression, builder *SqlBuilder, expl
 	builder.AppendSql(")")
 }
 
+// The operands are each either true or false, so differ where exactly one matches.
+func buildXorQueryBranch(expression query.XorExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	builder.AppendSql("((")
+	buildQueryBranch(expression.LeftOperand, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(")<>(")
+	buildQueryBranch(expression.RightOperand, builder, explicitOnly, ignoreCase)
+	builder.AppendSql("))")
+}
+
 func buildPathClause(path string, pathContainsRoot bool, builder *SqlBuilder) {
 	if path == "" {
 		return
@@ -589,17 +876,52 @@ func buildPathClause(path string, pathContainsRoot bool, builder *SqlBuilder) {
 	builder.AppendSql(")")
 }
 
-func buildSort(sort string, builder *SqlBuilder) {
+func buildSort(sort string, reverse bool, builder *SqlBuilder) {
+	var columns []string
+
 	switch sort {
 	case "none":
 		// do nowt
 	case "id":
-		builder.AppendSql("ORDER BY id")
-	case "name":
-		builder.AppendSql("ORDER BY directory || '/' || name")
-	case "time":
-		builder.AppendSql("ORDER BY mod_time, directory || '/' || name")
+		columns = []string{"id"}
+	case "name", "path":
+		columns = []string{"directory || '/' || name"}
+	case "basename":
+		columns = []string{"name", "directory"}
+	case "time", "modified":
+		columns = []string{"mod_time", "directory || '/' || name"}
 	case "size":
-		builder.AppendSql("ORDER BY size, directory || '/' || name")
+		columns = []string{"size", "directory || '/' || name"}
+	case "fingerprint":
+		columns = []string{"fingerprint", "directory || '/' || name"}
+	}
+
+	if len(columns) == 0 {
+		return
+	}
+
+	if reverse {
+		for index := range columns {
+			columns[index] += " DESC"
+		}
+	}
+
+	builder.AppendSql("ORDER BY " + strings.Join(columns, ", "))
+}
+
+func buildLimit(limit, offset uint, builder *SqlBuilder) {
+	if limit == 0 && offset == 0 {
+		return
 	}
+
+	// a negative limit is no limit
+	builder.AppendSql(" LIMIT ")
+	if limit == 0 {
+		builder.AppendParam(-1)
+	} else {
+		builder.AppendParam(limit)
+	}
+
+	builder.AppendSql(" OFFSET ")
+	builder.AppendParam(offset)
 }
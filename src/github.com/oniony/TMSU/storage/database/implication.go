@@ -26,7 +26,8 @@ func Implications(tx *Tx) (entities.Implications, error) {
 SELECT tag.id, tag.name,
        value.id, value.name,
 	   implied_tag.id, implied_tag.name,
-	   implied_value.id, implied_value.name
+	   implied_value.id, implied_value.name,
+	   implication.inherits_value
 FROM implication
 INNER JOIN tag tag ON implication.tag_id = tag.id
 LEFT OUTER JOIN value value ON implication.value_id = value.id
@@ -56,7 +57,8 @@ func ImplicationsFor(tx *Tx, pairs entities.TagIdValueIdPairs) (entities.Implica
 SELECT tag.id, tag.name,
        value.id, value.name,
        implied_tag.id, implied_tag.name,
-       implied_value.id, implied_value.name
+       implied_value.id, implied_value.name,
+       implication.inherits_value
 FROM implication
 INNER JOIN tag tag ON implication.tag_id = tag.id
 LEFT OUTER JOIN value value ON implication.value_id = value.id
@@ -97,7 +99,8 @@ func ImplyingImplications(tx *Tx, pairs entities.TagIdValueIdPairs) (entities.Im
 SELECT tag.id, tag.name,
        value.id, value.name,
        implying_tag.id, implying_tag.name,
-       implying_value.id, implying_value.name
+       implying_value.id, implying_value.name,
+       implication.inherits_value
 FROM implication
 INNER JOIN tag tag ON implication.tag_id = tag.id
 LEFT OUTER JOIN value value ON implication.value_id = value.id
@@ -134,13 +137,14 @@ ORDER BY tag.name, value.name, implying_tag.name, implying_value.name`
 	return implications, nil
 }
 
-// Adds the specified implications
-func AddImplication(tx *Tx, pair, impliedPair entities.TagIdValueIdPair) error {
+// Adds the specified implication, replacing any existing implication between
+// the same pairs so that whether the value is inherited may be changed.
+func AddImplication(tx *Tx, pair, impliedPair entities.TagIdValueIdPair, inheritsValue bool) error {
 	sql := `
-INSERT OR IGNORE INTO implication (tag_id, value_id, implied_tag_id, implied_value_id)
-VALUES (?1, ?2, ?3, ?4)`
+INSERT OR REPLACE INTO implication (tag_id, value_id, implied_tag_id, implied_value_id, inherits_value)
+VALUES (?1, ?2, ?3, ?4, ?5)`
 
-	_, err := tx.Exec(sql, pair.TagId, pair.ValueId, impliedPair.TagId, impliedPair.ValueId)
+	_, err := tx.Exec(sql, pair.TagId, pair.ValueId, impliedPair.TagId, impliedPair.ValueId, inheritsValue)
 	if err != nil {
 		return err
 	}
@@ -222,6 +226,7 @@ func readImplication(rows *sql.Rows) (*entities.Implication, error) {
 	var impliedTagName string
 	var impliedValueId *entities.ValueId
 	var impliedValueName *string
+	var inheritsValue bool
 	err := rows.Scan(&implyingTagId,
 		&implyingTagName,
 		&implyingValueId,
@@ -229,7 +234,8 @@ func readImplication(rows *sql.Rows) (*entities.Implication, error) {
 		&impliedTagId,
 		&impliedTagName,
 		&impliedValueId,
-		&impliedValueName)
+		&impliedValueName,
+		&inheritsValue)
 	if err != nil {
 		return nil, err
 	}
@@ -247,7 +253,8 @@ func readImplication(rows *sql.Rows) (*entities.Implication, error) {
 	return &entities.Implication{entities.Tag{implyingTagId, implyingTagName},
 		implyingValue,
 		entities.Tag{impliedTagId, impliedTagName},
-		impliedValue}, nil
+		impliedValue,
+		inheritsValue}, nil
 }
 
 func readImplications(rows *sql.Rows, implications entities.Implications) (entities.Implications, error) {
@@ -0,0 +1,187 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+)
+
+// Runs SQLite's own consistency check of the database file, returning the
+// problems it reports or none if the file is sound.
+func IntegrityProblems(tx *Tx) ([]string, error) {
+	sql := `
+PRAGMA integrity_check`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	problems := make([]string, 0, 1)
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return nil, err
+		}
+
+		if message != "ok" {
+			problems = append(problems, message)
+		}
+	}
+
+	return problems, rows.Err()
+}
+
+// The number of file-tags that refer to a file, tag or value that does not
+// exist.
+func OrphanedFileTagCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM file_tag
+WHERE ` + orphanedFileTagCondition
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Removes the file-tags that refer to a file, tag or value that does not exist.
+func DeleteOrphanedFileTags(tx *Tx) (uint, error) {
+	sql := `
+DELETE FROM file_tag
+WHERE ` + orphanedFileTagCondition
+
+	result, err := tx.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected(result)
+}
+
+// The number of file-tags that repeat the file, tag and value of another. The
+// primary key prevents these but databases modified by other programs may lack
+// it.
+func DuplicateFileTagCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM file_tag
+WHERE ` + duplicateFileTagCondition
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Removes the file-tags that repeat the file, tag and value of another, keeping
+// the first of each.
+func DeleteDuplicateFileTags(tx *Tx) (uint, error) {
+	sql := `
+DELETE FROM file_tag
+WHERE ` + duplicateFileTagCondition
+
+	result, err := tx.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected(result)
+}
+
+// The number of implications that refer to a tag or value that does not
+// exist.
+func BrokenImplicationCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM implication
+WHERE ` + brokenImplicationCondition
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Removes the implications that refer to a tag or value that does not exist.
+func DeleteBrokenImplications(tx *Tx) (uint, error) {
+	sql := `
+DELETE FROM implication
+WHERE ` + brokenImplicationCondition
+
+	result, err := tx.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected(result)
+}
+
+// The number of fingerprints shared by files of differing sizes. Files with the
+// same fingerprint are expected to have the same contents, so such files were
+// either fingerprinted with different algorithms or have stale fingerprints.
+func MismatchedFingerprintCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM (SELECT fingerprint
+      FROM file
+      WHERE fingerprint != '' AND is_dir = 0
+      GROUP BY fingerprint
+      HAVING count(DISTINCT size) > 1)`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// unexported
+
+const orphanedFileTagCondition = `file_id NOT IN (SELECT id FROM file) OR
+      tag_id NOT IN (SELECT id FROM tag) OR
+      (value_id != 0 AND value_id NOT IN (SELECT id FROM value))`
+
+const duplicateFileTagCondition = `rowid NOT IN (SELECT min(rowid)
+                        FROM file_tag
+                        GROUP BY file_id, tag_id, value_id)`
+
+const brokenImplicationCondition = `tag_id NOT IN (SELECT id FROM tag) OR
+      implied_tag_id NOT IN (SELECT id FROM tag) OR
+      (value_id != 0 AND value_id NOT IN (SELECT id FROM value)) OR
+      (implied_value_id != 0 AND implied_value_id NOT IN (SELECT id FROM value))`
+
+func rowsAffected(result sql.Result) (uint, error) {
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(count), nil
+}
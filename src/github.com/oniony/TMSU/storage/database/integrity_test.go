@@ -0,0 +1,113 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteDuplicateFileTags(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db")
+	if err := CreateAt(path); err != nil {
+		test.Fatal(err)
+	}
+
+	database, err := OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// the table is recreated without its primary key so that duplicates can be added
+	statements := []string{
+		"ALTER TABLE file_tag RENAME TO file_tag_old",
+		"CREATE TABLE file_tag (file_id INTEGER NOT NULL, tag_id INTEGER NOT NULL, value_id INTEGER NOT NULL)",
+		"DROP TABLE file_tag_old",
+		"INSERT INTO file_tag VALUES (1, 1, 0), (1, 1, 0), (1, 1, 0), (1, 2, 1), (1, 2, 1), (2, 1, 0), (2, 1, 0)"}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	expectDuplicateFileTagCount(tx, 4, test)
+
+	count, err := DeleteDuplicateFileTags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 4 {
+		test.Fatalf("Expected 4 duplicate file-tags to be removed but were %v.", count)
+	}
+
+	expectDuplicateFileTagCount(tx, 0, test)
+
+	rows, err := tx.Query("SELECT file_id, tag_id, value_id FROM file_tag ORDER BY file_id, tag_id, value_id")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer rows.Close()
+
+	expected := [][3]int{{1, 1, 0}, {1, 2, 1}, {2, 1, 0}}
+	actual := make([][3]int, 0, len(expected))
+	for rows.Next() {
+		var fileTag [3]int
+		if err := rows.Scan(&fileTag[0], &fileTag[1], &fileTag[2]); err != nil {
+			test.Fatal(err)
+		}
+
+		actual = append(actual, fileTag)
+	}
+	if err := rows.Err(); err != nil {
+		test.Fatal(err)
+	}
+
+	if len(actual) != len(expected) {
+		test.Fatalf("Expected file-tags %v but were %v.", expected, actual)
+	}
+	for index := range actual {
+		if actual[index] != expected[index] {
+			test.Fatalf("Expected file-tags %v but were %v.", expected, actual)
+		}
+	}
+}
+
+// unexported
+
+func expectDuplicateFileTagCount(tx *Tx, expected uint, test *testing.T) {
+	count, err := DuplicateFileTagCount(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != expected {
+		test.Fatalf("Expected %v duplicate file-tags but were %v.", expected, count)
+	}
+}
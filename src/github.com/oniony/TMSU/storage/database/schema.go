@@ -23,7 +23,7 @@ import (
 
 // unexported
 
-var latestSchemaVersion = schemaVersion{common.Version{0, 7, 0}, 1}
+var latestSchemaVersion = schemaVersion{common.Version{0, 7, 0}, 10}
 
 func currentSchemaVersion(tx *sql.Tx) schemaVersion {
 	sql := `
@@ -117,6 +117,26 @@ func createSchema(tx *sql.Tx) error {
 		return err
 	}
 
+	if err := createValueConstraintTable(tx); err != nil {
+		return err
+	}
+
+	if err := createAliasTable(tx); err != nil {
+		return err
+	}
+
+	if err := createTagMetaTable(tx); err != nil {
+		return err
+	}
+
+	if err := createAuditTable(tx); err != nil {
+		return err
+	}
+
+	if err := createUndoTables(tx); err != nil {
+		return err
+	}
+
 	if err := createVersionTable(tx); err != nil {
 		return err
 	}
@@ -132,7 +152,9 @@ func createTagTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS tag (
     id INTEGER PRIMARY KEY,
-    name TEXT NOT NULL
+    name TEXT NOT NULL,
+    last_used DATETIME,
+    description TEXT
 )`
 
 	if _, err := tx.Exec(sql); err != nil {
@@ -160,6 +182,7 @@ CREATE TABLE IF NOT EXISTS file (
     mod_time DATETIME NOT NULL,
     size INTEGER NOT NULL,
     is_dir BOOLEAN NOT NULL,
+    added_time DATETIME,
     CONSTRAINT con_file_path UNIQUE (directory, name)
 )`
 
@@ -243,6 +266,7 @@ CREATE TABLE IF NOT EXISTS implication (
     value_id INTEGER NOT NULL,
     implied_tag_id INTEGER NOT NULL,
     implied_value_id INTEGER NOT NULL,
+    inherits_value INTEGER NOT NULL DEFAULT 0,
     PRIMARY KEY (tag_id, value_id, implied_tag_id, implied_value_id)
 )`
 
@@ -280,6 +304,118 @@ CREATE TABLE IF NOT EXISTS setting (
 	return nil
 }
 
+func createValueConstraintTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS value_constraint (
+    tag_id INTEGER PRIMARY KEY,
+    type TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createAliasTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS alias (
+    name TEXT PRIMARY KEY,
+    tag_id INTEGER NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+CREATE INDEX IF NOT EXISTS idx_alias_tag_id
+ON alias(tag_id)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createTagMetaTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS tag_meta (
+    tag_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (tag_id, key),
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createAuditTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS audit (
+    id INTEGER PRIMARY KEY,
+    time DATETIME NOT NULL,
+    user TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    value TEXT NOT NULL,
+    path TEXT NOT NULL,
+    detail TEXT NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+CREATE INDEX IF NOT EXISTS idx_audit_time
+ON audit(time)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table recording the operation that may be undone together with
+// the tables, mirroring those of the entities, that hold the rows recorded for
+// it.
+func createUndoTables(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS undo (
+    description TEXT NOT NULL,
+    time DATETIME NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	for _, table := range undoTables {
+		sql = `
+CREATE TABLE IF NOT EXISTS undo_` + table.name + `
+AS SELECT ` + table.columns + `
+FROM ` + table.name + `
+WHERE 0`
+
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func createVersionTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS version (
@@ -84,6 +84,18 @@ VALUES (?, ?)`
 	return &entities.Setting{name, value}, nil
 }
 
+func DeleteSetting(tx *Tx, name string) error {
+	sql := `
+DELETE FROM setting
+WHERE name = ?`
+
+	if _, err := tx.Exec(sql, name); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // unexported
 
 func readSetting(rows *sql.Rows) (*entities.Setting, error) {
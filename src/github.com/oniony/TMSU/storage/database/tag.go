@@ -19,6 +19,7 @@ import (
 	"database/sql"
 	"github.com/oniony/TMSU/entities"
 	"strings"
+	"time"
 )
 
 // The number of tags in the database.
@@ -148,6 +149,23 @@ WHERE name ` + collation + ` IN (?`
 	return tags, nil
 }
 
+// Retrieves the set of tags whose names start with the specified prefix.
+func TagsByNamePrefix(tx *Tx, prefix string) (entities.Tags, error) {
+	sql := `
+SELECT id, name
+FROM tag
+WHERE name >= ?1 AND name < ?2
+ORDER BY name`
+
+	rows, err := tx.Query(sql, prefix, prefixUpperBound(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(entities.Tags, 0, 10))
+}
+
 // Adds a tag.
 func InsertTag(tx *Tx, name string) (*entities.Tag, error) {
 	sql := `
@@ -235,6 +253,220 @@ ORDER BY t.name`
 	}
 	defer rows.Close()
 
+	return readTagFileCounts(rows)
+}
+
+// Retrieves the tags applied with a value to at least one file, if withValues
+// is set, and without a value to at least one file, if withoutValues is set.
+func TagsByValueUsage(tx *Tx, withValues, withoutValues bool) (entities.Tags, error) {
+	sql := `
+SELECT t.id, t.name
+FROM tag t, file_tag ft
+WHERE ft.tag_id = t.id
+GROUP BY t.id
+HAVING 1 == 1`
+
+	if withValues {
+		sql += ` AND max(ft.value_id) != 0`
+	}
+	if withoutValues {
+		sql += ` AND min(ft.value_id) == 0`
+	}
+
+	sql += `
+ORDER BY t.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(entities.Tags, 0, 10))
+}
+
+// Retrieves the number of distinct files tagged with each tag, including
+// unused tags, ordered by descending count or by name.
+func TagFileCounts(tx *Tx, sort string) ([]entities.TagFileCount, error) {
+	sql := `
+SELECT t.id, t.name, count(DISTINCT ft.file_id)
+FROM tag t LEFT OUTER JOIN file_tag ft ON ft.tag_id = t.id
+GROUP BY t.id`
+
+	switch sort {
+	case "name":
+		sql += `
+ORDER BY t.name`
+	default:
+		sql += `
+ORDER BY count(DISTINCT ft.file_id) DESC, t.name`
+	}
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagFileCounts(rows)
+}
+
+// Retrieves the tags applied to the files that share a tag with the specified
+// file, together with the number of such files each is applied to, excluding
+// the tags already applied to the file. The most frequent tags are first.
+func CooccurringTags(tx *Tx, fileId entities.FileId) ([]entities.TagFileCount, error) {
+	sql := `
+SELECT t.id, t.name, count(DISTINCT other.file_id)
+FROM file_tag mine
+INNER JOIN file_tag other ON other.tag_id = mine.tag_id AND other.file_id != mine.file_id
+INNER JOIN file_tag suggested ON suggested.file_id = other.file_id
+INNER JOIN tag t ON t.id = suggested.tag_id
+WHERE mine.file_id = ?1
+AND suggested.tag_id NOT IN (SELECT tag_id
+                             FROM file_tag
+                             WHERE file_id = ?1)
+GROUP BY t.id
+ORDER BY count(DISTINCT other.file_id) DESC, t.name`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagFileCounts(rows)
+}
+
+// Retrieves when each tag was last applied to a file.
+func TagLastUsedTimes(tx *Tx) ([]entities.TagLastUsed, error) {
+	sql := `
+SELECT id, name, last_used
+FROM tag
+ORDER BY name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagLastUsedTimes(rows)
+}
+
+// Records that the tag has just been applied to a file.
+func UpdateTagLastUsed(tx *Tx, tagId entities.TagId) error {
+	sql := `
+UPDATE tag
+SET last_used = datetime('now')
+WHERE id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the description of each tag.
+func TagDescriptions(tx *Tx) ([]entities.TagDescription, error) {
+	sql := `
+SELECT id, name, description
+FROM tag
+ORDER BY name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagDescriptions(rows)
+}
+
+// Sets the description of the tag. An empty description removes it.
+func UpdateTagDescription(tx *Tx, tagId entities.TagId, description string) error {
+	sql := `
+UPDATE tag
+SET description = nullif(?1, '')
+WHERE id = ?2`
+
+	result, err := tx.Exec(sql, description, tagId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagDescriptions(rows *sql.Rows) ([]entities.TagDescription, error) {
+	tags := make([]entities.TagDescription, 0, 10)
+	for {
+		if !rows.Next() {
+			break
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var tagId entities.TagId
+		var name string
+		var description *string
+		err := rows.Scan(&tagId, &name, &description)
+		if err != nil {
+			return nil, err
+		}
+
+		tag := entities.TagDescription{tagId, name, ""}
+		if description != nil {
+			tag.Description = *description
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func readTagLastUsedTimes(rows *sql.Rows) ([]entities.TagLastUsed, error) {
+	tags := make([]entities.TagLastUsed, 0, 10)
+	for {
+		if !rows.Next() {
+			break
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var tagId entities.TagId
+		var name string
+		var lastUsed *time.Time
+		err := rows.Scan(&tagId, &name, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+
+		tag := entities.TagLastUsed{tagId, name, time.Time{}}
+		if lastUsed != nil {
+			tag.LastUsed = *lastUsed
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func readTagFileCounts(rows *sql.Rows) ([]entities.TagFileCount, error) {
 	tags := make([]entities.TagFileCount, 0, 10)
 	for {
 		if !rows.Next() {
@@ -258,8 +490,6 @@ ORDER BY t.name`
 	return tags, nil
 }
 
-// unexported
-
 func readTag(rows *sql.Rows) (*entities.Tag, error) {
 	if !rows.Next() {
 		return nil, nil
@@ -0,0 +1,121 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the metadata recorded against the specified tag, in order of key.
+func TagMetaByTagId(tx *Tx, tagId entities.TagId) (entities.TagMetas, error) {
+	sql := `
+SELECT tag_id, key, value
+FROM tag_meta
+WHERE tag_id = ?
+ORDER BY key`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagMetas(rows, make(entities.TagMetas, 0, 10))
+}
+
+// Sets the value of the item of tag metadata, replacing any existing value.
+func UpdateTagMeta(tx *Tx, tagId entities.TagId, key, value string) (*entities.TagMeta, error) {
+	sql := `
+INSERT OR REPLACE INTO tag_meta (tag_id, key, value)
+VALUES (?, ?, ?)`
+
+	result, err := tx.Exec(sql, tagId, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected")
+	}
+
+	return &entities.TagMeta{tagId, key, value}, nil
+}
+
+// Removes the item of tag metadata.
+func DeleteTagMeta(tx *Tx, tagId entities.TagId, key string) error {
+	sql := `
+DELETE FROM tag_meta
+WHERE tag_id = ? AND key = ?`
+
+	if _, err := tx.Exec(sql, tagId, key); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the metadata recorded against the specified tag.
+func DeleteTagMetaByTagId(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM tag_meta
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagMeta(rows *sql.Rows) (*entities.TagMeta, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var tagId entities.TagId
+	var key, value string
+	if err := rows.Scan(&tagId, &key, &value); err != nil {
+		return nil, err
+	}
+
+	return &entities.TagMeta{tagId, key, value}, nil
+}
+
+func readTagMetas(rows *sql.Rows, metas entities.TagMetas) (entities.TagMetas, error) {
+	for {
+		meta, err := readTagMeta(rows)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			break
+		}
+
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
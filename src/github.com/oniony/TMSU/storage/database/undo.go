@@ -0,0 +1,334 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the operation that may be undone, if any.
+func UndoOperation(tx *Tx) (*entities.UndoOperation, error) {
+	sql := `
+SELECT description, time
+FROM undo`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readUndoOperation(rows)
+}
+
+// Records a new operation that may be undone.
+func InsertUndoOperation(tx *Tx, description string) error {
+	sql := `
+INSERT INTO undo (description, time)
+VALUES (?, datetime('now'))`
+
+	if _, err := tx.Exec(sql, description); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Forgets the operation that may be undone together with the rows recorded for
+// it.
+func DeleteUndo(tx *Tx) error {
+	if _, err := tx.Exec("DELETE FROM undo"); err != nil {
+		return err
+	}
+
+	for _, table := range undoTables {
+		if _, err := tx.Exec("DELETE FROM undo_" + table.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Records the tag together with its taggings, the files so tagged, its
+// implications, value constraint, aliases and metadata.
+func SaveUndoTag(tx *Tx, tagId entities.TagId) error {
+	if err := saveUndoRows(tx, "tag", "id = ?1", tagId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "file", "id IN (SELECT file_id FROM file_tag WHERE tag_id = ?1)", tagId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "file_tag", "tag_id = ?1", tagId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "implication", "tag_id = ?1 OR implied_tag_id = ?1", tagId); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"value_constraint", "alias", "tag_meta"} {
+		if err := saveUndoRows(tx, table, "tag_id = ?1", tagId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Records the value together with its taggings, the files so tagged and its
+// implications.
+func SaveUndoValue(tx *Tx, valueId entities.ValueId) error {
+	if err := saveUndoRows(tx, "value", "id = ?1", valueId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "file", "id IN (SELECT file_id FROM file_tag WHERE value_id = ?1)", valueId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "file_tag", "value_id = ?1", valueId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "implication", "value_id = ?1 OR implied_value_id = ?1", valueId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Records the file together with its taggings.
+func SaveUndoFile(tx *Tx, fileId entities.FileId) error {
+	if err := saveUndoRows(tx, "file", "id = ?1", fileId); err != nil {
+		return err
+	}
+
+	if err := saveUndoRows(tx, "file_tag", "file_id = ?1", fileId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the name of a recorded tag that has since been recreated, or a tag
+// that has since taken the recorded tag's place, if any.
+func UndoTagConflict(tx *Tx) (string, error) {
+	sql := `
+SELECT t.name
+FROM undo_tag u
+INNER JOIN tag t ON t.id = u.id
+WHERE t.name != u.name
+UNION
+SELECT t.name
+FROM undo_tag u
+INNER JOIN tag t ON t.name = u.name
+WHERE t.id != u.id`
+
+	return readUndoConflict(tx, sql)
+}
+
+// Retrieves the name of a recorded value that has since been recreated, or a
+// value that has since taken the recorded value's place, if any.
+func UndoValueConflict(tx *Tx) (string, error) {
+	sql := `
+SELECT v.name
+FROM undo_value u
+INNER JOIN value v ON v.id = u.id
+WHERE v.name != u.name
+UNION
+SELECT v.name
+FROM undo_value u
+INNER JOIN value v ON v.name = u.name
+WHERE v.id != u.id`
+
+	return readUndoConflict(tx, sql)
+}
+
+// Retrieves a file that has since been added at the path of a recorded file, or
+// that has since taken the recorded file's place, if any.
+func UndoFileConflict(tx *Tx) (*entities.File, error) {
+	sql := `
+SELECT f.id, f.directory, f.name, f.fingerprint, f.mod_time, f.size, f.is_dir
+FROM undo_file u
+INNER JOIN file f ON f.id = u.id
+WHERE f.directory != u.directory OR f.name != u.name
+UNION
+SELECT f.id, f.directory, f.name, f.fingerprint, f.mod_time, f.size, f.is_dir
+FROM undo_file u
+INNER JOIN file f ON f.directory = u.directory AND f.name = u.name
+WHERE f.id != u.id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFile(rows)
+}
+
+// Restores the recorded rows. The current taggings and implications of the
+// recorded tags and values are first removed so that those made by the
+// operation are not kept. Taggings and implications of tags, values and files
+// that no longer exist are not restored.
+func RestoreUndo(tx *Tx) error {
+	statements := []string{`
+DELETE FROM file_tag
+WHERE tag_id IN (SELECT id FROM undo_tag)
+OR value_id IN (SELECT id FROM undo_value)`, `
+DELETE FROM implication
+WHERE tag_id IN (SELECT id FROM undo_tag)
+OR implied_tag_id IN (SELECT id FROM undo_tag)
+OR value_id IN (SELECT id FROM undo_value)
+OR implied_value_id IN (SELECT id FROM undo_value)`, `
+DELETE FROM value_constraint
+WHERE tag_id IN (SELECT id FROM undo_tag)`, `
+DELETE FROM alias
+WHERE tag_id IN (SELECT id FROM undo_tag)`, `
+DELETE FROM tag_meta
+WHERE tag_id IN (SELECT id FROM undo_tag)`}
+
+	for _, sql := range statements {
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	restores := []struct{ table, conflict, where string }{
+		{"tag", "IGNORE", ""},
+		{"value", "IGNORE", ""},
+		{"file", "IGNORE", ""},
+		{"file_tag", "IGNORE", `
+WHERE file_id IN (SELECT id FROM file)
+AND tag_id IN (SELECT id FROM tag)
+AND (value_id = 0 OR value_id IN (SELECT id FROM value))`},
+		{"implication", "IGNORE", `
+WHERE tag_id IN (SELECT id FROM tag)
+AND implied_tag_id IN (SELECT id FROM tag)
+AND (value_id = 0 OR value_id IN (SELECT id FROM value))
+AND (implied_value_id = 0 OR implied_value_id IN (SELECT id FROM value))`},
+		{"value_constraint", "REPLACE", `
+WHERE tag_id IN (SELECT id FROM tag)`},
+		{"alias", "IGNORE", `
+WHERE tag_id IN (SELECT id FROM tag)`},
+		{"tag_meta", "REPLACE", `
+WHERE tag_id IN (SELECT id FROM tag)`},
+	}
+
+	for _, restore := range restores {
+		columns := undoColumns(restore.table)
+
+		sql := `
+INSERT OR ` + restore.conflict + ` INTO ` + restore.table + ` (` + columns + `)
+SELECT ` + columns + `
+FROM undo_` + restore.table + restore.where
+
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	// files whose taggings could not be restored are not kept
+	if _, err := tx.Exec(`
+DELETE FROM file
+WHERE id IN (SELECT id FROM undo_file)
+AND id NOT IN (SELECT file_id FROM file_tag)`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+// The tables whose rows are recorded so that an operation may be undone, with
+// the columns recorded. Each is mirrored by a table of the same name prefixed
+// 'undo_'.
+var undoTables = []struct{ name, columns string }{
+	{"tag", "id, name, last_used, description"},
+	{"value", "id, name"},
+	{"file", "id, directory, name, fingerprint, mod_time, size, is_dir, added_time"},
+	{"file_tag", "file_id, tag_id, value_id"},
+	{"implication", "tag_id, value_id, implied_tag_id, implied_value_id, inherits_value"},
+	{"value_constraint", "tag_id, type"},
+	{"alias", "name, tag_id"},
+	{"tag_meta", "tag_id, key, value"},
+}
+
+func undoColumns(table string) string {
+	for _, undoTable := range undoTables {
+		if undoTable.name == table {
+			return undoTable.columns
+		}
+	}
+
+	panic("no such undo table '" + table + "'")
+}
+
+func saveUndoRows(tx *Tx, table, where string, id interface{}) error {
+	columns := undoColumns(table)
+
+	sql := `
+INSERT INTO undo_` + table + ` (` + columns + `)
+SELECT ` + columns + `
+FROM ` + table + `
+WHERE ` + where
+
+	if _, err := tx.Exec(sql, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readUndoOperation(rows *sql.Rows) (*entities.UndoOperation, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var operation entities.UndoOperation
+	if err := rows.Scan(&operation.Description, &operation.Time); err != nil {
+		return nil, err
+	}
+
+	return &operation, nil
+}
+
+func readUndoConflict(tx *Tx, sql string) (string, error) {
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+
+	var name string
+	if err := rows.Scan(&name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
@@ -26,16 +26,16 @@ import (
 func upgrade(tx *sql.Tx) error {
 	version := currentSchemaVersion(tx)
 
-	log.Infof(2, "database schema has version %v, latest schema version is %v", version, latestSchemaVersion)
+	log.Infof("database schema has version %v, latest schema version is %v", version, latestSchemaVersion)
 
 	if version == latestSchemaVersion {
-		log.Infof(2, "schema is up to date")
+		log.Infof("schema is up to date")
 		return nil
 	}
 
 	noVersion := schemaVersion{}
 	if version == noVersion {
-		log.Infof(2, "creating schema")
+		log.Infof("creating schema")
 
 		if err := createSchema(tx); err != nil {
 			return err
@@ -44,38 +44,106 @@ func upgrade(tx *sql.Tx) error {
 		// still need to run upgrade as per 0.5.0 database did not store a version
 	}
 
-	log.Infof(2, "upgrading database")
+	log.Infof("upgrading database")
 
 	if version.LessThan(schemaVersion{common.Version{0, 5, 0}, 0}) {
-		log.Infof(2, "renaming fingerprint algorithm setting")
+		log.Infof("renaming fingerprint algorithm setting")
 
 		if err := renameFingerprintAlgorithmSetting(tx); err != nil {
 			return err
 		}
 	}
 	if version.LessThan(schemaVersion{common.Version{0, 6, 0}, 0}) {
-		log.Infof(2, "recreating implication table")
+		log.Infof("recreating implication table")
 
 		if err := recreateImplicationTable(tx); err != nil {
 			return err
 		}
 	}
 	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 0}) {
-		log.Infof(2, "updating fingerprint algorithms")
+		log.Infof("updating fingerprint algorithms")
 
 		if err := updateFingerprintAlgorithms(tx); err != nil {
 			return err
 		}
 	}
 	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 1}) {
-		log.Infof(2, "recreating version table")
+		log.Infof("recreating version table")
 
 		if err := recreateVersionTable(tx); err != nil {
 			return err
 		}
 	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 2}) {
+		log.Infof("adding file added time column")
 
-	log.Infof(2, "updating schema version")
+		if err := addFileAddedTimeColumn(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 3}) {
+		log.Infof("creating value constraint table")
+
+		if err := createValueConstraintTable(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 4}) {
+		log.Infof("creating alias table")
+
+		if err := createAliasTable(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 5}) {
+		log.Infof("adding tag last used column")
+
+		if err := addTagLastUsedColumn(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 6}) {
+		log.Infof("adding tag description column")
+
+		if err := addTagDescriptionColumn(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 7}) {
+		log.Infof("adding implication inherits value column")
+
+		if err := addImplicationInheritsValueColumn(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 8}) {
+		log.Infof("creating tag metadata table")
+
+		if err := createTagMetaTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 9}) {
+		log.Infof("creating audit table")
+
+		if err := createAuditTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 10}) {
+		log.Infof("creating undo tables")
+
+		if err := createUndoTables(tx); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("updating schema version")
 	if err := updateSchemaVersion(tx, latestSchemaVersion); err != nil {
 		return err
 	}
@@ -106,7 +174,7 @@ RENAME TO implication_old`); err != nil {
 	}
 
 	if _, err := tx.Exec(`
-INSERT INTO implication
+INSERT INTO implication (tag_id, value_id, implied_tag_id, implied_value_id)
 SELECT tag_id, 0, implied_tag_id, 0
 FROM implication_old`); err != nil {
 		return err
@@ -176,3 +244,111 @@ func recreateVersionTable(tx *sql.Tx) error {
 
 	return nil
 }
+
+func addFileAddedTimeColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "file", "added_time")
+	if err != nil {
+		return err
+	}
+	if exists {
+		// table was created with the column
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+ALTER TABLE file
+ADD COLUMN added_time DATETIME`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func addTagLastUsedColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "tag", "last_used")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := tx.Exec(`
+ALTER TABLE tag
+ADD COLUMN last_used DATETIME`); err != nil {
+			return err
+		}
+	}
+
+	// the time each file was added is the best available approximation
+	if _, err := tx.Exec(`
+UPDATE tag
+SET last_used = (SELECT max(file.added_time)
+                 FROM file_tag
+                 INNER JOIN file ON file_tag.file_id = file.id
+                 WHERE file_tag.tag_id = tag.id)
+WHERE last_used IS NULL`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func addTagDescriptionColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "tag", "description")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+ALTER TABLE tag
+ADD COLUMN description TEXT`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func addImplicationInheritsValueColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "implication", "inherits_value")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+ALTER TABLE implication
+ADD COLUMN inherits_value INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(`
+PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, primaryKey int // primary key columns are numbered from 1
+		var name, columnType string
+		var notNull bool
+		var defaultValue interface{}
+
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return false, err
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -193,6 +193,83 @@ ORDER BY name`
 	return readValues(rows, make(entities.Values, 0, 10))
 }
 
+// Retrieves the set of values whose names start with the specified prefix.
+func ValuesByNamePrefix(tx *Tx, prefix string) (entities.Values, error) {
+	sql := `
+SELECT id, name
+FROM value
+WHERE name >= ?1 AND name < ?2
+ORDER BY name`
+
+	rows, err := tx.Query(sql, prefix, prefixUpperBound(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readValues(rows, make(entities.Values, 0, 10))
+}
+
+// Retrieves the set of values for the specified tag whose names start with
+// the specified prefix.
+func ValuesByTagIdAndNamePrefix(tx *Tx, tagId entities.TagId, prefix string) (entities.Values, error) {
+	sql := `
+SELECT id, name
+FROM value
+WHERE name >= ?2 AND name < ?3 AND
+      id IN (SELECT value_id
+             FROM file_tag
+             WHERE tag_id = ?1)
+ORDER BY name`
+
+	rows, err := tx.Query(sql, tagId, prefix, prefixUpperBound(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readValues(rows, make(entities.Values, 0, 10))
+}
+
+// Retrieves the number of distinct files tagged with each value of the
+// specified tag.
+func ValueFileCountsByTagId(tx *Tx, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	sql := `
+SELECT v.id, v.name, count(DISTINCT ft.file_id)
+FROM file_tag ft INNER JOIN value v ON v.id = ft.value_id
+WHERE ft.tag_id = ?1
+GROUP BY v.id
+ORDER BY v.name`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	valueFileCounts := make([]entities.ValueFileCount, 0, 10)
+	for {
+		if !rows.Next() {
+			break
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var valueId entities.ValueId
+		var name string
+		var count uint
+		err := rows.Scan(&valueId, &name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		valueFileCounts = append(valueFileCounts, entities.ValueFileCount{valueId, name, count})
+	}
+
+	return valueFileCounts, nil
+}
+
 // Adds a value.
 func InsertValue(tx *Tx, name string) (*entities.Value, error) {
 	sql := `
@@ -0,0 +1,123 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// The complete set of value constraints.
+func ValueConstraints(tx *Tx) (entities.ValueConstraints, error) {
+	sql := `
+SELECT tag_id, type
+FROM value_constraint
+ORDER BY tag_id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readValueConstraints(rows, make(entities.ValueConstraints, 0, 10))
+}
+
+// Retrieves the value constraint for the specified tag.
+func ValueConstraintByTagId(tx *Tx, tagId entities.TagId) (*entities.ValueConstraint, error) {
+	sql := `
+SELECT tag_id, type
+FROM value_constraint
+WHERE tag_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readValueConstraint(rows)
+}
+
+// Sets the value constraint for the specified tag.
+func UpdateValueConstraint(tx *Tx, tagId entities.TagId, constraintType string) (*entities.ValueConstraint, error) {
+	sql := `
+INSERT OR REPLACE INTO value_constraint (tag_id, type)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, tagId, constraintType)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected")
+	}
+
+	return &entities.ValueConstraint{tagId, constraintType}, nil
+}
+
+// Removes the value constraint for the specified tag.
+func DeleteValueConstraint(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM value_constraint
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readValueConstraint(rows *sql.Rows) (*entities.ValueConstraint, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var tagId entities.TagId
+	var constraintType string
+	if err := rows.Scan(&tagId, &constraintType); err != nil {
+		return nil, err
+	}
+
+	return &entities.ValueConstraint{tagId, constraintType}, nil
+}
+
+func readValueConstraints(rows *sql.Rows, constraints entities.ValueConstraints) (entities.ValueConstraints, error) {
+	for {
+		constraint, err := readValueConstraint(rows)
+		if err != nil {
+			return nil, err
+		}
+		if constraint == nil {
+			break
+		}
+
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints, nil
+}
@@ -18,6 +18,7 @@ package storage
 import (
 	"fmt"
 	"github.com/oniony/TMSU/entities"
+	"strings"
 )
 
 type AbsolutePathResolutionError struct {
@@ -38,3 +39,11 @@ type FileTagDoesNotExist struct {
 func (err FileTagDoesNotExist) Error() string {
 	return fmt.Sprintf("File-tag for file #%v, tag #%v and value #%v does not exist", err.FileId, err.TagId, err.ValueId)
 }
+
+type ImplicationCycleError struct {
+	Path []string
+}
+
+func (err ImplicationCycleError) Error() string {
+	return fmt.Sprintf("implication would create a cycle: %v", strings.Join(err.Path, " -> "))
+}
@@ -94,6 +94,11 @@ func (store *Storage) FileCountByFingerprint(tx *Tx, fingerprint fingerprint.Fin
 	return database.FileCountByFingerprint(tx.tx, fingerprint)
 }
 
+// Retrieves the number of fingerprinted files with the specified size.
+func (store *Storage) FileCountBySize(tx *Tx, size int64) (uint, error) {
+	return database.FileCountBySize(tx.tx, size)
+}
+
 // Retrieves the set of files with the specified fingerprint.
 func (store *Storage) FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.Files, error) {
 	files, err := database.FilesByFingerprint(tx.tx, fingerprint)
@@ -114,16 +119,62 @@ func (store *Storage) FileCountForQuery(tx *Tx, expression query.Expression, pat
 
 	pathContainsRoot := store.pathContainsRoot(relPath)
 
+	ignoreCase, err := store.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return 0, err
+	}
+
+	expression, err = store.ResolveAliases(tx, expression, ignoreCase)
+	if err != nil {
+		return 0, err
+	}
+
+	expression, err = store.expandGlobs(tx, expression, ignoreCase)
+	if err != nil {
+		return 0, err
+	}
+
+	expression, err = store.resolveMatchedValues(tx, expression, ignoreCase)
+	if err != nil {
+		return 0, err
+	}
+
+	expression = query.ResolvePaths(expression, store.RootPath)
+
 	return database.FileCountForQuery(tx.tx, expression, relPath, pathContainsRoot, explicitOnly, ignoreCase)
 }
 
-// Retrieves the set of files that match the specified query.
-func (store *Storage) FilesForQuery(tx *Tx, expression query.Expression, path string, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
+// Retrieves the set of files that match the specified query, ordered by sort and
+// in reverse if specified. At most limit files are retrieved, if not zero, after
+// skipping the first offset files.
+func (store *Storage) FilesForQuery(tx *Tx, expression query.Expression, path string, explicitOnly, ignoreCase bool, sort string, reverse bool, limit, offset uint) (entities.Files, error) {
 	relPath := store.relPath(path)
 
 	pathContainsRoot := store.pathContainsRoot(relPath)
 
-	files, err := database.FilesForQuery(tx.tx, expression, relPath, pathContainsRoot, explicitOnly, ignoreCase, sort)
+	ignoreCase, err := store.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.ResolveAliases(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.expandGlobs(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.resolveMatchedValues(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression = query.ResolvePaths(expression, store.RootPath)
+
+	files, err := database.FilesForQuery(tx.tx, expression, relPath, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit, offset)
 	store.absPaths(files)
 	return files, err
 }
@@ -227,3 +278,52 @@ func (store *Storage) pathContainsRoot(path string) bool {
 		checkPath = filepath.Clean(checkPath)
 	}
 }
+
+// Expands any glob patterns in the query against the current set of tags.
+func (store *Storage) expandGlobs(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	if !query.ContainsGlob(expression) {
+		return expression, nil
+	}
+
+	tags, err := database.Tags(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[index] = tag.Name
+	}
+
+	return query.ExpandGlobs(expression, tagNames, ignoreCase)
+}
+
+// Determines which of the values satisfy each 'near' and '~' comparison in the
+// query, as distances and regular expressions cannot be evaluated by the
+// database. Every value is tested so these comparisons are slower.
+func (store *Storage) resolveMatchedValues(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	containsNear := query.ContainsNear(expression)
+	containsRegex := query.ContainsRegex(expression)
+	if !containsNear && !containsRegex {
+		return expression, nil
+	}
+
+	values, err := database.Values(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+
+	valueNames := make([]string, len(values))
+	for index, value := range values {
+		valueNames[index] = value.Name
+	}
+
+	if containsNear {
+		expression = query.ResolveNearValues(expression, valueNames)
+	}
+	if containsRegex {
+		expression = query.ResolveRegexValues(expression, valueNames, ignoreCase)
+	}
+
+	return expression, nil
+}
@@ -124,7 +124,28 @@ func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explici
 
 // Adds a file tag.
 func (storage *Storage) AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
-	return database.AddFileTag(tx.tx, fileId, tagId, valueId)
+	exists, err := storage.FileTagExists(tx, fileId, tagId, valueId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fileTag, err := database.AddFileTag(tx.tx, fileId, tagId, valueId)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return fileTag, nil
+	}
+
+	if err := database.UpdateTagLastUsed(tx.tx, tagId); err != nil {
+		return nil, err
+	}
+
+	if err := storage.auditFileTag(tx, "tag", fileId, tagId, valueId); err != nil {
+		return nil, err
+	}
+
+	return fileTag, nil
 }
 
 // Delete file tag.
@@ -137,6 +158,10 @@ func (storage *Storage) DeleteFileTag(tx *Tx, fileId entities.FileId, tagId enti
 		return FileTagDoesNotExist{fileId, tagId, valueId}
 	}
 
+	if err := storage.auditFileTag(tx, "untag", fileId, tagId, valueId); err != nil {
+		return err
+	}
+
 	if err := database.DeleteFileTag(tx.tx, fileId, tagId, valueId); err != nil {
 		return err
 	}
@@ -150,6 +175,23 @@ func (storage *Storage) DeleteFileTag(tx *Tx, fileId entities.FileId, tagId enti
 
 // Deletes all of the file tags for the specified file.
 func (storage *Storage) DeleteFileTagsByFileId(tx *Tx, fileId entities.FileId) error {
+	auditing, err := storage.auditing(tx)
+	if err != nil {
+		return err
+	}
+	if auditing {
+		fileTags, err := database.FileTagsByFileId(tx.tx, fileId)
+		if err != nil {
+			return err
+		}
+
+		for _, fileTag := range fileTags {
+			if err := storage.auditFileTag(tx, "untag", fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := database.DeleteFileTagsByFileId(tx.tx, fileId); err != nil {
 		return err
 	}
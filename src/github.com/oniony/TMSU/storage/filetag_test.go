@@ -0,0 +1,103 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddFileTagUpdatesLastUsedOnlyForNewTagging(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db")
+	if err := CreateAt(path); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	file1, err := store.AddFile(tx, "/tmp/file1", fingerprint.Empty, time.Now(), 1, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	file2, err := store.AddFile(tx, "/tmp/file2", fingerprint.Empty, time.Now(), 1, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	aubergine, err := store.AddTag(tx, "aubergine")
+	if err != nil {
+		test.Fatal(err)
+	}
+	banana, err := store.AddTag(tx, "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, tag := range []*entities.Tag{aubergine, banana} {
+		if _, err := store.AddFileTag(tx, file1.Id, tag.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if _, err := tx.tx.Exec("UPDATE tag SET last_used = '2017-01-01 00:00:00'"); err != nil {
+		test.Fatal(err)
+	}
+
+	// reapplying a tag is not a use of it, unlike applying it to another file
+	if _, err := store.AddFileTag(tx, file1.Id, aubergine.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, file2.Id, banana.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	lastUsedTimes, err := store.TagLastUsedTimes(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(lastUsedTimes) != 2 {
+		test.Fatalf("Expected two tags but were %v.", lastUsedTimes)
+	}
+
+	old := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	if lastUsedTimes[0].Name != "aubergine" || !lastUsedTimes[0].LastUsed.Equal(old) {
+		test.Fatalf("Expected aubergine to be last used at %v but was %v.", old, lastUsedTimes[0])
+	}
+	if lastUsedTimes[1].Name != "banana" || !lastUsedTimes[1].LastUsed.After(old) {
+		test.Fatalf("Expected banana to be last used after %v but was %v.", old, lastUsedTimes[1])
+	}
+}
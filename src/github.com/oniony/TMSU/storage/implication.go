@@ -34,7 +34,7 @@ func (storage *Storage) ImplicationsFor(tx *Tx, pairs ...entities.TagIdValueIdPa
 	copy(impliedPairs, pairs)
 
 	for len(impliedPairs) > 0 {
-		implications, err := database.ImplicationsFor(tx.tx, impliedPairs)
+		implications, err := storage.implicationsFor(tx, impliedPairs)
 		if err != nil {
 			return nil, err
 		}
@@ -76,20 +76,75 @@ func (storage *Storage) ImplicationsImplying(tx *Tx, pairs ...entities.TagIdValu
 	return resultantImplications, nil
 }
 
-// Adds the specified implication.
-func (storage Storage) AddImplication(tx *Tx, pair, impliedPair entities.TagIdValueIdPair) error {
-	implications, err := storage.ImplicationsFor(tx, impliedPair)
-	if err != nil {
-		return err
+// Retrieves the chain of implications by which the specified pair implies the
+// specified target pair, or nil if there is no such chain.
+func (storage Storage) ImplicationChain(tx *Tx, pair, targetPair entities.TagIdValueIdPair) (entities.Implications, error) {
+	if impliesPair(pair, targetPair) {
+		return entities.Implications{}, nil
 	}
 
-	for _, implication := range implications {
-		if implication.ImpliedTag.Id == pair.TagId && (pair.ValueId == 0 || implication.ImpliedValue.Id == pair.ValueId) {
-			return fmt.Errorf("implication would create a cycle")
+	chains := map[entities.TagIdValueIdPair]entities.Implications{pair: entities.Implications{}}
+	pairs := entities.TagIdValueIdPairs{pair}
+
+	for len(pairs) > 0 {
+		nextPairs := make(entities.TagIdValueIdPairs, 0)
+
+		for _, pair := range pairs {
+			implications, err := storage.implicationsFor(tx, entities.TagIdValueIdPairs{pair})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, implication := range implications {
+				impliedPair := implication.ImpliedTagValuePair()
+				if _, seen := chains[impliedPair]; seen {
+					continue
+				}
+
+				chain := make(entities.Implications, len(chains[pair]), len(chains[pair])+1)
+				copy(chain, chains[pair])
+				chain = append(chain, implication)
+
+				if impliesPair(impliedPair, targetPair) {
+					return chain, nil
+				}
+
+				chains[impliedPair] = chain
+				nextPairs = append(nextPairs, impliedPair)
+			}
+		}
+
+		pairs = nextPairs
+	}
+
+	return nil, nil
+}
+
+// Adds the specified implication. If inheritsValue is specified then the implied
+// tag takes the value of the implying tag. Unless force is specified, an
+// implication that would create a cycle is refused.
+func (storage Storage) AddImplication(tx *Tx, pair, impliedPair entities.TagIdValueIdPair, inheritsValue, force bool) error {
+	if !force {
+		chain, err := storage.ImplicationChain(tx, impliedPair, pair)
+		if err != nil {
+			return err
+		}
+
+		if chain != nil {
+			names, err := storage.tagValueNames(tx, pair, impliedPair)
+			if err != nil {
+				return err
+			}
+
+			for _, implication := range chain {
+				names = append(names, formatTagValueName(implication.ImpliedTag.Name, implication.ImpliedValue.Name))
+			}
+
+			return ImplicationCycleError{names}
 		}
 	}
 
-	return database.AddImplication(tx.tx, pair, impliedPair)
+	return database.AddImplication(tx.tx, pair, impliedPair, inheritsValue)
 }
 
 // Deletes the specified implication
@@ -106,3 +161,94 @@ func (storage Storage) DeleteImplicationsByTagId(tx *Tx, tagId entities.TagId) e
 func (storage Storage) DeleteImplicationsByValueId(tx *Tx, valueId entities.ValueId) error {
 	return database.DeleteImplicationsByValueId(tx.tx, valueId)
 }
+
+// unexported
+
+// Retrieves the implications directly applying to the specified pairs. The
+// implications that inherit the implying tag's value are resolved for each pair's
+// value, such that 'camera' inheriting to 'source' yields 'camera=canon => source=canon'.
+func (storage Storage) implicationsFor(tx *Tx, pairs entities.TagIdValueIdPairs) (entities.Implications, error) {
+	implications, err := database.ImplicationsFor(tx.tx, pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(entities.Implications, 0, len(implications))
+	for _, implication := range implications {
+		if !implication.InheritsValue {
+			resolved = append(resolved, implication)
+			continue
+		}
+
+		inherited := false
+		for _, pair := range pairs {
+			if pair.TagId != implication.ImplyingTag.Id || pair.ValueId == 0 {
+				continue
+			}
+
+			value, err := database.Value(tx.tx, pair.ValueId)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, fmt.Errorf("no such value #%v", pair.ValueId)
+			}
+
+			resolvedImplication := *implication
+			resolvedImplication.ImplyingValue = *value
+			resolvedImplication.ImpliedValue = *value
+			resolved = append(resolved, &resolvedImplication)
+			inherited = true
+		}
+
+		if !inherited {
+			resolved = append(resolved, implication)
+		}
+	}
+
+	return resolved, nil
+}
+
+func (storage Storage) tagValueNames(tx *Tx, pairs ...entities.TagIdValueIdPair) ([]string, error) {
+	names := make([]string, 0, len(pairs)+10)
+
+	for _, pair := range pairs {
+		tag, err := storage.Tag(tx, pair.TagId)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			return nil, fmt.Errorf("no such tag #%v", pair.TagId)
+		}
+
+		valueName := ""
+		if pair.ValueId != 0 {
+			value, err := storage.Value(tx, pair.ValueId)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, fmt.Errorf("no such value #%v", pair.ValueId)
+			}
+
+			valueName = value.Name
+		}
+
+		names = append(names, formatTagValueName(tag.Name, valueName))
+	}
+
+	return names, nil
+}
+
+// Determines whether the implications of targetPair apply to files tagged with pair.
+func impliesPair(pair, targetPair entities.TagIdValueIdPair) bool {
+	return pair.TagId == targetPair.TagId && (targetPair.ValueId == 0 || pair.ValueId == targetPair.ValueId)
+}
+
+func formatTagValueName(tagName, valueName string) string {
+	if valueName == "" {
+		return tagName
+	}
+
+	return tagName + "=" + valueName
+}
@@ -0,0 +1,63 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// The problems reported by SQLite's consistency check of the database file.
+func (storage *Storage) IntegrityProblems(tx *Tx) ([]string, error) {
+	return database.IntegrityProblems(tx.tx)
+}
+
+// The number of file-tags referring to a file, tag or value that does not exist.
+func (storage *Storage) OrphanedFileTagCount(tx *Tx) (uint, error) {
+	return database.OrphanedFileTagCount(tx.tx)
+}
+
+// Removes the file-tags referring to a file, tag or value that does not exist,
+// returning the number removed.
+func (storage *Storage) DeleteOrphanedFileTags(tx *Tx) (uint, error) {
+	return database.DeleteOrphanedFileTags(tx.tx)
+}
+
+// The number of file-tags repeating the file, tag and value of another.
+func (storage *Storage) DuplicateFileTagCount(tx *Tx) (uint, error) {
+	return database.DuplicateFileTagCount(tx.tx)
+}
+
+// Removes the file-tags repeating the file, tag and value of another, keeping
+// one of each, returning the number removed.
+func (storage *Storage) DeleteDuplicateFileTags(tx *Tx) (uint, error) {
+	return database.DeleteDuplicateFileTags(tx.tx)
+}
+
+// The number of implications referring to a tag or value that does not exist.
+func (storage *Storage) BrokenImplicationCount(tx *Tx) (uint, error) {
+	return database.BrokenImplicationCount(tx.tx)
+}
+
+// Removes the implications referring to a tag or value that does not exist,
+// returning the number removed.
+func (storage *Storage) DeleteBrokenImplications(tx *Tx) (uint, error) {
+	return database.DeleteBrokenImplications(tx.tx)
+}
+
+// The number of fingerprints shared by files of differing sizes.
+func (storage *Storage) MismatchedFingerprintCount(tx *Tx) (uint, error) {
+	return database.MismatchedFingerprintCount(tx.tx)
+}
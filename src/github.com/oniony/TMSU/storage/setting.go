@@ -22,10 +22,15 @@ import (
 )
 
 var defaultSettings = entities.Settings{
+	&entities.Setting{"auditLog", "no"},
 	&entities.Setting{"autoCreateTags", "yes"},
 	&entities.Setting{"autoCreateValues", "yes"},
+	&entities.Setting{"caseSensitive", "yes"},
 	&entities.Setting{"directoryFingerprintAlgorithm", "none"},
 	&entities.Setting{"fileFingerprintAlgorithm", "dynamic:SHA256"},
+	&entities.Setting{"journalMode", "wal"},
+	&entities.Setting{"metadataTags", "Keywords,DateTimeOriginal:date,Model:camera"},
+	&entities.Setting{"postTagHook", "none"},
 	&entities.Setting{"reportDuplicates", "yes"},
 	&entities.Setting{"symlinkFingerprintAlgorithm", "follow"}}
 
@@ -64,3 +69,30 @@ func (storage *Storage) Setting(tx *Tx, name string) (*entities.Setting, error)
 func (storage *Storage) UpdateSetting(tx *Tx, name, value string) (*entities.Setting, error) {
 	return database.UpdateSetting(tx.tx, name, value)
 }
+
+// Removes a setting from the database, reverting it to its default.
+func (storage *Storage) DeleteSetting(tx *Tx, name string) error {
+	return database.DeleteSetting(tx.tx, name)
+}
+
+// Validates the name of an SQLite journal mode.
+func ValidateJournalMode(mode string) error {
+	return database.ValidateJournalMode(mode)
+}
+
+// unexported
+
+// Determines whether tag names should be matched case-insensitively, either
+// because this was requested or because the database is not case-sensitive.
+func (storage Storage) ignoreTagCase(tx *Tx, ignoreCase bool) (bool, error) {
+	if ignoreCase {
+		return true, nil
+	}
+
+	setting, err := storage.Setting(tx, "caseSensitive")
+	if err != nil {
+		return false, err
+	}
+
+	return !entities.Settings{setting}.CaseSensitive(), nil
+}
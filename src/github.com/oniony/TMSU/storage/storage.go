@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/storage/database"
+	"os"
 	"path/filepath"
 )
 
@@ -28,10 +29,31 @@ type Storage struct {
 	RootPath string
 }
 
+// Creates a new database at the path, creating any missing parent directories.
 func CreateAt(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create directory for database '%v': %v", path, err)
+	}
+
 	return database.CreateAt(path)
 }
 
+// Opens the database at the path, first creating it if it does not exist.
+// Whether the database was created is also returned.
+func OpenOrCreateAt(path string) (*Storage, bool, error) {
+	created := false
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := CreateAt(path); err != nil {
+			return nil, false, err
+		}
+
+		created = true
+	}
+
+	storage, err := OpenAt(path)
+	return storage, created, err
+}
+
 func OpenAt(path string) (*Storage, error) {
 	db, err := database.OpenAt(path)
 	if err != nil {
@@ -43,7 +65,32 @@ func OpenAt(path string) (*Storage, error) {
 		return nil, err
 	}
 
-	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+	log.Infof("files are stored relative to root path '%v'", rootPath)
+
+	storage := &Storage{db, path, rootPath}
+
+	if err := storage.applyJournalMode(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// Opens the database at the path such that it cannot be modified.
+func OpenReadOnlyAt(path string) (*Storage, error) {
+	db, err := database.OpenReadOnlyAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPath, err := determineRootPath(path)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Infof("files are stored relative to root path '%v'", rootPath)
 
 	return &Storage{db, path, rootPath}, nil
 }
@@ -54,7 +101,19 @@ func (storage *Storage) Begin() (*Tx, error) {
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	return &Tx{tx: tx}, nil
+}
+
+// Begins a transaction on the read-only connection. Read-only transactions do
+// not prevent other processes from writing to the database when the database
+// is in WAL journal mode.
+func (storage *Storage) BeginRead() (*Tx, error) {
+	tx, err := storage.db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx: tx}, nil
 }
 
 func (storage *Storage) Close() error {
@@ -72,8 +131,19 @@ func (storage *Storage) Close() error {
 	return nil
 }
 
+// Reclaims unused space within the database file and refreshes the query
+// planner statistics.
+func (storage *Storage) Vacuum() error {
+	if err := storage.db.Vacuum(); err != nil {
+		return fmt.Errorf("could not vacuum database: %v", err)
+	}
+
+	return nil
+}
+
 type Tx struct {
-	tx *database.Tx
+	tx       *database.Tx
+	auditing *bool // whether operations are audited, once determined
 }
 
 func (tx *Tx) Commit() error {
@@ -84,8 +154,49 @@ func (tx *Tx) Rollback() error {
 	return tx.tx.Rollback()
 }
 
+func (tx *Tx) Savepoint(name string) error {
+	return tx.tx.Savepoint(name)
+}
+
+func (tx *Tx) RollbackToSavepoint(name string) error {
+	return tx.tx.RollbackToSavepoint(name)
+}
+
+func (tx *Tx) ReleaseSavepoint(name string) error {
+	return tx.tx.ReleaseSavepoint(name)
+}
+
 // unexported
 
+// Switches the database to the journal mode configured by the 'journalMode'
+// setting. Where the journal mode cannot be changed, e.g. because WAL is not
+// supported on network filesystems or another process has the database open,
+// the database continues in its current journal mode.
+func (storage *Storage) applyJournalMode() error {
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+
+	setting, err := storage.Setting(tx, "journalMode")
+	tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not retrieve setting 'journalMode': %v", err)
+	}
+
+	mode, err := storage.db.SetJournalMode(setting.Value)
+	switch {
+	case err != nil:
+		log.Infof("could not change journal mode to '%v': %v", setting.Value, err)
+	case mode != setting.Value:
+		log.Infof("could not change journal mode to '%v': database is using '%v'", setting.Value, mode)
+	default:
+		log.Infof("using journal mode '%v'", mode)
+	}
+
+	return nil
+}
+
 func determineRootPath(dbPath string) (string, error) {
 	absDbPath, err := filepath.Abs(dbPath)
 	if err != nil {
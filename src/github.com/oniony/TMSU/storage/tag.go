@@ -16,6 +16,7 @@
 package storage
 
 import (
+	"fmt"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage/database"
 )
@@ -47,7 +48,25 @@ func (storage Storage) TagByName(tx *Tx, name string) (*entities.Tag, error) {
 
 // Retrieves a specific tag with specified case-sensitivity.
 func (storage Storage) TagByCasedName(tx *Tx, name string, ignoreCase bool) (*entities.Tag, error) {
-	return database.TagByName(tx.tx, name, ignoreCase)
+	ignoreCase, err := storage.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := database.TagByName(tx.tx, name, ignoreCase)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+
+	tagNames, err := storage.aliasedTagNames(tx, []string{name}, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if tagName, ok := tagNames[name]; ok {
+		return database.TagByName(tx.tx, tagName, false)
+	}
+
+	return nil, nil
 }
 
 // Retrieves the set of named tags.
@@ -57,15 +76,60 @@ func (storage Storage) TagsByNames(tx *Tx, names []string) (entities.Tags, error
 
 // Retrieves the set of named tags.
 func (storage Storage) TagsByCasedNames(tx *Tx, names []string, ignoreCase bool) (entities.Tags, error) {
+	ignoreCase, err := storage.ignoreTagCase(tx, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames, err := storage.aliasedTagNames(tx, names, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if len(tagNames) > 0 {
+		resolvedNames := make([]string, len(names))
+		for index, name := range names {
+			if tagName, ok := tagNames[name]; ok {
+				resolvedNames[index] = tagName
+			} else {
+				resolvedNames[index] = name
+			}
+		}
+
+		names = resolvedNames
+	}
+
 	return database.TagsByNames(tx.tx, names, ignoreCase)
 }
 
+// Retrieves the set of tags whose names start with the specified prefix.
+func (storage Storage) TagsByNamePrefix(tx *Tx, prefix string) (entities.Tags, error) {
+	return database.TagsByNamePrefix(tx.tx, prefix)
+}
+
 // Adds a tag.
 func (storage *Storage) AddTag(tx *Tx, name string) (*entities.Tag, error) {
 	if err := entities.ValidateTagName(name); err != nil {
 		return nil, err
 	}
 
+	ignoreCase, err := storage.ignoreTagCase(tx, false)
+	if err != nil {
+		return nil, err
+	}
+	if ignoreCase {
+		existing, err := database.TagByName(tx.tx, name, true)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("tag '%v' already exists as '%v'", name, existing.Name)
+		}
+	}
+
+	if err := storage.checkNotAlias(tx, name); err != nil {
+		return nil, err
+	}
+
 	return database.InsertTag(tx.tx, name)
 }
 
@@ -75,6 +139,10 @@ func (storage Storage) RenameTag(tx *Tx, tagId entities.TagId, name string) (*en
 		return nil, err
 	}
 
+	if err := storage.checkNotAlias(tx, name); err != nil {
+		return nil, err
+	}
+
 	return database.RenameTag(tx.tx, tagId, name)
 }
 
@@ -84,6 +152,10 @@ func (storage Storage) CopyTag(tx *Tx, sourceTagId entities.TagId, name string)
 		return nil, err
 	}
 
+	if err := storage.checkNotAlias(tx, name); err != nil {
+		return nil, err
+	}
+
 	tag, err := database.InsertTag(tx.tx, name)
 	if err != nil {
 		return nil, err
@@ -99,6 +171,16 @@ func (storage Storage) CopyTag(tx *Tx, sourceTagId entities.TagId, name string)
 
 // Deletes a tag.
 func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
+	tag, err := storage.Tag(tx, tagId)
+	if err != nil {
+		return err
+	}
+	if tag != nil {
+		if err := storage.Audit(tx, entities.AuditEntry{Operation: "delete", Tag: tag.Name}); err != nil {
+			return err
+		}
+	}
+
 	if err := storage.DeleteFileTagsByTagId(tx, tagId); err != nil {
 		return err
 	}
@@ -107,6 +189,18 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 		return err
 	}
 
+	if err := storage.DeleteValueConstraint(tx, tagId); err != nil {
+		return err
+	}
+
+	if err := storage.DeleteAliasesByTagId(tx, tagId); err != nil {
+		return err
+	}
+
+	if err := storage.DeleteTagMetaByTagId(tx, tagId); err != nil {
+		return err
+	}
+
 	if err := database.DeleteTag(tx.tx, tagId); err != nil {
 		return err
 	}
@@ -118,3 +212,58 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 func (storage Storage) TagUsage(tx *Tx) ([]entities.TagFileCount, error) {
 	return database.TagUsage(tx.tx)
 }
+
+// Retrieves when each tag was last applied to a file.
+func (storage Storage) TagLastUsedTimes(tx *Tx) ([]entities.TagLastUsed, error) {
+	return database.TagLastUsedTimes(tx.tx)
+}
+
+// Retrieves the tags that most frequently accompany the tags of the specified
+// file, excluding those the file already has either explicitly or by
+// implication. The most frequent tags are first.
+func (storage Storage) CooccurringTags(tx *Tx, fileId entities.FileId) ([]entities.TagFileCount, error) {
+	tagFileCounts, err := database.CooccurringTags(tx.tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	fileTags, err := storage.FileTagsByFileId(tx, fileId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]entities.TagFileCount, 0, len(tagFileCounts))
+	for _, tagFileCount := range tagFileCounts {
+		tagId := tagFileCount.Id
+		applied := fileTags.Any(func(fileTag entities.FileTag) bool {
+			return fileTag.TagId == tagId
+		})
+
+		if !applied {
+			suggestions = append(suggestions, tagFileCount)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// Retrieves the description of each tag.
+func (storage Storage) TagDescriptions(tx *Tx) ([]entities.TagDescription, error) {
+	return database.TagDescriptions(tx.tx)
+}
+
+// Sets the description of a tag. An empty description removes it.
+func (storage Storage) DescribeTag(tx *Tx, tagId entities.TagId, description string) error {
+	return database.UpdateTagDescription(tx.tx, tagId, description)
+}
+
+// Retrieves the tags applied with a value, if withValues is set, and without a
+// value, if withoutValues is set, to at least one file.
+func (storage Storage) TagsByValueUsage(tx *Tx, withValues, withoutValues bool) (entities.Tags, error) {
+	return database.TagsByValueUsage(tx.tx, withValues, withoutValues)
+}
+
+// Retrieves the number of files tagged with each tag.
+func (storage Storage) TagFileCounts(tx *Tx, sort string) ([]entities.TagFileCount, error) {
+	return database.TagFileCounts(tx.tx, sort)
+}
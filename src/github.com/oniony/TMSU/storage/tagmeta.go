@@ -0,0 +1,46 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the metadata recorded against the specified tag, in order of key.
+func (storage *Storage) TagMetaByTagId(tx *Tx, tagId entities.TagId) (entities.TagMetas, error) {
+	return database.TagMetaByTagId(tx.tx, tagId)
+}
+
+// Sets an item of metadata for the specified tag. An empty value removes it.
+func (storage *Storage) SetTagMeta(tx *Tx, tagId entities.TagId, key, value string) error {
+	if key == "" {
+		return fmt.Errorf("tag metadata key cannot be empty")
+	}
+
+	if value == "" {
+		return database.DeleteTagMeta(tx.tx, tagId, key)
+	}
+
+	_, err := database.UpdateTagMeta(tx.tx, tagId, key, value)
+	return err
+}
+
+// Removes the metadata recorded against the specified tag.
+func (storage *Storage) DeleteTagMetaByTagId(tx *Tx, tagId entities.TagId) error {
+	return database.DeleteTagMetaByTagId(tx.tx, tagId)
+}
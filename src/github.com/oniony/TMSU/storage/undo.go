@@ -0,0 +1,100 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the operation that may be undone, if any.
+func (storage *Storage) UndoOperation(tx *Tx) (*entities.UndoOperation, error) {
+	return database.UndoOperation(tx.tx)
+}
+
+// Starts recording a new operation that may be undone, forgetting the previous
+// one. The tags, values and files the operation changes are then recorded,
+// before being changed, with SaveUndoTag, SaveUndoValue and SaveUndoFile.
+func (storage *Storage) BeginUndo(tx *Tx, description string) error {
+	if err := database.DeleteUndo(tx.tx); err != nil {
+		return err
+	}
+
+	return database.InsertUndoOperation(tx.tx, description)
+}
+
+// Records the tag, with its taggings, implications, value constraint, aliases
+// and metadata, so that changes to them may be undone.
+func (storage *Storage) SaveUndoTag(tx *Tx, tagId entities.TagId) error {
+	return database.SaveUndoTag(tx.tx, tagId)
+}
+
+// Records the value, with its taggings and implications, so that changes to them
+// may be undone.
+func (storage *Storage) SaveUndoValue(tx *Tx, valueId entities.ValueId) error {
+	return database.SaveUndoValue(tx.tx, valueId)
+}
+
+// Records the file, with its taggings, so that changes to them may be undone.
+func (storage *Storage) SaveUndoFile(tx *Tx, fileId entities.FileId) error {
+	return database.SaveUndoFile(tx.tx, fileId)
+}
+
+// Undoes the recorded operation, restoring what was recorded, and then forgets
+// it. Nothing is restored should a recorded tag, value or file have since been
+// recreated.
+func (storage *Storage) Undo(tx *Tx) (*entities.UndoOperation, error) {
+	operation, err := database.UndoOperation(tx.tx)
+	if err != nil || operation == nil {
+		return nil, err
+	}
+
+	tagName, err := database.UndoTagConflict(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+	if tagName != "" {
+		return nil, fmt.Errorf("tag '%v' has since been recreated", tagName)
+	}
+
+	valueName, err := database.UndoValueConflict(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+	if valueName != "" {
+		return nil, fmt.Errorf("value '%v' has since been recreated", valueName)
+	}
+
+	file, err := database.UndoFileConflict(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		storage.absPath(file)
+		return nil, fmt.Errorf("file '%v' has since been added again", file.Path())
+	}
+
+	if err := database.RestoreUndo(tx.tx); err != nil {
+		return nil, err
+	}
+
+	if err := database.DeleteUndo(tx.tx); err != nil {
+		return nil, err
+	}
+
+	return operation, nil
+}
@@ -74,6 +74,22 @@ func (storage *Storage) ValuesByTag(tx *Tx, tagId entities.TagId) (entities.Valu
 	return database.ValuesByTagId(tx.tx, tagId)
 }
 
+// Retrieves the set of values whose names start with the specified prefix.
+func (storage *Storage) ValuesByNamePrefix(tx *Tx, prefix string) (entities.Values, error) {
+	return database.ValuesByNamePrefix(tx.tx, prefix)
+}
+
+// Retrieves the set of values for the specified tag whose names start with
+// the specified prefix.
+func (storage *Storage) ValuesByTagAndNamePrefix(tx *Tx, tagId entities.TagId, prefix string) (entities.Values, error) {
+	return database.ValuesByTagIdAndNamePrefix(tx.tx, tagId, prefix)
+}
+
+// Retrieves the number of files tagged with each value of the specified tag.
+func (storage *Storage) ValueFileCountsByTag(tx *Tx, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	return database.ValueFileCountsByTagId(tx.tx, tagId)
+}
+
 // Adds a value.
 func (storage *Storage) AddValue(tx *Tx, name string) (*entities.Value, error) {
 	if err := entities.ValidateValueName(name); err != nil {
@@ -94,6 +110,16 @@ func (storage *Storage) RenameValue(tx *Tx, valueId entities.ValueId, newName st
 
 // Deletes a value.
 func (storage *Storage) DeleteValue(tx *Tx, valueId entities.ValueId) error {
+	value, err := storage.Value(tx, valueId)
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		if err := storage.Audit(tx, entities.AuditEntry{Operation: "delete", Value: value.Name}); err != nil {
+			return err
+		}
+	}
+
 	if err := storage.DeleteFileTagsByValueId(tx, valueId); err != nil {
 		return err
 	}
@@ -0,0 +1,69 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// The complete set of value constraints.
+func (storage *Storage) ValueConstraints(tx *Tx) (entities.ValueConstraints, error) {
+	return database.ValueConstraints(tx.tx)
+}
+
+// Retrieves the value constraint for the specified tag, or nil if the tag's
+// values are unconstrained.
+func (storage *Storage) ValueConstraintByTagId(tx *Tx, tagId entities.TagId) (*entities.ValueConstraint, error) {
+	return database.ValueConstraintByTagId(tx.tx, tagId)
+}
+
+// Checks the value against the tag's value constraint, if it has one. Tagging
+// without a value is always permitted.
+func (storage *Storage) ValidateValue(tx *Tx, tag *entities.Tag, valueName string) error {
+	if valueName == "" {
+		return nil
+	}
+
+	constraint, err := storage.ValueConstraintByTagId(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value constraint for tag '%v': %v", tag.Name, err)
+	}
+	if constraint == nil {
+		return nil
+	}
+
+	if err := constraint.Validate(valueName); err != nil {
+		return fmt.Errorf("invalid value '%v' for tag '%v': %v", valueName, tag.Name, err)
+	}
+
+	return nil
+}
+
+// Sets the value constraint for the specified tag.
+func (storage *Storage) UpdateValueConstraint(tx *Tx, tagId entities.TagId, constraintType string) (*entities.ValueConstraint, error) {
+	if err := entities.ValidateConstraintType(constraintType); err != nil {
+		return nil, err
+	}
+
+	return database.UpdateValueConstraint(tx.tx, tagId, constraintType)
+}
+
+// Removes the value constraint for the specified tag.
+func (storage *Storage) DeleteValueConstraint(tx *Tx, tagId entities.TagId) error {
+	return database.DeleteValueConstraint(tx.tx, tagId)
+}
@@ -0,0 +1,332 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A set of operations made within a single transaction, such that they take
+// effect together when the batch is committed or not at all.
+type Batch struct {
+	storage  *storage.Storage
+	tx       *storage.Tx
+	settings entities.Settings
+}
+
+// How AddFile treats the file at the path.
+type AddOptions struct {
+	FollowSymlinks bool           // add the file a symbolic link refers to rather than the link
+	AllowMissing   bool           // add the file even if it does not exist
+	Force          bool           // add the file even if it does not exist or cannot be accessed
+	Fingerprinter  *Fingerprinter // creates the fingerprint, if not nil
+}
+
+// A file tracked by the database, as retrieved or added by AddFile.
+type AddedFile struct {
+	*entities.File
+	Stat      os.FileInfo // the file's details, or nil if it could not be accessed
+	New       bool        // whether the file was added
+	Duplicate bool        // whether a file with the same fingerprint was already tracked
+}
+
+// Begins a batch of operations.
+func (store *Store) Begin() (*Batch, error) {
+	tx, err := store.storage.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := NewBatch(store.storage, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// Creates a batch for an existing transaction, for callers that make other
+// changes through the underlying storage in the same transaction.
+func NewBatch(store *storage.Storage, tx *storage.Tx) (*Batch, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	return &Batch{store, tx, settings}, nil
+}
+
+// Makes the batch's changes.
+func (batch *Batch) Commit() error {
+	return batch.tx.Commit()
+}
+
+// Abandons the batch's changes.
+func (batch *Batch) Rollback() error {
+	return batch.tx.Rollback()
+}
+
+// The settings of the database.
+func (batch *Batch) Settings() entities.Settings {
+	return batch.settings
+}
+
+// Resolves the path to an absolute path, that of the file it refers to if it is
+// a symbolic link and followSymlinks is specified, and retrieves the file at it,
+// which is nil if the file is not tracked.
+func (batch *Batch) ResolveFile(path string, followSymlinks bool) (string, *entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err), os.IsPermission(err):
+			// a tracked file may since have been removed
+		default:
+			return "", nil, err
+		}
+	} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	file, err := batch.storage.FileByPath(batch.tx, absPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	return absPath, file, nil
+}
+
+// Retrieves the tracked file at the path, first adding it to the database if it
+// is not tracked. The errors from accessing the file are returned unwrapped so
+// that they can be identified with os.IsNotExist and os.IsPermission.
+func (batch *Batch) AddFile(path string, options AddOptions) (*AddedFile, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		missing := os.IsNotExist(err) && (options.Force || options.AllowMissing)
+		inaccessible := os.IsPermission(err) && options.Force
+		if !missing && !inaccessible {
+			return nil, err
+		}
+
+		stat = nil
+	} else if stat.Mode()&os.ModeSymlink != 0 && options.FollowSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			// can't honour 'force' as the target path is not known
+			return nil, err
+		}
+
+		stat, err = os.Lstat(absPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := batch.storage.FileByPath(batch.tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file != nil {
+		return &AddedFile{file, stat, false, false}, nil
+	}
+
+	fp := fingerprint.Empty
+	var modTime time.Time
+	var size int64
+	var isDir bool
+
+	// an inaccessible file is left for 'repair' to fingerprint
+	if stat != nil {
+		fingerprinter := options.Fingerprinter
+		if fingerprinter == nil {
+			fingerprinter = NewFingerprinter(batch.settings, 1)
+		}
+
+		fp, err = fingerprinter.Fingerprint(absPath)
+		if err != nil && (!options.Force || !(os.IsNotExist(err) || os.IsPermission(err))) {
+			return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+		}
+
+		modTime, size, isDir = stat.ModTime(), stat.Size(), stat.IsDir()
+	}
+
+	duplicate := false
+	if fp != fingerprint.Empty && batch.settings.ReportDuplicates() {
+		count, err := batch.storage.FileCountByFingerprint(batch.tx, fp)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not identify duplicates: %v", path, err)
+		}
+
+		duplicate = count != 0
+	}
+
+	file, err = batch.storage.AddFile(batch.tx, absPath, fp, modTime, size, isDir)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not add file to database: %v", path, err)
+	}
+
+	return &AddedFile{file, stat, true, duplicate}, nil
+}
+
+// Applies the tags to the file and then runs the post-tag hook. Unless explicit
+// is specified, the tags the file already has or that the others imply are
+// skipped. Returns the tags applied. Should the hook fail, the tags remain and a
+// PostTagHookError is returned.
+func (batch *Batch) TagFile(file *entities.File, pairs entities.TagIdValueIdPairs, explicit bool) (entities.TagIdValueIdPairs, error) {
+	if !explicit {
+		var err error
+		pairs, err = batch.unappliedPairs(file, pairs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pair := range pairs {
+		if _, err := batch.storage.AddFileTag(batch.tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+			return nil, fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+		}
+	}
+
+	if err := batch.runPostTagHook(file.Path(), pairs); err != nil {
+		return pairs, err
+	}
+
+	return pairs, nil
+}
+
+// Removes the tag from the file. A storage.FileTagDoesNotExist error is
+// returned if the file does not have the tag explicitly.
+func (batch *Batch) UntagFile(file *entities.File, pair entities.TagIdValueIdPair) error {
+	return batch.storage.DeleteFileTag(batch.tx, file.Id, pair.TagId, pair.ValueId)
+}
+
+// Removes all of the file's tags.
+func (batch *Batch) UntagFileAll(file *entities.File) error {
+	return batch.storage.DeleteFileTagsByFileId(batch.tx, file.Id)
+}
+
+// Retrieves the files matching the query expression, beneath the path if it is
+// not empty, in the order specified, e.g. 'path', 'size' or 'none'. A limit of
+// zero imposes no limit.
+func (batch *Batch) Files(expression query.Expression, path string, explicitOnly, ignoreCase bool, sort string, reverse bool, limit, offset uint) (entities.Files, error) {
+	files, err := batch.storage.FilesForQuery(batch.tx, expression, path, explicitOnly, ignoreCase, sort, reverse, limit, offset)
+	if err != nil {
+		if strings.Index(err.Error(), "parser stack overflow") > -1 {
+			return nil, fmt.Errorf("the query is too complex (see the troubleshooting wiki for how to increase the stack size)")
+		}
+
+		return nil, fmt.Errorf("could not query files: %v", err)
+	}
+
+	return files, nil
+}
+
+// unexported
+
+func (batch *Batch) unappliedPairs(file *entities.File, pairs entities.TagIdValueIdPairs) (entities.TagIdValueIdPairs, error) {
+	existingFileTags, err := batch.storage.FileTagsByFileId(batch.tx, file.Id, false)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
+	}
+
+	newImplications, err := batch.storage.ImplicationsFor(batch.tx, pairs...)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
+	}
+
+	revisedPairs := make(entities.TagIdValueIdPairs, 0, len(pairs))
+	for _, pair := range pairs {
+		predicate := func(ft entities.FileTag) bool {
+			return ft.TagId == pair.TagId && ft.ValueId == pair.ValueId
+		}
+
+		if existingFileTags.Any(predicate) {
+			continue
+		}
+
+		if newImplications.Implies(pair) {
+			continue
+		}
+
+		revisedPairs = append(revisedPairs, pair)
+	}
+
+	return revisedPairs, nil
+}
+
+// Runs the executable configured by the 'postTagHook' setting, if any, for a
+// newly tagged file. The file's path and the tags applied are passed both as
+// arguments and in the environment.
+func (batch *Batch) runPostTagHook(path string, pairs entities.TagIdValueIdPairs) error {
+	hook := batch.settings.PostTagHook()
+	if hook == "" || hook == "none" || len(pairs) == 0 {
+		return nil
+	}
+
+	tagArgs := make([]string, len(pairs))
+	for index, pair := range pairs {
+		tag, err := batch.storage.Tag(batch.tx, pair.TagId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag #%v: %v", pair.TagId, err)
+		}
+
+		valueName := ""
+		if pair.ValueId != 0 {
+			value, err := batch.storage.Value(batch.tx, pair.ValueId)
+			if err != nil {
+				return fmt.Errorf("could not retrieve value #%v: %v", pair.ValueId, err)
+			}
+
+			valueName = value.Name
+		}
+
+		tagArgs[index] = TagValue{tag.Name, valueName}.String()
+	}
+
+	command := exec.Command(hook, append([]string{path}, tagArgs...)...)
+	command.Env = append(os.Environ(), "TMSU_FILE="+path, "TMSU_TAGS="+strings.Join(tagArgs, " "))
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	if err := command.Run(); err != nil {
+		return PostTagHookError{path, hook, err}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tmsu
+
+import (
+	"fmt"
+)
+
+type NoSuchTagError struct {
+	Name string
+}
+
+func (err NoSuchTagError) Error() string {
+	return fmt.Sprintf("no such tag '%v'", err.Name)
+}
+
+type NoSuchValueError struct {
+	Name string
+}
+
+func (err NoSuchValueError) Error() string {
+	return fmt.Sprintf("no such value '%v'", err.Name)
+}
+
+// Returned when the file at the path is not tracked by the database.
+type NoSuchFileError struct {
+	Path string
+}
+
+func (err NoSuchFileError) Error() string {
+	return fmt.Sprintf("%v: file is not tagged", err.Path)
+}
+
+// Returned when the post-tag hook fails, which it does after the tags are
+// applied.
+type PostTagHookError struct {
+	Path string
+	Hook string
+	Err  error
+}
+
+func (err PostTagHookError) Error() string {
+	return fmt.Sprintf("%v: post-tag hook '%v' failed: %v", err.Path, err.Hook, err.Err)
+}
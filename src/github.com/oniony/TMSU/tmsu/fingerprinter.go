@@ -0,0 +1,119 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tmsu
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"os"
+	"sync"
+)
+
+// Creates fingerprints using the algorithms configured for a database, either
+// on demand or ahead of time using several threads.
+type Fingerprinter struct {
+	Throttle *_path.Throttle // limits the rate at which files are read, if not nil
+
+	fileAlgorithm      string
+	directoryAlgorithm string
+	symlinkAlgorithm   string
+	threads            int
+	results            map[string]fingerprintResult
+}
+
+// Creates a fingerprinter for the database settings that prefetches using up
+// to the number of threads specified.
+func NewFingerprinter(settings entities.Settings, threads int) *Fingerprinter {
+	return &Fingerprinter{nil,
+		settings.FileFingerprintAlgorithm(),
+		settings.DirectoryFingerprintAlgorithm(),
+		settings.SymlinkFingerprintAlgorithm(),
+		threads,
+		make(map[string]fingerprintResult)}
+}
+
+// The number of threads with which fingerprints are prefetched.
+func (fingerprinter *Fingerprinter) Threads() int {
+	return fingerprinter.threads
+}
+
+// Computes the fingerprints of the specified paths using a pool of worker
+// goroutines. The results are retained until retrieved with Fingerprint.
+func (fingerprinter *Fingerprinter) Prefetch(paths []string) {
+	if len(paths) < 2 || fingerprinter.threads < 2 {
+		return
+	}
+
+	results := make([]fingerprintResult, len(paths))
+	indices := make(chan int)
+
+	var waitGroup sync.WaitGroup
+	for thread := 0; thread < fingerprinter.threads && thread < len(paths); thread++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for index := range indices {
+				fp, err := fingerprinter.create(paths[index])
+				results[index] = fingerprintResult{fp, err}
+			}
+		}()
+	}
+
+	for index := range paths {
+		indices <- index
+	}
+	close(indices)
+
+	waitGroup.Wait()
+
+	for index, path := range paths {
+		fingerprinter.results[path] = results[index]
+	}
+}
+
+// Retrieves the fingerprint for the specified path, computing it now if it was
+// not prefetched.
+func (fingerprinter *Fingerprinter) Fingerprint(path string) (fingerprint.Fingerprint, error) {
+	if result, ok := fingerprinter.results[path]; ok {
+		delete(fingerprinter.results, path)
+		return result.fingerprint, result.err
+	}
+
+	return fingerprinter.create(path)
+}
+
+// unexported
+
+type fingerprintResult struct {
+	fingerprint fingerprint.Fingerprint
+	err         error
+}
+
+func (fingerprinter *Fingerprinter) create(path string) (fingerprint.Fingerprint, error) {
+	if fingerprinter.Throttle != nil {
+		var size int64
+		if stat, err := os.Stat(path); err == nil && stat.Mode().IsRegular() {
+			size = stat.Size()
+		}
+
+		fingerprinter.Throttle.Examined(size)
+	}
+
+	return fingerprint.Create(path, fingerprinter.fileAlgorithm, fingerprinter.directoryAlgorithm, fingerprinter.symlinkAlgorithm)
+}
@@ -0,0 +1,333 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package tmsu provides the core operations of TMSU, tagging and untagging
+// files and querying them by their tags, for programs that embed the tagging
+// engine rather than run the 'tmsu' command. Each of the Store's operations runs
+// in its own transaction, whereas those of a Batch share one. Problems are
+// reported as errors rather than written to the terminal. For anything not
+// offered here the underlying storage is available.
+package tmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"sort"
+	"time"
+)
+
+// A TMSU database.
+type Store struct {
+	storage *storage.Storage
+}
+
+// A tag, with a value if Value is not empty.
+type TagValue struct {
+	Tag   string
+	Value string
+}
+
+// Formats the tag and value in the form used in queries, e.g. 'year=2017'.
+func (tagValue TagValue) String() string {
+	tagName := text.Escape(tagValue.Tag, '=', ' ')
+	if tagValue.Value == "" {
+		return tagName
+	}
+
+	return tagName + "=" + text.Escape(tagValue.Value, '=', ' ')
+}
+
+// A tracked file.
+type File struct {
+	Path        string
+	Fingerprint string
+	ModTime     time.Time
+	Size        int64
+	IsDir       bool
+}
+
+// Creates a new database at the path.
+func Create(path string) error {
+	return storage.CreateAt(path)
+}
+
+// Opens the database at the path.
+func Open(path string) (*Store, error) {
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{store}, nil
+}
+
+// Opens the database at the path such that it cannot be modified.
+func OpenReadOnly(path string) (*Store, error) {
+	store, err := storage.OpenReadOnlyAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{store}, nil
+}
+
+// Closes the database.
+func (store *Store) Close() error {
+	return store.storage.Close()
+}
+
+// The underlying storage, for operations this package does not offer.
+func (store *Store) Storage() *storage.Storage {
+	return store.storage
+}
+
+// Applies the tags to the file at the path, adding the file to the database if
+// it is not already tracked. A symbolic link is replaced by the file it refers
+// to. Tags and values that do not exist are created if the database's settings
+// allow it. Should the post-tag hook fail the tags are applied regardless and a
+// PostTagHookError is returned.
+func (store *Store) Tag(path string, tagValues ...TagValue) error {
+	var hookErr error
+
+	err := store.inBatch(func(batch *Batch) error {
+		pairs, err := store.pairs(batch, tagValues, true)
+		if err != nil {
+			return err
+		}
+
+		file, err := batch.AddFile(path, AddOptions{FollowSymlinks: true})
+		if err != nil {
+			return err
+		}
+
+		if _, err := batch.TagFile(file.File, pairs, false); err != nil {
+			if _, ok := err.(PostTagHookError); !ok {
+				return err
+			}
+
+			hookErr = err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return hookErr
+}
+
+// Removes the tags from the file at the path.
+func (store *Store) Untag(path string, tagValues ...TagValue) error {
+	return store.inBatch(func(batch *Batch) error {
+		file, err := store.file(batch, path)
+		if err != nil {
+			return err
+		}
+
+		pairs, err := store.pairs(batch, tagValues, false)
+		if err != nil {
+			return err
+		}
+
+		// the file is no longer tracked once its last tag is removed
+		for _, pair := range pairs {
+			if err := batch.UntagFile(file, pair); err != nil {
+				return fmt.Errorf("%v: could not remove tags: %v", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Retrieves the tags applied to the file at the path, sorted by name. The tags
+// implied by those applied are included unless explicitOnly is specified.
+func (store *Store) Tags(path string, explicitOnly bool) ([]TagValue, error) {
+	var tagValues []TagValue
+
+	err := store.inBatch(func(batch *Batch) error {
+		file, err := store.file(batch, path)
+		if err != nil {
+			return err
+		}
+
+		tx := batch.tx
+
+		fileTags, err := store.storage.FileTagsByFileId(tx, file.Id, explicitOnly)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve tags: %v", path, err)
+		}
+
+		tags, err := store.storage.TagsByIds(tx, fileTags.TagIds())
+		if err != nil {
+			return fmt.Errorf("could not retrieve tags: %v", err)
+		}
+
+		values, err := store.storage.ValuesByIds(tx, fileTags.ValueIds())
+		if err != nil {
+			return fmt.Errorf("could not retrieve values: %v", err)
+		}
+
+		tagNames := make(map[entities.TagId]string, len(tags))
+		for _, tag := range tags {
+			tagNames[tag.Id] = tag.Name
+		}
+
+		valueNames := make(map[entities.ValueId]string, len(values))
+		for _, value := range values {
+			valueNames[value.Id] = value.Name
+		}
+
+		// a tag may be both applied and implied
+		seen := make(map[entities.TagIdValueIdPair]bool, len(fileTags))
+
+		tagValues = make([]TagValue, 0, len(fileTags))
+		for _, fileTag := range fileTags {
+			pair := fileTag.ToTagIdValueIdPair()
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+
+			tagValues = append(tagValues, TagValue{tagNames[fileTag.TagId], valueNames[fileTag.ValueId]})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tagValues, func(i, j int) bool {
+		if tagValues[i].Tag != tagValues[j].Tag {
+			return tagValues[i].Tag < tagValues[j].Tag
+		}
+
+		return tagValues[i].Value < tagValues[j].Value
+	})
+
+	return tagValues, nil
+}
+
+// Retrieves the files, sorted by path, that match the query, which takes the
+// same form as for the 'files' command, e.g. 'music and not mp3'.
+func (store *Store) Files(queryText string) ([]File, error) {
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query: %v", err)
+	}
+
+	var files []File
+
+	err = store.inBatch(func(batch *Batch) error {
+		matches, err := batch.Files(expression, "", false, false, "path", false, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		files = make([]File, len(matches))
+		for index, match := range matches {
+			files[index] = File{match.Path(), string(match.Fingerprint), match.ModTime, match.Size, match.IsDir}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// unexported
+
+func (store *Store) inBatch(operation func(batch *Batch) error) error {
+	batch, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := operation(batch); err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	return batch.Commit()
+}
+
+// Resolves the tags and values to their identifiers, creating them where
+// permitted if create is specified.
+func (store *Store) pairs(batch *Batch, tagValues []TagValue, create bool) (entities.TagIdValueIdPairs, error) {
+	tx, settings := batch.tx, batch.settings
+
+	pairs := make(entities.TagIdValueIdPairs, 0, len(tagValues))
+
+	for _, tagValue := range tagValues {
+		tag, err := store.storage.TagByName(tx, tagValue.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			if !create || !settings.AutoCreateTags() {
+				return nil, NoSuchTagError{tagValue.Tag}
+			}
+
+			if tag, err = store.storage.AddTag(tx, tagValue.Tag); err != nil {
+				return nil, err
+			}
+		}
+
+		if create {
+			if err := store.storage.ValidateValue(tx, tag, tagValue.Value); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := store.storage.ValueByName(tx, tagValue.Value)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			if !create || !settings.AutoCreateValues() {
+				return nil, NoSuchValueError{tagValue.Value}
+			}
+
+			if value, err = store.storage.AddValue(tx, tagValue.Value); err != nil {
+				return nil, err
+			}
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{TagId: tag.Id, ValueId: value.Id})
+	}
+
+	return pairs, nil
+}
+
+// Retrieves the tracked file at the path.
+func (store *Store) file(batch *Batch, path string) (*entities.File, error) {
+	_, file, err := batch.ResolveFile(path, true)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, NoSuchFileError{path}
+	}
+
+	return file, nil
+}
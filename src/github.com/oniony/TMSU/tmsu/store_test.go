@@ -0,0 +1,200 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tmsu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagQueryUntag(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, ".tmsu", "db")
+	if err := Create(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := Open(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	aubergine := filepath.Join(dir, "aubergine")
+	courgette := filepath.Join(dir, "courgette")
+	for _, path := range []string{aubergine, courgette} {
+		if err := ioutil.WriteFile(path, []byte(path), 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := store.Tag(aubergine, TagValue{"vegetable", ""}, TagValue{"colour", "purple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Tag(courgette, TagValue{"vegetable", ""}); err != nil {
+		test.Fatal(err)
+	}
+
+	files, err := store.Files("vegetable and not colour=green")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != aubergine || files[1].Path != courgette {
+		test.Fatalf("Expected aubergine and courgette but were %v.", files)
+	}
+
+	tagValues, err := store.Tags(aubergine, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagValues) != 2 || tagValues[0].String() != "colour=purple" || tagValues[1].String() != "vegetable" {
+		test.Fatalf("Expected colour=purple and vegetable but were %v.", tagValues)
+	}
+
+	if err := store.Untag(courgette, TagValue{"vegetable", ""}); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.Tags(courgette, false); err == nil {
+		test.Fatal("Expected untagged file to be no longer tracked.")
+	} else if _, ok := err.(NoSuchFileError); !ok {
+		test.Fatalf("Expected no such file error but was '%v'.", err)
+	}
+
+	if err := store.Untag(aubergine, TagValue{"fruit", ""}); err == nil {
+		test.Fatal("Expected no such tag error.")
+	}
+}
+
+func TestValueAndValuelessQueries(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, ".tmsu", "db")
+	if err := Create(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := Open(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	five := filepath.Join(dir, "five")
+	three := filepath.Join(dir, "three")
+	unrated := filepath.Join(dir, "unrated")
+	valueless := filepath.Join(dir, "valueless")
+	for _, path := range []string{five, three, unrated, valueless} {
+		if err := ioutil.WriteFile(path, []byte(path), 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := store.Tag(five, TagValue{"rating", "5"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Tag(three, TagValue{"rating", "3"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Tag(unrated, TagValue{"other", ""}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Tag(valueless, TagValue{"rating", ""}); err != nil {
+		test.Fatal(err)
+	}
+
+	expectFiles(store, "rating", []string{five, three, valueless}, test)
+	expectFiles(store, "rating=5", []string{five}, test)
+	expectFiles(store, "rating=*", []string{five, three}, test)
+	expectFiles(store, "rating!=*", []string{unrated, valueless}, test)
+	expectFiles(store, "rating and not rating=*", []string{valueless}, test)
+}
+
+func TestTagSymbolicLink(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, ".tmsu", "db")
+	if err := Create(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := Open(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	if err := ioutil.WriteFile(target, []byte(target), 0644); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Tag(link, TagValue{"aubergine", ""}); err != nil {
+		test.Fatal(err)
+	}
+
+	expectFiles(store, "aubergine", []string{target}, test)
+
+	tagValues, err := store.Tags(link, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagValues) != 1 || tagValues[0].String() != "aubergine" {
+		test.Fatalf("Expected aubergine but were %v.", tagValues)
+	}
+}
+
+// unexported
+
+func expectFiles(store *Store, queryText string, expectedPaths []string, test *testing.T) {
+	files, err := store.Files(queryText)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := make([]string, len(files))
+	for index, file := range files {
+		paths[index] = file.Path
+	}
+
+	if len(paths) != len(expectedPaths) {
+		test.Fatalf("Expected '%v' to match %v but matched %v.", queryText, expectedPaths, paths)
+	}
+	for index := range paths {
+		if paths[index] != expectedPaths[index] {
+			test.Fatalf("Expected '%v' to match %v but matched %v.", queryText, expectedPaths, paths)
+		}
+	}
+}
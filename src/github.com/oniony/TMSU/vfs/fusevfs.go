@@ -82,19 +82,45 @@ match the query. (It is not necessary to create the directory first.)
 You can even create new queries by typing the query into the file chooser of a
 graphical program.
 
+The files matching a query are cached for a few seconds but are refreshed as
+soon as the tags are changed.
+
 Use ` + "`rmdir`" + ` to remove any query directory you no longer need. Do not use ` + "`rm -r`" + `
 as this will untag the contained files.
 
 (This file will hide once you have created a query.)`
 
+// Present file entries as symbolic links to the tagged files.
+const SymlinkMode = "symlink"
+
+// Present file entries as read-only regular files with the content of the
+// tagged files, akin to hard links.
+const HardlinkMode = "hardlink"
+
+// Validates the name of a link mode.
+func ValidateLinkMode(linkMode string) error {
+	switch linkMode {
+	case SymlinkMode, HardlinkMode:
+		return nil
+	}
+
+	return fmt.Errorf("invalid link mode '%v': must be one of %v, %v", linkMode, SymlinkMode, HardlinkMode)
+}
+
 type FuseVfs struct {
-	store     *storage.Storage
-	mountPath string
-	server    *fuse.Server
+	store      *storage.Storage
+	mountPath  string
+	server     *fuse.Server
+	queryCache *queryCache
+	linkMode   string
 }
 
-func MountVfs(store *storage.Storage, mountPath string, options []string) (*FuseVfs, error) {
-	fuseVfs := FuseVfs{nil, "", nil}
+func MountVfs(store *storage.Storage, mountPath string, options []string, linkMode string) (*FuseVfs, error) {
+	if err := ValidateLinkMode(linkMode); err != nil {
+		return nil, err
+	}
+
+	fuseVfs := FuseVfs{nil, "", nil, nil, linkMode}
 
 	pathFs := pathfs.NewPathNodeFs(&fuseVfs, nil)
 	conn := nodefs.NewFileSystemConnector(pathFs.Root(), nil)
@@ -113,6 +139,7 @@ func MountVfs(store *storage.Storage, mountPath string, options []string) (*Fuse
 	fuseVfs.store = store
 	fuseVfs.mountPath = absMountPath
 	fuseVfs.server = server
+	fuseVfs.queryCache = newQueryCache(store.DbPath)
 
 	return &fuseVfs, nil
 }
@@ -125,41 +152,47 @@ func (vfs FuseVfs) Serve() {
 	vfs.server.Serve()
 }
 
+// Waits for the virtual filesystem to become available. The filesystem must be
+// served concurrently.
+func (vfs FuseVfs) WaitMount() error {
+	return vfs.server.WaitMount()
+}
+
 func (vfs FuseVfs) SetDebug(debug bool) {
 	vfs.SetDebug(debug)
 }
 
 func (vfs FuseVfs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Access(%v, %v)", name, mode)
-	defer log.Infof(2, "END Access(%v, %v)", name, mode)
+	log.Infof("BEGIN Access(%v, %v)", name, mode)
+	defer log.Infof("END Access(%v, %v)", name, mode)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Chmod(%v, %v)", name, mode)
-	defer log.Infof(2, "BEGIN Chmod(%v, %v)", name, mode)
+	log.Infof("BEGIN Chmod(%v, %v)", name, mode)
+	defer log.Infof("BEGIN Chmod(%v, %v)", name, mode)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Chown(%v, %v, %v)", name, uid, gid)
-	defer log.Infof(2, "BEGIN Chown(%v, %v)", name, uid, gid)
+	log.Infof("BEGIN Chown(%v, %v, %v)", name, uid, gid)
+	defer log.Infof("BEGIN Chown(%v, %v)", name, uid, gid)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	log.Infof(2, "BEGIN Create(%v, %v, %v)", name, flags, mode)
-	defer log.Infof(2, "BEGIN Create(%v, %v)", name, flags, mode)
+	log.Infof("BEGIN Create(%v, %v, %v)", name, flags, mode)
+	defer log.Infof("BEGIN Create(%v, %v)", name, flags, mode)
 
 	return nil, fuse.ENOSYS
 }
 
 func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN GetAttr(%v)", name)
-	defer log.Infof(2, "END GetAttr(%v)", name)
+	log.Infof("BEGIN GetAttr(%v)", name)
+	defer log.Infof("END GetAttr(%v)", name)
 
 	switch name {
 	case databaseFilename:
@@ -185,29 +218,29 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 }
 
 func (vfs FuseVfs) GetXAttr(name string, attr string, context *fuse.Context) ([]byte, fuse.Status) {
-	log.Infof(2, "BEGIN GetXAttr(%v, %v)", name, attr)
-	defer log.Infof(2, "END GetAttr(%v, %v)", name, attr)
+	log.Infof("BEGIN GetXAttr(%v, %v)", name, attr)
+	defer log.Infof("END GetAttr(%v, %v)", name, attr)
 
 	return nil, fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Link(%v, %v)", oldName, newName)
-	defer log.Infof(2, "END Link(%v, %v)", oldName, newName)
+	log.Infof("BEGIN Link(%v, %v)", oldName, newName)
+	defer log.Infof("END Link(%v, %v)", oldName, newName)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
-	log.Infof(2, "BEGIN ListXAttr(%v)", name)
-	defer log.Infof(2, "END ListXAttr(%v)", name)
+	log.Infof("BEGIN ListXAttr(%v)", name)
+	defer log.Infof("END ListXAttr(%v)", name)
 
 	return nil, fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Mkdir(%v)", name)
-	defer log.Infof(2, "END Mkdir(%v)", name)
+	log.Infof("BEGIN Mkdir(%v)", name)
+	defer log.Infof("END Mkdir(%v)", name)
 
 	path := vfs.splitPath(name)
 
@@ -215,6 +248,8 @@ func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 		return fuse.EPERM
 	}
 
+	defer vfs.queryCache.invalidate()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -242,25 +277,25 @@ func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 }
 
 func (vfs FuseVfs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Mknod(%v)", name)
-	defer log.Infof(2, "END Mknod(%v)", name)
+	log.Infof("BEGIN Mknod(%v)", name)
+	defer log.Infof("END Mknod(%v)", name)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) OnMount(nodeFs *pathfs.PathNodeFs) {
-	log.Infof(2, "BEGIN OnMount()")
-	defer log.Infof(2, "END OnMount()")
+	log.Infof("BEGIN OnMount()")
+	defer log.Infof("END OnMount()")
 }
 
 func (vfs FuseVfs) OnUnmount() {
-	log.Infof(2, "BEGIN OnUnmount()")
-	defer log.Infof(2, "END OnUnmount()")
+	log.Infof("BEGIN OnUnmount()")
+	defer log.Infof("END OnUnmount()")
 }
 
 func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	log.Infof(2, "BEGIN Open(%v)", name)
-	defer log.Infof(2, "END Open(%v)", name)
+	log.Infof("BEGIN Open(%v)", name)
+	defer log.Infof("END Open(%v)", name)
 
 	switch name {
 	case filepath.Join(queriesDir, helpFilename):
@@ -269,14 +304,20 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 		return nodefs.NewDataFile([]byte(tagsDirHelp)), fuse.OK
 	}
 
+	path := vfs.splitPath(name)
+	switch path[0] {
+	case tagsDir, queriesDir:
+		return vfs.openFileEntry(path, flags)
+	}
+
 	return nil, fuse.ENOSYS
 }
 
 func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN OpenDir(%v)", name)
-	defer log.Infof(2, "END OpenDir(%v)", name)
+	log.Infof("BEGIN OpenDir(%v)", name)
+	defer log.Infof("END OpenDir(%v)", name)
 
-	tx, err := vfs.store.Begin()
+	tx, err := vfs.store.BeginRead()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
@@ -304,10 +345,10 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 }
 
 func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
-	log.Infof(2, "BEGIN Readlink(%v)", name)
-	defer log.Infof(2, "END Readlink(%v)", name)
+	log.Infof("BEGIN Readlink(%v)", name)
+	defer log.Infof("END Readlink(%v)", name)
 
-	tx, err := vfs.store.Begin()
+	tx, err := vfs.store.BeginRead()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
@@ -327,15 +368,17 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 }
 
 func (vfs FuseVfs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN RemoveXAttr(%v, %v)", name, attr)
-	defer log.Infof(2, "END RemoveXAttr(%v, %v)", name, attr)
+	log.Infof("BEGIN RemoveXAttr(%v, %v)", name, attr)
+	defer log.Infof("END RemoveXAttr(%v, %v)", name, attr)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Rename(%v, %v)", oldName, newName)
-	defer log.Infof(2, "END Rename(%v, %v)", oldName, newName)
+	log.Infof("BEGIN Rename(%v, %v)", oldName, newName)
+	defer log.Infof("END Rename(%v, %v)", oldName, newName)
+
+	defer vfs.queryCache.invalidate()
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -377,8 +420,10 @@ func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context)
 }
 
 func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Rmdir(%v)", name)
-	defer log.Infof(2, "END Rmdir(%v)", name)
+	log.Infof("BEGIN Rmdir(%v)", name)
+	defer log.Infof("END Rmdir(%v)", name)
+
+	defer vfs.queryCache.invalidate()
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -444,15 +489,15 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 }
 
 func (vfs FuseVfs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN SetXAttr(%v, %v)", name, attr)
-	defer log.Infof(2, "END SetXAttr(%v, %v)", name, attr)
+	log.Infof("BEGIN SetXAttr(%v, %v)", name, attr)
+	defer log.Infof("END SetXAttr(%v, %v)", name, attr)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) StatFs(name string) *fuse.StatfsOut {
-	log.Infof(2, "BEGIN StatFs(%v)", name)
-	defer log.Infof(2, "END StatFs(%v)", name)
+	log.Infof("BEGIN StatFs(%v)", name)
+	defer log.Infof("END StatFs(%v)", name)
 
 	return &fuse.StatfsOut{}
 }
@@ -462,22 +507,24 @@ func (vfs FuseVfs) String() string {
 }
 
 func (vfs FuseVfs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Symlink(%v, %v)", value, linkName)
-	defer log.Infof(2, "END Symlink(%v, %v)", value, linkName)
+	log.Infof("BEGIN Symlink(%v, %v)", value, linkName)
+	defer log.Infof("END Symlink(%v, %v)", value, linkName)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Truncate(name string, offset uint64, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Truncate(%v)", name)
-	defer log.Infof(2, "END Truncate(%v)", name)
+	log.Infof("BEGIN Truncate(%v)", name)
+	defer log.Infof("END Truncate(%v)", name)
 
 	return fuse.ENOSYS
 }
 
 func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Unlink(%v)", name)
-	defer log.Infof(2, "END Unlink(%v)", name)
+	log.Infof("BEGIN Unlink(%v)", name)
+	defer log.Infof("END Unlink(%v)", name)
+
+	defer vfs.queryCache.invalidate()
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -578,8 +625,8 @@ func (vfs FuseVfs) parseFileId(name string) entities.FileId {
 }
 
 func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN topFiles")
-	defer log.Infof(2, "END topFiles")
+	log.Infof("BEGIN topFiles")
+	defer log.Infof("END topFiles")
 
 	entries := []fuse.DirEntry{
 		{Name: databaseFilename, Mode: fuse.S_IFLNK},
@@ -589,8 +636,8 @@ func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
 }
 
 func (vfs FuseVfs) tagDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN tagDirectories")
-	defer log.Infof(2, "END tagDirectories")
+	log.Infof("BEGIN tagDirectories")
+	defer log.Infof("END tagDirectories")
 
 	tags, err := vfs.store.Tags(tx)
 	if err != nil {
@@ -617,8 +664,8 @@ func (vfs FuseVfs) tagDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status)
 }
 
 func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN queriesDirectories")
-	defer log.Infof(2, "END queriesDirectories")
+	log.Infof("BEGIN queriesDirectories")
+	defer log.Infof("END queriesDirectories")
 
 	queries, err := vfs.store.Queries(tx)
 	if err != nil {
@@ -638,18 +685,18 @@ func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Sta
 }
 
 func (vfs FuseVfs) getFilesAttr(path []string) (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN getFilesAttr")
-	defer log.Infof(2, "END getFilesAttr")
+	log.Infof("BEGIN getFilesAttr")
+	defer log.Infof("END getFilesAttr")
 
 	now := time.Now()
 	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getTagsAttr() (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN getTagsAttr")
-	defer log.Infof(2, "END getTagsAttr")
+	log.Infof("BEGIN getTagsAttr")
+	defer log.Infof("END getTagsAttr")
 
-	tx, err := vfs.store.Begin()
+	tx, err := vfs.store.BeginRead()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
@@ -665,16 +712,16 @@ func (vfs FuseVfs) getTagsAttr() (*fuse.Attr, fuse.Status) {
 }
 
 func (vfs FuseVfs) getQueryAttr() (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN getQueryAttr")
-	defer log.Infof(2, "END getQueryAttr")
+	log.Infof("BEGIN getQueryAttr")
+	defer log.Infof("END getQueryAttr")
 
 	now := time.Now()
 	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN getTaggedEntryAttr(%v)", path)
-	defer log.Infof(2, "END getTaggedEntryAttr(%v)", path)
+	log.Infof("BEGIN getTaggedEntryAttr(%v)", path)
+	defer log.Infof("END getTaggedEntryAttr(%v)", path)
 
 	if len(path) == 1 && path[0] == helpFilename {
 		now := time.Now()
@@ -700,7 +747,7 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		}
 	}
 
-	tx, err := vfs.store.Begin()
+	tx, err := vfs.store.BeginRead()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
@@ -719,8 +766,8 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 }
 
 func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
-	log.Infof(2, "BEGIN getQueryEntryAttr(%v)", path)
-	defer log.Infof(2, "END getQueryEntryAttr(%v)", path)
+	log.Infof("BEGIN getQueryEntryAttr(%v)", path)
+	defer log.Infof("END getQueryEntryAttr(%v)", path)
 
 	if len(path) == 1 && path[0] == helpFilename {
 		now := time.Now()
@@ -762,8 +809,17 @@ func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 	}
 
 	tags, err := vfs.store.TagsByNames(tx, tagNames)
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v", err)
+	}
+
+	aliases, err := vfs.store.AliasesByNames(tx, tagNames, false)
+	if err != nil {
+		log.Fatalf("could not retrieve aliases: %v", err)
+	}
+
 	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
+		if !containsTag(tags, tagName) && !aliases.ContainsCasedName(tagName, false) {
 			return nil, fuse.ENOENT
 		}
 	}
@@ -797,7 +853,7 @@ func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
 }
 
 func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.Status) {
-	tx, err := vfs.store.Begin()
+	tx, err := vfs.store.BeginRead()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
@@ -811,6 +867,11 @@ func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.St
 		return &fuse.Attr{Mode: fuse.S_IFREG}, fuse.ENOENT
 	}
 
+	if fileInfo, ok := vfs.passthroughFileInfo(file); ok {
+		modTime := fileInfo.ModTime()
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(fileInfo.Size()), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+	}
+
 	fileInfo, err := os.Stat(file.Path())
 	var size int64
 	var modTime time.Time
@@ -826,8 +887,8 @@ func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.St
 }
 
 func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN openTaggedEntryDir(%v)", path)
-	defer log.Infof(2, "END openTaggedEntryDir(%v)", path)
+	log.Infof("BEGIN openTaggedEntryDir(%v)", path)
+	defer log.Infof("END openTaggedEntryDir(%v)", path)
 
 	lastPathElement := path[len(path)-1]
 
@@ -836,7 +897,7 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	}
 
 	expression := pathToExpression(path)
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "path", false, 0, 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -844,7 +905,7 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	var valueNames []string
 	if lastPathElement[0] != '=' {
 		expression := pathToExpression(path[:len(path)-1])
-		files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+		files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "path", false, 0, 0)
 		if err != nil {
 			log.Fatalf("could not query files: %v", err)
 		}
@@ -895,11 +956,11 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 }
 
 func (vfs FuseVfs) openTaggedEntryFilesDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN openTaggedEntryFilesDir(%v)", path)
-	defer log.Infof(2, "END openTaggedEntryFilesDir(%v)", path)
+	log.Infof("BEGIN openTaggedEntryFilesDir(%v)", path)
+	defer log.Infof("END openTaggedEntryFilesDir(%v)", path)
 
 	expression := pathToExpression(path)
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "path", false, 0, 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -908,21 +969,26 @@ func (vfs FuseVfs) openTaggedEntryFilesDir(tx *storage.Tx, path []string) ([]fus
 
 	for _, file := range files {
 		linkName := vfs.getLinkName(file)
-		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: vfs.fileEntryMode(file)})
 	}
 
 	return entries, fuse.OK
 }
 
 func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
-	log.Infof(2, "BEGIN openQueryEntryDir(%v)", path)
-	defer log.Infof(2, "END openQueryEntryDir(%v)", path)
+	log.Infof("BEGIN openQueryEntryDir(%v)", path)
+	defer log.Infof("END openQueryEntryDir(%v)", path)
 
 	queryText := path[0]
 
+	if entries, ok := vfs.queryCache.get(queryText); ok {
+		return entries, fuse.OK
+	}
+
 	expression, err := query.Parse(queryText)
 	if err != nil {
-		log.Fatalf("could not parse query: %v", err)
+		log.Infof("could not parse query '%v': %v", queryText, err)
+		return nil, fuse.ENOENT
 	}
 
 	tagNames, err := query.TagNames(expression)
@@ -931,13 +997,22 @@ func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirE
 	}
 
 	tags, err := vfs.store.TagsByNames(tx, tagNames)
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v", err)
+	}
+
+	aliases, err := vfs.store.AliasesByNames(tx, tagNames, false)
+	if err != nil {
+		log.Fatalf("could not retrieve aliases: %v", err)
+	}
+
 	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
+		if !containsTag(tags, tagName) && !aliases.ContainsCasedName(tagName, false) {
 			return nil, fuse.ENOENT
 		}
 	}
 
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "path", false, 0, 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -945,22 +1020,24 @@ func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirE
 	entries := make([]fuse.DirEntry, 0, len(files))
 	for _, file := range files {
 		linkName := vfs.getLinkName(file)
-		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: vfs.fileEntryMode(file)})
 	}
 
+	vfs.queryCache.put(queryText, entries)
+
 	return entries, fuse.OK
 }
 
 func (vfs FuseVfs) readDatabaseFileLink() (string, fuse.Status) {
-	log.Infof(2, "BEGIN readDatabaseFileLink()")
-	defer log.Infof(2, "END readDatabaseFileLink()")
+	log.Infof("BEGIN readDatabaseFileLink()")
+	defer log.Infof("END readDatabaseFileLink()")
 
 	return vfs.store.DbPath, fuse.OK
 }
 
 func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, fuse.Status) {
-	log.Infof(2, "BEGIN readTaggedEntryLink(%v)", path)
-	defer log.Infof(2, "END readTaggedEntryLink(%v)", path)
+	log.Infof("BEGIN readTaggedEntryLink(%v)", path)
+	defer log.Infof("END readTaggedEntryLink(%v)", path)
 
 	name := path[len(path)-1]
 
@@ -983,6 +1060,71 @@ func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, f
 	return relPath, fuse.OK
 }
 
+func (vfs FuseVfs) openFileEntry(path []string, flags uint32) (nodefs.File, fuse.Status) {
+	log.Infof("BEGIN openFileEntry(%v)", path)
+	defer log.Infof("END openFileEntry(%v)", path)
+
+	fileId := vfs.parseFileId(path[len(path)-1])
+	if fileId == 0 {
+		return nil, fuse.ENOSYS
+	}
+
+	tx, err := vfs.store.BeginRead()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil {
+		log.Fatalf("could not retrieve file #%v: %v", fileId, err)
+	}
+	if file == nil {
+		return nil, fuse.ENOENT
+	}
+
+	if _, ok := vfs.passthroughFileInfo(file); !ok {
+		return nil, fuse.ENOSYS
+	}
+
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, fuse.EPERM
+	}
+
+	osFile, err := os.Open(file.Path())
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+
+	return nodefs.NewReadOnlyFile(nodefs.NewLoopbackFile(osFile)), fuse.OK
+}
+
+// The mode of the directory entry for a file. In hardlink mode the entries for
+// files are regular files, whilst directories remain symbolic links.
+func (vfs FuseVfs) fileEntryMode(file *entities.File) uint32 {
+	if vfs.linkMode == HardlinkMode && !file.IsDir {
+		return fuse.S_IFREG
+	}
+
+	return fuse.S_IFLNK
+}
+
+// Retrieves the details of the tagged file if its entry is to be presented as
+// a regular file. Entries fall back to symbolic links for directories and for
+// files that cannot be accessed.
+func (vfs FuseVfs) passthroughFileInfo(file *entities.File) (os.FileInfo, bool) {
+	if vfs.linkMode != HardlinkMode || file.IsDir {
+		return nil, false
+	}
+
+	fileInfo, err := os.Stat(file.Path())
+	if err != nil || !fileInfo.Mode().IsRegular() {
+		return nil, false
+	}
+
+	return fileInfo, true
+}
+
 func (vfs FuseVfs) getLinkName(file *entities.File) string {
 	extension := filepath.Ext(file.Path())
 	fileName := filepath.Base(file.Path())
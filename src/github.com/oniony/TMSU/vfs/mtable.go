@@ -55,10 +55,12 @@ func GetMountTable() ([]Mount, error) {
 
 		mountpoint := path.UnescapeOctal(parts[1])
 
+		// other go-fuse file-systems share the file-system type so only those
+		// with a database link are TMSU's
 		databaseSymlink := filepath.Join(mountpoint, ".database")
 		databasePath, err := os.Readlink(databaseSymlink)
 		if err != nil {
-			return nil, err
+			continue
 		}
 
 		mountTable = append(mountTable, Mount{databasePath, mountpoint})
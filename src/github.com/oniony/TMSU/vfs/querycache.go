@@ -0,0 +1,103 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/log"
+	"os"
+	"sync"
+	"time"
+)
+
+// unexported
+
+// The length of time for which the entries of a query directory are reused.
+const queryCacheDuration = 5 * time.Second
+
+// Caches the entries of the query directories so that the query need not be
+// re-evaluated each time the directory is read. The cache is emptied whenever
+// the tags are changed via the virtual filesystem or the database is modified
+// by another process.
+type queryCache struct {
+	sync.Mutex
+	databasePath string
+	databaseTime time.Time
+	results      map[string]queryCacheResult
+}
+
+type queryCacheResult struct {
+	entries []fuse.DirEntry
+	expires time.Time
+}
+
+func newQueryCache(databasePath string) *queryCache {
+	return &queryCache{databasePath: databasePath, results: make(map[string]queryCacheResult)}
+}
+
+// Retrieves the cached entries for the query, if they have not expired.
+func (cache *queryCache) get(queryText string) ([]fuse.DirEntry, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.checkDatabase()
+
+	result, ok := cache.results[queryText]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(result.expires) {
+		delete(cache.results, queryText)
+		return nil, false
+	}
+
+	log.Infof("using cached entries for query '%v'", queryText)
+
+	return result.entries, true
+}
+
+func (cache *queryCache) put(queryText string, entries []fuse.DirEntry) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.results[queryText] = queryCacheResult{entries, time.Now().Add(queryCacheDuration)}
+}
+
+// Empties the cache.
+func (cache *queryCache) invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.results = make(map[string]queryCacheResult)
+}
+
+// Empties the cache if the database, or its write-ahead log, has been modified
+// since the cache was last checked.
+func (cache *queryCache) checkDatabase() {
+	var modTime time.Time
+	for _, path := range []string{cache.databasePath, cache.databasePath + "-wal"} {
+		if stat, err := os.Stat(path); err == nil && stat.ModTime().After(modTime) {
+			modTime = stat.ModTime()
+		}
+	}
+
+	if !modTime.Equal(cache.databaseTime) {
+		cache.databaseTime = modTime
+		cache.results = make(map[string]queryCacheResult)
+	}
+}